@@ -4,9 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
-	"reflect"
-	"sync"
 	"time"
 )
 
@@ -35,44 +32,76 @@ type AggregateStore interface {
 	Save(ctx context.Context, aggregate Aggregate) error
 }
 
-var aggFactories = make(map[AggregateType]func(string) Aggregate)
-var aggFactoriesMu sync.RWMutex
+// CreatingAggregateStore is an AggregateStore telling apart the stored aggregates it loads from the new ones
+// it creates, command handlers enforce the CreationPolicy of commands with it.
+type CreatingAggregateStore interface {
+	AggregateStore
 
-func RegisterAggregate(aggregateType AggregateType, factory func(string) Aggregate) {
-	ftype := reflect.TypeOf(factory)
-	if ftype.Kind() != reflect.Func {
-		panic("[evol] RegisterAggregate parameter not a func")
+	// LoadOrCreate loads an aggregate like Load, created is true when it was not stored
+	LoadOrCreate(ctx context.Context, aggregateType AggregateType, aggregateIdentity string) (agg Aggregate, created bool, err error)
+}
+
+// LoadOrCreate loads an aggregate from store, created is true when it was not stored. Stores that are not
+// a CreatingAggregateStore tell it with the version of a VersionedAggregate, 0 for a new one.
+func LoadOrCreate(ctx context.Context, store AggregateStore, aggregateType AggregateType, aggregateIdentity string) (Aggregate, bool, error) {
+	if s, ok := store.(CreatingAggregateStore); ok {
+		return s.LoadOrCreate(ctx, aggregateType, aggregateIdentity)
+	}
+
+	agg, err := store.Load(ctx, aggregateType, aggregateIdentity)
+	if err != nil {
+		return nil, false, err
 	}
-	if ftype.NumIn() != 1 {
-		panic("[evol] RegisterAggregate factory func parameter not match")
+	versioned, ok := agg.(VersionedAggregate)
+	if !ok {
+		return nil, false, fmt.Errorf("[evol] LoadOrCreate: store %T can not tell new %s aggregates apart", store, aggregateType)
 	}
+	return agg, versioned.AggregateVersion() == 0, nil
+}
 
-	aggFactoriesMu.Lock()
-	defer aggFactoriesMu.Unlock()
+// TemporalAggregateStore rebuilds aggregates as they were in the past, for audits and support.
+// The aggregates are read only, saving their events fails with ErrVersionConflict.
+type TemporalAggregateStore interface {
+	AggregateStore
 
-	if _, ok := aggFactories[aggregateType]; ok {
-		panic(fmt.Sprintf("[evol] RegisterAggregate register duplicated aggregate: %s", aggregateType))
-	}
+	// LoadAtVersion rebuilds an aggregate from the events of its stream up to version included
+	LoadAtVersion(ctx context.Context, aggregateType AggregateType, aggregateIdentity string, version int) (Aggregate, error)
 
-	aggFactories[aggregateType] = factory
+	// LoadAt rebuilds an aggregate from the events of its stream up to the time t included,
+	// ErrAggregateNotFound when it had no event yet
+	LoadAt(ctx context.Context, aggregateType AggregateType, aggregateIdentity string, t time.Time) (Aggregate, error)
+}
 
+// ErrVersionNotFound is returned when loading an aggregate at a version its stream has not reached.
+var ErrVersionNotFound = errors.New("[evol] aggregate version not found")
+
+// VersionedAggregate knows the version of its stream in the store, that is the number of stored events.
+// BaseAggregate implements it, stores use it to detect concurrent writes.
+type VersionedAggregate interface {
+	AggregateVersion() int
+	SetAggregateVersion(int)
 }
 
-func CreateAggregate(aggType AggregateType, identity string) (Aggregate, error) {
-	aggFactoriesMu.RLock()
-	defer aggFactoriesMu.RUnlock()
+// EventCommitter is an aggregate that drops its DomainEvents once a store saved them,
+// so they are neither saved nor published twice. BaseAggregate implements it.
+type EventCommitter interface {
+	CommitEvents()
+}
 
-	if factory, ok := aggFactories[aggType]; ok {
-		return factory(identity), nil
-	}
+func RegisterAggregate(aggregateType AggregateType, factory func(string) Aggregate) {
+	DefaultRegistry.RegisterAggregate(aggregateType, factory)
+}
 
-	return nil, errors.New("[evol] CreateAggregate aggregate not registered")
+func CreateAggregate(aggType AggregateType, identity string) (Aggregate, error) {
+	return DefaultRegistry.CreateAggregate(aggType, identity)
 }
 
 type BaseAggregate struct {
 	identity string
 	aType    AggregateType
 	events   []Event
+	version  int
+	tenant   string
 }
 
 func (b *BaseAggregate) EntityIdentity() string {
@@ -89,20 +118,52 @@ func (b *BaseAggregate) PublishEvent(topic Topic, data interface{}, timestamp ti
 	options = append(options, ForAggregate(
 		b.AggregateType(),
 		b.EntityIdentity(),
-	))
+	), WithVersion(b.version+len(b.events)+1))
 	e := NewEvent(topic, data, timestamp, options...)
 	b.events = append(b.events, e)
 
 	if err := esHandler.HandleSourcingEvent(context.Background(), e); err != nil {
-		log.Println(err)
+		GetLogger().Error("could not apply event", append(EventFields(e), LogKeyError, err)...)
 	}
 	return e
 }
 
+// PublishTombstone deletes the aggregate, its stream ends with a tombstone once stored
+// and the store then fails to load it with an AggregateDeletedError.
+func (b *BaseAggregate) PublishTombstone(timestamp time.Time, options ...EventOption) Event {
+	e := NewTombstone(b.AggregateType(), b.EntityIdentity(), b.version+len(b.events)+1, timestamp, options...)
+	b.events = append(b.events, e)
+	return e
+}
+
 func (b *BaseAggregate) DomainEvents() []Event {
 	return b.events
 }
 
+// AggregateVersion returns the version of the stored aggregate, not counting unsaved DomainEvents.
+func (b *BaseAggregate) AggregateVersion() int {
+	return b.version
+}
+
+func (b *BaseAggregate) SetAggregateVersion(version int) {
+	b.version = version
+}
+
+// EntityTenantID returns the tenant of the aggregate, empty for the default tenant.
+func (b *BaseAggregate) EntityTenantID() string {
+	return b.tenant
+}
+
+func (b *BaseAggregate) SetEntityTenantID(tenant string) {
+	b.tenant = tenant
+}
+
+// CommitEvents adds the DomainEvents to the aggregate version and clears them.
+func (b *BaseAggregate) CommitEvents() {
+	b.version += len(b.events)
+	b.events = nil
+}
+
 func NewBaseAggregate(aggregateType AggregateType, identity string) *BaseAggregate {
 	return &BaseAggregate{
 		identity: identity,
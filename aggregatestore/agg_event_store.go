@@ -5,37 +5,112 @@ import (
 	"errors"
 	"evol"
 	"fmt"
+	"time"
 )
 
 //AggregateEventStore stores aggregate's all codec instead of the latest status for codec sourcing
+//Aggregates belong to the tenant in context, loading or saving the events of another tenant fails with evol.ErrTenantMismatch,
+//so does loading the events without tenant from another tenant than the default one, see WithSharedDefaultTenant.
 type AggregateEventStore struct {
 	repo evol.EventRepo
+	options
 }
 
-func NewAggregateEventStore(repo evol.EventRepo) *AggregateEventStore {
-	return &AggregateEventStore{repo: repo}
+func NewAggregateEventStore(repo evol.EventRepo, opts ...Option) *AggregateEventStore {
+	return &AggregateEventStore{repo: repo, options: newOptions(opts)}
 }
 
 func (s *AggregateEventStore) Load(ctx context.Context, aggregateType evol.AggregateType, aggregateIdentity string) (evol.Aggregate, error) {
-	//TODO: set tag as a snapshot of aggregate, thus the number of events needs tobe apple will be reduced
-	agg, err := evol.CreateAggregate(aggregateType, aggregateIdentity)
+	agg, _, err := s.LoadOrCreate(ctx, aggregateType, aggregateIdentity)
+	return agg, err
+}
+
+// LoadOrCreate implements evol.CreatingAggregateStore, an aggregate without events is new.
+func (s *AggregateEventStore) LoadOrCreate(ctx context.Context, aggregateType evol.AggregateType, aggregateIdentity string) (evol.Aggregate, bool, error) {
+	agg, events, err := s.load(ctx, aggregateType, aggregateIdentity, func(events []evol.Event) ([]evol.Event, error) {
+		return events, nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	s.log().Debug("loaded aggregate", append(aggregateFields(aggregateType, aggregateIdentity), "events", len(events))...)
+	return agg, len(events) == 0, nil
+}
+
+// LoadAtVersion implements evol.TemporalAggregateStore, evol.ErrVersionNotFound is returned
+// when the stream has not reached version.
+func (s *AggregateEventStore) LoadAtVersion(ctx context.Context, aggregateType evol.AggregateType, aggregateIdentity string, version int) (evol.Aggregate, error) {
+	if version < 1 {
+		return nil, fmt.Errorf("[evol] %s %s version %d: %w", aggregateType, aggregateIdentity, version, evol.ErrVersionNotFound)
+	}
+
+	agg, _, err := s.load(ctx, aggregateType, aggregateIdentity, func(events []evol.Event) ([]evol.Event, error) {
+		if len(events) == 0 {
+			return nil, evol.ErrAggregateNotFound
+		}
+		for i, e := range events {
+			if eventVersion(i, e) == version {
+				return events[:i+1], nil
+			}
+		}
+		return nil, fmt.Errorf("[evol] %s %s version %d: %w", aggregateType, aggregateIdentity, version, evol.ErrVersionNotFound)
+	})
 	if err != nil {
 		return nil, err
 	}
+	s.log().Debug("loaded aggregate at version", append(aggregateFields(aggregateType, aggregateIdentity), "version", version)...)
+	return agg, nil
+}
+
+// LoadAt implements evol.TemporalAggregateStore, the events of a stream being in time order.
+func (s *AggregateEventStore) LoadAt(ctx context.Context, aggregateType evol.AggregateType, aggregateIdentity string, t time.Time) (evol.Aggregate, error) {
+	agg, events, err := s.load(ctx, aggregateType, aggregateIdentity, func(events []evol.Event) ([]evol.Event, error) {
+		n := 0
+		for n < len(events) && !events[n].Timestamp().After(t) {
+			n++
+		}
+		if n == 0 {
+			return nil, evol.ErrAggregateNotFound
+		}
+		return events[:n], nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.log().Debug("loaded aggregate at time", append(aggregateFields(aggregateType, aggregateIdentity), "at", t, "events", len(events))...)
+	return agg, nil
+}
+
+// load creates an aggregate and applies the events of its stream selected by upTo, a prefix of them
+func (s *AggregateEventStore) load(ctx context.Context, aggregateType evol.AggregateType, aggregateIdentity string, upTo func([]evol.Event) ([]evol.Event, error)) (evol.Aggregate, []evol.Event, error) {
+	//TODO: set tag as a snapshot of aggregate, thus the number of events needs tobe apple will be reduced
+	agg, err := s.registry.CreateAggregate(aggregateType, aggregateIdentity)
+	if err != nil {
+		return nil, nil, err
+	}
 	events, err := s.repo.Load(ctx, agg.EntityIdentity())
 	if err != nil && !errors.Is(err, evol.ErrAggregateNotFound) {
-		return nil, err
+		return nil, nil, err
 	}
 
 	esAgg, ok := agg.(evol.EventSourcingHandler)
 	if !ok {
-		return nil, fmt.Errorf("[evol] AggregateEventStore Load error: aggregate %s is not a codec sourcing aggregate", agg)
+		return nil, nil, fmt.Errorf("[evol] AggregateEventStore Load error: aggregate %s is not a codec sourcing aggregate", agg)
 	}
 
+	if err := s.checkTenant(ctx, events); err != nil {
+		return nil, nil, err
+	}
+	if events, err = upTo(events); err != nil {
+		return nil, nil, err
+	}
+	if err := evol.DeletedError(events); err != nil {
+		return nil, nil, err
+	}
 	if err := s.applyEvents(ctx, esAgg, events); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return agg, nil
+	return agg, events, nil
 }
 
 func (s *AggregateEventStore) Save(ctx context.Context, agg evol.Aggregate) error {
@@ -44,15 +119,90 @@ func (s *AggregateEventStore) Save(ctx context.Context, agg evol.Aggregate) erro
 		return fmt.Errorf("[evol] AggregateEventStore Save error: aggregate %s is not a codec sourcing aggregate", agg)
 	}
 	events := esAgg.DomainEvents()
+	if len(events) == 0 {
+		return nil
+	}
+	// events published without the metadata of the command still belong to its tenant
+	if tenant := evol.TenantID(ctx); tenant != "" {
+		for _, e := range events {
+			if evol.EventTenantID(e) == "" {
+				evol.WithMetadata(evol.Metadata{evol.TenantIDKey: tenant})(e)
+			}
+		}
+	}
+	if err := s.checkTenant(ctx, events); err != nil {
+		return err
+	}
 
 	if err := s.repo.Save(ctx, events); err != nil {
+		if errors.Is(err, evol.ErrVersionConflict) {
+			s.log().Warn("version conflict saving aggregate", append(aggregateFields(agg.AggregateType(), agg.EntityIdentity()), "version", events[0].Version())...)
+		}
+		return err
+	}
+	s.log().Debug("saved aggregate", append(aggregateFields(agg.AggregateType(), agg.EntityIdentity()), "events", len(events))...)
+
+	if committer, ok := agg.(evol.EventCommitter); ok {
+		committer.CommitEvents()
+	}
+	return nil
+}
+
+// Delete soft deletes an aggregate by appending a tombstone to its stream, loading it then fails with an
+// evol.AggregateDeletedError. Only an outbox relay publishes the tombstone, aggregates deleted by a command
+// call PublishTombstone instead.
+func (s *AggregateEventStore) Delete(ctx context.Context, aggregateType evol.AggregateType, aggregateIdentity string) error {
+	events, err := s.repo.Load(ctx, aggregateIdentity)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return fmt.Errorf("[evol] %s %s: %w", aggregateType, aggregateIdentity, evol.ErrAggregateNotFound)
+	}
+	if err := s.checkTenant(ctx, events); err != nil {
+		return err
+	}
+	if err := evol.DeletedError(events); err != nil {
+		return err
+	}
+
+	version := eventVersion(len(events)-1, events[len(events)-1])
+	tombstone := evol.NewTombstone(aggregateType, aggregateIdentity, version+1, time.Now(), evol.WithMetadata(evol.MetadataFromContext(ctx)))
+	if err := s.repo.Save(ctx, []evol.Event{tombstone}); err != nil {
 		return err
 	}
+	s.log().Info("deleted aggregate", append(aggregateFields(aggregateType, aggregateIdentity), "version", version+1)...)
+	return nil
+}
+
+// Purge hard deletes an aggregate, erasing its stream from a repo implementing evol.StreamDeleter.
+// Nothing is published, the identity can be used again.
+func (s *AggregateEventStore) Purge(ctx context.Context, aggregateType evol.AggregateType, aggregateIdentity string) error {
+	deleter, ok := evol.As[evol.StreamDeleter](s.repo)
+	if !ok {
+		return fmt.Errorf("[evol] AggregateEventStore Purge error: repo %T can not delete streams", s.repo)
+	}
+
+	events, err := s.repo.Load(ctx, aggregateIdentity)
+	if errors.Is(err, evol.ErrAggregateNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := s.checkTenant(ctx, events); err != nil {
+		return err
+	}
+
+	if err := deleter.DeleteStream(ctx, aggregateIdentity); err != nil {
+		return err
+	}
+	s.log().Info("purged aggregate", append(aggregateFields(aggregateType, aggregateIdentity), "events", len(events))...)
 	return nil
 }
 
 func (s *AggregateEventStore) applyEvents(ctx context.Context, agg evol.EventSourcingHandler, events []evol.Event) error {
-	for _, event := range events {
+	versioned, _ := agg.(evol.VersionedAggregate)
+	for i, event := range events {
 		if event.AggregateType() != agg.AggregateType() {
 			return fmt.Errorf("[evol] aggeventrepo applyEvents aggregateType not match%s", event)
 		}
@@ -61,6 +211,17 @@ func (s *AggregateEventStore) applyEvents(ctx context.Context, agg evol.EventSou
 			return fmt.Errorf("[evol] aggeventrepo applyEvents apply codec error %s: %w", event, err)
 		}
 
+		if versioned != nil {
+			versioned.SetAggregateVersion(eventVersion(i, event))
+		}
 	}
 	return nil
 }
+
+// eventVersion returns the version of the event at index i of a stream
+func eventVersion(i int, e evol.Event) int {
+	if v := e.Version(); v > 0 {
+		return v
+	}
+	return i + 1
+}
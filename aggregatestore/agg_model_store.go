@@ -7,35 +7,80 @@ import (
 )
 
 //AggregateModelStore stores aggregate's latest status, usually used by the command bus(dispatcher)
+//When the repository is an evol.OutboxRepository, the domain events are saved together with the status.
+//Models implementing evol.TenantEntity belong to the tenant in context when saved, loading the model of another
+//tenant fails with evol.ErrTenantMismatch, so does loading a model without tenant from another tenant than
+//the default one, see WithSharedDefaultTenant.
 type AggregateModelStore struct {
 	repo evol.RWRepository
+	options
+}
+
+func NewAggregateModelStore(repo evol.RWRepository, opts ...Option) *AggregateModelStore {
+	return &AggregateModelStore{repo: repo, options: newOptions(opts)}
 }
 
 func (s *AggregateModelStore) Load(ctx context.Context, aggregateType evol.AggregateType, aggregateIdentity string) (evol.Aggregate, error) {
+	aggregate, _, err := s.LoadOrCreate(ctx, aggregateType, aggregateIdentity)
+	return aggregate, err
+}
+
+// LoadOrCreate implements evol.CreatingAggregateStore, an aggregate the repository does not find is new.
+func (s *AggregateModelStore) LoadOrCreate(ctx context.Context, aggregateType evol.AggregateType, aggregateIdentity string) (evol.Aggregate, bool, error) {
 	entity, err := s.repo.Find(ctx, aggregateIdentity)
 	if errors.Is(err, evol.ErrAggregateNotFound) {
 		// Aggregate not found, create s new one
-		aggregate, err2 := evol.CreateAggregate(aggregateType, aggregateIdentity)
+		aggregate, err2 := s.registry.CreateAggregate(aggregateType, aggregateIdentity)
 		if err2 != nil {
-			return nil, err2
+			return nil, false, err2
 		}
-		return aggregate, nil
+		return aggregate, true, nil
 	} else if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	//convert entity to Aggregate
-	if aggregate, ok := entity.(evol.Aggregate); ok {
-		return aggregate, nil
+	aggregate, ok := entity.(evol.Aggregate)
+	if !ok {
+		return nil, false, errors.New("[evol] Load Aggregate: invalid aggregate")
 	}
-	return nil, errors.New("[evol] Load Aggregate: invalid aggregate")
+	if err := s.checkOwner(ctx, aggregateType, aggregateIdentity, tenantOf(aggregate)); err != nil {
+		return nil, false, err
+	}
+	return aggregate, false, nil
 
 }
 
 func (s *AggregateModelStore) Save(ctx context.Context, aggregate evol.Aggregate) error {
-	if err := s.repo.Save(ctx, aggregate); err != nil {
+	if t, ok := aggregate.(evol.TenantEntity); ok {
+		if t.EntityTenantID() == "" {
+			t.SetEntityTenantID(evol.TenantID(ctx))
+		}
+		if err := s.checkOwner(ctx, aggregate.AggregateType(), aggregate.EntityIdentity(), t.EntityTenantID()); err != nil {
+			return err
+		}
+	}
+
+	if outbox, ok := s.repo.(evol.OutboxRepository); ok {
+		if err := outbox.SaveWithEvents(ctx, aggregate, aggregate.DomainEvents()); err != nil {
+			return err
+		}
+	} else if err := s.repo.Save(ctx, aggregate); err != nil {
 		return err
 	}
 
+	s.log().Debug("saved aggregate", append(aggregateFields(aggregate.AggregateType(), aggregate.EntityIdentity()), "events", len(aggregate.DomainEvents()))...)
+
+	if committer, ok := aggregate.(evol.EventCommitter); ok {
+		committer.CommitEvents()
+	}
 	return nil
 }
+
+// tenantOf returns the tenant of a model, empty for models that are not an evol.TenantEntity
+func tenantOf(aggregate evol.Aggregate) string {
+	if t, ok := aggregate.(evol.TenantEntity); ok {
+		return t.EntityTenantID()
+	}
+	return ""
+}
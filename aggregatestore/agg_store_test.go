@@ -0,0 +1,105 @@
+package aggregatestore
+
+import (
+	"context"
+	"errors"
+	"evol"
+	"evol/repo/memory"
+	"testing"
+	"time"
+)
+
+// counter counts the events applied to it
+type counter struct {
+	*evol.BaseAggregate
+	n int
+}
+
+func (c *counter) HandleCommand(ctx context.Context, cmd evol.Command) error { return nil }
+
+func (c *counter) HandleSourcingEvent(ctx context.Context, e evol.Event) error {
+	c.n++
+	return nil
+}
+
+func newRegistry() *evol.Registry {
+	r := evol.NewRegistry()
+	r.RegisterAggregate("Counter", func(id string) evol.Aggregate {
+		return &counter{BaseAggregate: evol.NewBaseAggregate("Counter", id)}
+	})
+	return r
+}
+
+// sharedRepo does not keep the streams of each tenant apart, as repos written before tenants
+type sharedRepo struct {
+	events []evol.Event
+}
+
+func (r *sharedRepo) Save(ctx context.Context, events []evol.Event) error {
+	r.events = append(r.events, events...)
+	return nil
+}
+
+func (r *sharedRepo) Load(ctx context.Context, id string) ([]evol.Event, error) {
+	return r.events, nil
+}
+
+func TestEventStoreRejectsDefaultTenantEvents(t *testing.T) {
+	repo := &sharedRepo{events: []evol.Event{
+		evol.NewEvent("Counted", nil, time.Now(), evol.ForAggregate("Counter", "c1"), evol.WithVersion(1)),
+	}}
+	acme := evol.ContextWithTenant(context.Background(), "acme")
+
+	s := NewAggregateEventStore(repo, WithRegistry(newRegistry()), WithLogger(evol.NopLogger()))
+	if _, err := s.Load(context.Background(), "Counter", "c1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Load(acme, "Counter", "c1"); !errors.Is(err, evol.ErrTenantMismatch) {
+		t.Errorf("loaded an aggregate of the default tenant from acme: %v", err)
+	}
+
+	shared := NewAggregateEventStore(repo, WithRegistry(newRegistry()), WithLogger(evol.NopLogger()), WithSharedDefaultTenant())
+	if agg, err := shared.Load(acme, "Counter", "c1"); err != nil || agg.(*counter).n != 1 {
+		t.Errorf("shared aggregate %v: %v", agg, err)
+	}
+}
+
+func TestModelStoreChecksTenant(t *testing.T) {
+	ctx := context.Background()
+	acme := evol.ContextWithTenant(ctx, "acme")
+	repo := memory.NewModelRepo()
+	s := NewAggregateModelStore(repo, WithRegistry(newRegistry()), WithLogger(evol.NopLogger()))
+
+	agg, err := s.Load(acme, "Counter", "c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(acme, agg); err != nil {
+		t.Fatal(err)
+	}
+	if tenant := agg.(evol.TenantEntity).EntityTenantID(); tenant != "acme" {
+		t.Errorf("saved model of tenant %q", tenant)
+	}
+	if err := s.Save(ctx, agg); !errors.Is(err, evol.ErrTenantMismatch) {
+		t.Errorf("saved the model of acme for the default tenant: %v", err)
+	}
+
+	// a model stored without tenant, by a repo that does not keep tenants apart
+	if err := repo.Save(acme, &counter{BaseAggregate: evol.NewBaseAggregate("Counter", "c2")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Load(acme, "Counter", "c2"); !errors.Is(err, evol.ErrTenantMismatch) {
+		t.Errorf("loaded a model without tenant from acme: %v", err)
+	}
+	shared := NewAggregateModelStore(repo, WithRegistry(newRegistry()), WithLogger(evol.NopLogger()), WithSharedDefaultTenant())
+	if _, err := shared.Load(acme, "Counter", "c2"); err != nil {
+		t.Errorf("shared model: %v", err)
+	}
+}
+
+func TestDeleteEmptyStream(t *testing.T) {
+	s := NewAggregateEventStore(&sharedRepo{}, WithRegistry(newRegistry()), WithLogger(evol.NopLogger()))
+	if err := s.Delete(context.Background(), "Counter", "c1"); !errors.Is(err, evol.ErrAggregateNotFound) {
+		t.Errorf("deleted an empty stream: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package aggregatestore
+
+import (
+	"context"
+	"evol"
+	"fmt"
+)
+
+// Option is an option setter used to configure the aggregate stores.
+type Option func(*options)
+
+type options struct {
+	logger   evol.Logger
+	registry *evol.Registry
+	// sharedDefaultTenant lets every tenant load the aggregates without tenant
+	sharedDefaultTenant bool
+}
+
+func newOptions(opts []Option) options {
+	o := options{registry: evol.DefaultRegistry}
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		opt(&o)
+	}
+	return o
+}
+
+func (o options) log() evol.Logger {
+	return evol.LoggerOr(o.logger)
+}
+
+// WithLogger sets the logger of the store, evol.GetLogger() by default.
+func WithLogger(l evol.Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+// WithRegistry creates aggregates with the factories of r, evol.DefaultRegistry by default.
+func WithRegistry(r *evol.Registry) Option {
+	return func(o *options) {
+		o.registry = r
+	}
+}
+
+// WithSharedDefaultTenant lets every tenant load the aggregates stored without tenant, such as the ones
+// stored before an application had tenants. By default only the default tenant loads them.
+func WithSharedDefaultTenant() Option {
+	return func(o *options) {
+		o.sharedDefaultTenant = true
+	}
+}
+
+// checkTenant rejects the events of another tenant than the one in ctx
+func (o options) checkTenant(ctx context.Context, events []evol.Event) error {
+	for _, e := range events {
+		if err := o.checkOwner(ctx, e.AggregateType(), e.AggregateIdentity(), evol.EventTenantID(e)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkOwner rejects an aggregate of another tenant than the one in ctx,
+// an aggregate without tenant belongs to the default tenant unless it is shared
+func (o options) checkOwner(ctx context.Context, aggregateType evol.AggregateType, aggregateIdentity string, owner string) error {
+	tenant := evol.TenantID(ctx)
+	if owner == tenant || owner == "" && o.sharedDefaultTenant {
+		return nil
+	}
+	return fmt.Errorf("[evol] %s %s belongs to tenant %q, not %q: %w", aggregateType, aggregateIdentity, owner, tenant, evol.ErrTenantMismatch)
+}
+
+func aggregateFields(aggregateType evol.AggregateType, aggregateIdentity string) []interface{} {
+	return []interface{}{evol.LogKeyAggregateType, aggregateType, evol.LogKeyAggregateID, aggregateIdentity}
+}
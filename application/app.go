@@ -2,53 +2,414 @@ package application
 
 import (
 	"context"
+	"errors"
 	"evol"
 	"evol/command"
-
-	"evol/saga"
+	"evol/outbox"
+	"evol/policy"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
+// Option configures Run.
+type Option func(*options)
+
+type options struct {
+	outbox      evol.Outbox
+	checkpoints evol.CheckpointStore
+	logger      evol.Logger
+}
+
+// WithOutbox stores events without publishing them from the command handlers,
+// a relay started by Run publishes the events of the outbox to the event bus instead.
+// The AggregateStore must save events into the outbox, like an AggregateEventStore
+// over a memory repo, or an AggregateModelStore over an evol.OutboxRepository.
+func WithOutbox(o evol.Outbox, checkpoints evol.CheckpointStore) Option {
+	return func(opts *options) {
+		opts.outbox = o
+		opts.checkpoints = checkpoints
+	}
+}
+
+// WithLogger sets the logger of the App, its command handlers and outbox relay, evol.GetLogger() by default.
+// Sagas and policies log with their own logger, see saga.SagaManager.Logger and policy.WithLogger.
+func WithLogger(l evol.Logger) Option {
+	return func(opts *options) {
+		opts.logger = l
+	}
+}
+
+// App wires the aggregates, commands, event handlers, sagas and policies of a registry to the buses and stores.
+type App struct {
+	registry *evol.Registry
+
+	mu      sync.Mutex
+	running *running
+}
+
+// running is what Start set up and Stop tears down
+type running struct {
+	// cancel stops the background work, unregister the event handlers
+	cancel     context.CancelFunc
+	unregister context.CancelFunc
+	cmdBus     evol.CommandBus
+	eventBus   evol.EventBus
+	relay      *outbox.Relay
+	wg         sync.WaitGroup
+	logger     evol.Logger
+}
+
+// Default is the App of the package level registrations, used by Run.
+var Default = NewApp(evol.DefaultRegistry)
+
+// NewApp creates an App over the registrations of r.
+func NewApp(r *evol.Registry) *App {
+	return &App{registry: r}
+}
+
+// Registry returns the registry of the App.
+func (a *App) Registry() *evol.Registry {
+	return a.registry
+}
+
+// SendCommand dispatches cmd to the command bus of the running App.
+func (a *App) SendCommand(ctx context.Context, cmd evol.Command) error {
+	return a.registry.SendCommand(ctx, cmd)
+}
+
+// Run starts the Default App.
 func Run(ctx context.Context,
 	cmdBus evol.CommandBus,
 	eventBus evol.EventBus,
 	AggregateStore evol.AggregateStore,
-	SagaStore evol.SagaRepo) error {
-	//0. init dependency
-	evol.CmdBus = cmdBus
+	SagaStore evol.SagaRepo,
+	opts ...Option) error {
+	return Default.Start(ctx, cmdBus, eventBus, AggregateStore, SagaStore, opts...)
+}
 
-	//1. register aggregate command handler
-	//程序启动时才指定cmdbus， 需要将所有的aggregateType保存起来，程序bootstrap的时候，注册aggregate cmd handler
-	err := RegisterCmdHandler(cmdBus, AggregateStore, eventBus)
+// Stop stops the Default App.
+func Stop(ctx context.Context) error {
+	return Default.Stop(ctx)
+}
+
+// Start registers the command handlers, event handlers, sagas and policies of the App with the buses,
+// and starts the outbox relay and the saga deadlines until Stop or until ctx is done.
+// The AggregateStore should create aggregates with the registry of the App, see aggregatestore.WithRegistry.
+//
+// The configuration is checked before anything is registered. When a bus fails a registration,
+// the event handlers already registered are unregistered by cancelling the context they were
+// registered with, which buses like the NATS one ignore until they are closed. Command buses
+// can not unregister handlers, close them.
+func (a *App) Start(ctx context.Context,
+	cmdBus evol.CommandBus,
+	eventBus evol.EventBus,
+	AggregateStore evol.AggregateStore,
+	SagaStore evol.SagaRepo,
+	opts ...Option) error {
+	o := &options{}
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		opt(o)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.running != nil {
+		return errors.New("[evol] application already started")
+	}
+
+	//0. init dependency, and check them all before registering anything
+	logger := evol.LoggerOr(o.logger)
+	if cmdBus == nil || eventBus == nil {
+		return errors.New("[evol] application: missing command bus or event bus")
+	}
+	if len(a.registry.SagaNames()) > 0 && SagaStore == nil {
+		return errors.New("[evol] application: missing saga store")
+	}
+	eventHandlers := a.registry.NamedEventHandlers()
+	if err := uniqueNames(eventHandlers); err != nil {
+		return err
+	}
+
+	handlerOpts := []command.Option{command.WithLogger(logger)}
+	if o.outbox != nil {
+		handlerOpts = append(handlerOpts, command.WithOutbox())
+	}
+	cmdHandlers, err := a.cmdHandlers(AggregateStore, eventBus, handlerOpts...)
 	if err != nil {
 		return err
 	}
-	//2. Register Event Handler
-	//2.1 aggregatestore codec handlers
-	for topic, handlers := range evol.EventHandlers {
-		for _, handler := range handlers {
-			eventBus.RegisterHandler(ctx, topic, handler)
+
+	var relay *outbox.Relay
+	if o.outbox != nil {
+		relay, err = outbox.NewRelay("outbox", o.outbox, eventBus, o.checkpoints, outbox.WithLogger(logger))
+		if err != nil {
+			return err
 		}
 	}
-	//2.2 saga
-	err = saga.PrepareSagas(ctx, eventBus, cmdBus, SagaStore)
-	if err != nil {
+
+	// handlers stay registered until Stop drained the buses, background work stops first
+	regCtx, unregister := context.WithCancel(ctx)
+	runCtx, cancel := context.WithCancel(regCtx)
+	r := &running{cancel: cancel, unregister: unregister, cmdBus: cmdBus, eventBus: eventBus, relay: relay, logger: logger}
+
+	if err := a.register(regCtx, runCtx, r, cmdHandlers, eventHandlers, SagaStore); err != nil {
+		cancel()
+		unregister()
+		for _, name := range a.registry.SagaNames() {
+			a.registry.Saga(name).Wait()
+		}
 		return err
 	}
 
+	//3. outbox relay publishes stored events until stopped
+	if relay != nil {
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			if err := relay.Run(runCtx); err != nil {
+				logger.Error("outbox relay stopped", evol.LogKeyError, err)
+			}
+		}()
+	}
+
+	a.registry.SetCommandBus(cmdBus)
+	a.running = r
+	logger.Info("application started", "commands", len(a.registry.Commands()))
+
+	return nil
+}
+
+// register registers the handlers of the App with the buses, the event handlers with regCtx,
+// and binds the sagas until runCtx is done
+func (a *App) register(regCtx, runCtx context.Context, r *running, cmdHandlers map[evol.CommandName]evol.CommandHandler, eventHandlers map[evol.Topic][]evol.NamedEventHandler, sagaStore evol.SagaRepo) error {
+	//1. register aggregate command handler
+	for name, h := range cmdHandlers {
+		if err := r.cmdBus.RegisterCmdHandler(name, h); err != nil {
+			return err
+		}
+	}
+
+	//2. Register Event Handler
+	//2.1 aggregatestore codec handlers, named so durable subscriptions do not depend on the registration order
+	for topic, handlers := range eventHandlers {
+		for _, h := range handlers {
+			if err := r.eventBus.RegisterHandler(regCtx, topic, h.Handler, evol.WithHandlerName(h.Name)); err != nil {
+				return fmt.Errorf("[evol] could not register %s on %s: %w", h.Name, topic, err)
+			}
+		}
+	}
+	//2.2 saga, their deadlines stop with the background work
+	for _, name := range a.registry.SagaNames() {
+		s := a.registry.Saga(name)
+		s.Bind(runCtx, r.cmdBus, sagaStore)
+		for _, topic := range s.Topics() {
+			if err := r.eventBus.RegisterHandler(regCtx, topic, s, evol.WithHandlerName(name)); err != nil {
+				return fmt.Errorf("[evol] could not register saga %s on %s: %w", name, topic, err)
+			}
+		}
+	}
+	//2.3 policies
+	return policy.Prepare(regCtx, a.registry, r.eventBus, r.cmdBus)
+}
+
+// uniqueNames checks that no two event handlers of a topic have the same name
+func uniqueNames(handlers map[evol.Topic][]evol.NamedEventHandler) error {
+	for topic, hs := range handlers {
+		seen := make(map[string]bool, len(hs))
+		for _, h := range hs {
+			if seen[h.Name] {
+				return fmt.Errorf("[evol] application: two event handlers named %s on %s, register them with RegisterNamedEventHandler", h.Name, topic)
+			}
+			seen[h.Name] = true
+		}
+	}
 	return nil
 }
 
-func RegisterCmdHandler(cmdBus evol.CommandBus, store evol.AggregateStore, evtBus evol.EventBus) error {
-	cmds := evol.GetAllCmds()
-	for name, cmd := range cmds {
-		cmdHandler, err := command.NewAggCmdHandler(cmd.TargetAggregateType(), store, evtBus)
+// Stop shuts the App down in order, giving up on what is left when ctx is done:
+//  1. SendCommand stops accepting commands
+//  2. the outbox relay and the saga deadlines stop
+//  3. the commands being handled, the events they publish, the commands sagas and policies send for them
+//     and the events left in the outbox are handled, until nothing is left
+//  4. the event handlers are unregistered, the command bus then the event bus are closed
+//
+// Buses without a Pending method are not waited for, the local buses have one. Decorated buses are found
+// with evol.As.
+// The returned StopError lists what went wrong, the work left undelivered included.
+func (a *App) Stop(ctx context.Context) error {
+	a.mu.Lock()
+	r := a.running
+	a.running = nil
+	a.mu.Unlock()
+
+	if r == nil {
+		return errors.New("[evol] application not started")
+	}
+	r.logger.Info("application stopping")
+
+	//1. reject new commands
+	a.registry.SetCommandBus(nil)
+
+	//2. stop background work, sagas keep handling events
+	r.cancel()
+	r.wg.Wait()
+	for _, name := range a.registry.SagaNames() {
+		a.registry.Saga(name).Wait()
+	}
+
+	//3. drain
+	var errs []error
+	if err := r.drain(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
+	//4. unregister the event handlers and close the buses
+	r.unregister()
+	if c, ok := evol.As[interface{ Close(context.Context) error }](r.cmdBus); ok {
+		if err := c.Close(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c, ok := evol.As[io.Closer](r.eventBus); ok {
+		if err := c.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		for _, err := range errs {
+			r.logger.Error("application stopped uncleanly", evol.LogKeyError, err)
+		}
+		return &StopError{Errors: errs}
+	}
+	r.logger.Info("application stopped")
+	return nil
+}
+
+// StopOnSignal blocks until ctx is done or the process receives one of signals, SIGINT and SIGTERM by default,
+// then stops the App, giving it timeout to drain.
+func (a *App) StopOnSignal(ctx context.Context, timeout time.Duration, signals ...os.Signal) error {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+
+	sigCtx, stop := signal.NotifyContext(ctx, signals...)
+	<-sigCtx.Done()
+	stop()
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return a.Stop(stopCtx)
+}
+
+// StopError is returned by Stop when the App could not drain or close cleanly.
+type StopError struct {
+	Errors []error
+}
+
+func (e *StopError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return "[evol] application stop: " + strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the first error, usually the context error of an incomplete drain.
+func (e *StopError) Unwrap() error {
+	return e.Errors[0]
+}
+
+// pending is implemented by buses able to tell how much work they have left
+type pending interface {
+	Pending() int
+}
+
+// drain waits until the buses have been idle and the outbox empty for two polls in a row, or ctx is done.
+// A single poll could miss a command sent by a saga between reading both buses.
+func (r *running) drain(ctx context.Context) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	idle := 0
+	for {
+		n, err := r.pending(ctx)
 		if err != nil {
 			return err
 		}
-		err = cmdBus.RegisterCmdHandler(name, cmdHandler)
+		if n == 0 {
+			idle++
+		} else {
+			idle = 0
+		}
+		if idle == 2 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d commands and events undelivered: %w", n, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// pending counts the work left on the buses, then publishes a batch of the outbox,
+// in that order so events saved by a command finishing in between are not missed
+func (r *running) pending(ctx context.Context) (int, error) {
+	n := 0
+	if p, ok := evol.As[pending](r.cmdBus); ok {
+		n += p.Pending()
+	}
+	if p, ok := evol.As[pending](r.eventBus); ok {
+		n += p.Pending()
+	}
+	if r.relay != nil {
+		published, err := r.relay.Flush(ctx)
 		if err != nil {
+			return 0, fmt.Errorf("could not flush the outbox: %w", err)
+		}
+		n += published
+	}
+	return n, nil
+}
+
+func RegisterCmdHandler(cmdBus evol.CommandBus, store evol.AggregateStore, evtBus evol.EventBus, opts ...command.Option) error {
+	return Default.RegisterCmdHandler(cmdBus, store, evtBus, opts...)
+}
+
+// RegisterCmdHandler registers an aggregate command handler for every command of the App.
+func (a *App) RegisterCmdHandler(cmdBus evol.CommandBus, store evol.AggregateStore, evtBus evol.EventBus, opts ...command.Option) error {
+	handlers, err := a.cmdHandlers(store, evtBus, opts...)
+	if err != nil {
+		return err
+	}
+	for name, h := range handlers {
+		if err := cmdBus.RegisterCmdHandler(name, h); err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// cmdHandlers creates an aggregate command handler for every command of the App
+func (a *App) cmdHandlers(store evol.AggregateStore, evtBus evol.EventBus, opts ...command.Option) (map[evol.CommandName]evol.CommandHandler, error) {
+	handlers := make(map[evol.CommandName]evol.CommandHandler)
+	for name, cmd := range a.registry.Commands() {
+		h, err := command.NewAggCmdHandler(cmd.TargetAggregateType(), store, evtBus, opts...)
+		if err != nil {
+			return nil, err
+		}
+		handlers[name] = h
+	}
+	return handlers, nil
+}
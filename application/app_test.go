@@ -0,0 +1,150 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"evol"
+	"evol/aggregatestore"
+	"evol/command"
+	"evol/repo/memory"
+	"evol/saga"
+	"strings"
+	"testing"
+)
+
+// recordingBus records the contexts handlers are registered with, and fails the registrations on topic fail
+type recordingBus struct {
+	evol.EventBus
+	fail  evol.Topic
+	ctxs  []context.Context
+	names []string
+}
+
+func (b *recordingBus) RegisterHandler(ctx context.Context, topic evol.Topic, h evol.EventHandler, options ...evol.HandlerOption) error {
+	if topic == b.fail {
+		return errors.New("boom")
+	}
+	b.ctxs = append(b.ctxs, ctx)
+	b.names = append(b.names, evol.NewHandlerConfig(options...).Name)
+	return nil
+}
+
+// boundSaga records the context it is bound with
+type boundSaga struct {
+	topics []evol.Topic
+	ctx    context.Context
+}
+
+func (s *boundSaga) HandleEvent(ctx context.Context, e evol.Event) error { return nil }
+func (s *boundSaga) Topics() []evol.Topic                                { return s.topics }
+func (s *boundSaga) Wait()                                               {}
+func (s *boundSaga) Bind(ctx context.Context, cmdBus evol.CommandHandler, repo evol.SagaRepo) {
+	s.ctx = ctx
+}
+
+func project(ctx context.Context, e evol.Event) error { return nil }
+
+func newTestApp(t *testing.T, sagaTopic evol.Topic) (*App, *boundSaga) {
+	t.Helper()
+	r := evol.NewRegistry()
+	r.RegisterEventHandlers(evol.EventHandlerFunc(project), "Created")
+	s := &boundSaga{topics: []evol.Topic{sagaTopic}}
+	if err := r.RegisterSaga("TestSaga", s); err != nil {
+		t.Fatal(err)
+	}
+	return NewApp(r), s
+}
+
+func TestStartChecksConfigurationFirst(t *testing.T) {
+	app, _ := newTestApp(t, "Created")
+	bus := &recordingBus{}
+	store := aggregatestore.NewAggregateEventStore(memory.NewAggregateEventRepo())
+	ctx := context.Background()
+
+	err := app.Start(ctx, command.NewCommandBus(), bus, store, saga.NewMemorySagaRepo(), WithOutbox(memory.NewAggregateEventRepo(), nil))
+	if err == nil || !strings.Contains(err.Error(), "checkpoint store nil") {
+		t.Fatalf("start with an outbox without checkpoint store: %v", err)
+	}
+	if err := app.Start(ctx, command.NewCommandBus(), bus, store, nil); err == nil {
+		t.Fatal("started sagas without saga store")
+	}
+	if len(bus.ctxs) != 0 {
+		t.Fatalf("registered %d handlers", len(bus.ctxs))
+	}
+	if app.Registry().CommandBus() != nil {
+		t.Error("failed start set the command bus")
+	}
+}
+
+func TestStartUnregistersOnFailure(t *testing.T) {
+	app, s := newTestApp(t, "Failing")
+	bus := &recordingBus{fail: "Failing"}
+	store := aggregatestore.NewAggregateEventStore(memory.NewAggregateEventRepo())
+
+	if err := app.Start(context.Background(), command.NewCommandBus(), bus, store, saga.NewMemorySagaRepo()); err == nil {
+		t.Fatal("started with a failing registration")
+	}
+	if len(bus.ctxs) != 1 || bus.ctxs[0].Err() == nil {
+		t.Error("the event handler registered before the failure was not unregistered")
+	}
+	if s.ctx == nil || s.ctx.Err() == nil {
+		t.Error("the saga bound before the failure was not stopped")
+	}
+	if err := app.Stop(context.Background()); err == nil {
+		t.Error("stopped an application that failed to start")
+	}
+}
+
+func TestStopUnregistersAfterDraining(t *testing.T) {
+	app, s := newTestApp(t, "Created")
+	bus := &recordingBus{}
+	store := aggregatestore.NewAggregateEventStore(memory.NewAggregateEventRepo())
+
+	if err := app.Start(context.Background(), command.NewCommandBus(), bus, store, saga.NewMemorySagaRepo()); err != nil {
+		t.Fatal(err)
+	}
+	if len(bus.ctxs) != 2 {
+		t.Fatalf("registered %d handlers, want 2", len(bus.ctxs))
+	}
+	if bus.ctxs[0] != bus.ctxs[1] || bus.ctxs[0] == s.ctx {
+		t.Error("handlers and sagas must be registered with the same context, the saga bound with the background one")
+	}
+
+	if err := app.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, ctx := range append(bus.ctxs, s.ctx) {
+		if ctx.Err() == nil {
+			t.Error("handler still registered after Stop")
+		}
+	}
+}
+
+func TestStartRegistersHandlersByName(t *testing.T) {
+	app, _ := newTestApp(t, "Created")
+	bus := &recordingBus{}
+	store := aggregatestore.NewAggregateEventStore(memory.NewAggregateEventRepo())
+
+	if err := app.Start(context.Background(), command.NewCommandBus(), bus, store, saga.NewMemorySagaRepo()); err != nil {
+		t.Fatal(err)
+	}
+	defer app.Stop(context.Background())
+	if want := []string{"evol/application.project", "TestSaga"}; strings.Join(bus.names, " ") != strings.Join(want, " ") {
+		t.Errorf("registered %q, want %q", bus.names, want)
+	}
+}
+
+func TestStartRejectsDuplicateHandlerNames(t *testing.T) {
+	app, _ := newTestApp(t, "Created")
+	app.Registry().RegisterEventHandlers(evol.EventHandlerFunc(project), "Created")
+	bus := &recordingBus{}
+	store := aggregatestore.NewAggregateEventStore(memory.NewAggregateEventRepo())
+
+	err := app.Start(context.Background(), command.NewCommandBus(), bus, store, saga.NewMemorySagaRepo())
+	if err == nil || !strings.Contains(err.Error(), "two event handlers named evol/application.project") {
+		t.Fatalf("started with two handlers of the same name: %v", err)
+	}
+	if len(bus.ctxs) != 0 {
+		t.Errorf("registered %d handlers", len(bus.ctxs))
+	}
+}
@@ -0,0 +1,13 @@
+// Command evolctl inspects the event stores of evol applications.
+// Built without domain packages, it can list streams, dump and tail events;
+// see package evolctl to build it with the aggregates, sagas and commands of an application.
+package main
+
+import (
+	"evol/evolctl"
+	"os"
+)
+
+func main() {
+	os.Exit(evolctl.Main(os.Args[1:], os.Stdout, os.Stderr))
+}
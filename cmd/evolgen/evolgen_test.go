@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+// golden compares got with the golden file, rewritten with -update
+func golden(t *testing.T, path string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs, got:\n%s", path, got)
+	}
+}
+
+func TestGenerateGolden(t *testing.T) {
+	dir := t.TempDir()
+	src, err := os.ReadFile(filepath.Join("testdata", "orders", "orders.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "orders.go"), src, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the output of a previous run is not parsed
+	for i := 0; i < 2; i++ {
+		if err := run(dir, "evol_gen.go"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "evol_gen.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, filepath.Join("testdata", "orders", "evol_gen.go.golden"), got)
+}
+
+// TestExampleUpToDate checks the generated file of the example domain, the other golden file
+func TestExampleUpToDate(t *testing.T) {
+	dir := filepath.Join("..", "..", "example", "domain")
+	pkg, err := parsePackage(dir, "evol_gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkg.commands) == 0 || len(pkg.events) == 0 {
+		t.Fatalf("parsed %d commands, %d events", len(pkg.commands), len(pkg.events))
+	}
+	got, err := generate(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden(t, filepath.Join(dir, "evol_gen.go"), got)
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, tc := range []struct {
+		src  string
+		want string
+	}{
+		{"//evol:command\ntype C struct {\n\tId string `evol:\"target\"`\n}", "missing aggregate="},
+		{"//evol:command aggregate=A\ntype C struct {\n\tId string\n}", "no field tagged"},
+		{"//evol:command aggregate=A\ntype C struct {\n\tId int `evol:\"target\"`\n}", "must be a string"},
+		{"//evol:command aggregate=A\ntype C struct {\n\tId, Other string `evol:\"target\"`\n}", "single named field"},
+		{"//evol:command aggregate=A\ntype C struct {\n\tId string `evol:\"target\"`\n\tOther string `evol:\"target\"`\n}", "more than one target"},
+		{"//evol:command aggregate=A policy=never\ntype C struct {\n\tId string `evol:\"target\"`\n}", "policy must be"},
+		{"//evol:event const=1Topic\ntype E struct{}", "invalid topic or constant name"},
+		{"//evol:event\ntype E string", "not a struct"},
+	} {
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "types.go"), []byte("package p\n\n"+tc.src+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := parsePackage(dir, "evol_gen.go"); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("parsing %q: %v, want %q", tc.src, err, tc.want)
+		}
+	}
+}
+
+func TestRunDropsStaleOutput(t *testing.T) {
+	dir := t.TempDir()
+	for name, src := range map[string]string{"types.go": "package p\n\ntype T struct{}\n", "evol_gen.go": "package p\n"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := run(dir, "evol_gen.go"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "evol_gen.go")); !os.IsNotExist(err) {
+		t.Errorf("stale output kept: %v", err)
+	}
+}
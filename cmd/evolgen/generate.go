@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"text/template"
+	"unicode"
+)
+
+var tmpl = template.Must(template.New("evolgen").Funcs(template.FuncMap{
+	"receiver": receiver,
+}).Parse(`// Code generated by evolgen. DO NOT EDIT.
+
+package {{.Name}}
+
+import (
+	"evol"
+{{- if .Events}}
+	"evol/codec"
+{{- end}}
+)
+{{if .Events}}
+const (
+{{- range .Events}}
+	{{.ConstName}} evol.Topic = {{printf "%q" .Topic}}
+{{- end}}
+)
+{{end}}
+{{- range .Commands}}{{$r := receiver .TypeName}}
+func ({{$r}} *{{.TypeName}}) Name() evol.CommandName {
+	return {{printf "%q" .Name}}
+}
+
+func ({{$r}} *{{.TypeName}}) TargetAggregateType() evol.AggregateType {
+	return {{.Aggregate}}
+}
+
+func ({{$r}} *{{.TypeName}}) TargetIdentity() string {
+	return {{$r}}.{{.Target}}
+}
+{{- if .Policy}}
+
+func (*{{.TypeName}}) CreationPolicy() evol.CreationPolicy {
+	return {{.Policy}}
+}
+{{- end}}
+{{end}}
+{{- range .Events}}
+// Topic returns {{.ConstName}}.
+func (*{{.TypeName}}) Topic() evol.Topic {
+	return {{.ConstName}}
+}
+
+// {{.TypeName}}From decodes the data of a {{.ConstName}} event.
+func {{.TypeName}}From(e evol.Event) (*{{.TypeName}}, error) {
+	data := new({{.TypeName}})
+	if err := codec.DecodeData(e, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+{{end}}
+{{- if .Commands}}
+func init() {
+{{- range .Commands}}
+	if err := evol.RegisterCommand(&{{.TypeName}}{}); err != nil {
+		panic(err)
+	}
+{{- end}}
+}
+{{- end}}
+`))
+
+type commandData struct {
+	TypeName, Name, Aggregate, Target, Policy string
+}
+
+type eventData struct {
+	TypeName, Topic, ConstName string
+}
+
+func generate(pkg *pkgInfo) ([]byte, error) {
+	data := struct {
+		Name     string
+		Commands []commandData
+		Events   []eventData
+	}{Name: pkg.name}
+
+	for _, c := range pkg.commands {
+		data.Commands = append(data.Commands, commandData{c.typeName, c.name, c.aggregate, c.target, c.policy})
+	}
+	for _, e := range pkg.events {
+		data.Events = append(data.Events, eventData{e.typeName, e.topic, e.constName})
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated invalid code: %w\n%s", err, buf.String())
+	}
+	return src, nil
+}
+
+// receiver names the receiver after the type, like the hand written methods: c for CreateOrderCmd
+func receiver(typeName string) string {
+	r := []rune(typeName)
+	return string(unicode.ToLower(r[0]))
+}
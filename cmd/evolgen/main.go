@@ -0,0 +1,69 @@
+// Command evolgen generates the boilerplate of the commands and events of a package.
+//
+// Commands are structs annotated with //evol:command, naming their aggregate type,
+// with the field holding the identity of the target aggregate tagged evol:"target":
+//
+//	//evol:command aggregate=OrderAggregateType
+//	type CreateOrderCmd struct {
+//		OrderId string `evol:"target"`
+//	}
+//
+// evolgen generates their Name, TargetAggregateType and TargetIdentity methods and registers
+// them with evol.RegisterCommand. The name defaults to the type name, name=... overrides it.
+// policy=create, policy=exist or policy=any generates the evol.CreationPolicy of the command,
+// a command creating its aggregate or requiring an existing one.
+//
+// Events are structs annotated with //evol:event:
+//
+//	//evol:event
+//	type OrderCreatedEvent struct { ... }
+//
+// evolgen generates a topic constant OrderCreatedEventTopic, a Topic method and an accessor
+// OrderCreatedEventFrom(e evol.Event) decoding the event data. The topic defaults to the
+// type name, topic=... overrides it and const=... renames the constant.
+//
+// Use it from go generate in the package:
+//
+//	//go:generate go run evol/cmd/evolgen
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	dir := flag.String("dir", ".", "directory of the package")
+	output := flag.String("output", "evol_gen.go", "file written in the package directory")
+	flag.Parse()
+
+	if err := run(*dir, *output); err != nil {
+		fmt.Fprintf(os.Stderr, "evolgen: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(dir, output string) error {
+	pkg, err := parsePackage(dir, output)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, output)
+	if len(pkg.commands) == 0 && len(pkg.events) == 0 {
+		// nothing annotated, drop a stale file
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	src, err := generate(pkg)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, src, 0644)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	commandDirective = "//evol:command"
+	eventDirective   = "//evol:event"
+)
+
+type command struct {
+	typeName  string
+	name      string
+	aggregate string
+	target    string
+	// policy is the evol.CreationPolicy constant of the command, empty for the default
+	policy string
+}
+
+type event struct {
+	typeName  string
+	topic     string
+	constName string
+}
+
+type pkgInfo struct {
+	name     string
+	commands []command
+	events   []event
+}
+
+// parsePackage reads the annotated types of the package in dir, skipping tests and the output file
+func parsePackage(dir, output string) (*pkgInfo, error) {
+	fset := token.NewFileSet()
+	filter := func(fi fs.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go") && fi.Name() != output
+	}
+	pkgs, err := parser.ParseDir(fset, dir, filter, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("%d packages in %s, want 1", len(pkgs), dir)
+	}
+
+	info := &pkgInfo{}
+	for name, pkg := range pkgs {
+		info.name = name
+
+		// files in name order, so the output is stable
+		files := make([]string, 0, len(pkg.Files))
+		for file := range pkg.Files {
+			files = append(files, file)
+		}
+		sort.Strings(files)
+
+		for _, file := range files {
+			if err := info.parseFile(fset, pkg.Files[file]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return info, nil
+}
+
+func (p *pkgInfo) parseFile(fset *token.FileSet, file *ast.File) error {
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			doc := ts.Doc
+			if doc == nil && len(gen.Specs) == 1 {
+				doc = gen.Doc
+			}
+
+			for _, directive := range directives(doc) {
+				pos := fset.Position(ts.Pos())
+				st, ok := ts.Type.(*ast.StructType)
+				if !ok {
+					return fmt.Errorf("%s: %s is annotated but not a struct", pos, ts.Name.Name)
+				}
+
+				switch directive.kind {
+				case commandDirective:
+					cmd, err := parseCommand(ts.Name.Name, st, directive.args)
+					if err != nil {
+						return fmt.Errorf("%s: %w", pos, err)
+					}
+					p.commands = append(p.commands, cmd)
+				case eventDirective:
+					evt, err := parseEvent(ts.Name.Name, directive.args)
+					if err != nil {
+						return fmt.Errorf("%s: %w", pos, err)
+					}
+					p.events = append(p.events, evt)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+type directive struct {
+	kind string
+	args map[string]string
+}
+
+// directives returns the evol annotations of a doc comment with their key=value arguments
+func directives(doc *ast.CommentGroup) []directive {
+	if doc == nil {
+		return nil
+	}
+
+	var res []directive
+	for _, c := range doc.List {
+		fields := strings.Fields(c.Text)
+		if len(fields) == 0 || (fields[0] != commandDirective && fields[0] != eventDirective) {
+			continue
+		}
+
+		d := directive{kind: fields[0], args: map[string]string{}}
+		for _, arg := range fields[1:] {
+			kv := strings.SplitN(arg, "=", 2)
+			if len(kv) == 2 {
+				d.args[kv[0]] = kv[1]
+			} else {
+				d.args[kv[0]] = ""
+			}
+		}
+		res = append(res, d)
+	}
+	return res
+}
+
+func parseCommand(typeName string, st *ast.StructType, args map[string]string) (command, error) {
+	cmd := command{
+		typeName:  typeName,
+		name:      typeName,
+		aggregate: args["aggregate"],
+	}
+	if name, ok := args["name"]; ok {
+		cmd.name = unquote(name)
+	}
+	if cmd.aggregate == "" {
+		return cmd, fmt.Errorf("command %s: missing aggregate=", typeName)
+	}
+	if policy, ok := args["policy"]; ok {
+		if cmd.policy, ok = policies[policy]; !ok {
+			return cmd, fmt.Errorf("command %s: policy must be create, exist or any, got %q", typeName, policy)
+		}
+	}
+
+	for _, field := range st.Fields.List {
+		if field.Tag == nil {
+			continue
+		}
+		tag, err := strconv.Unquote(field.Tag.Value)
+		if err != nil {
+			return cmd, err
+		}
+		if reflect.StructTag(tag).Get("evol") != "target" {
+			continue
+		}
+		if len(field.Names) != 1 {
+			return cmd, fmt.Errorf("command %s: the target must be a single named field", typeName)
+		}
+		if ident, ok := field.Type.(*ast.Ident); !ok || ident.Name != "string" {
+			return cmd, fmt.Errorf("command %s: target %s must be a string", typeName, field.Names[0].Name)
+		}
+		if cmd.target != "" {
+			return cmd, fmt.Errorf("command %s: more than one target field", typeName)
+		}
+		cmd.target = field.Names[0].Name
+	}
+
+	if cmd.target == "" {
+		return cmd, fmt.Errorf("command %s: no field tagged evol:\"target\"", typeName)
+	}
+	return cmd, nil
+}
+
+// policies maps the policy= values to their evol.CreationPolicy
+var policies = map[string]string{
+	"create": "evol.MustCreate",
+	"exist":  "evol.MustExist",
+	"any":    "evol.CreateOrUpdate",
+}
+
+func parseEvent(typeName string, args map[string]string) (event, error) {
+	evt := event{
+		typeName:  typeName,
+		topic:     typeName,
+		constName: typeName + "Topic",
+	}
+	if topic, ok := args["topic"]; ok {
+		evt.topic = unquote(topic)
+	}
+	if name, ok := args["const"]; ok {
+		evt.constName = name
+	}
+	if evt.topic == "" || !token.IsIdentifier(evt.constName) {
+		return evt, fmt.Errorf("event %s: invalid topic or constant name", typeName)
+	}
+	return evt, nil
+}
+
+func unquote(s string) string {
+	if u, err := strconv.Unquote(s); err == nil {
+		return u
+	}
+	return s
+}
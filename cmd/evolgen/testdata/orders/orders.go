@@ -0,0 +1,32 @@
+package orders
+
+const OrderAggregateType = "Order"
+
+//evol:command aggregate=OrderAggregateType policy=create
+type CreateOrderCmd struct {
+	OrderId string `evol:"target"`
+	BuyerId string
+}
+
+type (
+	//evol:command aggregate=OrderAggregateType name="orders.cancel" policy=exist
+	CancelOrderCmd struct {
+		Reason  string
+		OrderId string `json:"id" evol:"target"`
+	}
+
+	//evol:event topic="orders.cancelled" const=OrderCancelledTopic
+	OrderCancelledEvent struct {
+		OrderId string
+	}
+)
+
+// OrderCreatedEvent is not a command
+//
+//evol:event
+type OrderCreatedEvent struct {
+	OrderId string
+}
+
+// notAnnotated gets nothing generated
+type notAnnotated struct{}
@@ -4,9 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"evol"
+	"fmt"
 )
 
 type JsonCmdCodec struct {
+	// Registry makes the decoded commands, evol.DefaultRegistry when nil
+	Registry *evol.Registry
 }
 
 func (j *JsonCmdCodec) MarshalCommand(ctx context.Context, cmd evol.Command) ([]byte, error) {
@@ -14,6 +17,7 @@ func (j *JsonCmdCodec) MarshalCommand(ctx context.Context, cmd evol.Command) ([]
 		Name:                    cmd.Name(),
 		TargetAggregateType:     cmd.TargetAggregateType(),
 		TargetAggregateIdentity: cmd.TargetIdentity(),
+		Metadata:                evol.MetadataFromContext(ctx),
 	}
 	data, err := json.Marshal(cmd)
 	if err != nil {
@@ -25,18 +29,35 @@ func (j *JsonCmdCodec) MarshalCommand(ctx context.Context, cmd evol.Command) ([]
 }
 
 func (j *JsonCmdCodec) UnmarshalCommand(ctx context.Context, bytes []byte) (evol.Command, error) {
+	_, cmd, err := j.UnmarshalCommandContext(ctx, bytes)
+	return cmd, err
+}
+
+// UnmarshalCommandContext decodes a command and returns ctx extended with the metadata
+// the sender had in its context, such as the trace context.
+func (j *JsonCmdCodec) UnmarshalCommandContext(ctx context.Context, bytes []byte) (context.Context, evol.Command, error) {
 	var c command
 	err := json.Unmarshal(bytes, &c)
 	if err != nil {
-		return nil, err
+		return ctx, nil, err
 	}
 
-	c2 := evol.NewCommand(c.Name)
-
-	json.Unmarshal(c.Data, &c2)
+	registry := j.Registry
+	if registry == nil {
+		registry = evol.DefaultRegistry
+	}
+	c2 := registry.NewCommand(c.Name)
+	if c2 == nil {
+		return ctx, nil, fmt.Errorf("[evol] unmarshal command: %s not registered", c.Name)
+	}
 
-	return c2, nil
+	if len(c.Data) > 0 {
+		if err := json.Unmarshal(c.Data, c2); err != nil {
+			return ctx, nil, fmt.Errorf("[evol] unmarshal command %s: %w", c.Name, err)
+		}
+	}
 
+	return evol.ContextWithMetadata(ctx, c.Metadata), c2, nil
 }
 
 type command struct {
@@ -44,4 +65,5 @@ type command struct {
 	TargetAggregateType     evol.AggregateType `json:"target_aggregate_type,omitempty"`
 	TargetAggregateIdentity string             `json:"target_aggregate_identity,omitempty"`
 	Data                    json.RawMessage    `json:"data,omitempty"`
+	Metadata                evol.Metadata      `json:"metadata,omitempty"`
 }
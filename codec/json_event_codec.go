@@ -6,6 +6,7 @@ import (
 	"evol"
 	"fmt"
 	"github.com/mitchellh/mapstructure"
+	"reflect"
 	"time"
 )
 
@@ -19,6 +20,8 @@ func (j *JsonEventCodec) MarshalEvent(ctx context.Context, e evol.Event) ([]byte
 		AggregateType: e.AggregateType(),
 		AggregateId:   e.AggregateIdentity(),
 		Time:          e.Timestamp(),
+		Version:       e.Version(),
+		Metadata:      e.Metadata(),
 	}
 	return json.Marshal(newEvent)
 }
@@ -33,6 +36,8 @@ func (j *JsonEventCodec) UnmarshalEvent(ctx context.Context, bytes []byte) (evol
 		e.Data,
 		e.Time,
 		evol.ForAggregate(e.AggregateType, e.AggregateId),
+		evol.WithVersion(e.Version),
+		evol.WithMetadata(e.Metadata),
 	)
 
 	return res, nil
@@ -44,6 +49,8 @@ type evt struct {
 	AggregateType evol.AggregateType `json:"aggregate_type"`
 	AggregateId   string             `json:"aggregate_id"`
 	Time          time.Time          `json:"time"`
+	Version       int                `json:"version,omitempty"`
+	Metadata      evol.Metadata      `json:"metadata,omitempty"`
 }
 
 // DecodeEventData translate map[string]interface{} to struct
@@ -51,3 +58,31 @@ type evt struct {
 func DecodeEventData(rawData interface{}, output interface{}) error {
 	return mapstructure.Decode(rawData, output)
 }
+
+// DecodeData decodes the data of e into output, a pointer to a struct.
+// Data of that struct type is copied, other data such as the map[string]interface{}
+// left by json.Unmarshal is converted through JSON, so time.Time fields survive.
+func DecodeData(e evol.Event, output interface{}) error {
+	out := reflect.ValueOf(output)
+	if out.Kind() != reflect.Ptr || out.IsNil() {
+		return fmt.Errorf("[evol] DecodeData: output must be a non nil pointer, got %T", output)
+	}
+
+	data := reflect.ValueOf(e.Data())
+	if data.IsValid() && data.Kind() == reflect.Ptr && !data.IsNil() {
+		data = data.Elem()
+	}
+	if data.IsValid() && data.Type() == out.Elem().Type() {
+		out.Elem().Set(data)
+		return nil
+	}
+
+	b, err := json.Marshal(e.Data())
+	if err != nil {
+		return fmt.Errorf("[evol] DecodeData %s: %w", e.Topic(), err)
+	}
+	if err := json.Unmarshal(b, output); err != nil {
+		return fmt.Errorf("[evol] DecodeData %s: %w", e.Topic(), err)
+	}
+	return nil
+}
@@ -2,6 +2,8 @@ package evol
 
 import (
 	"context"
+	"errors"
+	"fmt"
 )
 
 type Command interface {
@@ -27,3 +29,44 @@ type CommandHandlerFunc func(context.Context, Command) error
 func (h CommandHandlerFunc) HandleCommand(ctx context.Context, cmd Command) error {
 	return h(ctx, cmd)
 }
+
+// CreationPolicy tells whether a command creates its aggregate, requires an existing one, or either.
+type CreationPolicy int
+
+const (
+	// CreateOrUpdate handles the command with the stored aggregate, or a new one, the default
+	CreateOrUpdate CreationPolicy = iota
+	// MustCreate rejects the command with ErrAggregateAlreadyExists when the aggregate is stored
+	MustCreate
+	// MustExist rejects the command with ErrAggregateNotFound unless the aggregate is stored
+	MustExist
+)
+
+func (p CreationPolicy) String() string {
+	switch p {
+	case CreateOrUpdate:
+		return "create-or-update"
+	case MustCreate:
+		return "must-create"
+	case MustExist:
+		return "must-exist"
+	}
+	return fmt.Sprintf("CreationPolicy(%d)", int(p))
+}
+
+// CreationPolicyCommand is a command declaring its CreationPolicy, AggCmdHandler enforces it.
+type CreationPolicyCommand interface {
+	Command
+	CreationPolicy() CreationPolicy
+}
+
+// CommandCreationPolicy returns the CreationPolicy of cmd, CreateOrUpdate when it declares none.
+func CommandCreationPolicy(cmd Command) CreationPolicy {
+	if c, ok := cmd.(CreationPolicyCommand); ok {
+		return c.CreationPolicy()
+	}
+	return CreateOrUpdate
+}
+
+// ErrAggregateAlreadyExists is returned for a MustCreate command whose aggregate is stored.
+var ErrAggregateAlreadyExists = errors.New("[evol] aggregate already exists")
@@ -4,17 +4,24 @@ import (
 	"context"
 	"errors"
 	"evol"
+	"fmt"
 )
 
 //AggCmdHandler is command handlers for a type of aggregate
+//Commands declaring an evol.CreationPolicy fail when their aggregate is, or is not, stored.
+//Without outbox the events are published after they are stored: when publishing fails, the command fails
+//with the events stored but not all published, they are never published again. Only WithOutbox guarantees
+//that every stored event is delivered.
 type AggCmdHandler struct {
 	aggregateType evol.AggregateType
 	repo          evol.AggregateStore
 	eventBus      evol.EventBus
+	outbox        bool
+	logger        evol.Logger
 }
 
 func (h *AggCmdHandler) HandleCommand(ctx context.Context, cmd evol.Command) error {
-	a, err := h.repo.Load(ctx, h.aggregateType, cmd.TargetIdentity())
+	a, err := h.load(ctx, cmd)
 	if err != nil {
 		return err
 	} else if a == nil {
@@ -26,19 +33,76 @@ func (h *AggCmdHandler) HandleCommand(ctx context.Context, cmd evol.Command) err
 		return err
 	}
 
-	events := a.DomainEvents()
+	// keep the events, the store clears them from the aggregate when saved
+	events := append([]evol.Event(nil), a.DomainEvents()...)
+
+	// events carry the metadata of the command, such as its trace context
+	if md := evol.MetadataFromContext(ctx); len(md) > 0 {
+		for _, e := range events {
+			evol.WithMetadata(md)(e)
+		}
+	}
+
+	//store first, subscribers must never see events that were not stored
+	if err := h.repo.Save(ctx, a); err != nil {
+		return err
+	}
+
+	//in outbox mode a relay publishes the stored events
+	if h.outbox {
+		return nil
+	}
 
 	for _, e := range events {
 		if err := h.eventBus.HandleEvent(ctx, e); err != nil {
-			return err
+			evol.LoggerOr(h.logger).Error("stored event could not be published", append(evol.EventFields(e), evol.LogKeyCommand, cmd.Name(), evol.LogKeyError, err)...)
+			return fmt.Errorf("[evol] %s: events stored but not published: %w", cmd.Name(), err)
 		}
 	}
 
-	return h.repo.Save(ctx, a)
+	return nil
+}
+
+// load loads the target aggregate of cmd, enforcing the CreationPolicy of cmd
+func (h *AggCmdHandler) load(ctx context.Context, cmd evol.Command) (evol.Aggregate, error) {
+	policy := evol.CommandCreationPolicy(cmd)
+	if policy == evol.CreateOrUpdate {
+		return h.repo.Load(ctx, h.aggregateType, cmd.TargetIdentity())
+	}
+
+	a, created, err := evol.LoadOrCreate(ctx, h.repo, h.aggregateType, cmd.TargetIdentity())
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case policy == evol.MustCreate && !created:
+		return nil, fmt.Errorf("[evol] %s %s %s: %w", cmd.Name(), h.aggregateType, cmd.TargetIdentity(), evol.ErrAggregateAlreadyExists)
+	case policy == evol.MustExist && created:
+		return nil, fmt.Errorf("[evol] %s %s %s: %w", cmd.Name(), h.aggregateType, cmd.TargetIdentity(), evol.ErrAggregateNotFound)
+	}
+	return a, nil
+}
+
+// Option is an option setter used to configure an AggCmdHandler.
+type Option func(*AggCmdHandler)
+
+// WithOutbox only stores the events, an outbox relay publishes them to the event bus,
+// at least once even when publishing fails.
+func WithOutbox() Option {
+	return func(h *AggCmdHandler) {
+		h.outbox = true
+	}
+}
+
+// WithLogger sets the logger of the handler, evol.GetLogger() by default.
+func WithLogger(l evol.Logger) Option {
+	return func(h *AggCmdHandler) {
+		h.logger = l
+	}
 }
 
 //NewAggCmdHandler Create a evol.CommandHandler for an aggregate type
-func NewAggCmdHandler(aggregateType evol.AggregateType, repo evol.AggregateStore, bus evol.EventBus) (*AggCmdHandler, error) {
+func NewAggCmdHandler(aggregateType evol.AggregateType, repo evol.AggregateStore, bus evol.EventBus, options ...Option) (*AggCmdHandler, error) {
 	if repo == nil {
 		return nil, errors.New("[evol] NewAggCmdHandler: aggregatestore nil")
 	}
@@ -49,5 +113,16 @@ func NewAggCmdHandler(aggregateType evol.AggregateType, repo evol.AggregateStore
 		eventBus:      bus,
 	}
 
+	for _, option := range options {
+		if option == nil {
+			continue
+		}
+		option(h)
+	}
+
+	if !h.outbox && bus == nil {
+		return nil, errors.New("[evol] NewAggCmdHandler: eventbus nil")
+	}
+
 	return h, nil
 }
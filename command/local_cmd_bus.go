@@ -4,20 +4,52 @@ import (
 	"context"
 	"errors"
 	"evol"
+	"fmt"
 	"sync"
+	"sync/atomic"
 )
 
+// ErrCommandBusClosed is returned by HandleCommand once the bus is closed.
+var ErrCommandBusClosed = errors.New("[evol] LocalCommandBus closed")
+
 //LocalCommandBus dispatch command to aggregate, also a type of  evol.CommandHandler
 //TODO: distributed command bus
 type LocalCommandBus struct {
+	// counter first, 64-bit atomic operations need 64-bit alignment
+	inflight int64
+
 	handlers   map[evol.CommandName]evol.CommandHandler
 	handlersMu sync.RWMutex
+	logger     evol.Logger
+
+	closed bool
+	wg     sync.WaitGroup
 }
 
-func NewCommandBus() *LocalCommandBus {
-	return &LocalCommandBus{
+func NewCommandBus(options ...BusOption) *LocalCommandBus {
+	b := &LocalCommandBus{
 		handlers: make(map[evol.CommandName]evol.CommandHandler),
 	}
+
+	for _, option := range options {
+		if option == nil {
+			continue
+		}
+		option(b)
+	}
+
+	return b
+}
+
+// BusOption is an option setter used to configure a LocalCommandBus.
+type BusOption func(*LocalCommandBus)
+
+// WithBusLogger sets the logger of the bus, evol.GetLogger() by default.
+// Commands are handled asynchronously, so their errors are only logged.
+func WithBusLogger(l evol.Logger) BusOption {
+	return func(b *LocalCommandBus) {
+		b.logger = l
+	}
 }
 
 func (b *LocalCommandBus) RegisterCmdHandler(cmd evol.CommandName, handler evol.CommandHandler) error {
@@ -37,12 +69,54 @@ func (b *LocalCommandBus) HandleCommand(ctx context.Context, cmd evol.Command) e
 	b.handlersMu.RLock()
 	defer b.handlersMu.RUnlock()
 
+	if b.closed {
+		return ErrCommandBusClosed
+	}
+
 	if handler, ok := b.handlers[cmd.Name()]; ok {
 		//Async command handle
-		go handler.HandleCommand(ctx, cmd)
+		b.wg.Add(1)
+		atomic.AddInt64(&b.inflight, 1)
+		go func() {
+			defer b.wg.Done()
+			defer atomic.AddInt64(&b.inflight, -1)
+
+			if err := handler.HandleCommand(ctx, cmd); err != nil {
+				evol.LoggerOr(b.logger).Error("could not handle command", append(evol.CommandFields(ctx, cmd), evol.LogKeyError, err)...)
+			}
+		}()
 	} else {
 		return errors.New("[evol] LocalCommandBus HandleCommand: command handler not found")
 	}
 
 	return nil
 }
+
+// Pending returns the number of commands being handled.
+func (b *LocalCommandBus) Pending() int {
+	return int(atomic.LoadInt64(&b.inflight))
+}
+
+// Close rejects new commands with ErrCommandBusClosed and waits for the commands being handled,
+// until ctx is done.
+func (b *LocalCommandBus) Close(ctx context.Context) error {
+	b.handlersMu.Lock()
+	b.closed = true
+	b.handlersMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		if b.Pending() == 0 {
+			return nil
+		}
+		return fmt.Errorf("[evol] LocalCommandBus closed with %d commands still handled: %w", b.Pending(), ctx.Err())
+	}
+}
@@ -0,0 +1,35 @@
+package evol
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrDeadLetterNotFound = errors.New("[evol] could not find dead letter")
+
+// DeadLetter is an event that a handler could not process after all delivery attempts.
+type DeadLetter struct {
+	ID string
+	// Handler is the name of the handler, see WithHandlerName
+	Handler  string
+	Event    Event
+	Err      string
+	Attempts int
+	Time     time.Time
+}
+
+// DeadLetterStore keeps dead letters until they are redelivered or removed.
+type DeadLetterStore interface {
+	// Add stores a dead letter
+	Add(context.Context, *DeadLetter) error
+
+	// List returns all dead letters, oldest first
+	List(context.Context) ([]*DeadLetter, error)
+
+	// Get returns a dead letter by id, or ErrDeadLetterNotFound
+	Get(context.Context, string) (*DeadLetter, error)
+
+	// Remove deletes a dead letter by id
+	Remove(context.Context, string) error
+}
@@ -0,0 +1,111 @@
+package deadletter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"evol"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// New creates a dead letter for an event the named handler failed to process.
+func New(e evol.Event, handler string, err error, attempts int) *evol.DeadLetter {
+	return &evol.DeadLetter{
+		ID:       newID(),
+		Handler:  handler,
+		Event:    e,
+		Err:      err.Error(),
+		Attempts: attempts,
+		Time:     time.Now(),
+	}
+}
+
+// Redeliver hands the dead letter to h again, and removes it from the store when h succeeds.
+func Redeliver(ctx context.Context, store evol.DeadLetterStore, id string, h evol.EventHandler) error {
+	dl, err := store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := h.HandleEvent(ctx, dl.Event); err != nil {
+		return fmt.Errorf("[evol] redeliver dead letter %s: %w", id, err)
+	}
+
+	return store.Remove(ctx, id)
+}
+
+// Handlers indexes the handlers of a bus by topic and name, so a dead letter finds its handler again.
+type Handlers struct {
+	handlers   map[evol.Topic]map[string]evol.EventHandler
+	handlersMu sync.RWMutex
+}
+
+func NewHandlers() *Handlers {
+	return &Handlers{
+		handlers: make(map[evol.Topic]map[string]evol.EventHandler),
+	}
+}
+
+// Add indexes h and returns its name, made unique on the topic with a numeric suffix.
+func (r *Handlers) Add(topic evol.Topic, name string, h evol.EventHandler) string {
+	r.handlersMu.Lock()
+	defer r.handlersMu.Unlock()
+
+	byName, ok := r.handlers[topic]
+	if !ok {
+		byName = make(map[string]evol.EventHandler)
+		r.handlers[topic] = byName
+	}
+
+	unique := name
+	for i := 2; ; i++ {
+		if _, ok := byName[unique]; !ok {
+			break
+		}
+		unique = fmt.Sprintf("%s#%d", name, i)
+	}
+	byName[unique] = h
+
+	return unique
+}
+
+// AddNamed indexes h under name, which must not be taken on the topic yet.
+func (r *Handlers) AddNamed(topic evol.Topic, name string, h evol.EventHandler) error {
+	r.handlersMu.Lock()
+	defer r.handlersMu.Unlock()
+
+	byName, ok := r.handlers[topic]
+	if !ok {
+		byName = make(map[string]evol.EventHandler)
+		r.handlers[topic] = byName
+	}
+	if _, ok := byName[name]; ok {
+		return fmt.Errorf("[evol] handler %s already registered on %s", name, topic)
+	}
+	byName[name] = h
+
+	return nil
+}
+
+// Get returns the handler a dead letter was recorded for.
+func (r *Handlers) Get(dl *evol.DeadLetter) (evol.EventHandler, error) {
+	r.handlersMu.RLock()
+	defer r.handlersMu.RUnlock()
+
+	if h, ok := r.handlers[dl.Event.Topic()][dl.Handler]; ok {
+		return h, nil
+	}
+
+	return nil, errors.New("[evol] dead letter handler not registered: " + dl.Handler)
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
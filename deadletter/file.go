@@ -0,0 +1,172 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"evol"
+	"evol/codec"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileStore keeps each dead letter as a json file in a directory.
+type FileStore struct {
+	dir   string
+	codec evol.EventCodec
+	mu    sync.Mutex
+}
+
+// NewFileStore creates a FileStore in dir, the directory is created when missing.
+func NewFileStore(dir string, options ...FileOption) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("could not create dead letter directory: %w", err)
+	}
+
+	s := &FileStore{
+		dir:   dir,
+		codec: &codec.JsonEventCodec{},
+	}
+
+	for _, option := range options {
+		if option == nil {
+			continue
+		}
+		option(s)
+	}
+
+	return s, nil
+}
+
+// FileOption is an option setter used to configure a FileStore.
+type FileOption func(*FileStore)
+
+// WithCodec sets the codec of the events written to disk, codec.JsonEventCodec by default.
+// It must encode events as JSON. Use the codec of the event bus, like pii.EventCodec,
+// so dead letters do not keep on disk what the bus encrypts.
+func WithCodec(c evol.EventCodec) FileOption {
+	return func(s *FileStore) {
+		s.codec = c
+	}
+}
+
+type record struct {
+	ID       string          `json:"id"`
+	Handler  string          `json:"handler"`
+	Event    json.RawMessage `json:"event"`
+	Err      string          `json:"error"`
+	Attempts int             `json:"attempts"`
+	Time     time.Time       `json:"time"`
+}
+
+func (s *FileStore) Add(ctx context.Context, dl *evol.DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event, err := s.codec.MarshalEvent(ctx, dl.Event)
+	if err != nil {
+		return fmt.Errorf("could not marshal dead letter event: %w", err)
+	}
+
+	data, err := json.Marshal(&record{
+		ID:       dl.ID,
+		Handler:  dl.Handler,
+		Event:    event,
+		Err:      dl.Err,
+		Attempts: dl.Attempts,
+		Time:     dl.Time,
+	})
+	if err != nil {
+		return err
+	}
+
+	// write then rename, a crash never leaves a partial dead letter behind
+	tmp := s.path(dl.ID) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(dl.ID))
+}
+
+func (s *FileStore) List(ctx context.Context) ([]*evol.DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*evol.DeadLetter, 0, len(files))
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		dl, err := s.read(ctx, strings.TrimSuffix(f.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, dl)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Time.Before(res[j].Time)
+	})
+	return res, nil
+}
+
+func (s *FileStore) Get(ctx context.Context, id string) (*evol.DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.read(ctx, id)
+}
+
+func (s *FileStore) Remove(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := os.Remove(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return evol.ErrDeadLetterNotFound
+	}
+	return err
+}
+
+func (s *FileStore) read(ctx context.Context, id string) (*evol.DeadLetter, error) {
+	data, err := ioutil.ReadFile(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, evol.ErrDeadLetterNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var r record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("could not unmarshal dead letter %s: %w", id, err)
+	}
+
+	e, err := s.codec.UnmarshalEvent(ctx, r.Event)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal dead letter %s event: %w", id, err)
+	}
+
+	return &evol.DeadLetter{
+		ID:       r.ID,
+		Handler:  r.Handler,
+		Event:    e,
+		Err:      r.Err,
+		Attempts: r.Attempts,
+		Time:     r.Time,
+	}, nil
+}
+
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.dir, filepath.Base(id)+".json")
+}
@@ -0,0 +1,47 @@
+package deadletter
+
+import (
+	"context"
+	"evol"
+	"evol/pii"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type signedUp struct {
+	UserId string
+	Email  string `pii:"UserId"`
+}
+
+func TestFileStoreWithCodec(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileStore(dir, WithCodec(pii.NewEventCodec(nil, pii.NewMemoryKeyStore())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	e := evol.NewEvent("SignedUp", &signedUp{UserId: "u1", Email: "u1@example.com"}, time.Now(), evol.ForAggregate("User", "u1"), evol.WithVersion(1))
+	if err := s.Add(ctx, &evol.DeadLetter{ID: "d1", Handler: "h", Event: e, Err: "boom", Attempts: 1, Time: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "d1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "u1@example.com") {
+		t.Fatalf("dead letter in plaintext: %s", data)
+	}
+
+	dl, err := s.Get(ctx, "d1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email := dl.Event.Data().(map[string]interface{})["Email"]; email != "u1@example.com" {
+		t.Fatalf("dead letter email %v", email)
+	}
+}
@@ -0,0 +1,59 @@
+package deadletter
+
+import (
+	"context"
+	"evol"
+	"sync"
+)
+
+// MemoryStore keeps dead letters in memory.
+type MemoryStore struct {
+	letters   []*evol.DeadLetter
+	lettersMu sync.RWMutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (s *MemoryStore) Add(ctx context.Context, dl *evol.DeadLetter) error {
+	s.lettersMu.Lock()
+	defer s.lettersMu.Unlock()
+
+	s.letters = append(s.letters, dl)
+	return nil
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]*evol.DeadLetter, error) {
+	s.lettersMu.RLock()
+	defer s.lettersMu.RUnlock()
+
+	res := make([]*evol.DeadLetter, len(s.letters))
+	copy(res, s.letters)
+	return res, nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (*evol.DeadLetter, error) {
+	s.lettersMu.RLock()
+	defer s.lettersMu.RUnlock()
+
+	for _, dl := range s.letters {
+		if dl.ID == id {
+			return dl, nil
+		}
+	}
+	return nil, evol.ErrDeadLetterNotFound
+}
+
+func (s *MemoryStore) Remove(ctx context.Context, id string) error {
+	s.lettersMu.Lock()
+	defer s.lettersMu.Unlock()
+
+	for i, dl := range s.letters {
+		if dl.ID == id {
+			s.letters = append(s.letters[:i], s.letters[i+1:]...)
+			return nil
+		}
+	}
+	return evol.ErrDeadLetterNotFound
+}
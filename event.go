@@ -17,6 +17,10 @@ type Event interface {
 	AggregateIdentity() string
 	// Timestamp of when the codec was created.
 	Timestamp() time.Time
+	// Version is the position of the event in the aggregate stream starting at 1, 0 when unknown
+	Version() int
+	// Metadata of the event, such as trace context, never nil
+	Metadata() Metadata
 }
 
 type event struct {
@@ -25,6 +29,8 @@ type event struct {
 	aggregateType AggregateType
 	aggregateId   string
 	time          time.Time
+	version       int
+	metadata      Metadata
 }
 
 func (b *event) Topic() Topic {
@@ -46,14 +52,23 @@ func (b *event) Timestamp() time.Time {
 	return b.time
 }
 
+func (b *event) Version() int {
+	return b.version
+}
+
+func (b *event) Metadata() Metadata {
+	return b.metadata
+}
+
 // EventOption is an option to use when creating events.
 type EventOption func(Event)
 
 func NewEvent(topic Topic, data interface{}, time time.Time, options ...EventOption) Event {
 	e := &event{
-		topic: topic,
-		data:  data,
-		time:  time,
+		topic:    topic,
+		data:     data,
+		time:     time,
+		metadata: Metadata{},
 	}
 
 	for _, option := range options {
@@ -75,3 +90,51 @@ func ForAggregate(aggregateType AggregateType, identity string) EventOption {
 		}
 	}
 }
+
+// WithVersion sets the position of the event in the aggregate stream.
+func WithVersion(version int) EventOption {
+	return func(e Event) {
+		if evt, ok := e.(*event); ok {
+			evt.version = version
+		}
+	}
+}
+
+// WithMetadata adds metadata to the event, overwriting existing keys. It sets the metadata of any Event,
+// the map its Metadata returns being the one of the event.
+func WithMetadata(md Metadata) EventOption {
+	return func(e Event) {
+		if evt, ok := e.(*event); ok && evt.metadata == nil {
+			evt.metadata = Metadata{}
+		}
+		target := e.Metadata()
+		if target == nil {
+			return
+		}
+		for k, v := range md {
+			target[k] = v
+		}
+	}
+}
+
+// EventCopier is implemented by custom events to keep their type through CopyEvent.
+type EventCopier interface {
+	// CopyEvent returns a copy of the event, with metadata of its own, then applies options to the copy
+	CopyEvent(options ...EventOption) Event
+}
+
+// CopyEvent creates a new event with the fields of e, then applies options to the copy.
+// Events implementing EventCopier copy themselves, others are copied into an event of NewEvent.
+func CopyEvent(e Event, options ...EventOption) Event {
+	if c, ok := e.(EventCopier); ok {
+		return c.CopyEvent(options...)
+	}
+
+	options = append([]EventOption{
+		ForAggregate(e.AggregateType(), e.AggregateIdentity()),
+		WithVersion(e.Version()),
+		WithMetadata(e.Metadata()),
+	}, options...)
+
+	return NewEvent(e.Topic(), e.Data(), e.Timestamp(), options...)
+}
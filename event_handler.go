@@ -30,9 +30,5 @@ var EventHandlers = make(map[Topic][]EventHandler)
 var EventHandlersMu sync.RWMutex
 
 func RegisterEventHandlers(h EventHandler, topics ...Topic) {
-	EventHandlersMu.Lock()
-	defer EventHandlersMu.Unlock()
-	for _, topic := range topics {
-		EventHandlers[topic] = append(EventHandlers[topic], h)
-	}
+	DefaultRegistry.RegisterEventHandlers(h, topics...)
 }
@@ -1,9 +1,107 @@
 package evol
 
-import "context"
+import (
+	"context"
+	"fmt"
+)
 
 type EventBus interface {
 	EventHandler
 
-	RegisterHandler(context.Context, Topic, EventHandler) error
+	// RegisterHandler registers a handler of the events of a topic, until the context is done
+	// for the buses able to unregister handlers
+	RegisterHandler(context.Context, Topic, EventHandler, ...HandlerOption) error
+}
+
+// HandlerOption configures how an EventBus delivers events to a registered handler.
+type HandlerOption func(*HandlerConfig)
+
+// HandlerConfig collects the HandlerOption given to RegisterHandler.
+type HandlerConfig struct {
+	// Group is the consumer group of the handler. Handlers registered in the same group
+	// on a topic compete for its events, while a handler without group receives every event.
+	Group string
+	// Name identifies the handler in dead letters, unique per topic on a bus.
+	Name string
+	// Retry overrides the retry policy of the bus for the handler.
+	Retry *RetryPolicy
+	// Extensions holds settings of a specific bus implementation, keyed by a type of that package.
+	Extensions map[interface{}]interface{}
+}
+
+// NewHandlerConfig applies options to an empty HandlerConfig.
+func NewHandlerConfig(options ...HandlerOption) *HandlerConfig {
+	c := &HandlerConfig{}
+	for _, option := range options {
+		if option == nil {
+			continue
+		}
+		option(c)
+	}
+	return c
+}
+
+// HandlerName returns the configured name of h, or its type name.
+func (c *HandlerConfig) HandlerName(h EventHandler) string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return fmt.Sprintf("%T", h)
+}
+
+// RetryPolicyOr returns the retry policy of the handler, or def when none is set.
+func (c *HandlerConfig) RetryPolicyOr(def RetryPolicy) RetryPolicy {
+	if c.Retry != nil {
+		return *c.Retry
+	}
+	return def
+}
+
+// Extension returns the bus specific setting stored under key, or nil.
+func (c *HandlerConfig) Extension(key interface{}) interface{} {
+	return c.Extensions[key]
+}
+
+// SetExtension stores a bus specific setting under key.
+func (c *HandlerConfig) SetExtension(key, value interface{}) {
+	if c.Extensions == nil {
+		c.Extensions = make(map[interface{}]interface{})
+	}
+	c.Extensions[key] = value
+}
+
+// WithHandlerName names the handler, the name is recorded in dead letters and used to redeliver them.
+func WithHandlerName(name string) HandlerOption {
+	return func(c *HandlerConfig) {
+		c.Name = name
+	}
+}
+
+// WithRetryPolicy sets how the bus retries the handler when it returns an error.
+func WithRetryPolicy(p RetryPolicy) HandlerOption {
+	return func(c *HandlerConfig) {
+		c.Retry = &p
+	}
+}
+
+// InGroup registers the handler in a named consumer group.
+func InGroup(group string) HandlerOption {
+	return func(c *HandlerConfig) {
+		c.Group = group
+	}
+}
+
+type attemptKey struct{}
+
+// ContextWithAttempt returns a context telling a handler which delivery attempt it runs, starting at 1.
+func ContextWithAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, attemptKey{}, attempt)
+}
+
+// AttemptFromContext returns the delivery attempt set by the bus, 1 when unknown.
+func AttemptFromContext(ctx context.Context) int {
+	if attempt, ok := ctx.Value(attemptKey{}).(int); ok {
+		return attempt
+	}
+	return 1
 }
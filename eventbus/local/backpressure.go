@@ -0,0 +1,183 @@
+package local
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"sync"
+)
+
+// ErrQueueFull is returned by HandleEvent when a handler queue using the Fail policy is full.
+var ErrQueueFull = errors.New("[evol] local event bus queue full")
+
+// ErrBusClosed is returned when publishing to a closed EventBus.
+var ErrBusClosed = errors.New("[evol] local event bus closed")
+
+// Backpressure decides what publishing does when the queue of a handler is full.
+type Backpressure int
+
+const (
+	// Drop discards the new event and logs it, the default.
+	Drop Backpressure = iota
+	// Block waits for room in the queue until the publishing context is done.
+	Block
+	// Fail rejects the event with ErrQueueFull.
+	Fail
+	// DropOldest discards the oldest queued event to make room for the new one.
+	DropOldest
+	// Spill appends the event to a file on disk and queues it again once there is room.
+	Spill
+)
+
+func (p Backpressure) String() string {
+	switch p {
+	case Drop:
+		return "drop"
+	case Block:
+		return "block"
+	case Fail:
+		return "fail"
+	case DropOldest:
+		return "drop_oldest"
+	case Spill:
+		return "spill"
+	}
+	return "unknown"
+}
+
+// TopicStats counts what happened to the events of a topic, summed over its handler queues.
+type TopicStats struct {
+	// Queued is the number of events waiting in memory.
+	Queued int
+	// Spilled is the number of events waiting on disk.
+	Spilled int
+	// Pending is the number of events queued, spilled or being handled.
+	Pending int
+	// Dropped is the number of events discarded by Drop and DropOldest.
+	Dropped uint64
+	// Rejected is the number of events refused by Fail, or by Block when the context ended.
+	Rejected uint64
+}
+
+// spillQueue is a FIFO of length prefixed records in a temporary file
+type spillQueue struct {
+	mu     sync.Mutex
+	f      *os.File
+	r, w   int64
+	n      int
+	notify chan struct{}
+}
+
+func newSpillQueue(dir string) (*spillQueue, error) {
+	f, err := os.CreateTemp(dir, "evol-spill-*")
+	if err != nil {
+		return nil, err
+	}
+
+	return &spillQueue{
+		f:      f,
+		notify: make(chan struct{}, 1),
+	}, nil
+}
+
+func (q *spillQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.n
+}
+
+// offer sends data to ch when nothing is spilled and ch has room, and spills it otherwise,
+// so nothing overtakes the spilled events.
+func (q *spillQueue) offer(ch chan<- []byte, data []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.n == 0 {
+		select {
+		case ch <- data:
+			return nil
+		default:
+		}
+	}
+	return q.push(data)
+}
+
+// push appends a record, q.mu must be held
+func (q *spillQueue) push(data []byte) error {
+	record := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(record, uint32(len(data)))
+	copy(record[4:], data)
+
+	if _, err := q.f.WriteAt(record, q.w); err != nil {
+		return err
+	}
+	q.w += int64(len(record))
+	q.n++
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// peek reads the oldest record without removing it.
+func (q *spillQueue) peek() ([]byte, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.n == 0 {
+		return nil, false, nil
+	}
+
+	var size [4]byte
+	if _, err := q.f.ReadAt(size[:], q.r); err != nil {
+		return nil, false, err
+	}
+	data := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err := q.f.ReadAt(data, q.r+4); err != nil {
+		return nil, false, err
+	}
+
+	return data, true, nil
+}
+
+// pop removes the oldest record, the file is truncated once the queue is drained.
+func (q *spillQueue) pop() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var size [4]byte
+	if _, err := q.f.ReadAt(size[:], q.r); err != nil {
+		return err
+	}
+	q.r += 4 + int64(binary.BigEndian.Uint32(size[:]))
+	q.n--
+
+	if q.n == 0 {
+		q.r, q.w = 0, 0
+		return q.f.Truncate(0)
+	}
+
+	return nil
+}
+
+// close removes the file of an empty queue. The file of a queue still holding events is kept,
+// close returns its name and the number of events, each a 4 bytes big endian length and the event
+// encoded by the codec of the bus.
+func (q *spillQueue) close() (string, int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	name := q.f.Name()
+	if err := q.f.Close(); err != nil {
+		return name, q.n, err
+	}
+	if q.n > 0 {
+		return name, q.n, nil
+	}
+
+	return "", 0, os.Remove(name)
+}
@@ -0,0 +1,128 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fullQueue returns a bus with a queue of one, whose handler is busy with o1 while o2 waits in the queue.
+func fullQueue(t *testing.T, options ...Option) (*EventBus, *recorder) {
+	t.Helper()
+	b := newBus(t, append([]Option{WithQueueSize(1)}, options...)...)
+	r := &recorder{gate: make(chan struct{}), started: make(chan string, 10)}
+	register(t, b, context.Background(), r)
+
+	publish(t, b, "o1")
+	<-r.started
+	publish(t, b, "o2")
+	return b, r
+}
+
+func TestBackpressure(t *testing.T) {
+	tests := []struct {
+		policy   Backpressure
+		err      error
+		handled  []string
+		want     TopicStats
+		released TopicStats
+	}{
+		{Drop, nil, []string{"o1", "o2"},
+			TopicStats{Queued: 1, Pending: 2, Dropped: 1}, TopicStats{Dropped: 1}},
+		{Fail, ErrQueueFull, []string{"o1", "o2"},
+			TopicStats{Queued: 1, Pending: 2, Rejected: 1}, TopicStats{Rejected: 1}},
+		{DropOldest, nil, []string{"o1", "o3"},
+			TopicStats{Queued: 1, Pending: 2, Dropped: 1}, TopicStats{Dropped: 1}},
+		{Block, context.DeadlineExceeded, []string{"o1", "o2"},
+			TopicStats{Queued: 1, Pending: 2, Rejected: 1}, TopicStats{Rejected: 1}},
+		{Spill, nil, []string{"o1", "o2", "o3"},
+			TopicStats{Queued: 1, Spilled: 1, Pending: 3}, TopicStats{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			b, r := fullQueue(t, WithBackpressure(tt.policy))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			if err := b.HandleEvent(ctx, event("o3")); !errors.Is(err, tt.err) {
+				t.Fatalf("publish to a full queue: %v, want %v", err, tt.err)
+			}
+			if st := b.Stats()["Created"]; st != tt.want {
+				t.Errorf("stats %+v, want %+v", st, tt.want)
+			}
+
+			close(r.gate)
+			drain(t, b)
+			if got := r.handled(); !equal(got, tt.handled) {
+				t.Errorf("handled %v, want %v", got, tt.handled)
+			}
+			// the pump removes a spilled event from the file once it is queued, maybe after it is handled
+			waitFor(t, func() bool { return b.Stats()["Created"] == tt.released })
+		})
+	}
+}
+
+func TestBlockWaitsForRoom(t *testing.T) {
+	b, r := fullQueue(t, WithBackpressure(Block))
+
+	published := make(chan error)
+	go func() {
+		published <- b.HandleEvent(context.Background(), event("o3"))
+	}()
+	select {
+	case err := <-published:
+		t.Fatalf("published to a full queue: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(r.gate)
+	if err := <-published; err != nil {
+		t.Fatal(err)
+	}
+	drain(t, b)
+	if got := r.handled(); !equal(got, []string{"o1", "o2", "o3"}) {
+		t.Errorf("handled %v", got)
+	}
+}
+
+func TestSpillKeepsOrder(t *testing.T) {
+	b, r := fullQueue(t, WithBackpressure(Spill))
+	publish(t, b, "o3", "o4", "o5")
+	if st := b.Stats()["Created"]; st.Spilled != 3 {
+		t.Fatalf("spilled %d events, want 3", st.Spilled)
+	}
+
+	// spilled events stay behind the ones spilled before them
+	close(r.gate)
+	publish(t, b, "o6")
+	drain(t, b)
+	if got := r.handled(); !equal(got, []string{"o1", "o2", "o3", "o4", "o5", "o6"}) {
+		t.Errorf("handled %v", got)
+	}
+}
+
+func TestTopicBackpressure(t *testing.T) {
+	b, r := fullQueue(t, WithTopicBackpressure("Created", Fail))
+	defer close(r.gate)
+
+	if err := b.HandleEvent(context.Background(), event("o3")); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("publish with the Fail policy of the topic: %v", err)
+	}
+}
+
+func TestDrainWaitsForHandlers(t *testing.T) {
+	b, r := fullQueue(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := b.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("drained with a busy handler: %v", err)
+	}
+
+	close(r.gate)
+	drain(t, b)
+	if n := b.Pending(); n != 0 {
+		t.Errorf("%d events pending once drained", n)
+	}
+}
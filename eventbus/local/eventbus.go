@@ -4,9 +4,12 @@ import (
 	"context"
 	"errors"
 	"evol"
+	"evol/codec"
+	"evol/deadletter"
 	"fmt"
-	"log"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -21,6 +24,17 @@ type EventBus struct {
 	cancel context.CancelFunc
 	codec  evol.EventCodec
 	wg     sync.WaitGroup
+
+	queueSize     int
+	backpressure  Backpressure
+	topicPressure map[evol.Topic]Backpressure
+	spillDir      string
+
+	handlers    *deadletter.Handlers
+	deadLetters evol.DeadLetterStore
+	retry       evol.RetryPolicy
+
+	logger evol.Logger
 }
 
 // NewEventBus creates a EventBus.
@@ -31,6 +45,14 @@ func NewEventBus(options ...Option) *EventBus {
 		group:  NewGroup(),
 		ctx:    ctx,
 		cancel: cancel,
+		codec:  &codec.JsonEventCodec{},
+
+		queueSize:     DefaultQueueSize,
+		backpressure:  Drop,
+		topicPressure: map[evol.Topic]Backpressure{},
+		spillDir:      os.TempDir(),
+
+		handlers: deadletter.NewHandlers(),
 	}
 
 	// Apply configuration options.
@@ -53,6 +75,62 @@ func WithGroup(g *Group) Option {
 	}
 }
 
+// WithCodec uses the specified codec for encoding events.
+func WithCodec(codec evol.EventCodec) Option {
+	return func(b *EventBus) {
+		b.codec = codec
+	}
+}
+
+// WithQueueSize sets the capacity of each handler queue.
+func WithQueueSize(size int) Option {
+	return func(b *EventBus) {
+		b.queueSize = size
+	}
+}
+
+// WithBackpressure sets the policy applied when a handler queue is full, Drop by default.
+func WithBackpressure(p Backpressure) Option {
+	return func(b *EventBus) {
+		b.backpressure = p
+	}
+}
+
+// WithTopicBackpressure overrides the bus policy for the handler queues of one topic.
+func WithTopicBackpressure(topic evol.Topic, p Backpressure) Option {
+	return func(b *EventBus) {
+		b.topicPressure[topic] = p
+	}
+}
+
+// WithSpillDir sets the directory of the files used by the Spill policy.
+func WithSpillDir(dir string) Option {
+	return func(b *EventBus) {
+		b.spillDir = dir
+	}
+}
+
+// WithDeadLetterStore keeps the events handlers failed to process in store, instead of only logging them.
+func WithDeadLetterStore(store evol.DeadLetterStore) Option {
+	return func(b *EventBus) {
+		b.deadLetters = store
+	}
+}
+
+// WithRetryPolicy sets the retry policy of handlers registered without their own, a single attempt by default.
+func WithRetryPolicy(p evol.RetryPolicy) Option {
+	return func(b *EventBus) {
+		b.retry = p
+	}
+}
+
+// WithLogger sets the logger of the bus, evol.GetLogger() by default.
+func WithLogger(l evol.Logger) Option {
+	return func(b *EventBus) {
+		b.logger = l
+	}
+}
+
 // HandleEvent implements the HandleEvent method of the codec.EventHandler interface.
 func (b *EventBus) HandleEvent(ctx context.Context, event evol.Event) error {
 	data, err := b.codec.MarshalEvent(ctx, event)
@@ -60,106 +138,527 @@ func (b *EventBus) HandleEvent(ctx context.Context, event evol.Event) error {
 		return fmt.Errorf("could not marshal codec: %w", err)
 	}
 
-	return b.group.publish(ctx, string(event.Topic()), data)
+	dropped, err := b.group.publish(ctx, string(event.Topic()), data)
+	if dropped > 0 {
+		b.log().Warn("handler queue full, event dropped", append(evol.EventFields(event), "queues", dropped)...)
+	}
+	if err != nil {
+		b.log().Warn("could not queue event", append(evol.EventFields(event), evol.LogKeyError, err)...)
+		return err
+	}
+
+	return nil
 }
 
 // RegisterHandler implements the RegisterHandler method of the codec.EventBus interface.
-func (b *EventBus) RegisterHandler(ctx context.Context, topic evol.Topic, h evol.EventHandler) error {
+// Every handler receives all events of the topic, unless it joins a consumer group with
+// evol.InGroup, in which case the handlers of that group share the events between them.
+// The handler stops when ctx is done and leaves its queue, the events queued for it are left to the other
+// handlers of its group. The queue is removed with its last handler, the events it holds are lost.
+func (b *EventBus) RegisterHandler(ctx context.Context, topic evol.Topic, h evol.EventHandler, options ...evol.HandlerOption) error {
 
 	if h == nil {
 		return errors.New("missing codec handler")
 	}
 
-	ch := b.group.channel(string(topic))
+	cfg := evol.NewHandlerConfig(options...)
+	name := b.handlers.Add(topic, cfg.HandlerName(h), h)
+
+	policy, ok := b.topicPressure[topic]
+	if !ok {
+		policy = b.backpressure
+	}
+	sub, created, err := b.group.channel(string(topic), cfg.Group, func() (*subscription, error) {
+		return b.newSubscription(cfg.Group, policy)
+	})
+	if err != nil {
+		return fmt.Errorf("could not create handler queue: %w", err)
+	}
+
+	if created && sub.spill != nil {
+		b.wg.Add(1)
+		go b.pump(sub)
+	} else if created {
+		close(sub.pumped)
+	}
 
 	b.wg.Add(1)
 
 	// Handle until context is cancelled.
-	go b.handle(ctx, topic, h, ch)
+	go b.handle(ctx, topic, name, h, cfg.RetryPolicyOr(b.retry), sub)
 
 	return nil
 }
 
+// Redeliver hands a dead letter to the handler that failed it, and removes it once handled.
+func (b *EventBus) Redeliver(ctx context.Context, id string) error {
+	if b.deadLetters == nil {
+		return errors.New("[evol] local event bus has no dead letter store")
+	}
+
+	dl, err := b.deadLetters.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	h, err := b.handlers.Get(dl)
+	if err != nil {
+		return err
+	}
+
+	return deadletter.Redeliver(ctx, b.deadLetters, id, h)
+}
+
+// Stats returns the queue counters of every topic with registered handlers.
+func (b *EventBus) Stats() map[evol.Topic]TopicStats {
+	return b.group.stats()
+}
+
+// Pending returns the number of events queued, spilled or being handled, over all topics.
+func (b *EventBus) Pending() int {
+	n := 0
+	for _, st := range b.group.stats() {
+		n += st.Pending
+	}
+	return n
+}
+
+// Drain waits until every published event is handled, or ctx is done.
+// Handlers may publish more events while draining, those are waited for too.
+func (b *EventBus) Drain(ctx context.Context) error {
+	for {
+		// taken before counting, a queue emptied meanwhile closes it
+		emptied := b.group.emptied()
+		if b.Pending() == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("[evol] local event bus drained with %d events undelivered: %w", b.Pending(), ctx.Err())
+		case <-emptied:
+		}
+	}
+}
+
+// Close stops the handlers, the events they did not handle yet are logged as undelivered and lost,
+// but for the spilled ones, whose spill file is kept. Drain first to handle them.
 func (b *EventBus) Close() error {
 	b.cancel()
 	b.wg.Wait()
-	b.group.close()
+	b.group.close(b.log())
 
 	return nil
 }
 
-// Handles all events coming in on the channel.
-func (b *EventBus) handle(ctx context.Context, topic evol.Topic, h evol.EventHandler, ch <-chan []byte) {
+func (b *EventBus) log() evol.Logger {
+	return evol.LoggerOr(b.logger)
+}
+
+// Handles all events coming in on the queue, until ctx or the bus is done, then leaves the queue.
+func (b *EventBus) handle(ctx context.Context, topic evol.Topic, name string, h evol.EventHandler, retry evol.RetryPolicy, sub *subscription) {
 	defer b.wg.Done()
+	defer b.group.leave(string(topic), sub, b.log())
 
 	for {
 		select {
-		case data := <-ch:
-
-			time.Sleep(time.Millisecond)
-
+		case data := <-sub.ch:
 			e, err := b.codec.UnmarshalEvent(ctx, data)
 			if err != nil {
-				err = fmt.Errorf("could not unmarshal e: %w", err)
-				return
+				b.log().Error("could not unmarshal event", evol.LogKeyTopic, topic, evol.LogKeyHandler, name, evol.LogKeyError, err)
+			} else {
+				b.handleWithRetry(ctx, name, h, retry, e)
 			}
+			sub.done()
+		case <-ctx.Done():
+			return
+		case <-b.ctx.Done():
+			return
+		}
+	}
+}
 
-			if err := h.HandleEvent(ctx, e); err != nil {
-				_ = fmt.Errorf("could not handle e (%s): %s", e, err.Error())
+// handleWithRetry calls the handler until it succeeds or the retry policy gives up.
+func (b *EventBus) handleWithRetry(ctx context.Context, name string, h evol.EventHandler, retry evol.RetryPolicy, e evol.Event) {
+	// handlers see the metadata of the event, commands they send carry it on
+	ctx = evol.ContextWithMetadata(ctx, e.Metadata())
 
-			}
+	for attempt := 1; ; attempt++ {
+		err := h.HandleEvent(evol.ContextWithAttempt(ctx, attempt), e)
+		if err == nil {
+			return
+		}
+
+		if !retry.ShouldRetry(attempt, err) {
+			b.deadLetter(ctx, name, e, err, attempt)
+			return
+		}
+
+		// the handler may be unregistered, or the bus closed, while waiting
+		timer := time.NewTimer(retry.Backoff(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			b.deadLetter(ctx, name, e, err, attempt)
+			return
 		case <-b.ctx.Done():
+			timer.Stop()
+			b.deadLetter(ctx, name, e, err, attempt)
+			return
+		}
+	}
+}
+
+// deadLetter records an event the handler failed to process.
+func (b *EventBus) deadLetter(ctx context.Context, name string, e evol.Event, err error, attempts int) {
+	kv := append(evol.EventFields(e), evol.LogKeyHandler, name, "attempts", attempts, evol.LogKeyError, err)
+	if b.deadLetters == nil {
+		b.log().Error("handler could not handle event", kv...)
+		return
+	}
+
+	b.log().Warn("handler gave up on event, storing dead letter", kv...)
+	if err := b.deadLetters.Add(ctx, deadletter.New(e, name, err, attempts)); err != nil {
+		b.log().Error("could not store dead letter", append(evol.EventFields(e), evol.LogKeyHandler, name, evol.LogKeyError, err)...)
+	}
+}
+
+func (b *EventBus) newSubscription(group string, policy Backpressure) (*subscription, error) {
+	var spill *spillQueue
+	if policy == Spill {
+		var err error
+		if spill, err = newSpillQueue(b.spillDir); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(b.ctx)
+	return &subscription{
+		group:  group,
+		ch:     make(chan []byte, b.queueSize),
+		policy: policy,
+		spill:  spill,
+		closed: ctx.Done(),
+		cancel: cancel,
+		pumped: make(chan struct{}),
+	}, nil
+}
+
+// pump moves spilled events back into the queue as soon as there is room, until the queue is closed.
+func (b *EventBus) pump(sub *subscription) {
+	defer b.wg.Done()
+	defer close(sub.pumped)
+
+	for {
+		data, ok, err := sub.spill.peek()
+		if err != nil {
+			b.log().Error("could not read spilled event", evol.LogKeyError, err)
 			return
 		}
+
+		if !ok {
+			select {
+			case <-sub.spill.notify:
+				continue
+			case <-sub.closed:
+				return
+			}
+		}
+
+		select {
+		case sub.ch <- data:
+			if err := sub.spill.pop(); err != nil {
+				b.log().Error("could not remove spilled event", evol.LogKeyError, err)
+				return
+			}
+		case <-sub.closed:
+			return
+		}
+	}
+}
+
+// subscription is a queue feeding one handler, or all handlers of a consumer group
+type subscription struct {
+	// counters first, 64-bit atomic operations need 64-bit alignment
+	dropped  uint64
+	rejected uint64
+	// events queued, spilled or being handled
+	pending int64
+
+	group  string
+	ch     chan []byte
+	policy Backpressure
+	spill  *spillQueue
+
+	// members is the number of handlers reading the queue, guarded by the lock of the Group
+	members int
+	// closed once the last member left or the bus closed, cancel closes it
+	closed <-chan struct{}
+	cancel context.CancelFunc
+	// pumped is closed once the spilled events are no longer pumped
+	pumped chan struct{}
+	// emptied is called when no event is pending anymore
+	emptied func()
+}
+
+// done counts an event as handled.
+func (s *subscription) done() {
+	if atomic.AddInt64(&s.pending, -1) == 0 {
+		s.emptied()
+	}
+}
+
+// errDropped tells the Drop policy discarded the event
+var errDropped = errors.New("dropped")
+
+// enqueue adds an event to the queue, applying the backpressure policy when it is full.
+func (s *subscription) enqueue(ctx context.Context, b []byte) error {
+	atomic.AddInt64(&s.pending, 1)
+	if err := s.push(ctx, b); err != nil {
+		s.done()
+		return err
+	}
+	return nil
+}
+
+func (s *subscription) push(ctx context.Context, b []byte) error {
+	if s.policy == Spill {
+		return s.spill.offer(s.ch, b)
+	}
+
+	select {
+	case s.ch <- b:
+		return nil
+	default:
+	}
+
+	switch s.policy {
+	case Drop:
+		atomic.AddUint64(&s.dropped, 1)
+		return errDropped
+	case Fail:
+		atomic.AddUint64(&s.rejected, 1)
+		return ErrQueueFull
+	case DropOldest:
+		for {
+			select {
+			case <-s.ch:
+				atomic.AddUint64(&s.dropped, 1)
+				s.done()
+			default:
+			}
+			select {
+			case s.ch <- b:
+				return nil
+			default:
+			}
+		}
+	default:
+		select {
+		case s.ch <- b:
+			return nil
+		case <-ctx.Done():
+			atomic.AddUint64(&s.rejected, 1)
+			return ctx.Err()
+		case <-s.closed:
+			atomic.AddUint64(&s.rejected, 1)
+			return ErrBusClosed
+		}
+	}
+}
+
+func (s *subscription) stats() TopicStats {
+	st := TopicStats{
+		Queued:   len(s.ch),
+		Pending:  int(atomic.LoadInt64(&s.pending)),
+		Dropped:  atomic.LoadUint64(&s.dropped),
+		Rejected: atomic.LoadUint64(&s.rejected),
+	}
+	if s.spill != nil {
+		st.Spilled = s.spill.len()
 	}
+	return st
 }
 
-//Group publish events separate by topic
+//Group publish events separate by topic, each event is copied to every subscription of its topic
 type Group struct {
-	bus   map[string]chan []byte
+	bus   map[string][]*subscription
 	busMu sync.RWMutex
+
+	// empty is closed, and replaced, each time a queue has no event pending anymore
+	empty   chan struct{}
+	emptyMu sync.Mutex
 }
 
 func NewGroup() *Group {
 	return &Group{
-		bus: map[string]chan []byte{},
+		bus:   map[string][]*subscription{},
+		empty: make(chan struct{}),
 	}
 }
 
-func (g *Group) channel(id string) <-chan []byte {
+// channel returns the queue of a consumer group on the topic,
+// an empty group always gets a new queue of its own made by create.
+func (g *Group) channel(id string, group string, create func() (*subscription, error)) (*subscription, bool, error) {
 	g.busMu.Lock()
 	defer g.busMu.Unlock()
 
-	if ch, ok := g.bus[id]; ok {
-		return ch
+	if g.bus == nil {
+		return nil, false, ErrBusClosed
+	}
+
+	if group != "" {
+		for _, sub := range g.bus[id] {
+			if sub.group == group {
+				sub.members++
+				return sub, false, nil
+			}
+		}
 	}
 
-	ch := make(chan []byte, DefaultQueueSize)
-	g.bus[id] = ch
+	sub, err := create()
+	if err != nil {
+		return nil, false, err
+	}
+	sub.members = 1
+	sub.emptied = g.signalEmpty
+	g.bus[id] = append(g.bus[id], sub)
+
+	return sub, true, nil
+}
+
+// leave removes a handler from its queue, the queue of the last one is removed from the topic and closed.
+// The events left in it are logged as undelivered, but for the spilled ones, whose spill file is kept.
+func (g *Group) leave(id string, sub *subscription, logger evol.Logger) {
+	g.busMu.Lock()
+	sub.members--
+	if sub.members > 0 {
+		g.busMu.Unlock()
+		return
+	}
+	if g.bus != nil {
+		subs := g.bus[id]
+		for i, s := range subs {
+			if s == sub {
+				subs = append(subs[:i:i], subs[i+1:]...)
+				break
+			}
+		}
+		if len(subs) == 0 {
+			delete(g.bus, id)
+		} else {
+			g.bus[id] = subs
+		}
+	}
+	g.busMu.Unlock()
+
+	// publishers that listed the queue before may still send to it, blocked ones give up
+	sub.cancel()
+	<-sub.pumped
+	if st := sub.stats(); st.Queued > 0 {
+		logger.Warn("handler queue closed with undelivered events", evol.LogKeyTopic, id, "undelivered", st.Queued)
+	}
+	closeSpill(sub, logger)
+	g.signalEmpty()
+}
+
+// emptied returns a channel closed the next time a queue has no event pending anymore.
+func (g *Group) emptied() <-chan struct{} {
+	g.emptyMu.Lock()
+	defer g.emptyMu.Unlock()
+
+	return g.empty
+}
+
+func (g *Group) signalEmpty() {
+	g.emptyMu.Lock()
+	defer g.emptyMu.Unlock()
 
-	return ch
+	close(g.empty)
+	g.empty = make(chan struct{})
 }
 
-func (g *Group) publish(ctx context.Context, topic string, b []byte) error {
+// publish copies the event to every queue of the topic, a topic without handlers drops the event.
+// It returns the number of queues the Drop policy discarded the event from.
+func (g *Group) publish(ctx context.Context, topic string, b []byte) (int, error) {
+	// queues blocking the publisher must not block the handlers publishing, Close nor RegisterHandler
 	g.busMu.RLock()
-	defer g.busMu.RUnlock()
+	if g.bus == nil {
+		g.busMu.RUnlock()
+		return 0, ErrBusClosed
+	}
+	subs := append([]*subscription(nil), g.bus[topic]...)
+	g.busMu.RUnlock()
+
+	dropped := 0
+	var errs []error
+	for _, sub := range subs {
+		err := sub.enqueue(ctx, b)
+		switch {
+		case errors.Is(err, errDropped):
+			dropped++
+		case err != nil:
+			errs = append(errs, fmt.Errorf("%s policy: %w", sub.policy, err))
+		}
+	}
 
-	ch := g.bus[topic]
+	if len(errs) > 0 {
+		return dropped, fmt.Errorf("could not publish event to %d of %d handler queues: %w", len(errs), len(subs), errs[0])
+	}
 
-	select {
-	case ch <- b:
-	default:
-		log.Printf("[evol] publish queue full in local codec bus")
+	return dropped, nil
+}
+
+func (g *Group) stats() map[evol.Topic]TopicStats {
+	g.busMu.RLock()
+	defer g.busMu.RUnlock()
+
+	res := make(map[evol.Topic]TopicStats, len(g.bus))
+	for topic, subs := range g.bus {
+		var total TopicStats
+		for _, sub := range subs {
+			st := sub.stats()
+			total.Queued += st.Queued
+			total.Spilled += st.Spilled
+			total.Pending += st.Pending
+			total.Dropped += st.Dropped
+			total.Rejected += st.Rejected
+		}
+		res[evol.Topic(topic)] = total
 	}
 
-	return nil
+	return res
 }
 
-// Closes all the open channels after handling is done.
-func (g *Group) close() {
-	for _, ch := range g.bus {
-		close(ch)
+// close forgets the queues once their handlers left, the queues they left closed them already.
+// The channels are not closed, a publisher that read them before may still be sending.
+func (g *Group) close(logger evol.Logger) {
+	g.busMu.Lock()
+	defer g.busMu.Unlock()
+
+	for topic, subs := range g.bus {
+		for _, sub := range subs {
+			sub.cancel()
+			<-sub.pumped
+			if st := sub.stats(); st.Queued > 0 {
+				logger.Warn("event bus closed with undelivered events", evol.LogKeyTopic, topic, "undelivered", st.Queued)
+			}
+			closeSpill(sub, logger)
+		}
 	}
 
 	g.bus = nil
 }
+
+// closeSpill closes the spill file of a queue, the file still holding events is kept.
+func closeSpill(sub *subscription, logger evol.Logger) {
+	if sub.spill == nil {
+		return
+	}
+	name, n, err := sub.spill.close()
+	if err != nil {
+		logger.Warn("could not close spill file", "file", name, evol.LogKeyError, err)
+	} else if n > 0 {
+		logger.Warn("handler queue closed with spilled events, spill file kept", "file", name, "undelivered", n)
+	}
+}
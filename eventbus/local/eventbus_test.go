@@ -0,0 +1,248 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"evol"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder records the aggregate identities of the events it handles, in order
+type recorder struct {
+	mu  sync.Mutex
+	ids []string
+	// gate, when set, holds each event until it is received from
+	gate chan struct{}
+	// started receives the identity of each event as its handling starts, when set
+	started chan string
+}
+
+func (r *recorder) HandleEvent(ctx context.Context, e evol.Event) error {
+	if r.started != nil {
+		r.started <- e.AggregateIdentity()
+	}
+	if r.gate != nil {
+		<-r.gate
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ids = append(r.ids, e.AggregateIdentity())
+	return nil
+}
+
+func (r *recorder) handled() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.ids...)
+}
+
+func event(id string) evol.Event {
+	return evol.NewEvent("Created", nil, time.Now(), evol.ForAggregate("Order", id))
+}
+
+func newBus(t *testing.T, options ...Option) *EventBus {
+	t.Helper()
+	b := NewEventBus(append([]Option{WithLogger(evol.NopLogger()), WithSpillDir(t.TempDir())}, options...)...)
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func publish(t *testing.T, b *EventBus, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		if err := b.HandleEvent(context.Background(), event(id)); err != nil {
+			t.Fatalf("publish %s: %v", id, err)
+		}
+	}
+}
+
+func drain(t *testing.T, b *EventBus) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := b.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func register(t *testing.T, b *EventBus, ctx context.Context, h evol.EventHandler, options ...evol.HandlerOption) {
+	t.Helper()
+	if err := b.RegisterHandler(ctx, "Created", h, options...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEveryHandlerReceivesEveryEvent(t *testing.T) {
+	b := newBus(t)
+	ctx := context.Background()
+	a, c := &recorder{}, &recorder{}
+	g1, g2 := &recorder{}, &recorder{}
+	register(t, b, ctx, a, evol.WithHandlerName("a"))
+	register(t, b, ctx, c, evol.WithHandlerName("c"))
+	register(t, b, ctx, g1, evol.WithHandlerName("g1"), evol.InGroup("workers"))
+	register(t, b, ctx, g2, evol.WithHandlerName("g2"), evol.InGroup("workers"))
+
+	publish(t, b, "o1", "o2", "o3", "o4")
+	drain(t, b)
+
+	want := []string{"o1", "o2", "o3", "o4"}
+	for _, r := range []*recorder{a, c} {
+		if got := r.handled(); !equal(got, want) {
+			t.Errorf("handled %v, want %v", got, want)
+		}
+	}
+	shared := append(g1.handled(), g2.handled()...)
+	sort.Strings(shared)
+	if !equal(shared, want) {
+		t.Errorf("group handled %v, want each event once", shared)
+	}
+}
+
+func TestHandlerLeavesQueueWhenContextEnds(t *testing.T) {
+	b := newBus(t, WithQueueSize(1), WithBackpressure(Block))
+	ctx, cancel := context.WithCancel(context.Background())
+	register(t, b, ctx, &recorder{})
+	cancel()
+	waitFor(t, func() bool { return len(b.Stats()) == 0 })
+
+	// nothing reads the topic anymore, publishing neither queues nor blocks
+	for _, id := range []string{"o1", "o2", "o3"} {
+		pctx, pcancel := context.WithTimeout(context.Background(), time.Second)
+		err := b.HandleEvent(pctx, event(id))
+		pcancel()
+		if err != nil {
+			t.Fatalf("publish %s: %v", id, err)
+		}
+	}
+	if n := b.Pending(); n != 0 {
+		t.Fatalf("%d events pending", n)
+	}
+	drain(t, b)
+}
+
+func TestGroupQueueClosedWithLastMember(t *testing.T) {
+	b := newBus(t)
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	first, second := &recorder{}, &recorder{}
+	register(t, b, ctx1, first, evol.WithHandlerName("first"), evol.InGroup("workers"))
+	register(t, b, ctx2, second, evol.WithHandlerName("second"), evol.InGroup("workers"))
+
+	cancel1()
+	waitFor(t, func() bool { return members(b, "Created") == 1 })
+	publish(t, b, "o1", "o2")
+	drain(t, b)
+	if got := second.handled(); !equal(got, []string{"o1", "o2"}) {
+		t.Errorf("remaining member handled %v", got)
+	}
+	if len(b.Stats()) != 1 {
+		t.Fatal("queue closed while a member is left")
+	}
+
+	cancel2()
+	waitFor(t, func() bool { return len(b.Stats()) == 0 })
+
+	// a new member gets a new queue
+	third := &recorder{}
+	register(t, b, context.Background(), third, evol.WithHandlerName("third"), evol.InGroup("workers"))
+	publish(t, b, "o3")
+	drain(t, b)
+	if got := third.handled(); !equal(got, []string{"o3"}) {
+		t.Errorf("new member handled %v", got)
+	}
+}
+
+func TestRetryStopsWhenHandlerUnregistered(t *testing.T) {
+	dead := &deadLetters{}
+	b := newBus(t, WithDeadLetterStore(dead))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	attempts := make(chan int, 10)
+	h := evol.EventHandlerFunc(func(ctx context.Context, e evol.Event) error {
+		attempts <- evol.AttemptFromContext(ctx)
+		return errors.New("boom")
+	})
+	register(t, b, ctx, h, evol.WithHandlerName("failing"), evol.WithRetryPolicy(evol.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour}))
+	publish(t, b, "o1")
+
+	<-attempts
+	cancel()
+	waitFor(t, func() bool { return dead.len() == 1 })
+	if len(attempts) != 0 {
+		t.Error("retried after the handler was unregistered")
+	}
+}
+
+func TestRetryWithBackoff(t *testing.T) {
+	b := newBus(t)
+	var n int
+	h := evol.EventHandlerFunc(func(ctx context.Context, e evol.Event) error {
+		if n++; n < 3 {
+			return errors.New("boom")
+		}
+		return nil
+	})
+	register(t, b, context.Background(), h, evol.WithRetryPolicy(evol.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}))
+	publish(t, b, "o1")
+	drain(t, b)
+	if n != 3 {
+		t.Errorf("%d attempts, want 3", n)
+	}
+}
+
+// deadLetters counts the dead letters added
+type deadLetters struct {
+	evol.DeadLetterStore
+	mu sync.Mutex
+	n  int
+}
+
+func (d *deadLetters) Add(ctx context.Context, dl *evol.DeadLetter) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.n++
+	return nil
+}
+
+func (d *deadLetters) len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.n
+}
+
+// members returns the number of handlers reading the queues of topic
+func members(b *EventBus, topic string) int {
+	b.group.busMu.RLock()
+	defer b.group.busMu.RUnlock()
+	n := 0
+	for _, sub := range b.group.bus[topic] {
+		n += sub.members
+	}
+	return n
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
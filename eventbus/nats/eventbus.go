@@ -5,13 +5,17 @@ import (
 	"errors"
 	"evol"
 	"evol/codec"
+	"evol/deadletter"
 	"fmt"
 	"github.com/nats-io/nats.go"
-	"log"
+	"strings"
 	"sync"
 	"time"
 )
 
+// defaultTenant is the subject token of the events of the default tenant
+const defaultTenant = "_"
+
 type EventBus struct {
 	appID      string
 	streamName string
@@ -25,6 +29,16 @@ type EventBus struct {
 	cancel context.CancelFunc
 	wg     sync.WaitGroup
 	codec  evol.EventCodec
+
+	retry       evol.RetryPolicy
+	ackWait     time.Duration
+	handlers    *deadletter.Handlers
+	deadLetters evol.DeadLetterStore
+
+	logger evol.Logger
+
+	tenantSubjects bool
+	tenant         string
 }
 
 // NewEventBus creates an EventBus, with optional settings.
@@ -39,6 +53,10 @@ func NewEventBus(url, appID string, options ...Option) (*EventBus, error) {
 		cctx:   ctx,
 		cancel: cancel,
 		codec:  &codec.JsonEventCodec{},
+
+		retry:    evol.RetryPolicy{MaxAttempts: 10},
+		ackWait:  60 * time.Second,
+		handlers: deadletter.NewHandlers(),
 	}
 
 	// Apply configuration options.
@@ -63,12 +81,26 @@ func NewEventBus(url, appID string, options ...Option) (*EventBus, error) {
 		return nil, fmt.Errorf("could not create Jetstream context: %w", err)
 	}
 
+	subjects := b.streamName + ".*.*"
+	if b.tenantSubjects {
+		subjects = b.streamName + ".*.*.*"
+	}
+
 	if b.stream, err = b.js.StreamInfo(b.streamName); err == nil {
+		if contains(b.stream.Config.Subjects, subjects) {
+			return b, nil
+		}
+
+		// a stream created before tenant subjects, or without them
+		cfg := b.stream.Config
+		cfg.Subjects = append(cfg.Subjects, subjects)
+		if b.stream, err = b.js.UpdateStream(&cfg); err != nil {
+			return nil, fmt.Errorf("could not add subjects to NATS stream: %w", err)
+		}
 		return b, nil
 	}
 
 	// Create the stream, which stores messages received on the subject.
-	subjects := b.streamName + ".*.*"
 	cfg := &nats.StreamConfig{
 		Name:     b.streamName,
 		Subjects: []string{subjects},
@@ -103,21 +135,174 @@ func WithNATSOptions(opts ...nats.Option) Option {
 	}
 }
 
+// WithDeadLetterStore keeps the events a handler still failed on the last delivery in store,
+// instead of dropping them when the consumer gives up.
+func WithDeadLetterStore(store evol.DeadLetterStore) Option {
+	return func(b *EventBus) error {
+		b.deadLetters = store
+
+		return nil
+	}
+}
+
+// WithRetryPolicy sets the retry policy of handlers registered without their own,
+// 10 immediate redeliveries by default. Retries are delayed with NakWithDelay.
+func WithRetryPolicy(p evol.RetryPolicy) Option {
+	return func(b *EventBus) error {
+		b.retry = p
+
+		return nil
+	}
+}
+
+// WithAckWait sets how long the server waits for handlers registered without their own AckWait, 60s by default.
+func WithAckWait(d time.Duration) Option {
+	return func(b *EventBus) error {
+		b.ackWait = d
+
+		return nil
+	}
+}
+
+// WithLogger sets the logger of the bus, evol.GetLogger() by default.
+func WithLogger(l evol.Logger) Option {
+	return func(b *EventBus) error {
+		b.logger = l
+
+		return nil
+	}
+}
+
+// WithTenantSubjects publishes the events on <app>_events.<tenant>.<aggregate type>.<topic>,
+// "_" standing for the default tenant, so the events of a tenant can be consumed apart.
+// Handlers receive the events of all tenants. Durable consumers created without it keep their
+// subject, give them a new evol.InGroup or evol.WithHandlerName name.
+func WithTenantSubjects() Option {
+	return func(b *EventBus) error {
+		b.tenantSubjects = true
+
+		return nil
+	}
+}
+
+// WithTenant scopes the bus to a tenant with tenant subjects: handlers only receive the events of the tenant,
+// and publishing an event of another tenant fails with evol.ErrTenantMismatch.
+func WithTenant(tenant string) Option {
+	return func(b *EventBus) error {
+		if err := checkTenant(tenant); err != nil {
+			return err
+		}
+		b.tenantSubjects = true
+		b.tenant = tenant
+
+		return nil
+	}
+}
+
+// checkTenant rejects the tenants which can not be a subject token
+func checkTenant(tenant string) error {
+	if tenant == "" || tenant == defaultTenant || strings.ContainsAny(tenant, ".*> \t\r\n") {
+		return fmt.Errorf("[evol] invalid tenant %q for a NATS subject", tenant)
+	}
+	return nil
+}
+
+// consumerName names the durable consumer of a handler: <app>_<name>_<topic>, or <app>_<group>_<topic>
+// for a group, and <app>_<topic> for a legacy consumer, followed by _<tenant> for a tenant bus
+func (b *EventBus) consumerName(topic evol.Topic, name, group string, legacy bool) string {
+	parts := []string{b.appID}
+	switch {
+	case legacy:
+	case group != "":
+		parts = append(parts, group)
+	default:
+		// without group, every handler gets every event through a consumer of its own
+		parts = append(parts, name)
+	}
+	parts = append(parts, string(topic))
+	if b.tenant != "" {
+		parts = append(parts, b.tenant)
+	}
+
+	for i, p := range parts {
+		parts[i] = consumerToken(p)
+	}
+	return strings.Join(parts, "_")
+}
+
+// consumerToken makes a name usable in a durable consumer name, such as *saga.SagaManager
+func consumerToken(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func contains(subjects []string, subject string) bool {
+	for _, s := range subjects {
+		if s == subject {
+			return true
+		}
+	}
+	return false
+}
+
+// subject is where the event is published
+func (b *EventBus) subject(event evol.Event) (string, error) {
+	if !b.tenantSubjects {
+		return fmt.Sprintf("%s.%s.%s", b.streamName, event.AggregateType(), event.Topic()), nil
+	}
+
+	tenant := evol.EventTenantID(event)
+	if b.tenant != "" && tenant != b.tenant {
+		return "", fmt.Errorf("event of tenant %q on the bus of tenant %q: %w", tenant, b.tenant, evol.ErrTenantMismatch)
+	}
+	if tenant == "" {
+		tenant = defaultTenant
+	} else if err := checkTenant(tenant); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s.%s.%s.%s", b.streamName, tenant, event.AggregateType(), event.Topic()), nil
+}
+
 func (b *EventBus) HandleEvent(ctx context.Context, event evol.Event) error {
 	data, err := b.codec.MarshalEvent(ctx, event)
 	if err != nil {
 		return fmt.Errorf("could not marshal codec: %w", err)
 	}
 
-	subject := fmt.Sprintf("%s.%s.%s", b.streamName, event.AggregateType(), event.Topic())
-	if _, err := b.js.Publish(subject, data); err != nil {
+	subject, err := b.subject(event)
+	if err != nil {
+		return err
+	}
+	msg := nats.NewMsg(subject)
+	msg.Data = data
+	// metadata is also sent as headers, readable without decoding the event
+	for k, v := range event.Metadata() {
+		msg.Header.Set(k, v)
+	}
+
+	if _, err := b.js.PublishMsg(msg); err != nil {
 		return fmt.Errorf("could not publish codec: %w", err)
 	}
 
 	return nil
 }
 
-func (b *EventBus) RegisterHandler(ctx context.Context, topic evol.Topic, eh evol.EventHandler) error {
+// RegisterHandler subscribes eh with a durable consumer of its own, named after the handler name,
+// shared by the instances of the application. The name must be given with evol.WithHandlerName, and be
+// unique on the topic: the consumer of a handler must not depend on its type nor the registration order.
+// Handlers registered with evol.InGroup share a durable consumer per group instead, and compete for its events.
+// New consumers only receive events published after their creation, unless
+// a start position like DeliverAll is given.
+//
+// Earlier versions named the consumer of every handler <app>_<topic>: upgraded handlers get new consumers,
+// which skip the events published while they were down. Register them with LegacyConsumer to keep the old one.
+// The handler is subscribed until Close, whatever ctx: unsubscribing would delete its durable consumer.
+func (b *EventBus) RegisterHandler(ctx context.Context, topic evol.Topic, eh evol.EventHandler, options ...evol.HandlerOption) error {
 	if topic == "" {
 		return errors.New("missing codec topic")
 	}
@@ -126,17 +311,51 @@ func (b *EventBus) RegisterHandler(ctx context.Context, topic evol.Topic, eh evo
 		return errors.New("missing codec handler")
 	}
 
+	cfg := evol.NewHandlerConfig(options...)
+	sub := subscriptionOf(cfg)
+
+	// the handlers sharing a consumer only need a name for their dead letters
+	name := cfg.Name
+	switch {
+	case cfg.Group != "" || sub.legacy:
+		name = b.handlers.Add(topic, cfg.HandlerName(eh), eh)
+	case name == "":
+		return fmt.Errorf("[evol] handler %T on %s has no name for its durable consumer, register it with evol.WithHandlerName", eh, topic)
+	default:
+		if err := b.handlers.AddNamed(topic, name, eh); err != nil {
+			return err
+		}
+	}
+	retry := cfg.RetryPolicyOr(b.retry)
+
+	deliver := sub.deliver
+	if deliver == nil {
+		deliver = nats.DeliverNew()
+	}
+	ackWait := sub.ackWait
+	if ackWait <= 0 {
+		ackWait = b.ackWait
+	}
+	if sub.maxDeliver > 0 {
+		retry.MaxAttempts = sub.maxDeliver
+	}
+
 	// Create a consumer.
 	subject := fmt.Sprintf("%s.%s.%s", b.streamName, "*", topic)
-	consumerName := fmt.Sprintf("%s_%s", b.appID, topic)
+	consumerName := b.consumerName(topic, name, cfg.Group, sub.legacy)
+	if b.tenant != "" {
+		subject = fmt.Sprintf("%s.%s.%s.%s", b.streamName, b.tenant, "*", topic)
+	} else if b.tenantSubjects {
+		subject = fmt.Sprintf("%s.%s.%s.%s", b.streamName, "*", "*", topic)
+	}
 
-	sub, err := b.js.QueueSubscribe(subject, consumerName, b.handler(b.cctx, eh),
+	natsSub, err := b.js.QueueSubscribe(subject, consumerName, b.handler(b.cctx, name, eh, retry),
 		nats.Durable(consumerName),
-		nats.DeliverNew(),
+		deliver,
 		nats.ManualAck(),
 		nats.AckExplicit(),
-		nats.AckWait(60*time.Second),
-		nats.MaxDeliver(10),
+		nats.AckWait(ackWait),
+		nats.MaxDeliver(retry.Attempts()),
 	)
 	if err != nil {
 		return fmt.Errorf("could not subscribe to queue: %w", err)
@@ -145,11 +364,30 @@ func (b *EventBus) RegisterHandler(ctx context.Context, topic evol.Topic, eh evo
 	b.wg.Add(1)
 
 	// Handle until context is cancelled.
-	go b.handle(sub)
+	go b.handle(natsSub)
 
 	return nil
 }
 
+// Redeliver hands a dead letter to the handler that failed it, and removes it once handled.
+func (b *EventBus) Redeliver(ctx context.Context, id string) error {
+	if b.deadLetters == nil {
+		return errors.New("[evol] NATS event bus has no dead letter store")
+	}
+
+	dl, err := b.deadLetters.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	h, err := b.handlers.Get(dl)
+	if err != nil {
+		return err
+	}
+
+	return deadletter.Redeliver(ctx, b.deadLetters, id, h)
+}
+
 func (b *EventBus) Close() error {
 	b.cancel()
 	b.wg.Wait()
@@ -166,7 +404,7 @@ func (b *EventBus) handle(sub *nats.Subscription) {
 		select {
 		case <-b.cctx.Done():
 			if b.cctx.Err() != context.Canceled {
-				log.Printf("eventhorizon: context error in NATS codec bus: %s", b.cctx.Err())
+				b.log().Error("context error in NATS event bus", evol.LogKeyError, b.cctx.Err())
 			}
 
 			return
@@ -174,24 +412,68 @@ func (b *EventBus) handle(sub *nats.Subscription) {
 	}
 }
 
-func (b *EventBus) handler(ctx context.Context, eh evol.EventHandler) func(msg *nats.Msg) {
+func (b *EventBus) handler(ctx context.Context, name string, eh evol.EventHandler, retry evol.RetryPolicy) func(msg *nats.Msg) {
 	return func(msg *nats.Msg) {
 		event, err := b.codec.UnmarshalEvent(ctx, msg.Data)
 		if err != nil {
-			err = fmt.Errorf("could not unmarshal codec: %w", err)
-			msg.Nak()
+			// redelivering can not fix the payload
+			b.log().Error("could not unmarshal event", "subject", msg.Subject, evol.LogKeyHandler, name, evol.LogKeyError, err)
+			if err := msg.Term(); err != nil {
+				b.log().Warn("could not terminate message", "subject", msg.Subject, evol.LogKeyError, err)
+			}
 
 			return
 		}
 
-		if err := eh.HandleEvent(ctx, event); err != nil {
-			err = fmt.Errorf("could not handle codec : %w", err)
+		md := evol.Metadata{}
+		for k := range msg.Header {
+			md[k] = msg.Header.Get(k)
+		}
+		for k, v := range event.Metadata() {
+			md[k] = v
+		}
+		// handlers see the metadata of the event, commands they send carry it on
+		ctx := evol.ContextWithMetadata(ctx, md)
 
-			msg.Nak()
+		attempts := 1
+		if meta, err := msg.Metadata(); err == nil {
+			attempts = int(meta.NumDelivered)
+		}
 
-			return
+		if err := eh.HandleEvent(evol.ContextWithAttempt(ctx, attempts), event); err != nil {
+
+			if retry.ShouldRetry(attempts, err) {
+				b.log().Warn("handler failed, event will be redelivered", append(evol.EventFields(event), evol.LogKeyHandler, name, "attempts", attempts, evol.LogKeyError, err)...)
+				if err := msg.NakWithDelay(retry.Backoff(attempts)); err != nil {
+					b.log().Warn("could not nak event", append(evol.EventFields(event), evol.LogKeyHandler, name, evol.LogKeyError, err)...)
+				}
+
+				return
+			}
+
+			b.deadLetter(ctx, name, event, err, attempts)
 		}
 
-		msg.AckSync()
+		if err := msg.AckSync(); err != nil {
+			b.log().Warn("could not ack event", append(evol.EventFields(event), evol.LogKeyHandler, name, evol.LogKeyError, err)...)
+		}
 	}
 }
+
+// deadLetter records an event the handler failed on the last delivery.
+func (b *EventBus) deadLetter(ctx context.Context, name string, e evol.Event, err error, attempts int) {
+	kv := append(evol.EventFields(e), evol.LogKeyHandler, name, "attempts", attempts, evol.LogKeyError, err)
+	if b.deadLetters == nil {
+		b.log().Error("handler gave up on event", kv...)
+		return
+	}
+
+	b.log().Warn("handler gave up on event, storing dead letter", kv...)
+	if err := b.deadLetters.Add(ctx, deadletter.New(e, name, err, attempts)); err != nil {
+		b.log().Error("could not store dead letter", append(evol.EventFields(e), evol.LogKeyHandler, name, evol.LogKeyError, err)...)
+	}
+}
+
+func (b *EventBus) log() evol.Logger {
+	return evol.LoggerOr(b.logger)
+}
@@ -0,0 +1,73 @@
+package nats
+
+import (
+	"context"
+	"evol"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+func newBus(t *testing.T) *EventBus {
+	t.Helper()
+	ns, err := server.NewServer(&server.Options{Port: -1, JetStream: true, StoreDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ns.Start()
+	t.Cleanup(ns.Shutdown)
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+
+	b, err := NewEventBus(ns.ClientURL(), "app", WithLogger(evol.NopLogger()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+var nop = evol.EventHandlerFunc(func(ctx context.Context, e evol.Event) error { return nil })
+
+func TestConsumerNames(t *testing.T) {
+	b := newBus(t)
+	ctx := context.Background()
+
+	if err := b.RegisterHandler(ctx, "Created", nop); err == nil || !strings.Contains(err.Error(), "WithHandlerName") {
+		t.Errorf("registered a handler without name: %v", err)
+	}
+	if err := b.RegisterHandler(ctx, "Created", nop, evol.WithHandlerName("orders.projector")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.RegisterHandler(ctx, "Created", nop, evol.WithHandlerName("orders.projector")); err == nil {
+		t.Error("registered two handlers with the same name")
+	}
+	for _, options := range [][]evol.HandlerOption{
+		{evol.InGroup("workers pool")},
+		{evol.InGroup("workers pool")},
+		{LegacyConsumer()},
+	} {
+		if err := b.RegisterHandler(ctx, "Created", nop, options...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"app_orders_projector_Created", "app_workers_pool_Created", "app_Created"} {
+		if _, err := b.js.ConsumerInfo(b.streamName, name); err != nil {
+			t.Errorf("consumer %s: %v", name, err)
+		}
+	}
+}
+
+func TestTenantConsumerName(t *testing.T) {
+	b := &EventBus{appID: "app", tenant: "acme.eu"}
+	if name := b.consumerName("Created", "projector", "", false); name != "app_projector_Created_acme_eu" {
+		t.Errorf("consumer name %s", name)
+	}
+	if name := b.consumerName("Created", "projector", "", true); name != "app_Created_acme_eu" {
+		t.Errorf("legacy consumer name %s", name)
+	}
+}
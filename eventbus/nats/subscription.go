@@ -0,0 +1,87 @@
+package nats
+
+import (
+	"evol"
+	"github.com/nats-io/nats.go"
+	"time"
+)
+
+// subscriptionKey stores the subscription settings in evol.HandlerConfig
+type subscriptionKey struct{}
+
+// subscription holds the JetStream consumer settings of a handler.
+// They only apply when the durable consumer is created, use a new evol.InGroup or evol.WithHandlerName
+// name to replay the stream for a handler whose consumer already exists.
+type subscription struct {
+	deliver    nats.SubOpt
+	ackWait    time.Duration
+	maxDeliver int
+	legacy     bool
+}
+
+func subscriptionOf(cfg *evol.HandlerConfig) *subscription {
+	if sub, ok := cfg.Extension(subscriptionKey{}).(*subscription); ok {
+		return sub
+	}
+	return &subscription{}
+}
+
+func withSubscription(apply func(*subscription)) evol.HandlerOption {
+	return func(cfg *evol.HandlerConfig) {
+		sub := subscriptionOf(cfg)
+		apply(sub)
+		cfg.SetExtension(subscriptionKey{}, sub)
+	}
+}
+
+// LegacyConsumer subscribes the handler with the durable consumer of earlier versions, named <app>_<topic>
+// and shared by every handler of the topic registered with it, which compete for its events. An existing
+// deployment upgraded with it goes on from where its consumer stopped, give the handlers their own
+// consumers with evol.WithHandlerName and DeliverFromSequence once they are caught up.
+func LegacyConsumer() evol.HandlerOption {
+	return withSubscription(func(s *subscription) {
+		s.legacy = true
+	})
+}
+
+// DeliverAll starts a new consumer at the first event in the stream.
+func DeliverAll() evol.HandlerOption {
+	return withSubscription(func(s *subscription) {
+		s.deliver = nats.DeliverAll()
+	})
+}
+
+// DeliverFromSequence starts a new consumer at the stream sequence seq.
+func DeliverFromSequence(seq uint64) evol.HandlerOption {
+	return withSubscription(func(s *subscription) {
+		s.deliver = nats.StartSequence(seq)
+	})
+}
+
+// DeliverFromTime starts a new consumer at the first event stored at or after t.
+func DeliverFromTime(t time.Time) evol.HandlerOption {
+	return withSubscription(func(s *subscription) {
+		s.deliver = nats.StartTime(t)
+	})
+}
+
+// DeliverLastPerSubject starts a new consumer with the last event of each aggregate type and topic.
+func DeliverLastPerSubject() evol.HandlerOption {
+	return withSubscription(func(s *subscription) {
+		s.deliver = nats.DeliverLastPerSubject()
+	})
+}
+
+// AckWait sets how long the server waits for the handler before redelivering an event.
+func AckWait(d time.Duration) evol.HandlerOption {
+	return withSubscription(func(s *subscription) {
+		s.ackWait = d
+	})
+}
+
+// MaxDeliver sets the number of deliveries of an event, overriding the attempts of the retry policy.
+func MaxDeliver(n int) evol.HandlerOption {
+	return withSubscription(func(s *subscription) {
+		s.maxDeliver = n
+	})
+}
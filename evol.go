@@ -2,51 +2,25 @@ package evol
 
 import (
 	"context"
-	"errors"
-	"sync"
 )
 
+// CmdBus is the command bus of DefaultRegistry
 var CmdBus CommandBus
 
-var cmds = make(map[CommandName]Command)
-var cmdsMu sync.RWMutex
-
 func RegisterCommand(cmd Command) error {
-	cmdsMu.Lock()
-	defer cmdsMu.Unlock()
-
-	if _, ok := cmds[cmd.Name()]; ok {
-		return errors.New("command already registered")
-	}
-
-	cmds[cmd.Name()] = cmd
-	return nil
+	return DefaultRegistry.RegisterCommand(cmd)
 }
 
+// SendCommand dispatches cmd to CmdBus, with a new correlation id unless ctx already has one.
 func SendCommand(ctx context.Context, cmd Command) error {
-	err := CmdBus.HandleCommand(ctx, cmd)
-	if err != nil {
-		return err
-	}
-	return nil
+	return DefaultRegistry.SendCommand(ctx, cmd)
 }
 
+// NewCommand returns a new zero command of the type registered under name, nil when not registered.
 func NewCommand(name CommandName) Command {
-	cmdsMu.RLock()
-	defer cmdsMu.RUnlock()
-
-	return cmds[name]
+	return DefaultRegistry.NewCommand(name)
 }
 
 func GetAllCmds() map[CommandName]Command {
-	cmdsMu.RLock()
-	defer cmdsMu.RUnlock()
-
-	mapCopy := map[CommandName]Command{}
-
-	for index, element := range cmds {
-		mapCopy[index] = element
-	}
-
-	return mapCopy
+	return DefaultRegistry.Commands()
 }
@@ -0,0 +1,511 @@
+// Package evolctl inspects and operates the stores of an evol application.
+//
+// Rebuilding aggregates, reading sagas and sending commands need the aggregates, sagas
+// and commands of the application, so build evolctl along with its domain packages:
+//
+//	package main
+//
+//	import (
+//		"evol/evolctl"
+//		_ "example.com/app/domain"
+//		"os"
+//	)
+//
+//	func main() {
+//		os.Exit(evolctl.Main(os.Args[1:], os.Stdout, os.Stderr))
+//	}
+//
+// evolctl opens the memory, file, SQLite and JetStream event stores of evol and memory saga stores.
+// The other stores of an application are opened by the functions it registers with RegisterStore
+// and RegisterSagaStore before calling Main.
+//
+// send against a store saves the events of the command, then publishes them to the -bus event bus.
+// Without -bus the events are only saved, to the outbox of the store: sagas, policies and projections
+// see them once the outbox relay of the application publishes them. Stores without outbox need -bus,
+// or the command sent to the application with -url.
+package evolctl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"evol"
+	"evol/aggregatestore"
+	"evol/codec"
+	"evol/command"
+	"evol/eventbus/nats"
+	"evol/pii"
+	"evol/repo/jetstream"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+const usage = `usage: evolctl [flags] <command> [args]
+
+commands:
+  streams                           list the aggregate streams of all tenants
+  events <aggregate-id>             print the events of an aggregate as JSON
+  tail [-from N] [-follow]          print the events of all aggregates in save order
+  sagas                             print the live sagas of the -sagas store
+  rebuild [-version N] [-at TIME] <aggregate-type> <id>
+                                    apply the events of an aggregate and print its state,
+                                    up to a version or an RFC 3339 time
+  send [-url URL | -bus URL] <command> <json>
+                                    send a command by name with a JSON body, to the application
+                                    at URL or handled against the store, its events published to
+                                    the -bus event bus, or left to the outbox relay of the application
+  forget <subject>                  delete the key of the personal data of subject
+
+flags:
+`
+
+// Main runs evolctl with the arguments following the program name and returns the exit code.
+func Main(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("evolctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	storeURL := fs.String("store", "", "event store: memory:PATH for a memory repo dump, file:PATH, sqlite:PATH, nats://HOST:PORT for JetStream, or a registered store")
+	appID := fs.String("app", "", "application id of a JetStream store or event bus")
+	sagasURL := fs.String("sagas", "", "saga store: memory:PATH for a memory saga repo dump, or a registered saga store")
+	tenant := fs.String("tenant", "", "tenant of the aggregates, sagas and commands, the default tenant when empty")
+	keysURL := fs.String("keys", "", "key store of personal data: nats://HOST:PORT for the JetStream key store of -app, events are printed decrypted")
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if *tenant != "" {
+		ctx = evol.ContextWithTenant(ctx, *tenant)
+	}
+
+	c := &ctl{out: stdout, storeURL: *storeURL, appID: *appID, sagasURL: *sagasURL, keysURL: *keysURL}
+	err := c.openKeys()
+	if err == nil {
+		if c.keys != nil {
+			defer c.keys.Close()
+		}
+		err = c.run(ctx, fs.Arg(0), fs.Args()[1:])
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "evolctl: %s\n", err)
+		var ue usageError
+		if errors.As(err, &ue) {
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+type usageError string
+
+func (e usageError) Error() string {
+	return string(e)
+}
+
+type ctl struct {
+	out      io.Writer
+	storeURL string
+	appID    string
+	sagasURL string
+	keysURL  string
+	keys     *jetstream.KeyStore
+	codec    codec.JsonEventCodec
+	// pii decrypts the printed events and encrypts the events saved by send, with -keys
+	pii *pii.EventCodec
+}
+
+func (c *ctl) run(ctx context.Context, name string, args []string) error {
+	switch name {
+	case "streams":
+		return c.withStore(ctx, func(s *store) error { return c.streams(ctx, s) })
+	case "events":
+		if len(args) != 1 {
+			return usageError("events <aggregate-id>")
+		}
+		return c.withStore(ctx, func(s *store) error { return c.events(ctx, s, args[0]) })
+	case "tail":
+		return c.tail(ctx, args)
+	case "sagas":
+		return c.sagas(ctx)
+	case "rebuild":
+		return c.rebuild(ctx, args)
+	case "send":
+		return c.send(ctx, args)
+	case "forget":
+		if len(args) != 1 {
+			return usageError("forget <subject>")
+		}
+		return c.forget(ctx, args[0])
+	}
+	return usageError(fmt.Sprintf("unknown command %s", name))
+}
+
+func (c *ctl) withStore(ctx context.Context, f func(s *store) error) error {
+	var eventCodec evol.EventCodec
+	if c.pii != nil {
+		eventCodec = c.pii
+	}
+	s, err := openStore(ctx, c.storeURL, c.appID, eventCodec)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	return f(s)
+}
+
+func (c *ctl) streams(ctx context.Context, s *store) error {
+	lister, ok := evol.As[evol.StreamLister](s.repo)
+	if !ok {
+		return fmt.Errorf("%s can not list streams", c.storeURL)
+	}
+
+	streams, err := lister.Streams(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TENANT\tAGGREGATE TYPE\tAGGREGATE ID\tVERSION")
+	for _, st := range streams {
+		tenant := st.Tenant
+		if tenant == "" {
+			tenant = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\n", tenant, st.AggregateType, st.AggregateIdentity, st.Version)
+	}
+	return w.Flush()
+}
+
+func (c *ctl) events(ctx context.Context, s *store, id string) error {
+	events, err := s.repo.Load(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	res := make([]json.RawMessage, len(events))
+	for i, e := range events {
+		if res[i], err = c.marshal(ctx, e); err != nil {
+			return err
+		}
+	}
+	return c.printJSON(res)
+}
+
+func (c *ctl) tail(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ContinueOnError)
+	from := fs.Uint64("from", 0, "print the events after this position")
+	follow := fs.Bool("follow", false, "wait for new events until interrupted")
+	interval := fs.Duration("interval", time.Second, "how often -follow looks for new events")
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+
+	return c.withStore(ctx, func(s *store) error {
+		outbox, ok := evol.As[evol.Outbox](s.repo)
+		if !ok {
+			return fmt.Errorf("%s has no global stream", c.storeURL)
+		}
+
+		enc := json.NewEncoder(c.out)
+		position := *from
+		for {
+			records, err := outbox.Fetch(ctx, position, 100)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return err
+			}
+
+			for _, rec := range records {
+				data, err := c.marshal(ctx, rec.Event)
+				if err != nil {
+					return err
+				}
+				if err := enc.Encode(struct {
+					Position uint64          `json:"position"`
+					Event    json.RawMessage `json:"event"`
+				}{rec.Position, data}); err != nil {
+					return err
+				}
+				position = rec.Position
+			}
+
+			if len(records) > 0 {
+				continue
+			}
+			if !*follow {
+				return nil
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(*interval):
+			}
+		}
+	})
+}
+
+func (c *ctl) sagas(ctx context.Context) error {
+	lister, err := openSagas(ctx, c.sagasURL)
+	if err != nil {
+		return err
+	}
+
+	sagas, err := lister.ListSagas(ctx)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(c.out)
+	for _, s := range sagas {
+		state, err := json.Marshal(s)
+		if err != nil {
+			return err
+		}
+		if err := enc.Encode(struct {
+			SagaType     string          `json:"saga_type"`
+			SagaIdentity string          `json:"saga_id"`
+			Alive        bool            `json:"alive"`
+			State        json.RawMessage `json:"state"`
+		}{s.SagaType(), s.SagaIdentity(), s.IsAlive(), state}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *ctl) rebuild(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("rebuild", flag.ContinueOnError)
+	atVersion := fs.Int("version", 0, "rebuild the aggregate up to this version")
+	atTime := fs.String("at", "", "rebuild the aggregate as it was at this RFC 3339 time")
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	if fs.NArg() != 2 || (*atVersion != 0 && *atTime != "") {
+		return usageError("rebuild [-version N | -at TIME] <aggregate-type> <aggregate-id>")
+	}
+	var at time.Time
+	if *atTime != "" {
+		var err error
+		if at, err = time.Parse(time.RFC3339Nano, *atTime); err != nil {
+			return usageError(fmt.Sprintf("invalid -at time: %s", err))
+		}
+	}
+	aggregateType, id := evol.AggregateType(fs.Arg(0)), fs.Arg(1)
+
+	return c.withStore(ctx, func(s *store) error {
+		aggStore := aggregatestore.NewAggregateEventStore(s.repo, aggregatestore.WithLogger(evol.NopLogger()))
+		switch {
+		case *atVersion != 0:
+			a, err := aggStore.LoadAtVersion(ctx, aggregateType, id, *atVersion)
+			return c.printAggregate(a, aggregateType, id, err)
+		case !at.IsZero():
+			a, err := aggStore.LoadAt(ctx, aggregateType, id, at)
+			return c.printAggregate(a, aggregateType, id, err)
+		}
+		a, err := aggStore.Load(ctx, aggregateType, id)
+		return c.printAggregate(a, aggregateType, id, err)
+	})
+}
+
+// printAggregate prints the state of a loaded aggregate
+func (c *ctl) printAggregate(a evol.Aggregate, aggregateType evol.AggregateType, id string, err error) error {
+	if err != nil {
+		return err
+	}
+
+	version := 0
+	if versioned, ok := a.(evol.VersionedAggregate); ok {
+		version = versioned.AggregateVersion()
+	}
+	if version == 0 {
+		return fmt.Errorf("%s %s: %w", aggregateType, id, evol.ErrAggregateNotFound)
+	}
+
+	state, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return c.printJSON(struct {
+		AggregateType     evol.AggregateType `json:"aggregate_type"`
+		AggregateIdentity string             `json:"aggregate_id"`
+		Version           int                `json:"version"`
+		State             json.RawMessage    `json:"state"`
+	}{aggregateType, id, version, state})
+}
+
+// send decodes the command with the JSON command codec, then posts it to url,
+// or handles it with its aggregate in the event store. The events saved in the store are published
+// to the -bus event bus, without it they are left to the outbox relay of the application.
+func (c *ctl) send(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("send", flag.ContinueOnError)
+	url := fs.String("url", "", "post the encoded command to this url instead of handling it against the store")
+	busURL := fs.String("bus", "", "publish the saved events to the JetStream event bus of -app at nats://HOST:PORT")
+	if err := fs.Parse(args); err != nil {
+		return usageError(err.Error())
+	}
+	if fs.NArg() != 2 || (*url != "" && *busURL != "") {
+		return usageError("send [-url URL | -bus URL] <command> <json>")
+	}
+
+	cmdCodec := &codec.JsonCmdCodec{}
+	envelope, err := json.Marshal(struct {
+		Name evol.CommandName `json:"command_name"`
+		Data json.RawMessage  `json:"data"`
+	}{evol.CommandName(fs.Arg(0)), json.RawMessage(fs.Arg(1))})
+	if err != nil {
+		return fmt.Errorf("invalid command body: %w", err)
+	}
+
+	ctx = evol.ContextWithCorrelationID(ctx)
+	cmd, err := cmdCodec.UnmarshalCommand(ctx, envelope)
+	if err != nil {
+		return err
+	}
+
+	if *url != "" {
+		data, err := cmdCodec.MarshalCommand(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		resp, err := http.Post(*url, "application/json", bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("%s: %s %s", *url, resp.Status, body)
+		}
+		fmt.Fprintf(c.out, "%s sent: %s\n", cmd.Name(), resp.Status)
+		return nil
+	}
+
+	return c.withStore(ctx, func(s *store) error {
+		aggStore := aggregatestore.NewAggregateEventStore(s.repo, aggregatestore.WithLogger(evol.NopLogger()))
+
+		var h *command.AggCmdHandler
+		if *busURL != "" {
+			bus, err := c.openBus(*busURL)
+			if err != nil {
+				return err
+			}
+			defer bus.Close()
+			if h, err = command.NewAggCmdHandler(cmd.TargetAggregateType(), aggStore, bus, command.WithLogger(evol.NopLogger())); err != nil {
+				return err
+			}
+		} else {
+			if _, ok := evol.As[evol.Outbox](s.repo); !ok {
+				return fmt.Errorf("%s has no outbox to publish the events from, send with -bus or -url", c.storeURL)
+			}
+			// no bus to publish to, the outbox relay of the application publishes the saved events
+			if h, err = command.NewAggCmdHandler(cmd.TargetAggregateType(), aggStore, nil, command.WithOutbox()); err != nil {
+				return err
+			}
+		}
+
+		// the events are saved when the handler fails to publish them
+		err := h.HandleCommand(ctx, cmd)
+		if flushErr := s.flush(ctx); err == nil {
+			err = flushErr
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(c.out, "%s handled by %s %s, correlation id %s\n", cmd.Name(), cmd.TargetAggregateType(), cmd.TargetIdentity(), evol.CorrelationID(ctx))
+		if *busURL != "" {
+			fmt.Fprintf(c.out, "events saved and published to %s\n", *busURL)
+		} else {
+			fmt.Fprintln(c.out, "events saved, NOT published: the outbox relay of the application publishes them")
+		}
+		return nil
+	})
+}
+
+// openBus connects to the JetStream event bus of the application, publishing events encoded as the store does
+func (c *ctl) openBus(url string) (*nats.EventBus, error) {
+	if !strings.HasPrefix(url, "nats://") && !strings.HasPrefix(url, "tls://") {
+		return nil, fmt.Errorf("unknown event bus %s, event buses are nats://", url)
+	}
+	if c.appID == "" {
+		return nil, fmt.Errorf("-app is required with a JetStream event bus")
+	}
+
+	var opts []nats.Option
+	if c.pii != nil {
+		opts = append(opts, nats.WithCodec(c.pii))
+	}
+	return nats.NewEventBus(url, c.appID, opts...)
+}
+
+// openKeys opens the -keys key store, events are then printed decrypted
+func (c *ctl) openKeys() error {
+	if c.keysURL == "" {
+		return nil
+	}
+	if !strings.HasPrefix(c.keysURL, "nats://") && !strings.HasPrefix(c.keysURL, "tls://") {
+		return fmt.Errorf("unknown key store %s, key stores are nats://", c.keysURL)
+	}
+	if c.appID == "" {
+		return fmt.Errorf("-app is required with a JetStream key store")
+	}
+
+	keys, err := jetstream.NewKeyStore(c.keysURL, c.appID)
+	if err != nil {
+		return err
+	}
+	c.keys = keys
+	c.pii = pii.NewEventCodec(&c.codec, keys)
+	return nil
+}
+
+// marshal encodes an event to print, with its personal data decrypted when there are keys
+func (c *ctl) marshal(ctx context.Context, e evol.Event) ([]byte, error) {
+	data, err := c.codec.MarshalEvent(ctx, e)
+	if err != nil || c.pii == nil {
+		return data, err
+	}
+
+	if e, err = c.pii.UnmarshalEvent(ctx, data); err != nil {
+		return nil, err
+	}
+	return c.codec.MarshalEvent(ctx, e)
+}
+
+func (c *ctl) forget(ctx context.Context, subject string) error {
+	if c.keys == nil {
+		return fmt.Errorf("missing -keys")
+	}
+	if err := c.keys.Forget(ctx, subject); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "%s forgotten\n", subject)
+	return nil
+}
+
+func (c *ctl) printJSON(v interface{}) error {
+	enc := json.NewEncoder(c.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
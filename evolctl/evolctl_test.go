@@ -0,0 +1,124 @@
+package evolctl
+
+import (
+	"bytes"
+	"context"
+	"evol"
+	"evol/eventbus/nats"
+	"evol/repo/memory"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+type pingCmd struct {
+	Id string
+}
+
+func (c *pingCmd) Name() evol.CommandName                  { return "PingCmd" }
+func (c *pingCmd) TargetAggregateType() evol.AggregateType { return "Pinger" }
+func (c *pingCmd) TargetIdentity() string                  { return c.Id }
+
+// pinger publishes a Pinged event for every PingCmd
+type pinger struct {
+	*evol.BaseAggregate
+}
+
+func (p *pinger) HandleCommand(ctx context.Context, cmd evol.Command) error {
+	p.PublishEvent("Pinged", nil, time.Now(), p)
+	return nil
+}
+
+func (p *pinger) HandleSourcingEvent(ctx context.Context, e evol.Event) error { return nil }
+
+func init() {
+	evol.RegisterAggregate("Pinger", func(id string) evol.Aggregate {
+		return &pinger{BaseAggregate: evol.NewBaseAggregate("Pinger", id)}
+	})
+	if err := evol.RegisterCommand(&pingCmd{}); err != nil {
+		panic(err)
+	}
+}
+
+func startServer(t *testing.T) string {
+	t.Helper()
+
+	ns, err := server.NewServer(&server.Options{Port: -1, JetStream: true, StoreDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ns.Start()
+	t.Cleanup(ns.Shutdown)
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+	return ns.ClientURL()
+}
+
+func TestSendToOutbox(t *testing.T) {
+	store := "memory:" + filepath.Join(t.TempDir(), "events.dump")
+
+	var out, errOut bytes.Buffer
+	if code := Main([]string{"-store", store, "send", "PingCmd", `{"Id":"p1"}`}, &out, &errOut); code != 0 {
+		t.Fatalf("exit code %d: %s", code, errOut.String())
+	}
+	if !strings.Contains(out.String(), "NOT published") {
+		t.Errorf("send did not tell the events are not published:\n%s", out.String())
+	}
+
+	out.Reset()
+	if code := Main([]string{"-store", store, "events", "p1"}, &out, &errOut); code != 0 || !strings.Contains(out.String(), "Pinged") {
+		t.Errorf("exit code %d, events:\n%s%s", code, out.String(), errOut.String())
+	}
+
+	// events saved to a store without outbox would never be published
+	err := RegisterStore("nooutbox", func(ctx context.Context, url string, eventCodec evol.EventCodec) (evol.EventRepo, error) {
+		return struct{ evol.EventRepo }{memory.NewAggregateEventRepo()}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	errOut.Reset()
+	if code := Main([]string{"-store", "nooutbox:db", "send", "PingCmd", `{"Id":"p1"}`}, &out, &errOut); code != 1 || !strings.Contains(errOut.String(), "no outbox") {
+		t.Errorf("exit code %d: %s", code, errOut.String())
+	}
+}
+
+func TestSendToBus(t *testing.T) {
+	url := startServer(t)
+	bus, err := nats.NewEventBus(url, "test", nats.WithLogger(evol.NopLogger()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+
+	pinged := make(chan evol.Event, 1)
+	err = bus.RegisterHandler(context.Background(), "Pinged", evol.EventHandlerFunc(func(ctx context.Context, e evol.Event) error {
+		pinged <- e
+		return nil
+	}), evol.WithHandlerName("pinged"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := "memory:" + filepath.Join(t.TempDir(), "events.dump")
+	var out, errOut bytes.Buffer
+	if code := Main([]string{"-store", store, "-app", "test", "send", "-bus", url, "PingCmd", `{"Id":"p1"}`}, &out, &errOut); code != 0 {
+		t.Fatalf("exit code %d: %s", code, errOut.String())
+	}
+	if !strings.Contains(out.String(), "published to "+url) {
+		t.Errorf("send output:\n%s", out.String())
+	}
+
+	select {
+	case e := <-pinged:
+		if e.AggregateIdentity() != "p1" {
+			t.Errorf("published %v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the event was not published")
+	}
+}
@@ -0,0 +1,247 @@
+package evolctl
+
+import (
+	"context"
+	"database/sql"
+	"evol"
+	"evol/repo/file"
+	"evol/repo/jetstream"
+	"evol/repo/memory"
+	"evol/repo/sqlite"
+	"evol/saga"
+	"fmt"
+	_ "github.com/mattn/go-sqlite3"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// StoreOpener opens the event store of a url, for the stores of the application evolctl does not know.
+// The store is closed with its Close method, when it has one.
+type StoreOpener func(ctx context.Context, url string, eventCodec evol.EventCodec) (evol.EventRepo, error)
+
+// SagaStoreOpener opens the saga store of a url, for the saga stores of the application.
+type SagaStoreOpener func(ctx context.Context, url string) (evol.SagaLister, error)
+
+var (
+	openersMu     sync.RWMutex
+	storeOpeners  = map[string]StoreOpener{}
+	sagaOpeners   = map[string]SagaStoreOpener{}
+	builtinStores = map[string]bool{"memory": true, "file": true, "sqlite": true, "nats": true, "tls": true}
+)
+
+// RegisterStore makes evolctl open the -store urls of scheme with open, for the event stores of an
+// application that evol does not have. Stores are registered before calling Main.
+func RegisterStore(scheme string, open StoreOpener) error {
+	openersMu.Lock()
+	defer openersMu.Unlock()
+
+	if builtinStores[scheme] {
+		return fmt.Errorf("[evol] RegisterStore: %s is a store of evol", scheme)
+	}
+	if _, ok := storeOpeners[scheme]; ok {
+		return fmt.Errorf("[evol] RegisterStore: store %s already registered", scheme)
+	}
+	storeOpeners[scheme] = open
+	return nil
+}
+
+// RegisterSagaStore makes evolctl open the -sagas urls of scheme with open, evol itself only
+// reads memory saga repo dumps.
+func RegisterSagaStore(scheme string, open SagaStoreOpener) error {
+	openersMu.Lock()
+	defer openersMu.Unlock()
+
+	if scheme == "memory" {
+		return fmt.Errorf("[evol] RegisterSagaStore: %s is a saga store of evol", scheme)
+	}
+	if _, ok := sagaOpeners[scheme]; ok {
+		return fmt.Errorf("[evol] RegisterSagaStore: saga store %s already registered", scheme)
+	}
+	sagaOpeners[scheme] = open
+	return nil
+}
+
+// scheme returns the scheme of url, what precedes its first colon
+func scheme(url string) string {
+	if i := strings.Index(url, ":"); i > 0 {
+		return url[:i]
+	}
+	return ""
+}
+
+// store is an opened event store, with what it takes to persist changes made by send
+type store struct {
+	repo  evol.EventRepo
+	flush func(ctx context.Context) error
+	close func() error
+}
+
+// openStore opens an event store from its url:
+//
+//	memory:PATH      a file written by memory.AggregateEventRepo.Dump, created by send when missing
+//	file:PATH        the file of a file.EventRepo
+//	sqlite:PATH      the SQLite database of a sqlite.EventRepo
+//	nats://HOST:PORT the JetStream event repo of the application named by appID
+//	SCHEME:...       a store registered with RegisterStore
+//
+// Events saved by send are encoded with eventCodec, codec.JsonEventCodec when nil.
+func openStore(ctx context.Context, url, appID string, eventCodec evol.EventCodec) (*store, error) {
+	switch {
+	case strings.HasPrefix(url, "memory:"):
+		path := strings.TrimPrefix(url, "memory:")
+		repo := memory.NewAggregateEventRepo()
+
+		f, err := os.Open(path)
+		if err == nil {
+			defer f.Close()
+			if repo, err = memory.RestoreAggregateEventRepo(ctx, f, nil); err != nil {
+				return nil, fmt.Errorf("could not read %s: %w", path, err)
+			}
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		return &store{
+			repo: repo,
+			flush: func(ctx context.Context) error {
+				return writeFile(path, func(f *os.File) error { return repo.Dump(ctx, f, eventCodec) })
+			},
+			close: func() error { return nil },
+		}, nil
+
+	case strings.HasPrefix(url, "file:"):
+		path := strings.TrimPrefix(url, "file:")
+		if _, err := os.Stat(path); err != nil {
+			// a missing file would be created empty
+			return nil, err
+		}
+		var opts []file.Option
+		if eventCodec != nil {
+			opts = append(opts, file.WithCodec(eventCodec))
+		}
+		repo, err := file.NewEventRepo(path, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &store{
+			repo:  repo,
+			flush: func(context.Context) error { return nil },
+			close: repo.Close,
+		}, nil
+
+	case strings.HasPrefix(url, "sqlite:"):
+		path := strings.TrimPrefix(url, "sqlite:")
+		if _, err := os.Stat(path); err != nil {
+			// a missing database would be created empty
+			return nil, err
+		}
+		db, err := sql.Open("sqlite3", "file:"+path+"?_txlock=immediate&_busy_timeout=5000")
+		if err != nil {
+			return nil, err
+		}
+		var opts []sqlite.Option
+		if eventCodec != nil {
+			opts = append(opts, sqlite.WithCodec(eventCodec))
+		}
+		repo, err := sqlite.NewEventRepo(ctx, db, opts...)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		return &store{
+			repo:  repo,
+			flush: func(context.Context) error { return nil },
+			close: db.Close,
+		}, nil
+
+	case strings.HasPrefix(url, "nats://"), strings.HasPrefix(url, "tls://"):
+		if appID == "" {
+			return nil, fmt.Errorf("-app is required with a JetStream store")
+		}
+		var opts []jetstream.Option
+		if eventCodec != nil {
+			opts = append(opts, jetstream.WithCodec(eventCodec))
+		}
+		repo, err := jetstream.NewEventRepo(url, appID, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &store{
+			repo:  repo,
+			flush: func(context.Context) error { return nil },
+			close: repo.Close,
+		}, nil
+
+	case url == "":
+		return nil, fmt.Errorf("missing -store")
+	}
+
+	openersMu.RLock()
+	open, ok := storeOpeners[scheme(url)]
+	openersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown store %s, stores are memory:, file:, sqlite:, nats:// and the ones registered with RegisterStore", url)
+	}
+
+	repo, err := open(ctx, url, eventCodec)
+	if err != nil {
+		return nil, err
+	}
+	closeRepo := func() error { return nil }
+	if c, ok := evol.As[io.Closer](repo); ok {
+		closeRepo = c.Close
+	}
+	return &store{
+		repo:  repo,
+		flush: func(context.Context) error { return nil },
+		close: closeRepo,
+	}, nil
+}
+
+// openSagas opens a saga store from its url, memory:PATH being a file written by the memory saga repo Dump,
+// or a saga store registered with RegisterSagaStore.
+// The sagas are made by the factories of the sagas registered in the binary.
+func openSagas(ctx context.Context, url string) (evol.SagaLister, error) {
+	if !strings.HasPrefix(url, "memory:") {
+		if url == "" {
+			return nil, fmt.Errorf("missing -sagas")
+		}
+		openersMu.RLock()
+		open, ok := sagaOpeners[scheme(url)]
+		openersMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("unknown saga store %s, saga stores are memory: and the ones registered with RegisterSagaStore", url)
+		}
+		return open(ctx, url)
+	}
+
+	path := strings.TrimPrefix(url, "memory:")
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return saga.RestoreMemorySagaRepo(f)
+}
+
+// writeFile replaces the file at path with what write writes
+func writeFile(path string, write func(f *os.File) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".evolctl-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,112 @@
+package evolctl
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"evol"
+	"evol/repo/file"
+	"evol/repo/memory"
+	"evol/repo/sqlite"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegisteredStore(t *testing.T) {
+	repo := memory.NewAggregateEventRepo()
+	e := evol.NewEvent("Tested", map[string]interface{}{"n": 1}, time.Now(), evol.ForAggregate("Test", "a"), evol.WithVersion(1))
+	if err := repo.Save(context.Background(), []evol.Event{e}); err != nil {
+		t.Fatal(err)
+	}
+
+	var opened string
+	err := RegisterStore("test", func(ctx context.Context, url string, eventCodec evol.EventCodec) (evol.EventRepo, error) {
+		opened = url
+		return repo, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterStore("test", nil); err == nil {
+		t.Error("registered a store twice")
+	}
+	if err := RegisterStore("nats", nil); err == nil {
+		t.Error("registered a store of evol")
+	}
+
+	var out, errOut bytes.Buffer
+	if code := Main([]string{"-store", "test:db", "streams"}, &out, &errOut); code != 0 {
+		t.Fatalf("exit code %d: %s", code, errOut.String())
+	}
+	if opened != "test:db" {
+		t.Errorf("opened %q", opened)
+	}
+	if !strings.Contains(out.String(), "Test") || !strings.Contains(out.String(), " a ") {
+		t.Errorf("unexpected streams:\n%s", out.String())
+	}
+
+	errOut.Reset()
+	if code := Main([]string{"-store", "postgres:db", "streams"}, &out, &errOut); code != 1 || !strings.Contains(errOut.String(), "unknown store postgres:db") {
+		t.Errorf("exit code %d: %s", code, errOut.String())
+	}
+}
+
+func TestFileAndSQLiteStores(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	e := func(id string) evol.Event {
+		return evol.NewEvent("Tested", map[string]interface{}{"n": 1}, time.Now(), evol.ForAggregate("Test", id), evol.WithVersion(1))
+	}
+
+	fileRepo, err := file.NewEventRepo(filepath.Join(dir, "events.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fileRepo.Close()
+	if err := fileRepo.Save(ctx, []evol.Event{e("f1")}); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "events.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	sqliteRepo, err := sqlite.NewEventRepo(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sqliteRepo.Save(ctx, []evol.Event{e("s1")}); err != nil {
+		t.Fatal(err)
+	}
+
+	for url, id := range map[string]string{"file:" + filepath.Join(dir, "events.log"): "f1", "sqlite:" + filepath.Join(dir, "events.db"): "s1"} {
+		var out, errOut bytes.Buffer
+		if code := Main([]string{"-store", url, "streams"}, &out, &errOut); code != 0 {
+			t.Fatalf("%s: exit code %d: %s", url, code, errOut.String())
+		}
+		if !strings.Contains(out.String(), " "+id+" ") {
+			t.Errorf("%s streams:\n%s", url, out.String())
+		}
+
+		out.Reset()
+		if code := Main([]string{"-store", url, "tail"}, &out, &errOut); code != 0 {
+			t.Fatalf("%s: exit code %d: %s", url, code, errOut.String())
+		}
+		if !strings.Contains(out.String(), `"aggregate_id":"`+id+`"`) {
+			t.Errorf("%s tail:\n%s", url, out.String())
+		}
+	}
+
+	// evolctl does not create the stores of an application
+	var out, errOut bytes.Buffer
+	if code := Main([]string{"-store", "sqlite:" + filepath.Join(dir, "missing.db"), "streams"}, &out, &errOut); code != 1 {
+		t.Errorf("exit code %d: %s", code, errOut.String())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "missing.db")); !os.IsNotExist(err) {
+		t.Errorf("created a missing database: %v", err)
+	}
+}
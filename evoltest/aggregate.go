@@ -0,0 +1,231 @@
+// Package evoltest provides fixtures to test aggregates and sagas without buses or stores.
+//
+// An aggregate test states the events the aggregate already published, the command it
+// handles and what should come out of it:
+//
+//	evoltest.NewAggregateFixture(t, domain.PaymentAggregateType, "p1").
+//		Given(evoltest.Event(domain.OrderPayFailedEventTopic, &domain.OrderPayFailedEvent{PaymentId: "p1"})).
+//		When(&domain.PayOrderCmd{PaymentId: "p1", BuyerId: "b1", Amount: 10}).
+//		ThenEvents(evoltest.Event(domain.OrderPayedEventTopic, &domain.OrderPayedEvent{PaymentId: "p1", Amount: 10})).
+//		ThenState(func(t testing.TB, a evol.Aggregate) { ... })
+package evoltest
+
+import (
+	"context"
+	"errors"
+	"evol"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Event creates an event to give to or expect from an aggregate fixture,
+// the fixture fills in the aggregate and the version.
+func Event(topic evol.Topic, data interface{}) evol.Event {
+	return evol.NewEvent(topic, data, time.Time{})
+}
+
+// AggregateFixture runs an aggregate in memory through HandleSourcingEvent and HandleCommand.
+// Assertions report failures to t and return the fixture, so they can be chained.
+type AggregateFixture struct {
+	t         testing.TB
+	ctx       context.Context
+	aggregate evol.Aggregate
+	ignore    []string
+
+	version int
+	when    bool
+	events  []evol.Event
+	err     error
+}
+
+// NewAggregateFixture creates a fixture for a new aggregate made by its registered factory.
+func NewAggregateFixture(t testing.TB, aggregateType evol.AggregateType, identity string) *AggregateFixture {
+	t.Helper()
+
+	a, err := evol.CreateAggregate(aggregateType, identity)
+	if err != nil {
+		t.Fatalf("evoltest: could not create %s %s: %s", aggregateType, identity, err)
+	}
+	return ForAggregate(t, a)
+}
+
+// ForAggregate creates a fixture for an aggregate, which must implement evol.EventSourcingHandler.
+func ForAggregate(t testing.TB, a evol.Aggregate) *AggregateFixture {
+	t.Helper()
+
+	if _, ok := a.(evol.EventSourcingHandler); !ok {
+		t.Fatalf("evoltest: %T is not an event sourcing aggregate", a)
+	}
+	return &AggregateFixture{t: t, ctx: context.Background(), aggregate: a}
+}
+
+// WithContext sets the context passed to the aggregate.
+func (f *AggregateFixture) WithContext(ctx context.Context) *AggregateFixture {
+	f.ctx = ctx
+	return f
+}
+
+// IgnoreFields leaves out the struct fields with one of these names when comparing
+// events and state, such as timestamps set with time.Now().
+func (f *AggregateFixture) IgnoreFields(names ...string) *AggregateFixture {
+	f.ignore = append(f.ignore, names...)
+	return f
+}
+
+// Aggregate returns the aggregate under test.
+func (f *AggregateFixture) Aggregate() evol.Aggregate {
+	return f.aggregate
+}
+
+// Given applies events the aggregate published before, in order.
+func (f *AggregateFixture) Given(events ...evol.Event) *AggregateFixture {
+	f.t.Helper()
+
+	handler := f.aggregate.(evol.EventSourcingHandler)
+	for _, e := range events {
+		f.version++
+		e = evol.CopyEvent(e,
+			evol.ForAggregate(f.aggregate.AggregateType(), f.aggregate.EntityIdentity()),
+			evol.WithVersion(f.version),
+		)
+		if err := handler.HandleSourcingEvent(f.ctx, e); err != nil {
+			f.t.Fatalf("evoltest: could not apply given event %s: %s", e.Topic(), err)
+		}
+	}
+
+	if versioned, ok := f.aggregate.(evol.VersionedAggregate); ok {
+		versioned.SetAggregateVersion(f.version)
+	}
+	return f
+}
+
+// When makes the aggregate handle cmd, the events it publishes and its error are kept for the Then assertions.
+func (f *AggregateFixture) When(cmd evol.Command) *AggregateFixture {
+	f.t.Helper()
+
+	if f.when {
+		f.t.Fatalf("evoltest: When called twice, use a fixture per command")
+	}
+	f.when = true
+
+	f.err = f.aggregate.HandleCommand(f.ctx, cmd)
+	f.events = append([]evol.Event(nil), f.aggregate.DomainEvents()...)
+	return f
+}
+
+// ThenEvents asserts the command succeeded and published exactly these events, in order.
+// Topics and data are compared, and the aggregate and version when set on the expected event.
+func (f *AggregateFixture) ThenEvents(events ...evol.Event) *AggregateFixture {
+	f.t.Helper()
+	f.requireWhen("ThenEvents")
+
+	if f.err != nil {
+		f.t.Errorf("evoltest: command failed: %s", f.err)
+		return f
+	}
+
+	var diffs []string
+	if len(f.events) != len(events) {
+		diffs = append(diffs, "events.len: got "+strconv.Itoa(len(f.events))+", want "+strconv.Itoa(len(events)))
+	}
+	for i := 0; i < len(f.events) && i < len(events); i++ {
+		diffs = append(diffs, f.diffEvent(i, f.events[i], events[i])...)
+	}
+
+	if len(diffs) > 0 {
+		f.t.Errorf("evoltest: unexpected events:\n\t%s\npublished:\n%s", strings.Join(diffs, "\n\t"), describe(f.events))
+	}
+	return f
+}
+
+// ThenNoEvents asserts the command succeeded without publishing any event.
+func (f *AggregateFixture) ThenNoEvents() *AggregateFixture {
+	f.t.Helper()
+	return f.ThenEvents()
+}
+
+// ThenError asserts the command failed with an error matching want with errors.Is,
+// or with any error when want is nil.
+func (f *AggregateFixture) ThenError(want error) *AggregateFixture {
+	f.t.Helper()
+	f.requireWhen("ThenError")
+
+	switch {
+	case f.err == nil:
+		f.t.Errorf("evoltest: command succeeded, want error %v\npublished:\n%s", want, describe(f.events))
+	case want != nil && !errors.Is(f.err, want):
+		f.t.Errorf("evoltest: command failed with %q, want %q", f.err, want)
+	}
+	return f
+}
+
+// ThenErrorContains asserts the command failed with an error containing substr.
+func (f *AggregateFixture) ThenErrorContains(substr string) *AggregateFixture {
+	f.t.Helper()
+	f.requireWhen("ThenErrorContains")
+
+	if f.err == nil || !strings.Contains(f.err.Error(), substr) {
+		f.t.Errorf("evoltest: command error %v, want an error containing %q", f.err, substr)
+	}
+	return f
+}
+
+// ThenState runs check on the aggregate, after the published events were applied to it.
+func (f *AggregateFixture) ThenState(check func(t testing.TB, a evol.Aggregate)) *AggregateFixture {
+	f.t.Helper()
+
+	check(f.t, f.aggregate)
+	return f
+}
+
+// ThenStateEquals compares the exported fields of the aggregate with want, usually
+// an aggregate of the same type with the expected fields set.
+func (f *AggregateFixture) ThenStateEquals(want evol.Aggregate) *AggregateFixture {
+	f.t.Helper()
+
+	if diffs := Diff(f.aggregate, want, f.ignore...); len(diffs) > 0 {
+		f.t.Errorf("evoltest: unexpected state of %s %s:\n\t%s", f.aggregate.AggregateType(), f.aggregate.EntityIdentity(), strings.Join(diffs, "\n\t"))
+	}
+	return f
+}
+
+func (f *AggregateFixture) requireWhen(assertion string) {
+	f.t.Helper()
+
+	if !f.when {
+		f.t.Fatalf("evoltest: %s called before When", assertion)
+	}
+}
+
+func (f *AggregateFixture) diffEvent(i int, got, want evol.Event) []string {
+	prefix := "events[" + strconv.Itoa(i) + "]"
+
+	var diffs []string
+	if got.Topic() != want.Topic() {
+		diffs = append(diffs, prefix+".Topic: got "+string(got.Topic())+", want "+string(want.Topic()))
+	}
+	if want.AggregateType() != "" && (got.AggregateType() != want.AggregateType() || got.AggregateIdentity() != want.AggregateIdentity()) {
+		diffs = append(diffs, prefix+".Aggregate: got "+string(got.AggregateType())+" "+got.AggregateIdentity()+
+			", want "+string(want.AggregateType())+" "+want.AggregateIdentity())
+	}
+	if want.Version() != 0 && got.Version() != want.Version() {
+		diffs = append(diffs, prefix+".Version: got "+strconv.Itoa(got.Version())+", want "+strconv.Itoa(want.Version()))
+	}
+	return append(diffs, diffAt(prefix+".Data", got.Data(), want.Data(), f.ignore)...)
+}
+
+// describe lists events one per line for failure messages
+func describe(events []evol.Event) string {
+	if len(events) == 0 {
+		return "\t(none)"
+	}
+
+	lines := make([]string, len(events))
+	for i, e := range events {
+		lines[i] = fmt.Sprintf("\t[%d] %s v%d %+v", i, e.Topic(), e.Version(), e.Data())
+	}
+	return strings.Join(lines, "\n")
+}
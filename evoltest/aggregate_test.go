@@ -0,0 +1,210 @@
+package evoltest
+
+import (
+	"context"
+	"errors"
+	"evol"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeT records the failures reported by the assertions under test
+type fakeT struct {
+	testing.TB
+	failures []string
+	fatal    bool
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Error(args ...interface{}) {
+	t.failures = append(t.failures, fmt.Sprint(args...))
+}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.failures = append(t.failures, fmt.Sprintf(format, args...))
+}
+
+func (t *fakeT) Fatalf(format string, args ...interface{}) {
+	t.Errorf(format, args...)
+	t.fatal = true
+	runtime.Goexit()
+}
+
+// run runs f with a fakeT in its own goroutine, so Fatalf stops f only
+func run(f func(t testing.TB)) *fakeT {
+	t := &fakeT{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f(t)
+	}()
+	<-done
+	return t
+}
+
+// assertPasses fails when the fixture reported a failure
+func assertPasses(t *testing.T, ft *fakeT) {
+	t.Helper()
+	if len(ft.failures) > 0 {
+		t.Fatalf("unexpected failures:\n%s", strings.Join(ft.failures, "\n"))
+	}
+}
+
+// assertFails fails unless the fixture reported one failure containing each of msgs
+func assertFails(t *testing.T, ft *fakeT, msgs ...string) {
+	t.Helper()
+	if len(ft.failures) != 1 {
+		t.Fatalf("got %d failures, want 1: %q", len(ft.failures), ft.failures)
+	}
+	for _, msg := range msgs {
+		if !strings.Contains(ft.failures[0], msg) {
+			t.Errorf("failure %q does not contain %q", ft.failures[0], msg)
+		}
+	}
+}
+
+const counterType evol.AggregateType = "Counter"
+
+var errTooMuch = errors.New("too much")
+
+type addCmd struct {
+	Id string
+	N  int
+}
+
+func (c *addCmd) Name() evol.CommandName                  { return "AddCmd" }
+func (c *addCmd) TargetAggregateType() evol.AggregateType { return counterType }
+func (c *addCmd) TargetIdentity() string                  { return c.Id }
+
+type added struct {
+	N  int
+	At time.Time
+}
+
+// counter adds up to 10
+type counter struct {
+	*evol.BaseAggregate
+	Total int
+}
+
+func newCounter(id string) *counter {
+	return &counter{BaseAggregate: evol.NewBaseAggregate(counterType, id)}
+}
+
+func (c *counter) HandleCommand(ctx context.Context, cmd evol.Command) error {
+	add := cmd.(*addCmd)
+	if c.Total+add.N > 10 {
+		return fmt.Errorf("add %d: %w", add.N, errTooMuch)
+	}
+	c.PublishEvent("Added", &added{N: add.N, At: time.Now()}, time.Now(), c)
+	return nil
+}
+
+func (c *counter) HandleSourcingEvent(ctx context.Context, e evol.Event) error {
+	c.Total += e.Data().(*added).N
+	return nil
+}
+
+func TestAggregateFixturePasses(t *testing.T) {
+	ft := run(func(t testing.TB) {
+		ForAggregate(t, newCounter("c1")).
+			IgnoreFields("At").
+			Given(Event("Added", &added{N: 2}), Event("Added", &added{N: 3})).
+			When(&addCmd{Id: "c1", N: 4}).
+			ThenEvents(evol.NewEvent("Added", &added{N: 4}, time.Time{}, evol.ForAggregate(counterType, "c1"), evol.WithVersion(3))).
+			ThenStateEquals(&counter{Total: 9}).
+			ThenState(func(t testing.TB, a evol.Aggregate) {
+				if v := a.(*counter).AggregateVersion(); v != 2 {
+					t.Errorf("version %d", v)
+				}
+			})
+
+		ForAggregate(t, newCounter("c2")).
+			Given(Event("Added", &added{N: 8})).
+			When(&addCmd{Id: "c2", N: 4}).
+			ThenError(errTooMuch).
+			ThenErrorContains("add 4").
+			ThenStateEquals(&counter{Total: 8})
+	})
+	assertPasses(t, ft)
+}
+
+func TestAggregateFixtureFails(t *testing.T) {
+	when := func(t testing.TB, n int) *AggregateFixture {
+		return ForAggregate(t, newCounter("c1")).IgnoreFields("At").When(&addCmd{Id: "c1", N: n})
+	}
+
+	tests := []struct {
+		name   string
+		assert func(t testing.TB)
+		msgs   []string
+	}{
+		{"other data", func(t testing.TB) {
+			when(t, 1).ThenEvents(Event("Added", &added{N: 2}))
+		}, []string{"unexpected events", "events[0].Data.N: got 1, want 2", "[0] Added v1"}},
+		{"missing event", func(t testing.TB) {
+			when(t, 1).ThenEvents(Event("Added", &added{N: 1}), Event("Added", &added{N: 1}))
+		}, []string{"events.len: got 1, want 2"}},
+		{"other topic", func(t testing.TB) {
+			when(t, 1).ThenEvents(Event("Removed", &added{N: 1}))
+		}, []string{"events[0].Topic: got Added, want Removed"}},
+		{"other version", func(t testing.TB) {
+			when(t, 1).ThenEvents(evol.NewEvent("Added", &added{N: 1}, time.Time{}, evol.WithVersion(2)))
+		}, []string{"events[0].Version: got 1, want 2"}},
+		{"events", func(t testing.TB) {
+			when(t, 1).ThenNoEvents()
+		}, []string{"events.len: got 1, want 0"}},
+		{"failed command", func(t testing.TB) {
+			when(t, 11).ThenNoEvents()
+		}, []string{"command failed: add 11: too much"}},
+		{"no error", func(t testing.TB) {
+			when(t, 1).ThenError(nil)
+		}, []string{"command succeeded", "[0] Added v1"}},
+		{"other error", func(t testing.TB) {
+			when(t, 11).ThenError(context.Canceled)
+		}, []string{`failed with "add 11: too much", want "context canceled"`}},
+		{"error text", func(t testing.TB) {
+			when(t, 11).ThenErrorContains("add 12")
+		}, []string{`want an error containing "add 12"`}},
+		{"state", func(t testing.TB) {
+			when(t, 1).ThenStateEquals(&counter{Total: 2})
+		}, []string{"unexpected state of Counter c1", "Total: got 1, want 2"}},
+		{"state check", func(t testing.TB) {
+			when(t, 1).ThenState(func(t testing.TB, a evol.Aggregate) { t.Error("bad state") })
+		}, []string{"bad state"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ft := run(tt.assert)
+			assertFails(t, ft, tt.msgs...)
+			if ft.fatal {
+				t.Error("failed assertion stopped the test")
+			}
+		})
+	}
+}
+
+func TestAggregateFixtureFatal(t *testing.T) {
+	ft := run(func(t testing.TB) {
+		ForAggregate(t, newCounter("c1")).ThenEvents()
+		t.Error("not stopped")
+	})
+	assertFails(t, ft, "ThenEvents called before When")
+
+	ft = run(func(t testing.TB) {
+		ForAggregate(t, newCounter("c1")).When(&addCmd{Id: "c1", N: 1}).When(&addCmd{Id: "c1", N: 1})
+	})
+	assertFails(t, ft, "When called twice")
+
+	ft = run(func(t testing.TB) {
+		NewAggregateFixture(t, "Unregistered", "u1")
+	})
+	assertFails(t, ft, "could not create Unregistered u1")
+	if !ft.fatal {
+		t.Error("fixture of an unregistered aggregate did not stop the test")
+	}
+}
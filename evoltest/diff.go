@@ -0,0 +1,153 @@
+package evoltest
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// differ compares values field by field, only exported struct fields are compared
+type differ struct {
+	ignore map[string]bool
+	diffs  []string
+}
+
+func newDiffer(ignore []string) *differ {
+	d := &differ{ignore: map[string]bool{}}
+	for _, name := range ignore {
+		d.ignore[name] = true
+	}
+	return d
+}
+
+// Diff returns a line per difference between got and want, empty when they are equal.
+// Unexported struct fields and the fields named in ignore are not compared,
+// time.Time values are compared with Equal.
+func Diff(got, want interface{}, ignore ...string) []string {
+	diffs := diffAt("", got, want, ignore)
+	for i, d := range diffs {
+		diffs[i] = strings.TrimPrefix(d, ".")
+	}
+	return diffs
+}
+
+// diffAt is Diff with paths starting at path.
+func diffAt(path string, got, want interface{}, ignore []string) []string {
+	d := newDiffer(ignore)
+	d.diff(path, reflect.ValueOf(got), reflect.ValueOf(want))
+	return d.diffs
+}
+
+func (d *differ) report(path string, got, want string) {
+	if path == "" {
+		path = "value"
+	}
+	d.diffs = append(d.diffs, fmt.Sprintf("%s: got %s, want %s", path, got, want))
+}
+
+func (d *differ) diff(path string, got, want reflect.Value) {
+	if !got.IsValid() || !want.IsValid() {
+		if got.IsValid() != want.IsValid() {
+			d.report(path, format(got), format(want))
+		}
+		return
+	}
+
+	if got.Type() != want.Type() {
+		d.report(path, fmt.Sprintf("%s %s", got.Type(), format(got)), fmt.Sprintf("%s %s", want.Type(), format(want)))
+		return
+	}
+
+	switch got.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if got.IsNil() || want.IsNil() {
+			if got.IsNil() != want.IsNil() {
+				d.report(path, format(got), format(want))
+			}
+			return
+		}
+		d.diff(path, got.Elem(), want.Elem())
+	case reflect.Struct:
+		if got.Type() == timeType && got.CanInterface() {
+			if !got.Interface().(time.Time).Equal(want.Interface().(time.Time)) {
+				d.report(path, format(got), format(want))
+			}
+			return
+		}
+		for i := 0; i < got.NumField(); i++ {
+			field := got.Type().Field(i)
+			if field.PkgPath != "" || d.ignore[field.Name] || !exported(field.Type) {
+				continue
+			}
+			d.diff(path+"."+field.Name, got.Field(i), want.Field(i))
+		}
+	case reflect.Slice, reflect.Array:
+		if got.Len() != want.Len() {
+			d.report(path+".len", fmt.Sprint(got.Len()), fmt.Sprint(want.Len()))
+		}
+		for i := 0; i < got.Len() && i < want.Len(); i++ {
+			d.diff(fmt.Sprintf("%s[%d]", path, i), got.Index(i), want.Index(i))
+		}
+	case reflect.Map:
+		keys := map[string]reflect.Value{}
+		for _, k := range append(got.MapKeys(), want.MapKeys()...) {
+			keys[fmt.Sprint(k.Interface())] = k
+		}
+		names := make([]string, 0, len(keys))
+		for name := range keys {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			d.diff(fmt.Sprintf("%s[%s]", path, name), got.MapIndex(keys[name]), want.MapIndex(keys[name]))
+		}
+	case reflect.Func:
+		if !got.IsNil() || !want.IsNil() {
+			d.report(path, "func", "func, functions are not comparable")
+		}
+	default:
+		if got.CanInterface() && !reflect.DeepEqual(got.Interface(), want.Interface()) {
+			d.report(path, format(got), format(want))
+		}
+	}
+}
+
+// exported reports whether values of t have exported state, a struct like
+// evol.BaseAggregate with unexported fields only is left out of comparisons.
+func exported(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType {
+		return true
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).PkgPath == "" {
+			return true
+		}
+	}
+	return false
+}
+
+func format(v reflect.Value) string {
+	if !v.IsValid() {
+		return "<nil>"
+	}
+	if !v.CanInterface() {
+		return "<unexported>"
+	}
+	switch i := v.Interface().(type) {
+	case string:
+		return fmt.Sprintf("%q", i)
+	case time.Time:
+		return i.Format(time.RFC3339Nano)
+	}
+	if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+		return "<nil>"
+	}
+	return fmt.Sprintf("%+v", v.Interface())
+}
@@ -0,0 +1,365 @@
+package evoltest
+
+import (
+	"context"
+	"errors"
+	"evol"
+	"evol/saga"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// FakeClock is a saga.Clock only moving when told to.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFakeClock creates a FakeClock set to now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// CommandRecorder is a command bus keeping every command it receives,
+// commands succeed unless stubbed.
+type CommandRecorder struct {
+	mu       sync.Mutex
+	commands []evol.Command
+	stubs    map[evol.CommandName]evol.CommandHandlerFunc
+}
+
+// NewCommandRecorder creates a CommandRecorder.
+func NewCommandRecorder() *CommandRecorder {
+	return &CommandRecorder{stubs: map[evol.CommandName]evol.CommandHandlerFunc{}}
+}
+
+func (r *CommandRecorder) HandleCommand(ctx context.Context, cmd evol.Command) error {
+	r.mu.Lock()
+	r.commands = append(r.commands, cmd)
+	stub := r.stubs[cmd.Name()]
+	r.mu.Unlock()
+
+	if stub != nil {
+		return stub(ctx, cmd)
+	}
+	return nil
+}
+
+// Stub makes commands with that name go to h, which decides their outcome.
+func (r *CommandRecorder) Stub(name evol.CommandName, h evol.CommandHandlerFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.stubs[name] = h
+}
+
+// Commands returns the recorded commands in order.
+func (r *CommandRecorder) Commands() []evol.Command {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]evol.Command(nil), r.commands...)
+}
+
+// Reset forgets the recorded commands, the stubs are kept.
+func (r *CommandRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.commands = nil
+}
+
+// SagaFixture feeds events to a SagaManager with an in-memory repo, a CommandRecorder
+// as command bus and a FakeClock for deadlines.
+// The Then assertions check what happened since the last When or WhenTimeElapses.
+type SagaFixture struct {
+	t       testing.TB
+	ctx     context.Context
+	manager *saga.SagaManager
+	repo    evol.SagaRepo
+	bus     *CommandRecorder
+	clock   *FakeClock
+	ignore  []string
+
+	when  bool
+	last  sagaKey
+	err   error
+	ended map[sagaKey]bool
+}
+
+// sagaKey identifies a saga, saga identities are unique within a tenant
+type sagaKey struct {
+	tenant string
+	sagaId string
+}
+
+// NewSagaFixture creates a fixture for the sagas of m, such as saga.Manager("OrderSaga").
+// The fixture works on a copy of m, which is left untouched.
+func NewSagaFixture(t testing.TB, m *saga.SagaManager) *SagaFixture {
+	t.Helper()
+
+	if m == nil {
+		t.Fatalf("evoltest: no saga manager")
+	}
+
+	f := &SagaFixture{
+		t:     t,
+		ctx:   context.Background(),
+		repo:  saga.NewMemorySagaRepo(),
+		bus:   NewCommandRecorder(),
+		clock: NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)),
+		ended: map[sagaKey]bool{},
+	}
+	f.manager = saga.NewSagaManager(&saga.SagaManagerOpt{
+		SagaType:    m.SagaType,
+		StartEvents: m.StartEvents,
+		OnEvents:    m.OnEvents,
+		EndEvents:   m.EndEvents,
+		Resolver:    m.Resolver,
+		SagaFactory: m.SagaFactory,
+	})
+	f.manager.SagaRepo = f.repo
+	f.manager.CmdBus = f.bus
+	f.manager.Clock = f.clock
+	f.manager.Observer = (*sagaObserver)(f)
+	f.manager.Logger = evol.NopLogger()
+	return f
+}
+
+type sagaObserver SagaFixture
+
+func (o *sagaObserver) SagaStarted(ctx context.Context, _ string, sagaIdentity string) {
+	delete(o.ended, sagaKey{tenant: evol.TenantID(ctx), sagaId: sagaIdentity})
+}
+
+func (o *sagaObserver) SagaEnded(ctx context.Context, _ string, sagaIdentity string) {
+	o.ended[sagaKey{tenant: evol.TenantID(ctx), sagaId: sagaIdentity}] = true
+}
+
+// WithContext sets the context passed to the saga manager, see evol.ContextWithTenant for the sagas of a tenant.
+func (f *SagaFixture) WithContext(ctx context.Context) *SagaFixture {
+	f.ctx = ctx
+	return f
+}
+
+// IgnoreFields leaves out the struct fields with one of these names when comparing
+// commands and state, such as generated identifiers.
+func (f *SagaFixture) IgnoreFields(names ...string) *SagaFixture {
+	f.ignore = append(f.ignore, names...)
+	return f
+}
+
+// StubCommand makes commands with that name go to h, which decides their outcome.
+func (f *SagaFixture) StubCommand(name evol.CommandName, h evol.CommandHandlerFunc) *SagaFixture {
+	f.bus.Stub(name, h)
+	return f
+}
+
+// FailCommand makes commands with that name fail with err.
+func (f *SagaFixture) FailCommand(name evol.CommandName, err error) *SagaFixture {
+	return f.StubCommand(name, func(context.Context, evol.Command) error {
+		return err
+	})
+}
+
+// Clock returns the clock of the deadlines.
+func (f *SagaFixture) Clock() *FakeClock {
+	return f.clock
+}
+
+// Manager returns the saga manager under test.
+func (f *SagaFixture) Manager() *saga.SagaManager {
+	return f.manager
+}
+
+// Given handles events that happened before, failing the test on any error.
+func (f *SagaFixture) Given(events ...evol.Event) *SagaFixture {
+	f.t.Helper()
+
+	for _, e := range events {
+		f.resolve(e)
+		if err := f.manager.HandleEvent(f.ctx, e); err != nil {
+			f.t.Fatalf("evoltest: could not handle given event %s: %s", e.Topic(), err)
+		}
+	}
+	f.bus.Reset()
+	return f
+}
+
+// When handles an event, the commands sent and the error are kept for the Then assertions.
+func (f *SagaFixture) When(e evol.Event) *SagaFixture {
+	f.bus.Reset()
+	f.when = true
+	f.resolve(e)
+	f.err = f.manager.HandleEvent(f.ctx, e)
+	return f
+}
+
+// resolve keeps the saga of e, in the tenant of e or else of the fixture context, as the manager does
+func (f *SagaFixture) resolve(e evol.Event) {
+	ctx := evol.ContextWithMetadata(f.ctx, e.Metadata())
+	f.last = sagaKey{tenant: evol.TenantID(ctx), sagaId: f.manager.Resolver(e)}
+}
+
+// sagaContext is the context of the tenant and saga type of the last saga
+func (f *SagaFixture) sagaContext() context.Context {
+	return evol.ContextWithSagaType(evol.ContextWithTenant(f.ctx, f.last.tenant), f.manager.SagaType)
+}
+
+// WhenTimeElapses advances the clock by d and fires the deadlines due by then.
+func (f *SagaFixture) WhenTimeElapses(d time.Duration) *SagaFixture {
+	f.bus.Reset()
+	f.when = true
+	f.clock.Advance(d)
+	_, f.err = f.manager.FireDeadlines(f.ctx)
+	return f
+}
+
+// Commands returns the commands sent since the last When.
+func (f *SagaFixture) Commands() []evol.Command {
+	return f.bus.Commands()
+}
+
+// ThenCommands asserts exactly these commands were sent, in order.
+func (f *SagaFixture) ThenCommands(commands ...evol.Command) *SagaFixture {
+	f.t.Helper()
+	f.requireWhen("ThenCommands")
+
+	got := f.bus.Commands()
+	var diffs []string
+	if len(got) != len(commands) {
+		diffs = append(diffs, fmt.Sprintf("commands.len: got %d, want %d", len(got), len(commands)))
+	}
+	for i := 0; i < len(got) && i < len(commands); i++ {
+		diffs = append(diffs, diffAt(fmt.Sprintf("commands[%d]", i), got[i], commands[i], f.ignore)...)
+	}
+
+	if len(diffs) > 0 {
+		f.t.Errorf("evoltest: unexpected commands:\n\t%s\nsent:\n%s", strings.Join(diffs, "\n\t"), describeCommands(got))
+	}
+	return f
+}
+
+// ThenNoCommands asserts no command was sent.
+func (f *SagaFixture) ThenNoCommands() *SagaFixture {
+	f.t.Helper()
+	return f.ThenCommands()
+}
+
+// ThenError asserts handling failed with an error matching want with errors.Is,
+// or with any error when want is nil.
+func (f *SagaFixture) ThenError(want error) *SagaFixture {
+	f.t.Helper()
+	f.requireWhen("ThenError")
+
+	switch {
+	case f.err == nil:
+		f.t.Errorf("evoltest: saga succeeded, want error %v", want)
+	case want != nil && !errors.Is(f.err, want):
+		f.t.Errorf("evoltest: saga failed with %q, want %q", f.err, want)
+	}
+	return f
+}
+
+// ThenNoError asserts handling succeeded.
+func (f *SagaFixture) ThenNoError() *SagaFixture {
+	f.t.Helper()
+	f.requireWhen("ThenNoError")
+
+	if f.err != nil {
+		f.t.Errorf("evoltest: saga failed: %s", f.err)
+	}
+	return f
+}
+
+// ThenAlive asserts the saga of the last event is alive.
+func (f *SagaFixture) ThenAlive() *SagaFixture {
+	f.t.Helper()
+
+	s := f.repo.Load(f.sagaContext(), f.last.sagaId)
+	switch {
+	case f.ended[f.last]:
+		f.t.Errorf("evoltest: saga %s %s ended, want alive", f.manager.SagaType, f.last.sagaId)
+	case s == nil:
+		f.t.Errorf("evoltest: saga %s %s was never started, want alive", f.manager.SagaType, f.last.sagaId)
+	case !s.IsAlive():
+		f.t.Errorf("evoltest: saga %s %s is not alive", f.manager.SagaType, f.last.sagaId)
+	}
+	return f
+}
+
+// ThenEnded asserts the saga of the last event ended.
+func (f *SagaFixture) ThenEnded() *SagaFixture {
+	f.t.Helper()
+
+	if !f.ended[f.last] {
+		state := "was never started"
+		if s := f.repo.Load(f.sagaContext(), f.last.sagaId); s != nil {
+			state = fmt.Sprintf("is alive: %+v", s)
+		}
+		f.t.Errorf("evoltest: saga %s %s %s, want ended", f.manager.SagaType, f.last.sagaId, state)
+	}
+	return f
+}
+
+// ThenDeadline asserts the saga of the last event has a deadline of that name due after d from now.
+func (f *SagaFixture) ThenDeadline(name string, d time.Duration) *SagaFixture {
+	f.t.Helper()
+
+	want := f.clock.Now().Add(d)
+	deadlines := f.manager.Deadlines(f.sagaContext(), f.last.sagaId)
+	at, ok := deadlines[name]
+	switch {
+	case !ok:
+		f.t.Errorf("evoltest: saga %s %s has no deadline %s, deadlines: %v", f.manager.SagaType, f.last.sagaId, name, deadlines)
+	case !at.Equal(want):
+		f.t.Errorf("evoltest: deadline %s due in %s, want %s", name, at.Sub(f.clock.Now()), d)
+	}
+	return f
+}
+
+// ThenState runs check on the saga of the last event, nil when it ended.
+func (f *SagaFixture) ThenState(check func(t testing.TB, s evol.SagaHandler)) *SagaFixture {
+	f.t.Helper()
+
+	check(f.t, f.repo.Load(f.sagaContext(), f.last.sagaId))
+	return f
+}
+
+func (f *SagaFixture) requireWhen(assertion string) {
+	f.t.Helper()
+
+	if !f.when {
+		f.t.Fatalf("evoltest: %s called before When", assertion)
+	}
+}
+
+func describeCommands(commands []evol.Command) string {
+	if len(commands) == 0 {
+		return "\t(none)"
+	}
+
+	lines := make([]string, len(commands))
+	for i, cmd := range commands {
+		lines[i] = fmt.Sprintf("\t[%d] %s %+v", i, cmd.Name(), cmd)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,173 @@
+package evoltest
+
+import (
+	"context"
+	"errors"
+	"evol"
+	"evol/saga"
+	"testing"
+	"time"
+)
+
+type ticketCmd struct {
+	Action string
+	Id     string
+}
+
+func (c *ticketCmd) Name() evol.CommandName                  { return evol.CommandName(c.Action + "Cmd") }
+func (c *ticketCmd) TargetAggregateType() evol.AggregateType { return "Ticket" }
+func (c *ticketCmd) TargetIdentity() string                  { return c.Id }
+
+type ticketEvent struct {
+	Id string
+}
+
+// ticketSaga assigns opened tickets and escalates them when they are not closed within an hour
+type ticketSaga struct {
+	*saga.BaseSaga
+	Events int
+}
+
+func (s *ticketSaga) HandleSagaEvent(ctx context.Context, e evol.Event, bus evol.CommandHandler) error {
+	s.Events++
+	if e.Topic() != "Opened" {
+		return nil
+	}
+	if err := bus.HandleCommand(ctx, &ticketCmd{Action: "Assign", Id: s.SagaIdentity()}); err != nil {
+		return err
+	}
+	return saga.ScheduleDeadline(ctx, "escalate", time.Hour)
+}
+
+func (s *ticketSaga) HandleDeadline(ctx context.Context, name string, bus evol.CommandHandler) error {
+	s.EndSaga()
+	return bus.HandleCommand(ctx, &ticketCmd{Action: "Escalate", Id: s.SagaIdentity()})
+}
+
+func ticketManager() *saga.SagaManager {
+	return saga.NewSagaManager(&saga.SagaManagerOpt{
+		SagaType:    "TicketSaga",
+		StartEvents: []evol.Topic{"Opened"},
+		OnEvents:    []evol.Topic{"Commented"},
+		EndEvents:   []evol.Topic{"Closed"},
+		Resolver: func(e evol.Event) string {
+			return e.Data().(*ticketEvent).Id
+		},
+		SagaFactory: func(sagaType string, sagaIdentity string) evol.SagaHandler {
+			return &ticketSaga{BaseSaga: saga.NewBaseSaga(sagaIdentity, sagaType)}
+		},
+	})
+}
+
+func ticket(topic evol.Topic, id string) evol.Event {
+	return Event(topic, &ticketEvent{Id: id})
+}
+
+func TestSagaFixturePasses(t *testing.T) {
+	ft := run(func(t testing.TB) {
+		f := NewSagaFixture(t, ticketManager())
+		f.When(ticket("Opened", "t1")).
+			ThenNoError().
+			ThenCommands(&ticketCmd{Action: "Assign", Id: "t1"}).
+			ThenDeadline("escalate", time.Hour).
+			ThenAlive()
+		f.When(ticket("Commented", "t1")).
+			ThenNoCommands().
+			ThenState(func(t testing.TB, s evol.SagaHandler) {
+				if n := s.(*ticketSaga).Events; n != 2 {
+					t.Errorf("%d events", n)
+				}
+			})
+		f.WhenTimeElapses(59 * time.Minute).ThenNoCommands().ThenAlive()
+		f.WhenTimeElapses(time.Minute).
+			ThenCommands(&ticketCmd{Action: "Escalate", Id: "t1"}).
+			ThenEnded()
+
+		NewSagaFixture(t, ticketManager()).
+			Given(ticket("Opened", "t2")).
+			When(ticket("Closed", "t2")).
+			ThenNoCommands().
+			ThenEnded()
+
+		boom := errors.New("boom")
+		NewSagaFixture(t, ticketManager()).
+			FailCommand("AssignCmd", boom).
+			When(ticket("Opened", "t3")).
+			ThenError(boom)
+	})
+	assertPasses(t, ft)
+}
+
+func TestSagaFixtureFails(t *testing.T) {
+	opened := func(t testing.TB) *SagaFixture {
+		return NewSagaFixture(t, ticketManager()).When(ticket("Opened", "t1"))
+	}
+
+	tests := []struct {
+		name   string
+		assert func(t testing.TB)
+		msgs   []string
+	}{
+		{"other command", func(t testing.TB) {
+			opened(t).ThenCommands(&ticketCmd{Action: "Assign", Id: "t2"})
+		}, []string{"unexpected commands", `commands[0].Id: got "t1", want "t2"`, "[0] AssignCmd"}},
+		{"commands", func(t testing.TB) {
+			opened(t).ThenNoCommands()
+		}, []string{"commands.len: got 1, want 0"}},
+		{"no error", func(t testing.TB) {
+			opened(t).ThenError(nil)
+		}, []string{"saga succeeded"}},
+		{"error", func(t testing.TB) {
+			NewSagaFixture(t, ticketManager()).FailCommand("AssignCmd", errors.New("boom")).
+				When(ticket("Opened", "t1")).ThenNoError()
+		}, []string{"saga failed: boom"}},
+		{"alive", func(t testing.TB) {
+			opened(t).ThenEnded()
+		}, []string{"saga TicketSaga t1 is alive", "want ended"}},
+		{"ended", func(t testing.TB) {
+			NewSagaFixture(t, ticketManager()).Given(ticket("Opened", "t1")).
+				When(ticket("Closed", "t1")).ThenAlive()
+		}, []string{"saga TicketSaga t1 ended, want alive"}},
+		{"never started", func(t testing.TB) {
+			NewSagaFixture(t, ticketManager()).ThenAlive()
+		}, []string{"was never started, want alive"}},
+		{"no deadline", func(t testing.TB) {
+			opened(t).ThenDeadline("close", time.Hour)
+		}, []string{"has no deadline close"}},
+		{"other deadline", func(t testing.TB) {
+			opened(t).ThenDeadline("escalate", time.Minute)
+		}, []string{"deadline escalate due in 1h0m0s, want 1m0s"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ft := run(tt.assert)
+			assertFails(t, ft, tt.msgs...)
+		})
+	}
+}
+
+func TestSagaFixtureTenants(t *testing.T) {
+	acme := evol.Metadata{evol.TenantIDKey: "acme"}
+	withTenant := func(e evol.Event, md evol.Metadata) evol.Event {
+		return evol.CopyEvent(e, evol.WithMetadata(md))
+	}
+
+	ft := run(func(t testing.TB) {
+		f := NewSagaFixture(t, ticketManager()).
+			Given(ticket("Opened", "t1"), withTenant(ticket("Opened", "t1"), acme))
+
+		// the saga of the default tenant ends, the one of acme is alive
+		f.When(ticket("Closed", "t1")).ThenEnded()
+		f.When(withTenant(ticket("Commented", "t1"), acme)).ThenAlive()
+
+		f.WithContext(evol.ContextWithTenant(context.Background(), "acme")).
+			When(ticket("Commented", "t1")).
+			ThenAlive().
+			ThenState(func(t testing.TB, s evol.SagaHandler) {
+				if n := s.(*ticketSaga).Events; n != 3 {
+					t.Errorf("%d events", n)
+				}
+			})
+	})
+	assertPasses(t, ft)
+}
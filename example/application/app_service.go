@@ -4,6 +4,7 @@ import (
 	"context"
 	"evol"
 	"evol/example/request"
+	"evol/typed"
 
 	"evol/example/domain"
 )
@@ -33,7 +34,10 @@ func PayOrder(ctx context.Context, req *request.PayOrderRequest) {
 }
 
 func QueryOrders(ctx context.Context, uid string) Orders {
-	orders := domain.QueryUserOrders(uid)
+	orders, err := typed.Ask[[]domain.Order](ctx, domain.Queries, domain.UserOrdersQuery{BuyerId: uid})
+	if err != nil {
+		evol.GetLogger().Error("could not query orders", evol.LogKeyError, err)
+	}
 	return Orders{
 		orders: orders,
 	}
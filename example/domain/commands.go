@@ -1,122 +1,45 @@
 package domain
 
-import (
-	"evol"
-)
+//go:generate go run evol/cmd/evolgen
 
 //CreateOrderCmd sent to Order Aggregate to  make a new order
+//evol:command aggregate=OrderAggregateType policy=create
 type CreateOrderCmd struct {
-	OrderId string
+	OrderId string `evol:"target"`
 	BuyerId string
 	Price   float32
 	Goods   []string
 }
 
-func (o *CreateOrderCmd) Name() evol.CommandName {
-	return "CreateOrderCmd"
-}
-
-func (o *CreateOrderCmd) TargetAggregateType() evol.AggregateType {
-	return OrderAggregateType
-}
-
-func (o *CreateOrderCmd) TargetIdentity() string {
-	return o.OrderId
-}
-
+//evol:command aggregate=OrderAggregateType policy=exist
 type CancelOrderCmd struct {
-	OrderId string
+	OrderId string `evol:"target"`
 	Reason  string
 }
 
-func (c *CancelOrderCmd) Name() evol.CommandName {
-	return "CancelOrderCmd"
-}
-
-func (c *CancelOrderCmd) TargetAggregateType() evol.AggregateType {
-	return OrderAggregateType
-}
-
-func (c *CancelOrderCmd) TargetIdentity() string {
-	return c.OrderId
-}
-
+//evol:command aggregate=StockAggregateType
 type MakeReservationCmd struct {
 	OrderId   string
-	ProductId string //target aggregate identity
+	ProductId string `evol:"target"`
 	Count     int
 }
 
-func (m *MakeReservationCmd) Name() evol.CommandName {
-	return "MakeReservationCmd"
-}
-
-func (m *MakeReservationCmd) TargetAggregateType() evol.AggregateType {
-	return StockAggregateType
-}
-
-func (m *MakeReservationCmd) TargetIdentity() string {
-	return m.ProductId
-}
-
+//evol:command aggregate=StockAggregateType
 type RollBackReservationCmd struct {
 	OrderId   string
-	ProductId string //target aggregate identity
+	ProductId string `evol:"target"`
 	Count     int
 }
 
-func (r *RollBackReservationCmd) Name() evol.CommandName {
-	return "RollBackReservationCmd"
-}
-
-func (r *RollBackReservationCmd) TargetAggregateType() evol.AggregateType {
-	return StockAggregateType
-}
-
-func (r *RollBackReservationCmd) TargetIdentity() string {
-	return r.ProductId
-}
-
+//evol:command aggregate=PaymentAggregateType policy=create
 type PayOrderCmd struct {
-	PaymentId string
+	PaymentId string `evol:"target"`
 	OrderId   string
 	BuyerId   string
 	Amount    float32
 }
 
-func (p *PayOrderCmd) Name() evol.CommandName {
-	return "PayOrderCmd"
-}
-
-func (p *PayOrderCmd) TargetAggregateType() evol.AggregateType {
-	return PaymentAggregateType
-}
-
-func (p *PayOrderCmd) TargetIdentity() string {
-	return p.PaymentId
-}
-
+//evol:command aggregate=OrderAggregateType policy=exist
 type OrderConfirmedCmd struct {
-	OrderId string
-}
-
-func (o *OrderConfirmedCmd) Name() evol.CommandName {
-	return "OrderConfirmedCmd"
-}
-
-func (o *OrderConfirmedCmd) TargetAggregateType() evol.AggregateType {
-	return OrderAggregateType
-}
-
-func (o *OrderConfirmedCmd) TargetIdentity() string {
-	return o.OrderId
-}
-
-func init() {
-	evol.RegisterCommand(&CreateOrderCmd{})
-	evol.RegisterCommand(&CancelOrderCmd{})
-	evol.RegisterCommand(&MakeReservationCmd{})
-	evol.RegisterCommand(&RollBackReservationCmd{})
-	evol.RegisterCommand(&PayOrderCmd{})
-	evol.RegisterCommand(&OrderConfirmedCmd{})
+	OrderId string `evol:"target"`
 }
@@ -3,21 +3,33 @@ package domain
 import (
 	"context"
 	"evol"
+	"evol/typed"
 )
 
 func init() {
+	typed.RegisterEventHandler(evol.DefaultRegistry, ProjectOrderCreated)
 	evol.RegisterEventHandlers(
 		evol.EventHandlerFunc(OrderEventFuncHandler),
-		OrderCreatedEventTopic,
 		OrderPayedEventTopic,
 		OrderConfirmedEventTopic,
 		OrderCanceledEventTopic)
 }
 
+// ProjectOrderCreated adds created orders to the orders of their buyer
+func ProjectOrderCreated(ctx context.Context, e typed.Event[OrderCreatedEvent]) error {
+	data := e.Payload()
+	Orders[data.BuyerId] = append(Orders[data.BuyerId], Order{
+		OrderId:    data.OrderId,
+		BuyerId:    data.BuyerId,
+		TotalPrice: data.TotalPrice,
+		ProductIds: data.ProductIds,
+		Status:     "CREATED",
+	})
+	return nil
+}
+
 func OrderEventFuncHandler(ctx context.Context, event evol.Event) error {
 	switch event.Topic() {
-	case OrderCreatedEventTopic:
-		//TODO:
 	case OrderPayedEventTopic:
 		//TODO:
 	case OrderConfirmedEventTopic:
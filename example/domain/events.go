@@ -5,32 +5,28 @@ import (
 	"time"
 )
 
+// topics of the events without data, the other topics are generated by evolgen
 const (
-	OrderCreatedEventTopic evol.Topic = "OrderCreatedEvent"
-
-	ProductReservedEventTopic      evol.Topic = "ProductReservedEvent"
-	ProductReserveFailedEventTopic evol.Topic = "ProductReserveFailedEvent"
-
-	OrderPayedEventTopic     evol.Topic = "OrderPayedEvent"
-	OrderPayFailedEventTopic evol.Topic = "OrderPayFailedEvent"
-
 	OrderConfirmedEventTopic evol.Topic = "OrderConfirmedEvent"
 	OrderCanceledEventTopic  evol.Topic = "OrderCanceledEvent"
 )
 
+//evol:event
 type OrderCreatedEvent struct {
 	OrderId    string
-	BuyerId    string
+	BuyerId    string `pii:"BuyerId"`
 	TotalPrice float32
 	ProductIds []string
 }
 
+//evol:event
 type ProductReservedEvent struct {
 	ProductId string
 	OrderId   string
 	Count     int
 }
 
+//evol:event
 type ProductReserveFailedEvent struct {
 	ProductId string
 	OrderId   string
@@ -38,6 +34,7 @@ type ProductReserveFailedEvent struct {
 	Reason    string
 }
 
+//evol:event
 type OrderPayedEvent struct {
 	PaymentId string
 	OrderId   string
@@ -45,6 +42,7 @@ type OrderPayedEvent struct {
 	Time      time.Time
 }
 
+//evol:event
 type OrderPayFailedEvent struct {
 	PaymentId string
 	OrderId   string
@@ -0,0 +1,195 @@
+// Code generated by evolgen. DO NOT EDIT.
+
+package domain
+
+import (
+	"evol"
+	"evol/codec"
+)
+
+const (
+	OrderCreatedEventTopic         evol.Topic = "OrderCreatedEvent"
+	ProductReservedEventTopic      evol.Topic = "ProductReservedEvent"
+	ProductReserveFailedEventTopic evol.Topic = "ProductReserveFailedEvent"
+	OrderPayedEventTopic           evol.Topic = "OrderPayedEvent"
+	OrderPayFailedEventTopic       evol.Topic = "OrderPayFailedEvent"
+)
+
+func (c *CreateOrderCmd) Name() evol.CommandName {
+	return "CreateOrderCmd"
+}
+
+func (c *CreateOrderCmd) TargetAggregateType() evol.AggregateType {
+	return OrderAggregateType
+}
+
+func (c *CreateOrderCmd) TargetIdentity() string {
+	return c.OrderId
+}
+
+func (*CreateOrderCmd) CreationPolicy() evol.CreationPolicy {
+	return evol.MustCreate
+}
+
+func (c *CancelOrderCmd) Name() evol.CommandName {
+	return "CancelOrderCmd"
+}
+
+func (c *CancelOrderCmd) TargetAggregateType() evol.AggregateType {
+	return OrderAggregateType
+}
+
+func (c *CancelOrderCmd) TargetIdentity() string {
+	return c.OrderId
+}
+
+func (*CancelOrderCmd) CreationPolicy() evol.CreationPolicy {
+	return evol.MustExist
+}
+
+func (m *MakeReservationCmd) Name() evol.CommandName {
+	return "MakeReservationCmd"
+}
+
+func (m *MakeReservationCmd) TargetAggregateType() evol.AggregateType {
+	return StockAggregateType
+}
+
+func (m *MakeReservationCmd) TargetIdentity() string {
+	return m.ProductId
+}
+
+func (r *RollBackReservationCmd) Name() evol.CommandName {
+	return "RollBackReservationCmd"
+}
+
+func (r *RollBackReservationCmd) TargetAggregateType() evol.AggregateType {
+	return StockAggregateType
+}
+
+func (r *RollBackReservationCmd) TargetIdentity() string {
+	return r.ProductId
+}
+
+func (p *PayOrderCmd) Name() evol.CommandName {
+	return "PayOrderCmd"
+}
+
+func (p *PayOrderCmd) TargetAggregateType() evol.AggregateType {
+	return PaymentAggregateType
+}
+
+func (p *PayOrderCmd) TargetIdentity() string {
+	return p.PaymentId
+}
+
+func (*PayOrderCmd) CreationPolicy() evol.CreationPolicy {
+	return evol.MustCreate
+}
+
+func (o *OrderConfirmedCmd) Name() evol.CommandName {
+	return "OrderConfirmedCmd"
+}
+
+func (o *OrderConfirmedCmd) TargetAggregateType() evol.AggregateType {
+	return OrderAggregateType
+}
+
+func (o *OrderConfirmedCmd) TargetIdentity() string {
+	return o.OrderId
+}
+
+func (*OrderConfirmedCmd) CreationPolicy() evol.CreationPolicy {
+	return evol.MustExist
+}
+
+// Topic returns OrderCreatedEventTopic.
+func (*OrderCreatedEvent) Topic() evol.Topic {
+	return OrderCreatedEventTopic
+}
+
+// OrderCreatedEventFrom decodes the data of a OrderCreatedEventTopic event.
+func OrderCreatedEventFrom(e evol.Event) (*OrderCreatedEvent, error) {
+	data := new(OrderCreatedEvent)
+	if err := codec.DecodeData(e, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Topic returns ProductReservedEventTopic.
+func (*ProductReservedEvent) Topic() evol.Topic {
+	return ProductReservedEventTopic
+}
+
+// ProductReservedEventFrom decodes the data of a ProductReservedEventTopic event.
+func ProductReservedEventFrom(e evol.Event) (*ProductReservedEvent, error) {
+	data := new(ProductReservedEvent)
+	if err := codec.DecodeData(e, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Topic returns ProductReserveFailedEventTopic.
+func (*ProductReserveFailedEvent) Topic() evol.Topic {
+	return ProductReserveFailedEventTopic
+}
+
+// ProductReserveFailedEventFrom decodes the data of a ProductReserveFailedEventTopic event.
+func ProductReserveFailedEventFrom(e evol.Event) (*ProductReserveFailedEvent, error) {
+	data := new(ProductReserveFailedEvent)
+	if err := codec.DecodeData(e, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Topic returns OrderPayedEventTopic.
+func (*OrderPayedEvent) Topic() evol.Topic {
+	return OrderPayedEventTopic
+}
+
+// OrderPayedEventFrom decodes the data of a OrderPayedEventTopic event.
+func OrderPayedEventFrom(e evol.Event) (*OrderPayedEvent, error) {
+	data := new(OrderPayedEvent)
+	if err := codec.DecodeData(e, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Topic returns OrderPayFailedEventTopic.
+func (*OrderPayFailedEvent) Topic() evol.Topic {
+	return OrderPayFailedEventTopic
+}
+
+// OrderPayFailedEventFrom decodes the data of a OrderPayFailedEventTopic event.
+func OrderPayFailedEventFrom(e evol.Event) (*OrderPayFailedEvent, error) {
+	data := new(OrderPayFailedEvent)
+	if err := codec.DecodeData(e, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func init() {
+	if err := evol.RegisterCommand(&CreateOrderCmd{}); err != nil {
+		panic(err)
+	}
+	if err := evol.RegisterCommand(&CancelOrderCmd{}); err != nil {
+		panic(err)
+	}
+	if err := evol.RegisterCommand(&MakeReservationCmd{}); err != nil {
+		panic(err)
+	}
+	if err := evol.RegisterCommand(&RollBackReservationCmd{}); err != nil {
+		panic(err)
+	}
+	if err := evol.RegisterCommand(&PayOrderCmd{}); err != nil {
+		panic(err)
+	}
+	if err := evol.RegisterCommand(&OrderConfirmedCmd{}); err != nil {
+		panic(err)
+	}
+}
@@ -3,17 +3,22 @@ package domain
 import (
 	"context"
 	"evol"
-	"github.com/mitchellh/mapstructure"
+	"evol/typed"
 	"time"
 )
 
 func init() {
 	// Register Aggregate
 	evol.RegisterAggregate(OrderAggregateType, func(s string) evol.Aggregate {
-		return &OrderAggregate{
-			BaseAggregate: evol.NewBaseAggregate(OrderAggregateType, s),
-			OrderId:       s, //OrderId as Aggregate Identity
+		o := &OrderAggregate{
+			Aggregate: typed.NewAggregate(OrderAggregateType, s),
+			OrderId:   s, //OrderId as Aggregate Identity
 		}
+		typed.Handle(o.Aggregate, o.handleCreate)
+		typed.Handle(o.Aggregate, o.handleConfirm)
+		typed.Handle(o.Aggregate, o.handleCancel)
+		typed.Apply(o.Aggregate, o.applyCreated)
+		return o
 	})
 }
 
@@ -21,7 +26,7 @@ var OrderAggregateType evol.AggregateType = "OrderAggregate"
 
 //OrderAggregate Aggregate
 type OrderAggregate struct {
-	*evol.BaseAggregate
+	*typed.Aggregate
 	OrderId    string
 	BuyerId    string
 	TotalPrice float32
@@ -29,34 +34,32 @@ type OrderAggregate struct {
 	Status     string
 }
 
-func (o *OrderAggregate) HandleCommand(ctx context.Context, c evol.Command) error {
-	switch cmd := c.(type) {
-	case *CreateOrderCmd:
-		o.PublishEvent(OrderCreatedEventTopic, &OrderCreatedEvent{
-			OrderId:    cmd.OrderId,
-			BuyerId:    cmd.BuyerId,
-			TotalPrice: cmd.Price,
-			ProductIds: cmd.Goods,
-		}, time.Now(), o)
-
-	}
+func (o *OrderAggregate) handleCreate(ctx context.Context, cmd *CreateOrderCmd) error {
+	typed.Publish(o.Aggregate, OrderCreatedEvent{
+		OrderId:    cmd.OrderId,
+		BuyerId:    cmd.BuyerId,
+		TotalPrice: cmd.Price,
+		ProductIds: cmd.Goods,
+	}, time.Now())
 	return nil
 }
 
-func (o *OrderAggregate) HandleSourcingEvent(ctx context.Context, e evol.Event) error {
-	switch e.Topic() {
-	case OrderCreatedEventTopic:
-		o.Status = "CREATED"
-		ne := new(OrderCreatedEvent)
-		err := mapstructure.Decode(e.Data(), ne)
-		if err != nil {
-			return err
-		}
-		o.OrderId = ne.OrderId
-		o.BuyerId = ne.BuyerId
-		o.ProductIds = ne.ProductIds
-		o.TotalPrice = ne.TotalPrice
+func (o *OrderAggregate) handleConfirm(ctx context.Context, cmd *OrderConfirmedCmd) error {
+	//TODO:
+	return nil
+}
+
+func (o *OrderAggregate) handleCancel(ctx context.Context, cmd *CancelOrderCmd) error {
+	//TODO:
+	return nil
+}
 
-	}
+func (o *OrderAggregate) applyCreated(ctx context.Context, e typed.Event[OrderCreatedEvent]) error {
+	ne := e.Payload()
+	o.Status = "CREATED"
+	o.OrderId = ne.OrderId
+	o.BuyerId = ne.BuyerId
+	o.ProductIds = ne.ProductIds
+	o.TotalPrice = ne.TotalPrice
 	return nil
 }
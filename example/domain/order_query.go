@@ -1,14 +1,30 @@
 package domain
 
 import (
+	"context"
 	"evol"
 	"evol/repo/memory"
+	"evol/typed"
 )
 
 var repo evol.ReadRepository = &memory.ModelRepo{}
 
-func QueryUserOrders(uid string) []Order {
+// Queries answers the queries of the domain
+var Queries = typed.NewQueryBus()
+
+func init() {
+	if err := typed.RegisterQueryHandler(Queries, QueryUserOrders); err != nil {
+		panic(err)
+	}
+}
+
+// UserOrdersQuery asks for the orders of a buyer.
+type UserOrdersQuery struct {
+	BuyerId string
+}
+
+func QueryUserOrders(ctx context.Context, q UserOrdersQuery) ([]Order, error) {
 	//repo.Find(uid )
 
-	return Orders[uid] //access mock db
+	return Orders[q.BuyerId], nil //access mock db
 }
@@ -0,0 +1,23 @@
+package domain_test
+
+import (
+	"evol/evoltest"
+	"evol/example/domain"
+	"testing"
+)
+
+func TestPayOrder(t *testing.T) {
+	evoltest.NewAggregateFixture(t, domain.PaymentAggregateType, "p1").
+		IgnoreFields("Time").
+		When(&domain.PayOrderCmd{PaymentId: "p1", OrderId: "o1", BuyerId: "u100", Amount: 10}).
+		ThenEvents(evoltest.Event(domain.OrderPayedEventTopic, &domain.OrderPayedEvent{PaymentId: "p1", OrderId: "o1", Amount: 10})).
+		ThenStateEquals(&domain.PaymentAggregate{PaymentId: "p1", OrderId: "o1", Status: "PAYED", Amount: 10})
+}
+
+func TestPayOrderWithoutBalance(t *testing.T) {
+	evoltest.NewAggregateFixture(t, domain.PaymentAggregateType, "p2").
+		IgnoreFields("Time").
+		When(&domain.PayOrderCmd{PaymentId: "p2", OrderId: "o2", BuyerId: "nobody", Amount: 10}).
+		ThenEvents(evoltest.Event(domain.OrderPayFailedEventTopic, &domain.OrderPayFailedEvent{PaymentId: "p2", OrderId: "o2", Reason: "balance not enough"})).
+		ThenStateEquals(&domain.PaymentAggregate{PaymentId: "p2", OrderId: "o2", Status: "Failed"})
+}
@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"context"
+	"evol"
+	"evol/policy"
+)
+
+func init() {
+	p, err := policy.NewPolicy("ConfirmPayedOrder", []evol.Topic{OrderPayedEventTopic}, policy.Send(ConfirmPayedOrder))
+	if err != nil {
+		panic(err)
+	}
+	if err := policy.Register(p); err != nil {
+		panic(err)
+	}
+}
+
+// ConfirmPayedOrder confirms the orders once payed
+func ConfirmPayedOrder(ctx context.Context, e evol.Event) (evol.Command, error) {
+	evt, err := OrderPayedEventFrom(e)
+	if err != nil {
+		return nil, err
+	}
+	return &OrderConfirmedCmd{OrderId: evt.OrderId}, nil
+}
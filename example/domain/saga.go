@@ -8,6 +8,7 @@ import (
 	"github.com/mitchellh/mapstructure"
 	"github.com/thoas/go-funk"
 	"strconv"
+	"time"
 )
 
 func init() {
@@ -28,12 +29,20 @@ func init() {
 
 }
 
+// PaymentTimeout is how long OrderSaga waits for the payment of a reserved order
+var PaymentTimeout = 15 * time.Minute
+
+const paymentDeadline = "payment"
+
 func NewOrderSaga(sagaType string, sagaIdentity string) evol.SagaHandler {
 	return &OrderSaga{BaseSaga: saga.NewBaseSaga(sagaIdentity, sagaType)}
 }
 
+// Resolver uses the OrderId all saga events carry as saga identity
 func Resolver(e evol.Event) string {
-	return "OrderId"
+	var data struct{ OrderId string }
+	_ = mapstructure.Decode(e.Data(), &data)
+	return data.OrderId
 }
 
 // OrderSaga handle a transaction across aggregates
@@ -49,15 +58,16 @@ type OrderSaga struct {
 	ReservedProducts      []string
 	ReserveFailedProducts []string
 
-	toReserveNum int
-	needRollBack bool
+	// ToReserveNum counts the reservations not answered yet, NeedRollBack tells one of them failed.
+	// They are exported as the rest of the state, repos storing sagas as JSON keep them.
+	ToReserveNum int
+	NeedRollBack bool
 }
 
 func (o *OrderSaga) HandleSagaEvent(ctx context.Context, event evol.Event, bus evol.CommandHandler) error {
 	switch event.Topic() {
 	case OrderCreatedEventTopic: //start saga
-		evt := new(OrderCreatedEvent)
-		err := mapstructure.Decode(event.Data(), evt)
+		evt, err := OrderCreatedEventFrom(event)
 		if err != nil {
 			return err
 		}
@@ -65,6 +75,7 @@ func (o *OrderSaga) HandleSagaEvent(ctx context.Context, event evol.Event, bus e
 		o.AllProducts = evt.ProductIds
 		o.BuyerId = evt.BuyerId
 		o.TotalPrice = evt.TotalPrice
+		o.ToReserveNum = len(evt.ProductIds)
 
 		for _, productId := range evt.ProductIds {
 			cmd := &MakeReservationCmd{
@@ -77,50 +88,46 @@ func (o *OrderSaga) HandleSagaEvent(ctx context.Context, event evol.Event, bus e
 		}
 
 	case ProductReservedEventTopic:
-		evt := new(ProductReservedEvent)
-		err := mapstructure.Decode(event.Data(), evt)
+		evt, err := ProductReservedEventFrom(event)
 		if err != nil {
 			return err
 		}
 		if !funk.Contains(o.ReservedProducts, evt.ProductId) {
 			o.ReservedProducts = append(o.ReservedProducts, evt.ProductId)
 		}
-		o.toReserveNum--
-		if o.toReserveNum == 0 {
+		o.ToReserveNum--
+		if o.ToReserveNum == 0 {
 			return o.FinishReservation(ctx, bus)
 		}
 
 	case ProductReserveFailedEventTopic:
-		o.needRollBack = true
-		evt := new(ProductReserveFailedEvent)
-		err := mapstructure.Decode(event.Data(), evt)
+		o.NeedRollBack = true
+		evt, err := ProductReserveFailedEventFrom(event)
 		if err != nil {
 			return err
 		}
 		if !funk.Contains(o.ReserveFailedProducts, evt.ProductId) {
 			o.ReserveFailedProducts = append(o.ReserveFailedProducts, evt.ProductId)
 		}
-		o.toReserveNum--
-		if o.toReserveNum == 0 {
+		o.ToReserveNum--
+		if o.ToReserveNum == 0 {
 			return o.FinishReservation(ctx, bus)
 		}
 
 	case OrderPayedEventTopic:
-		evt := new(OrderPayedEvent)
-		err := mapstructure.Decode(event.Data(), evt)
-		if err != nil {
+		if _, err := OrderPayedEventFrom(event); err != nil {
 			return err
 		}
-		cmd := &OrderConfirmedCmd{
-			OrderId: o.OrderId,
+		if err := saga.CancelDeadline(ctx, paymentDeadline); err != nil {
+			return err
 		}
-		return bus.HandleCommand(ctx, cmd)
+		// the ConfirmPayedOrder policy confirms the order
+		o.EndSaga()
+		return nil
 
 	case OrderPayFailedEventTopic:
-		o.needRollBack = true
-		evt := new(OrderPayFailedEvent)
-		err := mapstructure.Decode(event.Data(), evt)
-		if err != nil {
+		o.NeedRollBack = true
+		if _, err := OrderPayFailedEventFrom(event); err != nil {
 			return err
 		}
 		o.RollBackOrder(ctx, bus)
@@ -137,7 +144,7 @@ func (o *OrderSaga) HandleSagaEvent(ctx context.Context, event evol.Event, bus e
 }
 
 func (o *OrderSaga) FinishReservation(ctx context.Context, bus evol.CommandHandler) error {
-	if o.needRollBack {
+	if o.NeedRollBack {
 		o.RollBackOrder(ctx, bus)
 		//cancel order
 		cmd := &CancelOrderCmd{
@@ -158,11 +165,28 @@ func (o *OrderSaga) FinishReservation(ctx context.Context, bus evol.CommandHandl
 			Amount:    o.TotalPrice,
 		}
 
-		return bus.HandleCommand(ctx, cmd)
+		if err := bus.HandleCommand(ctx, cmd); err != nil {
+			return err
+		}
+		return saga.ScheduleDeadline(ctx, paymentDeadline, PaymentTimeout)
 	}
 	return nil
 }
 
+// HandleDeadline cancels the order when it is not payed in time
+func (o *OrderSaga) HandleDeadline(ctx context.Context, name string, bus evol.CommandHandler) error {
+	if name != paymentDeadline {
+		return nil
+	}
+
+	o.RollBackOrder(ctx, bus)
+	o.EndSaga()
+	return bus.HandleCommand(ctx, &CancelOrderCmd{
+		OrderId: o.OrderId,
+		Reason:  "Pay Order Timeout",
+	})
+}
+
 func (o *OrderSaga) RollBackOrder(ctx context.Context, bus evol.CommandHandler) {
 	//rollback reserved products
 	for _, product := range o.ReservedProducts {
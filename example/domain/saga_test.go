@@ -0,0 +1,85 @@
+package domain_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"evol"
+	"evol/evoltest"
+	"evol/example/domain"
+	"evol/saga"
+	"testing"
+	"time"
+)
+
+func orderCreated() evol.Event {
+	return evoltest.Event(domain.OrderCreatedEventTopic, &domain.OrderCreatedEvent{OrderId: "o1", BuyerId: "u100", TotalPrice: 5, ProductIds: []string{"p1", "p2"}})
+}
+
+func productReserved(productId string) evol.Event {
+	return evoltest.Event(domain.ProductReservedEventTopic, &domain.ProductReservedEvent{OrderId: "o1", ProductId: productId})
+}
+
+func TestOrderSagaPaysReservedOrder(t *testing.T) {
+	f := evoltest.NewSagaFixture(t, saga.Manager("OrderSaga")).IgnoreFields("PaymentId")
+	f.When(orderCreated()).
+		ThenNoError().
+		ThenCommands(
+			&domain.MakeReservationCmd{OrderId: "o1", ProductId: "p1", Count: 1},
+			&domain.MakeReservationCmd{OrderId: "o1", ProductId: "p2", Count: 1},
+		).
+		ThenAlive()
+	f.When(productReserved("p1")).ThenNoCommands()
+	f.When(productReserved("p2")).
+		ThenCommands(&domain.PayOrderCmd{OrderId: "o1", BuyerId: "u100", Amount: 5}).
+		ThenDeadline("payment", 15*time.Minute)
+	f.When(evoltest.Event(domain.OrderPayedEventTopic, &domain.OrderPayedEvent{OrderId: "o1"})).
+		ThenNoCommands().
+		ThenEnded()
+}
+
+func TestOrderSagaCancelsUnpaidOrder(t *testing.T) {
+	f := evoltest.NewSagaFixture(t, saga.Manager("OrderSaga")).
+		Given(orderCreated(), productReserved("p1"), productReserved("p2"))
+	f.WhenTimeElapses(time.Minute).ThenNoCommands().ThenAlive()
+	f.WhenTimeElapses(15*time.Minute).
+		ThenCommands(
+			&domain.RollBackReservationCmd{OrderId: "o1", ProductId: "p1", Count: 1},
+			&domain.RollBackReservationCmd{OrderId: "o1", ProductId: "p2", Count: 1},
+			&domain.CancelOrderCmd{OrderId: "o1", Reason: "Pay Order Timeout"},
+		).
+		ThenEnded()
+}
+
+func TestOrderSagaFailsToPay(t *testing.T) {
+	boom := errors.New("boom")
+	evoltest.NewSagaFixture(t, saga.Manager("OrderSaga")).
+		FailCommand("PayOrderCmd", boom).
+		Given(orderCreated(), productReserved("p1")).
+		When(productReserved("p2")).
+		ThenError(boom)
+}
+
+func TestOrderSagaSurvivesDumpAndRestore(t *testing.T) {
+	s := domain.NewOrderSaga("OrderSaga", "o1").(*domain.OrderSaga)
+	s.StartSaga()
+	s.OrderId, s.ToReserveNum, s.NeedRollBack = "o1", 1, true
+
+	repo := saga.NewMemorySagaRepo()
+	if err := repo.Save(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+	var dump bytes.Buffer
+	if err := repo.Dump(&dump); err != nil {
+		t.Fatal(err)
+	}
+	restored, err := saga.RestoreMemorySagaRepo(&dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, ok := restored.Load(evol.ContextWithSagaType(context.Background(), "OrderSaga"), "o1").(*domain.OrderSaga)
+	if !ok || got.ToReserveNum != 1 || !got.NeedRollBack {
+		t.Errorf("restored saga %+v", got)
+	}
+}
@@ -3,7 +3,6 @@ package domain
 import (
 	"context"
 	"evol"
-	"github.com/mitchellh/mapstructure"
 	"time"
 )
 
@@ -51,8 +50,7 @@ func (s *StockAggregate) HandleCommand(ctx context.Context, c evol.Command) erro
 func (s *StockAggregate) HandleSourcingEvent(ctx context.Context, e evol.Event) error {
 	switch e.Topic() {
 	case ProductReservedEventTopic:
-		evt := new(ProductReservedEvent)
-		err := mapstructure.Decode(e.Data(), evt)
+		evt, err := ProductReservedEventFrom(e)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,12 @@
+// Command evolctl is evolctl built with the example domain.
+package main
+
+import (
+	"evol/evolctl"
+	_ "evol/example/domain"
+	"os"
+)
+
+func main() {
+	os.Exit(evolctl.Main(os.Args[1:], os.Stdout, os.Stderr))
+}
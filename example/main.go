@@ -2,34 +2,68 @@ package main
 
 import (
 	"context"
+	"errors"
 	"evol/aggregatestore"
 	"evol/application"
 	"evol/command"
+	"evol/deadletter"
 	"evol/eventbus/local"
 	"evol/example/adapter"
+	"evol/pii"
 	"evol/repo/memory"
 	"evol/saga"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
 	"github.com/gin-gonic/gin"
 )
 
+// shutdownTimeout bounds the http shutdown and the drain of the application
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	initEvol()
-	RunGin()
+	srv := RunGin()
+
+	// on SIGINT or SIGTERM, stop taking requests then drain the application
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("http shutdown: %s", err)
+	}
+	if err := application.Stop(shutdownCtx); err != nil {
+		log.Printf("application stop: %s", err)
+	}
 }
 
 func initEvol() {
 	cmdBus := command.NewCommandBus()
-	evtBus := local.NewEventBus()
-	aggStore := aggregatestore.NewAggregateEventStore(memory.NewAggregateEventRepo())
+	// buyer ids are stored, published and dead lettered encrypted, forgetting a buyer deletes its key
+	piiCodec := pii.NewEventCodec(nil, pii.NewMemoryKeyStore())
+	deadLetters, err := deadletter.NewFileStore(filepath.Join(os.TempDir(), "evol-example-dead-letters"), deadletter.WithCodec(piiCodec))
+	if err != nil {
+		panic(err)
+	}
+	evtBus := local.NewEventBus(local.WithCodec(piiCodec), local.WithDeadLetterStore(deadLetters))
+	aggStore := aggregatestore.NewAggregateEventStore(memory.NewAggregateEventRepo(memory.WithCodec(piiCodec)))
 	sagaStore := saga.NewMemorySagaRepo()
-	err := application.Run(context.Background(), cmdBus, evtBus, aggStore, sagaStore)
+	err = application.Run(context.Background(), cmdBus, evtBus, aggStore, sagaStore)
 	if err != nil {
 		panic(err)
 	}
 
 }
 
-func RunGin() {
+func RunGin() *http.Server {
 	r := gin.Default()
 	r.POST("/createOrder", adapter.CreateOrder)
 	r.POST("/cancelOrder", adapter.CancelOrder)
@@ -37,5 +71,11 @@ func RunGin() {
 
 	r.GET("/orders", adapter.QueryOrders)
 
-	r.Run()
+	srv := &http.Server{Addr: ":8080", Handler: r}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+	return srv
 }
@@ -0,0 +1,187 @@
+package evol
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// Logger is a structured logger, kv are alternating keys and values.
+// A *slog.Logger implements it as is, a zap.SugaredLogger through SugaredLogger.
+type Logger interface {
+	Debug(msg string, kv ...interface{})
+	Info(msg string, kv ...interface{})
+	Warn(msg string, kv ...interface{})
+	Error(msg string, kv ...interface{})
+}
+
+// Keys of the structured fields logged by evol.
+const (
+	LogKeyAggregateType = "aggregate_type"
+	LogKeyAggregateID   = "aggregate_id"
+	LogKeyTopic         = "topic"
+	LogKeyCommand       = "command"
+	LogKeyHandler       = "handler"
+	LogKeyCorrelationID = "correlation_id"
+	LogKeyTenant        = "tenant"
+	LogKeyError         = "error"
+)
+
+// CorrelationIDKey is the metadata key of the correlation id shared by a command and all
+// the events and commands that follow from it.
+const CorrelationIDKey = "evol-correlation-id"
+
+// the default logger leaves out debug messages
+var logger Logger = &stdLogger{l: log.Default(), quiet: true}
+var loggerMu sync.RWMutex
+
+// SetLogger sets the logger used by the components which were not given one, the standard log package without debug messages by default.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = NopLogger()
+	}
+
+	loggerMu.Lock()
+	defer loggerMu.Unlock()
+	logger = l
+}
+
+// GetLogger returns the logger set with SetLogger.
+func GetLogger() Logger {
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	return logger
+}
+
+// LoggerOr returns l, or the logger set with SetLogger when l is nil.
+func LoggerOr(l Logger) Logger {
+	if l != nil {
+		return l
+	}
+	return GetLogger()
+}
+
+// CorrelationID returns the correlation id carried by the metadata of ctx.
+func CorrelationID(ctx context.Context) string {
+	return MetadataFromContext(ctx)[CorrelationIDKey]
+}
+
+// ContextWithCorrelationID returns a context carrying a correlation id, a new one if ctx has none yet.
+func ContextWithCorrelationID(ctx context.Context) context.Context {
+	if CorrelationID(ctx) != "" {
+		return ctx
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ctx
+	}
+	return ContextWithMetadata(ctx, Metadata{CorrelationIDKey: hex.EncodeToString(b)})
+}
+
+// EventFields returns the log fields of an event, with the correlation id and tenant from its metadata.
+func EventFields(e Event) []interface{} {
+	kv := []interface{}{
+		LogKeyTopic, e.Topic(),
+		LogKeyAggregateType, e.AggregateType(),
+		LogKeyAggregateID, e.AggregateIdentity(),
+	}
+	if id := e.Metadata()[CorrelationIDKey]; id != "" {
+		kv = append(kv, LogKeyCorrelationID, id)
+	}
+	if tenant := EventTenantID(e); tenant != "" {
+		kv = append(kv, LogKeyTenant, tenant)
+	}
+	return kv
+}
+
+// CommandFields returns the log fields of a command, with the correlation id and tenant from ctx.
+func CommandFields(ctx context.Context, cmd Command) []interface{} {
+	kv := []interface{}{
+		LogKeyCommand, cmd.Name(),
+		LogKeyAggregateType, cmd.TargetAggregateType(),
+		LogKeyAggregateID, cmd.TargetIdentity(),
+	}
+	if id := CorrelationID(ctx); id != "" {
+		kv = append(kv, LogKeyCorrelationID, id)
+	}
+	if tenant := TenantID(ctx); tenant != "" {
+		kv = append(kv, LogKeyTenant, tenant)
+	}
+	return kv
+}
+
+// NewStdLogger returns a Logger writing key=value lines to l, or to the standard logger when l is nil.
+func NewStdLogger(l *log.Logger) Logger {
+	if l == nil {
+		l = log.Default()
+	}
+	return &stdLogger{l: l}
+}
+
+type stdLogger struct {
+	l     *log.Logger
+	quiet bool
+}
+
+func (s *stdLogger) Debug(msg string, kv ...interface{}) {
+	if !s.quiet {
+		s.print("DEBUG", msg, kv)
+	}
+}
+func (s *stdLogger) Info(msg string, kv ...interface{})  { s.print("INFO", msg, kv) }
+func (s *stdLogger) Warn(msg string, kv ...interface{})  { s.print("WARN", msg, kv) }
+func (s *stdLogger) Error(msg string, kv ...interface{}) { s.print("ERROR", msg, kv) }
+
+func (s *stdLogger) print(level string, msg string, kv []interface{}) {
+	var b strings.Builder
+	b.WriteString(level)
+	b.WriteString(" [evol] ")
+	b.WriteString(msg)
+	for i := 0; i < len(kv); i += 2 {
+		if i+1 < len(kv) {
+			fmt.Fprintf(&b, " %v=%v", kv[i], kv[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v", kv[i])
+		}
+	}
+	s.l.Println(b.String())
+}
+
+// NopLogger returns a Logger discarding everything.
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+// SugaredWriter is implemented by zap.SugaredLogger and alike.
+type SugaredWriter interface {
+	Debugw(msg string, kv ...interface{})
+	Infow(msg string, kv ...interface{})
+	Warnw(msg string, kv ...interface{})
+	Errorw(msg string, kv ...interface{})
+}
+
+// SugaredLogger adapts a zap style sugared logger to Logger.
+func SugaredLogger(s SugaredWriter) Logger {
+	return sugaredLogger{s: s}
+}
+
+type sugaredLogger struct {
+	s SugaredWriter
+}
+
+func (l sugaredLogger) Debug(msg string, kv ...interface{}) { l.s.Debugw(msg, kv...) }
+func (l sugaredLogger) Info(msg string, kv ...interface{})  { l.s.Infow(msg, kv...) }
+func (l sugaredLogger) Warn(msg string, kv ...interface{})  { l.s.Warnw(msg, kv...) }
+func (l sugaredLogger) Error(msg string, kv ...interface{}) { l.s.Errorw(msg, kv...) }
@@ -0,0 +1,33 @@
+package evol
+
+import "context"
+
+// Metadata is a set of string values travelling with events and commands,
+// such as trace context, correlation and tenant identifiers.
+type Metadata map[string]string
+
+type metadataKey struct{}
+
+// ContextWithMetadata returns a context carrying md merged over the metadata already in ctx.
+func ContextWithMetadata(ctx context.Context, md Metadata) context.Context {
+	if len(md) == 0 {
+		return ctx
+	}
+
+	merged := MetadataFromContext(ctx)
+	for k, v := range md {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, metadataKey{}, merged)
+}
+
+// MetadataFromContext returns a copy of the metadata carried by ctx, never nil.
+func MetadataFromContext(ctx context.Context) Metadata {
+	md, _ := ctx.Value(metadataKey{}).(Metadata)
+
+	res := make(Metadata, len(md))
+	for k, v := range md {
+		res[k] = v
+	}
+	return res
+}
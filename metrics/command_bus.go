@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"context"
+	"evol"
+	"time"
+)
+
+// CommandBus is an evol.CommandBus counting and timing command dispatch and handling.
+type CommandBus struct {
+	bus evol.CommandBus
+	m   *Metrics
+}
+
+// CommandBus instruments bus.
+func (m *Metrics) CommandBus(bus evol.CommandBus) *CommandBus {
+	return &CommandBus{bus: bus, m: m}
+}
+
+// Unwrap implements evol.Wrapper.
+func (b *CommandBus) Unwrap() interface{} {
+	return b.bus
+}
+
+func (b *CommandBus) HandleCommand(ctx context.Context, cmd evol.Command) error {
+	start := time.Now()
+	err := b.bus.HandleCommand(ctx, cmd)
+	b.m.observeCommand(cmd.Name(), "dispatch", start, err)
+
+	return err
+}
+
+func (b *CommandBus) RegisterCmdHandler(name evol.CommandName, handler evol.CommandHandler) error {
+	return b.bus.RegisterCmdHandler(name, evol.CommandHandlerFunc(func(ctx context.Context, cmd evol.Command) error {
+		start := time.Now()
+		err := handler.HandleCommand(ctx, cmd)
+		b.m.observeCommand(cmd.Name(), "handle", start, err)
+
+		return err
+	}))
+}
+
+func (m *Metrics) observeCommand(name evol.CommandName, stage string, start time.Time, err error) {
+	m.commandDuration.WithLabelValues(string(name), stage).Observe(time.Since(start).Seconds())
+	m.commands.WithLabelValues(string(name), stage, result(err)).Inc()
+}
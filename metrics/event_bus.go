@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"context"
+	"evol"
+	"evol/eventbus/local"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// EventBus is an evol.EventBus counting published events and timing each handler invocation.
+type EventBus struct {
+	bus evol.EventBus
+	m   *Metrics
+}
+
+// EventBus instruments bus, the queues of a local event bus are exported too, summed by topic
+// with the queues of the other local buses.
+func (m *Metrics) EventBus(bus evol.EventBus) *EventBus {
+	if lb, ok := evol.As[*local.EventBus](bus); ok {
+		m.queueCollector().add(lb)
+	}
+
+	return &EventBus{bus: bus, m: m}
+}
+
+// Unwrap implements evol.Wrapper.
+func (b *EventBus) Unwrap() interface{} {
+	return b.bus
+}
+
+func (b *EventBus) HandleEvent(ctx context.Context, e evol.Event) error {
+	err := b.bus.HandleEvent(ctx, e)
+	b.m.eventsPublished.WithLabelValues(string(e.Topic()), result(err)).Inc()
+
+	return err
+}
+
+func (b *EventBus) RegisterHandler(ctx context.Context, topic evol.Topic, h evol.EventHandler, options ...evol.HandlerOption) error {
+	// keep the name of the wrapped handler for dead letters
+	name := evol.NewHandlerConfig(options...).HandlerName(h)
+	options = append(options, evol.WithHandlerName(name))
+
+	handler := evol.EventHandlerFunc(func(ctx context.Context, e evol.Event) error {
+		if evol.AttemptFromContext(ctx) > 1 {
+			b.m.handlerRedeliveries.WithLabelValues(string(topic), name).Inc()
+		}
+
+		start := time.Now()
+		err := h.HandleEvent(ctx, e)
+		b.m.handlerDuration.WithLabelValues(string(topic), name).Observe(time.Since(start).Seconds())
+		if err != nil {
+			b.m.handlerErrors.WithLabelValues(string(topic), name).Inc()
+		}
+
+		return err
+	})
+
+	return b.bus.RegisterHandler(ctx, topic, handler, options...)
+}
+
+// queueCollector reads the queue counters of the local event buses at scrape time.
+type queueCollector struct {
+	buses   []*local.EventBus
+	busesMu sync.Mutex
+
+	queued   *prometheus.Desc
+	spilled  *prometheus.Desc
+	dropped  *prometheus.Desc
+	rejected *prometheus.Desc
+}
+
+// queueCollector returns the collector of m, registered with the first local bus
+func (m *Metrics) queueCollector() *queueCollector {
+	m.queuesOnce.Do(func() {
+		m.queues = newQueueCollector(m.namespace)
+		m.registry.MustRegister(m.queues)
+	})
+	return m.queues
+}
+
+func newQueueCollector(namespace string) *queueCollector {
+	labels := []string{"topic"}
+	return &queueCollector{
+		queued: prometheus.NewDesc(prometheus.BuildFQName(namespace, "local_bus", "queued_events"),
+			"Events waiting in memory in the handler queues of a topic.", labels, nil),
+		spilled: prometheus.NewDesc(prometheus.BuildFQName(namespace, "local_bus", "spilled_events"),
+			"Events waiting on disk in the handler queues of a topic.", labels, nil),
+		dropped: prometheus.NewDesc(prometheus.BuildFQName(namespace, "local_bus", "dropped_events_total"),
+			"Events discarded by the drop and drop oldest policies.", labels, nil),
+		rejected: prometheus.NewDesc(prometheus.BuildFQName(namespace, "local_bus", "rejected_events_total"),
+			"Events refused because a handler queue was full.", labels, nil),
+	}
+}
+
+func (c *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.queued
+	ch <- c.spilled
+	ch <- c.dropped
+	ch <- c.rejected
+}
+
+func (c *queueCollector) add(bus *local.EventBus) {
+	c.busesMu.Lock()
+	defer c.busesMu.Unlock()
+
+	for _, b := range c.buses {
+		if b == bus {
+			return
+		}
+	}
+	c.buses = append(c.buses, bus)
+}
+
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	c.busesMu.Lock()
+	buses := append([]*local.EventBus(nil), c.buses...)
+	c.busesMu.Unlock()
+
+	stats := make(map[evol.Topic]local.TopicStats)
+	for _, bus := range buses {
+		for topic, st := range bus.Stats() {
+			sum := stats[topic]
+			sum.Queued += st.Queued
+			sum.Spilled += st.Spilled
+			sum.Dropped += st.Dropped
+			sum.Rejected += st.Rejected
+			stats[topic] = sum
+		}
+	}
+
+	for topic, st := range stats {
+		ch <- prometheus.MustNewConstMetric(c.queued, prometheus.GaugeValue, float64(st.Queued), string(topic))
+		ch <- prometheus.MustNewConstMetric(c.spilled, prometheus.GaugeValue, float64(st.Spilled), string(topic))
+		ch <- prometheus.MustNewConstMetric(c.dropped, prometheus.CounterValue, float64(st.Dropped), string(topic))
+		ch <- prometheus.MustNewConstMetric(c.rejected, prometheus.CounterValue, float64(st.Rejected), string(topic))
+	}
+}
@@ -0,0 +1,144 @@
+// Package metrics exposes Prometheus metrics of command buses, event buses, event repos,
+// aggregate stores and saga managers through instrumented decorators.
+package metrics
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics owns the collectors shared by all decorators it creates.
+type Metrics struct {
+	namespace string
+	registry  *prometheus.Registry
+
+	commands        *prometheus.CounterVec
+	commandDuration *prometheus.HistogramVec
+
+	eventsPublished     *prometheus.CounterVec
+	handlerDuration     *prometheus.HistogramVec
+	handlerErrors       *prometheus.CounterVec
+	handlerRedeliveries *prometheus.CounterVec
+
+	repoDuration   *prometheus.HistogramVec
+	eventsAppended *prometheus.CounterVec
+
+	storeDuration *prometheus.HistogramVec
+
+	sagasStarted *prometheus.CounterVec
+	sagasEnded   *prometheus.CounterVec
+
+	queues     *queueCollector
+	queuesOnce sync.Once
+}
+
+// New creates Metrics registered in a new registry, see Registry and Handler.
+func New(options ...Option) *Metrics {
+	m := &Metrics{
+		namespace: "evol",
+		registry:  prometheus.NewRegistry(),
+	}
+
+	for _, option := range options {
+		if option == nil {
+			continue
+		}
+		option(m)
+	}
+
+	m.commands = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: m.namespace, Name: "commands_total",
+		Help: "Commands dispatched and handled, by command and result.",
+	}, []string{"command", "stage", "result"})
+	m.commandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: m.namespace, Name: "command_duration_seconds",
+		Help: "Latency of command dispatch and handling.",
+	}, []string{"command", "stage"})
+
+	m.eventsPublished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: m.namespace, Name: "events_published_total",
+		Help: "Events published to the event bus, by topic and result.",
+	}, []string{"topic", "result"})
+	m.handlerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: m.namespace, Name: "event_handler_duration_seconds",
+		Help: "Latency of event handler invocations.",
+	}, []string{"topic", "handler"})
+	m.handlerErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: m.namespace, Name: "event_handler_errors_total",
+		Help: "Event handler invocations returning an error.",
+	}, []string{"topic", "handler"})
+	m.handlerRedeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: m.namespace, Name: "event_handler_redeliveries_total",
+		Help: "Event handler invocations that were not the first delivery of the event.",
+	}, []string{"topic", "handler"})
+
+	m.repoDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: m.namespace, Name: "event_repo_duration_seconds",
+		Help: "Latency of event repo appends and loads.",
+	}, []string{"operation", "result"})
+	m.eventsAppended = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: m.namespace, Name: "event_repo_events_appended_total",
+		Help: "Events appended to the event repo, by aggregate type.",
+	}, []string{"aggregate_type"})
+
+	m.storeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: m.namespace, Name: "aggregate_store_duration_seconds",
+		Help: "Latency of aggregate loads and saves.",
+	}, []string{"aggregate_type", "operation", "result"})
+
+	m.sagasStarted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: m.namespace, Name: "sagas_started_total",
+		Help: "Sagas started.",
+	}, []string{"saga_type"})
+	m.sagasEnded = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: m.namespace, Name: "sagas_ended_total",
+		Help: "Sagas ended.",
+	}, []string{"saga_type"})
+
+	m.registry.MustRegister(
+		m.commands, m.commandDuration,
+		m.eventsPublished, m.handlerDuration, m.handlerErrors, m.handlerRedeliveries,
+		m.repoDuration, m.eventsAppended,
+		m.storeDuration,
+		m.sagasStarted, m.sagasEnded,
+	)
+
+	return m
+}
+
+// Option is an option setter used to configure Metrics.
+type Option func(*Metrics)
+
+// WithNamespace prefixes the metric names, "evol" by default.
+func WithNamespace(namespace string) Option {
+	return func(m *Metrics) {
+		m.namespace = namespace
+	}
+}
+
+// WithRegistry registers the collectors in registry instead of a new one.
+func WithRegistry(registry *prometheus.Registry) Option {
+	return func(m *Metrics) {
+		m.registry = registry
+	}
+}
+
+// Registry returns the registry holding the collectors.
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Handler serves the metrics of the registry in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
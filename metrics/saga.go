@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"context"
+	"evol/saga"
+)
+
+// SagaManager instruments manager to count the sagas it starts and ends, and returns it.
+// Event handling of the manager is timed by the EventBus it is registered on.
+func (m *Metrics) SagaManager(manager *saga.SagaManager) *saga.SagaManager {
+	manager.Observer = &sagaObserver{m: m, next: manager.Observer}
+	return manager
+}
+
+type sagaObserver struct {
+	m    *Metrics
+	next saga.SagaObserver
+}
+
+func (o *sagaObserver) SagaStarted(ctx context.Context, sagaType string, sagaIdentity string) {
+	o.m.sagasStarted.WithLabelValues(sagaType).Inc()
+	if o.next != nil {
+		o.next.SagaStarted(ctx, sagaType, sagaIdentity)
+	}
+}
+
+func (o *sagaObserver) SagaEnded(ctx context.Context, sagaType string, sagaIdentity string) {
+	o.m.sagasEnded.WithLabelValues(sagaType).Inc()
+	if o.next != nil {
+		o.next.SagaEnded(ctx, sagaType, sagaIdentity)
+	}
+}
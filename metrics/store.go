@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"context"
+	"evol"
+	"time"
+)
+
+// EventRepo is an evol.EventRepo timing appends and loads.
+type EventRepo struct {
+	repo evol.EventRepo
+	m    *Metrics
+}
+
+// EventRepo instruments repo.
+func (m *Metrics) EventRepo(repo evol.EventRepo) *EventRepo {
+	return &EventRepo{repo: repo, m: m}
+}
+
+// Unwrap implements evol.Wrapper.
+func (r *EventRepo) Unwrap() interface{} {
+	return r.repo
+}
+
+func (r *EventRepo) Save(ctx context.Context, events []evol.Event) error {
+	start := time.Now()
+	err := r.repo.Save(ctx, events)
+	r.m.repoDuration.WithLabelValues("append", result(err)).Observe(time.Since(start).Seconds())
+
+	if err == nil && len(events) > 0 {
+		r.m.eventsAppended.WithLabelValues(events[0].AggregateType().String()).Add(float64(len(events)))
+	}
+
+	return err
+}
+
+func (r *EventRepo) Load(ctx context.Context, id string) ([]evol.Event, error) {
+	start := time.Now()
+	events, err := r.repo.Load(ctx, id)
+	r.m.repoDuration.WithLabelValues("load", result(err)).Observe(time.Since(start).Seconds())
+
+	return events, err
+}
+
+// AggregateStore is an evol.AggregateStore timing loads and saves.
+type AggregateStore struct {
+	store evol.AggregateStore
+	m     *Metrics
+}
+
+// AggregateStore instruments store.
+func (m *Metrics) AggregateStore(store evol.AggregateStore) *AggregateStore {
+	return &AggregateStore{store: store, m: m}
+}
+
+// Unwrap implements evol.Wrapper.
+func (s *AggregateStore) Unwrap() interface{} {
+	return s.store
+}
+
+func (s *AggregateStore) Load(ctx context.Context, aggregateType evol.AggregateType, aggregateIdentity string) (evol.Aggregate, error) {
+	start := time.Now()
+	agg, err := s.store.Load(ctx, aggregateType, aggregateIdentity)
+	s.m.storeDuration.WithLabelValues(aggregateType.String(), "load", result(err)).Observe(time.Since(start).Seconds())
+
+	return agg, err
+}
+
+// LoadOrCreate implements evol.CreatingAggregateStore, timed like Load.
+func (s *AggregateStore) LoadOrCreate(ctx context.Context, aggregateType evol.AggregateType, aggregateIdentity string) (evol.Aggregate, bool, error) {
+	start := time.Now()
+	agg, created, err := evol.LoadOrCreate(ctx, s.store, aggregateType, aggregateIdentity)
+	s.m.storeDuration.WithLabelValues(aggregateType.String(), "load", result(err)).Observe(time.Since(start).Seconds())
+
+	return agg, created, err
+}
+
+func (s *AggregateStore) Save(ctx context.Context, aggregate evol.Aggregate) error {
+	start := time.Now()
+	err := s.store.Save(ctx, aggregate)
+	s.m.storeDuration.WithLabelValues(aggregate.AggregateType().String(), "save", result(err)).Observe(time.Since(start).Seconds())
+
+	return err
+}
@@ -0,0 +1,128 @@
+package migration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"evol"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// StreamKey identifies a source stream, streams are migrated in the order of their keys.
+type StreamKey struct {
+	Tenant            string             `json:"tenant"`
+	AggregateType     evol.AggregateType `json:"aggregate_type"`
+	AggregateIdentity string             `json:"aggregate_id"`
+}
+
+func keyOf(info evol.StreamInfo) StreamKey {
+	return StreamKey{Tenant: info.Tenant, AggregateType: info.AggregateType, AggregateIdentity: info.AggregateIdentity}
+}
+
+// less orders the keys by tenant, aggregate type then aggregate identity
+func (k StreamKey) less(o StreamKey) bool {
+	if k.Tenant != o.Tenant {
+		return k.Tenant < o.Tenant
+	}
+	if k.AggregateType != o.AggregateType {
+		return k.AggregateType < o.AggregateType
+	}
+	return k.AggregateIdentity < o.AggregateIdentity
+}
+
+// Checkpoints keeps the key of the last stream a migration wrote, a run resumes after it.
+type Checkpoints interface {
+	// LoadMigrationCheckpoint returns the key of the last migrated stream, false when there is none
+	LoadMigrationCheckpoint(ctx context.Context, name string) (StreamKey, bool, error)
+
+	SaveMigrationCheckpoint(ctx context.Context, name string, key StreamKey) error
+}
+
+// MemoryCheckpoints keeps checkpoints in memory, for tests and migrations resumed in the same process.
+type MemoryCheckpoints struct {
+	mu   sync.RWMutex
+	keys map[string]StreamKey
+}
+
+// NewMemoryCheckpoints creates an empty MemoryCheckpoints.
+func NewMemoryCheckpoints() *MemoryCheckpoints {
+	return &MemoryCheckpoints{keys: make(map[string]StreamKey)}
+}
+
+func (c *MemoryCheckpoints) LoadMigrationCheckpoint(ctx context.Context, name string) (StreamKey, bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	k, ok := c.keys[name]
+	return k, ok, nil
+}
+
+func (c *MemoryCheckpoints) SaveMigrationCheckpoint(ctx context.Context, name string, key StreamKey) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.keys[name] = key
+	return nil
+}
+
+// FileCheckpoints keeps the checkpoints of migrations in a JSON file.
+type FileCheckpoints struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileCheckpoints creates FileCheckpoints in the file at path, created on the first save.
+func NewFileCheckpoints(path string) *FileCheckpoints {
+	return &FileCheckpoints{path: path}
+}
+
+func (c *FileCheckpoints) LoadMigrationCheckpoint(ctx context.Context, name string) (StreamKey, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys, err := c.read()
+	if err != nil {
+		return StreamKey{}, false, err
+	}
+	k, ok := keys[name]
+	return k, ok, nil
+}
+
+func (c *FileCheckpoints) SaveMigrationCheckpoint(ctx context.Context, name string, key StreamKey) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys, err := c.read()
+	if err != nil {
+		return err
+	}
+	keys[name] = key
+
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write then rename, a crash never leaves a partial file behind
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+func (c *FileCheckpoints) read() (map[string]StreamKey, error) {
+	keys := make(map[string]StreamKey)
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return keys, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("could not read checkpoints %s: %w", filepath.Base(c.path), err)
+	}
+	return keys, nil
+}
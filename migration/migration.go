@@ -0,0 +1,445 @@
+// Package migration rewrites the history of an application, copying every stream of an event repo
+// to another one through transforms, such as renaming topics or moving events between aggregates.
+// The events written are copies of the source events, custom events keep their type by implementing evol.EventCopier.
+package migration
+
+import (
+	"context"
+	"errors"
+	"evol"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SourceKey is the metadata key of the migrated events, the migration name, event index and source stream
+// key that wrote them, as name:event:tenant:type:id. A migration resumed after a failure skips the events its target streams already have.
+const SourceKey = "evol-migration"
+
+// Migrator copies the streams of a source repo listing them to a target repo, through its transforms.
+// The source must not change during a migration, streams are migrated in the order of their keys.
+type Migrator struct {
+	name        string
+	source      evol.EventRepo
+	lister      evol.StreamLister
+	target      evol.EventRepo
+	checkpoints Checkpoints
+	transforms  []namedTransform
+
+	dryRun   bool
+	progress int
+	logger   evol.Logger
+}
+
+type namedTransform struct {
+	name string
+	t    Transform
+}
+
+// NewMigrator creates a Migrator, name identifies its checkpoint and the events it writes.
+func NewMigrator(name string, source, target evol.EventRepo, options ...Option) (*Migrator, error) {
+	if name == "" {
+		return nil, errors.New("[evol] NewMigrator: missing migration name")
+	}
+	if source == nil || target == nil {
+		return nil, errors.New("[evol] NewMigrator: missing repo")
+	}
+	lister, ok := evol.As[evol.StreamLister](source)
+	if !ok {
+		return nil, fmt.Errorf("[evol] NewMigrator: source repo %T can not list streams", source)
+	}
+
+	m := &Migrator{
+		name:     name,
+		source:   source,
+		lister:   lister,
+		target:   target,
+		progress: 1000,
+	}
+
+	for _, option := range options {
+		if option == nil {
+			continue
+		}
+		option(m)
+	}
+
+	return m, nil
+}
+
+// Option is an option setter used to configure a Migrator.
+type Option func(*Migrator)
+
+// WithCheckpoints saves the key of each migrated stream, a run resumes after the last one.
+func WithCheckpoints(checkpoints Checkpoints) Option {
+	return func(m *Migrator) {
+		m.checkpoints = checkpoints
+	}
+}
+
+// WithDryRun transforms the streams without writing them nor saving checkpoints, the report tells
+// what a migration would write.
+func WithDryRun() Option {
+	return func(m *Migrator) {
+		m.dryRun = true
+	}
+}
+
+// WithProgressInterval logs the progress of the migration every n streams, 1000 by default.
+func WithProgressInterval(n int) Option {
+	return func(m *Migrator) {
+		m.progress = n
+	}
+}
+
+// WithLogger sets the logger of the migration, evol.GetLogger() by default.
+func WithLogger(l evol.Logger) Option {
+	return func(m *Migrator) {
+		m.logger = l
+	}
+}
+
+// Register adds a transform, transforms apply in the order they are registered, each to the events of the previous one.
+func (m *Migrator) Register(name string, t Transform) error {
+	if name == "" || t == nil {
+		return errors.New("[evol] Register: missing transform name or func")
+	}
+	for _, nt := range m.transforms {
+		if nt.name == name {
+			return fmt.Errorf("[evol] Register: transform %s already registered", name)
+		}
+	}
+
+	m.transforms = append(m.transforms, namedTransform{name: name, t: t})
+	return nil
+}
+
+// targetKey identifies a target stream
+type targetKey struct {
+	tenant string
+	id     string
+}
+
+// targetStream is the state of a target stream during a run
+type targetStream struct {
+	aggregateType evol.AggregateType
+	// version of the stream
+	version int
+	// last is the position of the last migrated event of the stream, nil if none, positions up to it were
+	// written by an earlier run
+	last *position
+}
+
+// position of a written event: the key of its source stream and its index in the output of that stream
+type position struct {
+	stream StreamKey
+	event  int
+}
+
+func (p position) after(o *position) bool {
+	return o == nil || o.stream.less(p.stream) || p.stream == o.stream && p.event > o.event
+}
+
+// Run migrates the streams of all tenants, after the checkpoint of the migration if any, then verifies
+// the target streams against the source. The report is returned with the error of a failed run.
+func (m *Migrator) Run(ctx context.Context) (*Report, error) {
+	start := time.Now()
+	report := &Report{Name: m.name, DryRun: m.dryRun, Transforms: make([]TransformReport, len(m.transforms))}
+	for i, nt := range m.transforms {
+		report.Transforms[i].Name = nt.name
+	}
+	targets := make(map[targetKey]*targetStream)
+	defer func() {
+		report.TargetStreams = len(targets)
+		report.Duration = time.Since(start)
+	}()
+
+	var from *StreamKey
+	if m.checkpoints != nil && !m.dryRun {
+		key, ok, err := m.checkpoints.LoadMigrationCheckpoint(ctx, m.name)
+		if err != nil {
+			return report, fmt.Errorf("[evol] migration %s could not load checkpoint: %w", m.name, err)
+		}
+		if ok {
+			from = &key
+		}
+	}
+
+	streams, err := m.lister.Streams(ctx)
+	if err != nil {
+		return report, fmt.Errorf("[evol] migration %s could not list streams: %w", m.name, err)
+	}
+	// listers do not agree on an order, sorted by key a run resumes after the checkpoint whatever the repo
+	sort.Slice(streams, func(i, j int) bool {
+		return keyOf(streams[i]).less(keyOf(streams[j]))
+	})
+	first := 0
+	if from != nil {
+		first = sort.Search(len(streams), func(i int) bool {
+			return from.less(keyOf(streams[i]))
+		})
+	}
+	report.Resumed = first
+
+	log := evol.LoggerOr(m.logger)
+	log.Info("migration started", "migration", m.name, "streams", len(streams), "resumed", first, "dry_run", m.dryRun)
+
+	for _, info := range streams[first:] {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		if err := m.migrate(ctx, info, targets, report); err != nil {
+			return report, fmt.Errorf("[evol] migration %s of %s %s: %w", m.name, info.AggregateType, info.AggregateIdentity, err)
+		}
+		report.Streams++
+
+		if m.checkpoints != nil && !m.dryRun {
+			if err := m.checkpoints.SaveMigrationCheckpoint(ctx, m.name, keyOf(info)); err != nil {
+				return report, fmt.Errorf("[evol] migration %s could not save checkpoint: %w", m.name, err)
+			}
+		}
+		if m.progress > 0 && report.Streams%m.progress == 0 {
+			log.Info("migration progress", "migration", m.name, "streams", first+report.Streams, "of", len(streams), "events_written", report.EventsWritten)
+		}
+	}
+
+	if !m.dryRun {
+		if err := m.verify(ctx, streams, report); err != nil {
+			return report, fmt.Errorf("[evol] migration %s could not verify target: %w", m.name, err)
+		}
+		report.verified = true
+	}
+
+	log.Info("migration done", "migration", m.name, "streams", report.Streams, "events_read", report.EventsRead, "events_written", report.EventsWritten, "mismatches", len(report.Mismatches))
+	return report, nil
+}
+
+// migrate transforms a source stream and writes its events to their target streams
+func (m *Migrator) migrate(ctx context.Context, info evol.StreamInfo, targets map[targetKey]*targetStream, report *Report) error {
+	ctx = evol.ContextWithTenant(ctx, info.Tenant)
+
+	events, read, err := m.transform(ctx, info, report.Transforms)
+	if err != nil {
+		return err
+	}
+	report.EventsRead += read
+
+	// group the events by target stream, in order
+	var order []targetKey
+	batches := make(map[targetKey][]evol.Event)
+	for j, e := range events {
+		if e == nil || e.Topic() == "" || e.AggregateIdentity() == "" {
+			return fmt.Errorf("transformed event %d has no topic or aggregate identity", j)
+		}
+
+		k := targetKey{tenant: info.Tenant, id: e.AggregateIdentity()}
+		target, ok := targets[k]
+		if !ok {
+			if target, err = m.targetStream(ctx, e); err != nil {
+				return err
+			}
+			targets[k] = target
+			order = append(order, k)
+		} else if _, ok := batches[k]; !ok {
+			order = append(order, k)
+		}
+
+		p := position{stream: keyOf(info), event: len(batches[k])}
+		if !p.after(target.last) {
+			report.EventsSkipped++
+			batches[k] = append(batches[k], nil)
+			continue
+		}
+		target.version++
+		target.last = &p
+		batches[k] = append(batches[k], evol.CopyEvent(e,
+			evol.WithVersion(target.version),
+			evol.WithMetadata(evol.Metadata{SourceKey: m.formatSource(p)}),
+		))
+	}
+
+	for _, k := range order {
+		batch := compact(batches[k])
+		if len(batch) == 0 {
+			continue
+		}
+		report.EventsWritten += len(batch)
+		if m.dryRun {
+			continue
+		}
+		if err := m.target.Save(ctx, batch); err != nil {
+			return fmt.Errorf("could not write %s: %w", k.id, err)
+		}
+	}
+	return nil
+}
+
+// transform loads a source stream and passes its events through the transforms, counted in counts unless nil.
+// It returns the transformed events and the number of events of the source stream.
+func (m *Migrator) transform(ctx context.Context, info evol.StreamInfo, counts []TransformReport) ([]evol.Event, int, error) {
+	events, err := m.source.Load(ctx, info.AggregateIdentity)
+	if errors.Is(err, evol.ErrAggregateNotFound) {
+		return nil, 0, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+	read := len(events)
+
+	for j, nt := range m.transforms {
+		if counts != nil {
+			counts[j].In += len(events)
+		}
+		if events, err = nt.t(ctx, events); err != nil {
+			return nil, read, fmt.Errorf("transform %s: %w", nt.name, err)
+		}
+		if counts != nil {
+			counts[j].Out += len(events)
+		}
+	}
+	return events, read, nil
+}
+
+// targetStream reads the version of the target stream of e and the last event a previous run wrote to it
+func (m *Migrator) targetStream(ctx context.Context, e evol.Event) (*targetStream, error) {
+	target := &targetStream{aggregateType: e.AggregateType()}
+
+	events, err := m.target.Load(ctx, e.AggregateIdentity())
+	if errors.Is(err, evol.ErrAggregateNotFound) {
+		return target, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not read target %s: %w", e.AggregateIdentity(), err)
+	}
+
+	target.version = len(events)
+	if v := events[len(events)-1].Version(); v > 0 {
+		target.version = v
+	}
+	if p, ok := m.parseSource(events[len(events)-1].Metadata()[SourceKey]); ok {
+		target.last = &p
+	}
+	return target, nil
+}
+
+// formatSource formats the SourceKey metadata of the event at p, the identity last as it may hold colons
+func (m *Migrator) formatSource(p position) string {
+	return fmt.Sprintf("%s:%d:%s:%s:%s", m.name, p.event, p.stream.Tenant, p.stream.AggregateType, p.stream.AggregateIdentity)
+}
+
+// parseSource parses the SourceKey metadata written by this migration
+func (m *Migrator) parseSource(s string) (position, bool) {
+	if !strings.HasPrefix(s, m.name+":") {
+		return position{}, false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(s, m.name+":"), ":", 4)
+	if len(parts) != 4 {
+		return position{}, false
+	}
+	event, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return position{}, false
+	}
+	key := StreamKey{Tenant: parts[1], AggregateType: evol.AggregateType(parts[2]), AggregateIdentity: parts[3]}
+	return position{stream: key, event: event}, true
+}
+
+// verify passes the source streams through the transforms again, and compares the number of events each
+// one yields with the events of the target streams written from it, by any run
+func (m *Migrator) verify(ctx context.Context, streams []evol.StreamInfo, report *Report) error {
+	report.Sources = make([]StreamReport, len(streams))
+	sources := make(map[StreamKey]*StreamReport, len(streams))
+	var targets []targetKey
+	types := make(map[targetKey]evol.AggregateType)
+
+	for i, info := range streams {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		events, read, err := m.transform(evol.ContextWithTenant(ctx, info.Tenant), info, nil)
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", info.AggregateType, info.AggregateIdentity, err)
+		}
+		report.Sources[i] = StreamReport{
+			Tenant:            info.Tenant,
+			AggregateType:     info.AggregateType,
+			AggregateIdentity: info.AggregateIdentity,
+			SourceEvents:      read,
+			Expected:          len(events),
+		}
+		sources[keyOf(info)] = &report.Sources[i]
+
+		for _, e := range events {
+			k := targetKey{tenant: info.Tenant, id: e.AggregateIdentity()}
+			if _, ok := types[k]; !ok {
+				types[k] = e.AggregateType()
+				targets = append(targets, k)
+			}
+		}
+	}
+
+	for _, k := range targets {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		events, err := m.target.Load(evol.ContextWithTenant(ctx, k.tenant), k.id)
+		if err != nil && !errors.Is(err, evol.ErrAggregateNotFound) {
+			return err
+		}
+		for _, e := range events {
+			if p, ok := m.parseSource(e.Metadata()[SourceKey]); ok {
+				if s, ok := sources[p.stream]; ok {
+					s.TargetEvents++
+				}
+			}
+		}
+		if !contiguous(events) {
+			report.Mismatches = append(report.Mismatches, Mismatch{
+				Tenant:            k.tenant,
+				AggregateType:     types[k],
+				AggregateIdentity: k.id,
+				Expected:          events[len(events)-1].Version(),
+				Actual:            len(events),
+				Reason:            "versions not contiguous",
+			})
+		}
+	}
+
+	for _, s := range report.Sources {
+		if s.TargetEvents != s.Expected {
+			report.Mismatches = append(report.Mismatches, Mismatch{
+				Tenant:            s.Tenant,
+				AggregateType:     s.AggregateType,
+				AggregateIdentity: s.AggregateIdentity,
+				Expected:          s.Expected,
+				Actual:            s.TargetEvents,
+				Reason:            "event count",
+			})
+		}
+	}
+	return nil
+}
+
+// contiguous reports whether the versions of a stream follow each other from 1, unversioned events aside
+func contiguous(events []evol.Event) bool {
+	for i, e := range events {
+		if v := e.Version(); v != 0 && v != i+1 {
+			return false
+		}
+	}
+	return true
+}
+
+// compact drops the nil events of a batch, those already written
+func compact(events []evol.Event) []evol.Event {
+	res := events[:0]
+	for _, e := range events {
+		if e != nil {
+			res = append(res, e)
+		}
+	}
+	return res
+}
@@ -0,0 +1,165 @@
+package migration_test
+
+import (
+	"context"
+	"errors"
+	"evol"
+	"evol/migration"
+	"evol/repo/memory"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// reversedLister lists the streams of its repo in reverse order, as another lister could
+type reversedLister struct {
+	*memory.AggregateEventRepo
+}
+
+func (r reversedLister) Streams(ctx context.Context) ([]evol.StreamInfo, error) {
+	streams, err := r.AggregateEventRepo.Streams(ctx)
+	for i, j := 0, len(streams)-1; i < j; i, j = i+1, j-1 {
+		streams[i], streams[j] = streams[j], streams[i]
+	}
+	return streams, err
+}
+
+// droppingRepo drops the events saved to the stream id
+type droppingRepo struct {
+	*memory.AggregateEventRepo
+	id string
+}
+
+func (r droppingRepo) Save(ctx context.Context, events []evol.Event) error {
+	if events[0].AggregateIdentity() == r.id {
+		return nil
+	}
+	return r.AggregateEventRepo.Save(ctx, events)
+}
+
+func newSource(t *testing.T) *memory.AggregateEventRepo {
+	t.Helper()
+	source := memory.NewAggregateEventRepo()
+	for _, tenant := range []string{"", "acme"} {
+		ctx := evol.ContextWithTenant(context.Background(), tenant)
+		for _, id := range []string{"o1", "o2", "o3"} {
+			events := []evol.Event{
+				evol.NewEvent("Created", nil, time.Now(), evol.ForAggregate("Order", id), evol.WithVersion(1)),
+				evol.NewEvent("Shipped", nil, time.Now(), evol.ForAggregate("Order", id), evol.WithVersion(2)),
+			}
+			if err := source.Save(ctx, events); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return source
+}
+
+func TestRunResumesAfterCheckpointedStream(t *testing.T) {
+	ctx := context.Background()
+	source := newSource(t)
+	target := memory.NewAggregateEventRepo()
+	checkpoints := migration.NewMemoryCheckpoints()
+
+	fail := true
+	migrator := func(source evol.EventRepo) *migration.Migrator {
+		m, err := migration.NewMigrator("v2", source, target, migration.WithCheckpoints(checkpoints), migration.WithLogger(evol.NopLogger()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Register("rename", migration.RenameTopic("Shipped", "Dispatched"))
+		m.Register("fail", func(ctx context.Context, events []evol.Event) ([]evol.Event, error) {
+			if fail && events[0].AggregateIdentity() == "o2" {
+				return nil, errors.New("boom")
+			}
+			return events, nil
+		})
+		return m
+	}
+
+	// streams are migrated by key whatever the order of the lister: the default tenant first, o1 then o2
+	report, err := migrator(source).Run(ctx)
+	if err == nil || report.Streams != 1 {
+		t.Fatalf("first run migrated %d streams: %v", report.Streams, err)
+	}
+	key, ok, err := checkpoints.LoadMigrationCheckpoint(ctx, "v2")
+	if err != nil || !ok || key != (migration.StreamKey{AggregateType: "Order", AggregateIdentity: "o1"}) {
+		t.Fatalf("checkpoint %v %v %v", key, ok, err)
+	}
+
+	fail = false
+	report, err = migrator(reversedLister{source}).Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Resumed != 1 || report.Streams != 5 || report.EventsWritten != 10 || report.EventsSkipped != 0 {
+		t.Errorf("resumed %d, migrated %d streams, wrote %d events, skipped %d", report.Resumed, report.Streams, report.EventsWritten, report.EventsSkipped)
+	}
+	if !report.Verified() || len(report.Sources) != 6 {
+		t.Fatalf("not verified:\n%s", report)
+	}
+	for _, s := range report.Sources {
+		if s.SourceEvents != 2 || s.Expected != 2 || s.TargetEvents != 2 {
+			t.Errorf("source stream %+v", s)
+		}
+	}
+
+	events, err := target.Load(evol.ContextWithTenant(ctx, "acme"), "o3")
+	if err != nil || len(events) != 2 || events[1].Topic() != "Dispatched" {
+		t.Fatalf("target stream %v %v", events, err)
+	}
+	if src := events[1].Metadata()[migration.SourceKey]; src != "v2:1:acme:Order:o3" {
+		t.Errorf("source key %q", src)
+	}
+}
+
+func TestRunVerifiesAgainstSource(t *testing.T) {
+	ctx := context.Background()
+	target := droppingRepo{AggregateEventRepo: memory.NewAggregateEventRepo(), id: "o2"}
+
+	m, err := migration.NewMigrator("v2", newSource(t), target, migration.WithLogger(evol.NopLogger()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Register("drop", migration.Drop("Shipped"))
+
+	report, err := m.Run(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Verified() || len(report.Mismatches) != 2 {
+		t.Fatalf("mismatches %v", report.Mismatches)
+	}
+	for _, mismatch := range report.Mismatches {
+		if mismatch.AggregateIdentity != "o2" || mismatch.Expected != 1 || mismatch.Actual != 0 {
+			t.Errorf("mismatch %+v", mismatch)
+		}
+	}
+	for _, s := range report.Sources {
+		if s.SourceEvents != 2 || s.Expected != 1 {
+			t.Errorf("source stream %+v", s)
+		}
+	}
+}
+
+func TestFileCheckpoints(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "checkpoints.json")
+
+	if _, ok, err := migration.NewFileCheckpoints(path).LoadMigrationCheckpoint(ctx, "v2"); ok || err != nil {
+		t.Fatalf("checkpoint before any save: %v %v", ok, err)
+	}
+
+	key := migration.StreamKey{Tenant: "acme", AggregateType: "Order", AggregateIdentity: "o:1"}
+	if err := migration.NewFileCheckpoints(path).SaveMigrationCheckpoint(ctx, "v2", key); err != nil {
+		t.Fatal(err)
+	}
+	if err := migration.NewFileCheckpoints(path).SaveMigrationCheckpoint(ctx, "v3", migration.StreamKey{}); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, ok, err := migration.NewFileCheckpoints(path).LoadMigrationCheckpoint(ctx, "v2")
+	if err != nil || !ok || loaded != key {
+		t.Errorf("loaded %v %v %v, want %v", loaded, ok, err, key)
+	}
+}
@@ -0,0 +1,105 @@
+package migration
+
+import (
+	"evol"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Report tells what a migration run read, transformed and wrote, and how the target streams verified.
+type Report struct {
+	Name   string
+	DryRun bool
+
+	// Streams is the number of source streams migrated by the run
+	Streams int
+	// Resumed is the number of source streams migrated by earlier runs, skipped from the checkpoint
+	Resumed int
+	// TargetStreams is the number of target streams the run wrote to
+	TargetStreams int
+
+	EventsRead    int
+	EventsWritten int
+	// EventsSkipped were already written by an interrupted run
+	EventsSkipped int
+
+	Transforms []TransformReport
+	// Sources compares each source stream with the target events written from it, empty for a dry run
+	Sources []StreamReport
+	// Mismatches are the source streams whose events the target does not hold, and the target streams
+	// whose versions are not contiguous, empty for a dry run
+	Mismatches []Mismatch
+
+	Duration time.Duration
+
+	// verified is set once the target streams are verified
+	verified bool
+}
+
+// TransformReport counts the events a transform received and returned.
+type TransformReport struct {
+	Name string
+	In   int
+	Out  int
+}
+
+// StreamReport counts the events of a source stream, through the transforms and in the target.
+type StreamReport struct {
+	Tenant            string
+	AggregateType     evol.AggregateType
+	AggregateIdentity string
+	// SourceEvents is the number of events of the source stream
+	SourceEvents int
+	// Expected is the number of events the transforms return for the stream
+	Expected int
+	// TargetEvents is the number of target events written from the stream, by any run of the migration
+	TargetEvents int
+}
+
+// Mismatch is a source stream whose events do not match the target events written from it,
+// or a target stream whose versions are not contiguous.
+type Mismatch struct {
+	Tenant            string
+	AggregateType     evol.AggregateType
+	AggregateIdentity string
+	Expected          int
+	Actual            int
+	Reason            string
+}
+
+// Verified reports whether the run completed and every target stream holds what it wrote, false for a dry run.
+func (r *Report) Verified() bool {
+	return r.verified && len(r.Mismatches) == 0
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+	mode := ""
+	if r.DryRun {
+		mode = " (dry run)"
+	}
+	fmt.Fprintf(&b, "migration %s%s in %s\n", r.Name, mode, r.Duration.Round(time.Millisecond))
+	fmt.Fprintf(&b, "  streams: %d migrated, %d resumed, %d target streams\n", r.Streams, r.Resumed, r.TargetStreams)
+	fmt.Fprintf(&b, "  events: %d read, %d written, %d already written\n", r.EventsRead, r.EventsWritten, r.EventsSkipped)
+	for _, t := range r.Transforms {
+		fmt.Fprintf(&b, "  transform %s: %d in, %d out\n", t.Name, t.In, t.Out)
+	}
+	if r.verified {
+		var source, expected, target int
+		for _, s := range r.Sources {
+			source += s.SourceEvents
+			expected += s.Expected
+			target += s.TargetEvents
+		}
+		fmt.Fprintf(&b, "  source: %d streams, %d events, %d expected in the target, %d found\n", len(r.Sources), source, expected, target)
+	}
+	if r.Verified() {
+		b.WriteString("  verified\n")
+	}
+	for _, m := range r.Mismatches {
+		fmt.Fprintf(&b, "  mismatch %s %s tenant %q: %s, expected %d events, found %d\n",
+			m.AggregateType, m.AggregateIdentity, m.Tenant, m.Reason, m.Expected, m.Actual)
+	}
+	return b.String()
+}
@@ -0,0 +1,102 @@
+package migration
+
+import (
+	"context"
+	"evol"
+)
+
+// Transform rewrites the events of a stream, it returns the events to write in their place.
+// The versions of the returned events are restamped when written, the aggregate identities
+// of the returned events choose their target streams.
+type Transform func(ctx context.Context, events []evol.Event) ([]evol.Event, error)
+
+// Map transforms the events of a stream one by one, f returns none, one or several events for each.
+func Map(f func(ctx context.Context, e evol.Event) ([]evol.Event, error)) Transform {
+	return func(ctx context.Context, events []evol.Event) ([]evol.Event, error) {
+		res := make([]evol.Event, 0, len(events))
+		for _, e := range events {
+			mapped, err := f(ctx, e)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, mapped...)
+		}
+		return res, nil
+	}
+}
+
+// RenameTopic renames the events of topic from to topic to.
+func RenameTopic(from, to evol.Topic) Transform {
+	return Map(func(ctx context.Context, e evol.Event) ([]evol.Event, error) {
+		if e.Topic() != from {
+			return []evol.Event{e}, nil
+		}
+		return []evol.Event{Derive(e, to, e.Data())}, nil
+	})
+}
+
+// Drop drops the events of topics.
+func Drop(topics ...evol.Topic) Transform {
+	drop := make(map[evol.Topic]bool, len(topics))
+	for _, topic := range topics {
+		drop[topic] = true
+	}
+	return Map(func(ctx context.Context, e evol.Event) ([]evol.Event, error) {
+		if drop[e.Topic()] {
+			return nil, nil
+		}
+		return []evol.Event{e}, nil
+	})
+}
+
+// Split replaces each event of topic by the events split returns, usually made with Derive.
+func Split(topic evol.Topic, split func(e evol.Event) ([]evol.Event, error)) Transform {
+	return Map(func(ctx context.Context, e evol.Event) ([]evol.Event, error) {
+		if e.Topic() != topic {
+			return []evol.Event{e}, nil
+		}
+		return split(e)
+	})
+}
+
+// Merge replaces each event of topic first directly followed by an event of topic next by the event merge returns.
+func Merge(first, next evol.Topic, merge func(first, next evol.Event) (evol.Event, error)) Transform {
+	return func(ctx context.Context, events []evol.Event) ([]evol.Event, error) {
+		res := make([]evol.Event, 0, len(events))
+		for i := 0; i < len(events); i++ {
+			if events[i].Topic() != first || i+1 == len(events) || events[i+1].Topic() != next {
+				res = append(res, events[i])
+				continue
+			}
+
+			merged, err := merge(events[i], events[i+1])
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, merged)
+			i++
+		}
+		return res, nil
+	}
+}
+
+// Rekey moves events to the aggregate key returns, splitting a stream between aggregates or,
+// when the events of several streams get the same identity, merging streams.
+func Rekey(key func(e evol.Event) (evol.AggregateType, string)) Transform {
+	return Map(func(ctx context.Context, e evol.Event) ([]evol.Event, error) {
+		aggregateType, id := key(e)
+		if aggregateType == e.AggregateType() && id == e.AggregateIdentity() {
+			return []evol.Event{e}, nil
+		}
+		return []evol.Event{evol.CopyEvent(e, evol.ForAggregate(aggregateType, id))}, nil
+	})
+}
+
+// Derive creates an event of topic with data, for the aggregate of e with its time and metadata.
+func Derive(e evol.Event, topic evol.Topic, data interface{}) evol.Event {
+	return evol.NewEvent(topic, data, e.Timestamp(),
+		evol.ForAggregate(e.AggregateType(), e.AggregateIdentity()),
+		evol.WithVersion(e.Version()),
+		evol.WithMetadata(e.Metadata()),
+	)
+}
@@ -0,0 +1,32 @@
+package evol
+
+import "context"
+
+// OutboxRecord is a stored event with its position in the order events were saved.
+type OutboxRecord struct {
+	Position uint64
+	Event    Event
+}
+
+// Outbox is a store keeping saved events in order, so they are published only after they are stored.
+type Outbox interface {
+	// Fetch returns up to limit records with a position after the given one, in order
+	Fetch(ctx context.Context, after uint64, limit int) ([]OutboxRecord, error)
+}
+
+// OutboxRepository is a RWRepository that stores the events of an entity atomically with the entity
+type OutboxRepository interface {
+	RWRepository
+	Outbox
+
+	// SaveWithEvents saves the entity and appends its events to the outbox in one step
+	SaveWithEvents(context.Context, Entity, []Event) error
+}
+
+// CheckpointStore keeps the position a named consumer has processed up to.
+type CheckpointStore interface {
+	// LoadCheckpoint returns the saved position, 0 when there is none
+	LoadCheckpoint(ctx context.Context, name string) (uint64, error)
+
+	SaveCheckpoint(ctx context.Context, name string, position uint64) error
+}
@@ -0,0 +1,144 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"evol"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Relay publishes the events of an evol.Outbox to an event bus in save order.
+// Its position is saved as a checkpoint after publishing, so an event is published
+// at least once: after a crash the events since the last checkpoint are published again.
+type Relay struct {
+	// first for 64-bit alignment of atomic operations
+	position uint64
+
+	name        string
+	outbox      evol.Outbox
+	bus         evol.EventHandler
+	checkpoints evol.CheckpointStore
+
+	batchSize int
+	interval  time.Duration
+	logger    evol.Logger
+}
+
+// NewRelay creates a Relay, name identifies its checkpoint.
+func NewRelay(name string, outbox evol.Outbox, bus evol.EventHandler, checkpoints evol.CheckpointStore, options ...Option) (*Relay, error) {
+	if outbox == nil {
+		return nil, errors.New("[evol] NewRelay: outbox nil")
+	}
+	if bus == nil {
+		return nil, errors.New("[evol] NewRelay: eventbus nil")
+	}
+	if checkpoints == nil {
+		return nil, errors.New("[evol] NewRelay: checkpoint store nil")
+	}
+
+	r := &Relay{
+		name:        name,
+		outbox:      outbox,
+		bus:         bus,
+		checkpoints: checkpoints,
+		batchSize:   100,
+		interval:    100 * time.Millisecond,
+	}
+
+	for _, option := range options {
+		if option == nil {
+			continue
+		}
+		option(r)
+	}
+
+	return r, nil
+}
+
+// Option is an option setter used to configure a Relay.
+type Option func(*Relay)
+
+// WithBatchSize sets how many events are fetched at once, 100 by default.
+func WithBatchSize(size int) Option {
+	return func(r *Relay) {
+		r.batchSize = size
+	}
+}
+
+// WithInterval sets how long the relay waits when the outbox is drained or publishing failed, 100ms by default.
+func WithInterval(d time.Duration) Option {
+	return func(r *Relay) {
+		r.interval = d
+	}
+}
+
+// WithLogger sets the logger of the relay, evol.GetLogger() by default.
+func WithLogger(l evol.Logger) Option {
+	return func(r *Relay) {
+		r.logger = l
+	}
+}
+
+// Run publishes events until ctx is done, resuming from the saved checkpoint.
+func (r *Relay) Run(ctx context.Context) error {
+	position, err := r.checkpoints.LoadCheckpoint(ctx, r.name)
+	if err != nil {
+		return fmt.Errorf("[evol] relay %s could not load checkpoint: %w", r.name, err)
+	}
+	atomic.StoreUint64(&r.position, position)
+
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		n, err := r.Flush(ctx)
+		if err != nil {
+			evol.LoggerOr(r.logger).Error("outbox relay failed", "relay", r.name, "position", r.Position(), evol.LogKeyError, err)
+		}
+
+		if n == 0 || err != nil {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(r.interval):
+			}
+		}
+	}
+}
+
+// Flush publishes a batch of pending events and returns how many were published.
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	position := atomic.LoadUint64(&r.position)
+
+	records, err := r.outbox.Fetch(ctx, position, r.batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("could not fetch events: %w", err)
+	}
+
+	published := 0
+	for _, record := range records {
+		if err = r.bus.HandleEvent(ctx, record.Event); err != nil {
+			err = fmt.Errorf("could not publish event at %d: %w", record.Position, err)
+			break
+		}
+		position = record.Position
+		published++
+	}
+
+	if published > 0 {
+		atomic.StoreUint64(&r.position, position)
+		if cpErr := r.checkpoints.SaveCheckpoint(ctx, r.name, position); cpErr != nil && err == nil {
+			err = fmt.Errorf("could not save checkpoint: %w", cpErr)
+		}
+	}
+
+	return published, err
+}
+
+// Position returns the position of the last published event.
+func (r *Relay) Position() uint64 {
+	return atomic.LoadUint64(&r.position)
+}
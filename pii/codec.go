@@ -0,0 +1,397 @@
+package pii
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"evol"
+	"evol/codec"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// errMalformed is returned for values not encrypted by a key of the store
+var errMalformed = errors.New("malformed encrypted value")
+
+// kinds of encrypted values, kind:key id:nonce and ciphertext in base64.
+// Strings are redacted with Redacted, other values with null.
+const (
+	kindString = "s"
+	kindJSON   = "j"
+)
+
+// EventCodec wraps an evol.EventCodec encoding event data as JSON, like codec.JsonEventCodec,
+// encrypting the personal data of the events it marshals and decrypting it in the events it unmarshals.
+type EventCodec struct {
+	codec evol.EventCodec
+	keys  KeyStore
+
+	mu     sync.RWMutex
+	types  map[reflect.Type][]field
+	topics map[evol.Topic][]field
+}
+
+// field is a tagged field by JSON name, with the JSON name of its subject field
+type field struct {
+	name    string
+	subject string
+}
+
+// NewEventCodec creates an EventCodec over c, codec.JsonEventCodec when nil, with the keys of keys.
+func NewEventCodec(c evol.EventCodec, keys KeyStore) *EventCodec {
+	if c == nil {
+		c = &codec.JsonEventCodec{}
+	}
+	return &EventCodec{
+		codec:  c,
+		keys:   keys,
+		types:  make(map[reflect.Type][]field),
+		topics: make(map[evol.Topic][]field),
+	}
+}
+
+// Register declares the data type of topic. The codec learns the fields to encrypt from the data
+// it marshals, Register is needed for events whose data is not of that type, such as events
+// unmarshaled by a relay before they are marshaled again.
+func (c *EventCodec) Register(topic evol.Topic, data interface{}) error {
+	fields, err := c.typeFields(reflect.TypeOf(data))
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.topics[topic] = fields
+	return nil
+}
+
+func (c *EventCodec) MarshalEvent(ctx context.Context, e evol.Event) ([]byte, error) {
+	fields, err := c.fields(e)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		if _, ok := e.Metadata()[FieldsKey]; ok {
+			// carried over from the context, nothing is encrypted
+			return c.codec.MarshalEvent(ctx, withData(e, e.Data(), nil))
+		}
+		return c.codec.MarshalEvent(ctx, e)
+	}
+
+	data, err := toObject(e.Data())
+	if err != nil {
+		return nil, fmt.Errorf("[evol] pii: data of %s: %w", e.Topic(), err)
+	}
+
+	// read the subjects first, a subject may be personal data too
+	subjects := make([]string, len(fields))
+	for i, f := range fields {
+		subjects[i], _ = data[f.subject].(string)
+	}
+
+	// fields encrypted already, by a codec marshaling the event before
+	encrypted := make(map[string]bool)
+	listed := encryptedFields(e.Metadata())
+	for i, f := range fields {
+		v, ok := data[f.name]
+		if !ok || v == nil {
+			continue
+		}
+		if listed[f.name] {
+			ok, err := c.isEncrypted(ctx, v)
+			if err != nil {
+				return nil, fmt.Errorf("[evol] pii: %s of %s: %w", f.name, e.Topic(), err)
+			}
+			if ok {
+				encrypted[f.name] = true
+				continue
+			}
+		}
+		switch subjects[i] {
+		case "":
+			return nil, fmt.Errorf("[evol] pii: %s has no subject in %s for %s", e.Topic(), f.subject, f.name)
+		case Redacted:
+			// forgotten already
+			continue
+		}
+
+		if data[f.name], err = c.encrypt(tenantContext(ctx, e), subjects[i], v); err != nil {
+			return nil, fmt.Errorf("[evol] pii: could not encrypt %s of %s: %w", f.name, e.Topic(), err)
+		}
+		encrypted[f.name] = true
+	}
+
+	return c.codec.MarshalEvent(ctx, withData(e, data, encrypted))
+}
+
+func (c *EventCodec) UnmarshalEvent(ctx context.Context, b []byte) (evol.Event, error) {
+	e, err := c.codec.UnmarshalEvent(ctx, b)
+	if err != nil {
+		return nil, err
+	}
+
+	// only the fields listed by the metadata are encrypted, whatever the values of the others
+	listed := encryptedFields(e.Metadata())
+	if len(listed) == 0 {
+		return e, nil
+	}
+	data, ok := e.Data().(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("[evol] pii: %s has encrypted fields but its data is not a JSON object", e.Topic())
+	}
+
+	for name := range listed {
+		v, ok := data[name]
+		if !ok || v == nil {
+			continue
+		}
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("[evol] pii: could not decrypt %s of %s: %w", name, e.Topic(), errMalformed)
+		}
+		if data[name], err = c.decrypt(ctx, s); err != nil {
+			return nil, fmt.Errorf("[evol] pii: could not decrypt %s of %s: %w", name, e.Topic(), err)
+		}
+	}
+
+	return withData(e, data, nil), nil
+}
+
+// fields returns the fields to encrypt in the data of e
+func (c *EventCodec) fields(e evol.Event) ([]field, error) {
+	t := reflect.TypeOf(e.Data())
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		return c.topics[e.Topic()], nil
+	}
+
+	fields, err := c.typeFields(t)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) > 0 {
+		c.mu.Lock()
+		c.topics[e.Topic()] = fields
+		c.mu.Unlock()
+	}
+	return fields, nil
+}
+
+// typeFields returns the tagged fields of a struct type, cached
+func (c *EventCodec) typeFields(t reflect.Type) ([]field, error) {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("[evol] pii: event data must be a struct, got %v", t)
+	}
+
+	c.mu.RLock()
+	fields, ok := c.types[t]
+	c.mu.RUnlock()
+	if ok {
+		return fields, nil
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		subject, ok := sf.Tag.Lookup(TagName)
+		if !ok || sf.PkgPath != "" {
+			continue
+		}
+		name, ok := jsonName(sf)
+		if !ok {
+			continue
+		}
+
+		subjectField, ok := t.FieldByName(subject)
+		if !ok {
+			return nil, fmt.Errorf("[evol] pii: %s.%s: no subject field %q", t.Name(), sf.Name, subject)
+		}
+		subjectName, ok := jsonName(subjectField)
+		if !ok || subjectField.Type.Kind() != reflect.String {
+			return nil, fmt.Errorf("[evol] pii: %s.%s: subject field %s must be an encoded string", t.Name(), sf.Name, subject)
+		}
+		fields = append(fields, field{name: name, subject: subjectName})
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.types[t] = fields
+	return fields, nil
+}
+
+// jsonName returns the name of a field in JSON, false when it is not encoded
+func jsonName(sf reflect.StructField) (string, bool) {
+	tag := sf.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	if name := strings.Split(tag, ",")[0]; name != "" {
+		return name, true
+	}
+	return sf.Name, true
+}
+
+// tenantContext returns a context for the tenant of e, subjects belonging to the tenant of their events
+func tenantContext(ctx context.Context, e evol.Event) context.Context {
+	return evol.ContextWithTenant(ctx, evol.StoreTenantID(ctx, []evol.Event{e}))
+}
+
+func (c *EventCodec) encrypt(ctx context.Context, subject string, v interface{}) (string, error) {
+	id, key, err := c.keys.SubjectKey(ctx, subject)
+	if err != nil {
+		return "", err
+	}
+
+	kind := kindString
+	var plaintext []byte
+	if s, ok := v.(string); ok {
+		plaintext = []byte(s)
+	} else {
+		kind = kindJSON
+		if plaintext, err = json.Marshal(v); err != nil {
+			return "", err
+		}
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(id))
+
+	return kind + ":" + id + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt returns the value encrypted in s, redacted when its key is forgotten
+func (c *EventCodec) decrypt(ctx context.Context, s string) (interface{}, error) {
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) != 3 || parts[0] != kindString && parts[0] != kindJSON {
+		return nil, errMalformed
+	}
+	kind, id := parts[0], parts[1]
+
+	key, err := c.keys.Key(ctx, id)
+	if errors.Is(err, ErrKeyNotFound) {
+		if kind == kindString {
+			return Redacted, nil
+		}
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errMalformed
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errMalformed
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(id))
+	if err != nil {
+		return nil, errMalformed
+	}
+
+	if kind == kindString {
+		return string(plaintext), nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(plaintext, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// isEncrypted tells whether v is a value encrypted by a key of the store, or by a forgotten one,
+// metadata listing a field being possibly carried over from another event
+func (c *EventCodec) isEncrypted(ctx context.Context, v interface{}) (bool, error) {
+	s, ok := v.(string)
+	if !ok {
+		return false, nil
+	}
+	_, err := c.decrypt(ctx, s)
+	if errors.Is(err, errMalformed) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// encryptedFields returns the fields listed as encrypted by the metadata of an event
+func encryptedFields(md evol.Metadata) map[string]bool {
+	fields := make(map[string]bool)
+	for _, name := range strings.Split(md[FieldsKey], ",") {
+		if name != "" {
+			fields[name] = true
+		}
+	}
+	return fields
+}
+
+// toObject converts event data to its JSON object
+func toObject(data interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var obj map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&obj); err != nil {
+		return nil, errors.New("personal data needs a JSON object")
+	}
+	return obj, nil
+}
+
+// withData copies e with data, listing the encrypted fields in its metadata
+func withData(e evol.Event, data interface{}, encrypted map[string]bool) evol.Event {
+	md := make(evol.Metadata, len(e.Metadata())+1)
+	for k, v := range e.Metadata() {
+		md[k] = v
+	}
+	delete(md, FieldsKey)
+	if len(encrypted) > 0 {
+		names := make([]string, 0, len(encrypted))
+		for name := range encrypted {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		md[FieldsKey] = strings.Join(names, ",")
+	}
+
+	return evol.NewEvent(e.Topic(), data, e.Timestamp(),
+		evol.ForAggregate(e.AggregateType(), e.AggregateIdentity()),
+		evol.WithVersion(e.Version()),
+		evol.WithMetadata(md),
+	)
+}
@@ -0,0 +1,146 @@
+package pii
+
+import (
+	"context"
+	"encoding/json"
+	"evol"
+	"evol/codec"
+	"strings"
+	"testing"
+	"time"
+)
+
+type buyerEvent struct {
+	OrderId string
+	BuyerId string `pii:"BuyerId"`
+	Address string `pii:"BuyerId"`
+	Note    string
+}
+
+func buyer(data *buyerEvent, options ...evol.EventOption) evol.Event {
+	return evol.NewEvent("Bought", data, time.Now(), append([]evol.EventOption{evol.ForAggregate("Order", data.OrderId), evol.WithVersion(1)}, options...)...)
+}
+
+func TestEventCodec(t *testing.T) {
+	keys := NewMemoryKeyStore()
+	c := NewEventCodec(nil, keys)
+	ctx := context.Background()
+
+	b, err := c.MarshalEvent(ctx, buyer(&buyerEvent{OrderId: "o1", BuyerId: "u1", Address: "1 main street", Note: "ring twice"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), `"u1"`) || strings.Contains(string(b), "main street") || !strings.Contains(string(b), "ring twice") {
+		t.Fatalf("unexpected encoding %s", b)
+	}
+
+	e, err := c.UnmarshalEvent(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := e.Data().(map[string]interface{})
+	if data["BuyerId"] != "u1" || data["Address"] != "1 main street" {
+		t.Fatalf("unexpected data %v", data)
+	}
+	if _, ok := e.Metadata()[FieldsKey]; ok {
+		t.Error("decoded event lists encrypted fields")
+	}
+
+	// an event read without the pii codec keeps its encrypted fields when marshaled again
+	plain, err := (&codec.JsonEventCodec{}).UnmarshalEvent(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := c.MarshalEvent(ctx, plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, err = c.UnmarshalEvent(ctx, again); err != nil || e.Data().(map[string]interface{})["BuyerId"] != "u1" {
+		t.Fatalf("event encrypted twice: %v %v", e, err)
+	}
+
+	if err := keys.Forget(ctx, "u1"); err != nil {
+		t.Fatal(err)
+	}
+	if e, err = c.UnmarshalEvent(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	if data := e.Data().(map[string]interface{}); data["BuyerId"] != Redacted || data["Address"] != Redacted {
+		t.Fatalf("forgotten data %v", data)
+	}
+}
+
+func TestEventCodecOnlyDecryptsListedFields(t *testing.T) {
+	c := NewEventCodec(nil, NewMemoryKeyStore())
+	ctx := context.Background()
+
+	// a user value looking encrypted is left alone
+	crafted := "s:0123:AAAA"
+	b, err := c.MarshalEvent(ctx, buyer(&buyerEvent{OrderId: "o1", BuyerId: "u1", Address: "a", Note: crafted}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := c.UnmarshalEvent(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if note := e.Data().(map[string]interface{})["Note"]; note != crafted {
+		t.Fatalf("note %v", note)
+	}
+
+	// fields listed by metadata carried over from another event are encrypted, unless they decrypt
+	id, _, err := c.keys.SubjectKey(ctx, "u2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	crafted = "s:" + id + ":AAAA"
+	listed := evol.WithMetadata(evol.Metadata{FieldsKey: "Address,BuyerId,Note"})
+	if b, err = c.MarshalEvent(ctx, buyer(&buyerEvent{OrderId: "o2", BuyerId: "u2", Address: crafted}, listed)); err != nil {
+		t.Fatal(err)
+	}
+	var raw struct {
+		Data     map[string]interface{} `json:"data"`
+		Metadata evol.Metadata          `json:"metadata"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if raw.Data["Address"] == crafted || raw.Metadata[FieldsKey] != "Address,BuyerId" {
+		t.Fatalf("unexpected encoding %s", b)
+	}
+	if e, err = c.UnmarshalEvent(ctx, b); err != nil || e.Data().(map[string]interface{})["Address"] != crafted {
+		t.Fatalf("decoded %v %v", e, err)
+	}
+}
+
+func TestSubjectsOfEachTenant(t *testing.T) {
+	keys := NewMemoryKeyStore()
+	c := NewEventCodec(nil, keys)
+	ctx := context.Background()
+	acme := evol.ContextWithTenant(ctx, "acme")
+
+	var encoded [][]byte
+	for _, e := range []evol.Event{
+		buyer(&buyerEvent{OrderId: "o1", BuyerId: "u1", Address: "1 main street"}),
+		buyer(&buyerEvent{OrderId: "o2", BuyerId: "u1", Address: "2 main street"}, evol.WithMetadata(evol.Metadata{evol.TenantIDKey: "acme"})),
+	} {
+		b, err := c.MarshalEvent(ctx, e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded = append(encoded, b)
+	}
+
+	if err := keys.Forget(acme, "u1"); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"1 main street", Redacted} {
+		e, err := c.UnmarshalEvent(ctx, encoded[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if address := e.Data().(map[string]interface{})["Address"]; address != want {
+			t.Errorf("address %v, want %s", address, want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package pii
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"evol"
+	"sync"
+)
+
+// KeySize is the size of the AES-256 keys of subjects.
+const KeySize = 32
+
+// KeyStore holds a key per subject of each tenant, identified by a random id stored with the encrypted values.
+// Subjects belong to the tenant in ctx, see evol.TenantID, so a subject forgotten by a tenant is kept by the others.
+type KeyStore interface {
+	// SubjectKey returns the id and the key of subject, created on first use
+	SubjectKey(ctx context.Context, subject string) (id string, key []byte, err error)
+
+	// Key returns the key with id, ErrKeyNotFound once its subject is forgotten
+	Key(ctx context.Context, id string) ([]byte, error)
+
+	// Forget deletes the key of subject, forgetting an unknown subject is not an error
+	Forget(ctx context.Context, subject string) error
+}
+
+// NewKey returns a random key id and key.
+func NewKey() (string, []byte, error) {
+	b := make([]byte, 16+KeySize)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	return hex.EncodeToString(b[:16]), b[16:], nil
+}
+
+// MemoryKeyStore is a KeyStore in memory, for tests and single process applications
+// whose events do not outlive the process.
+type MemoryKeyStore struct {
+	mu       sync.RWMutex
+	subjects map[subjectKey]string
+	keys     map[string][]byte
+}
+
+// subjectKey identifies a subject, subjects are unique within a tenant
+type subjectKey struct {
+	tenant  string
+	subject string
+}
+
+// NewMemoryKeyStore creates an empty MemoryKeyStore.
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{
+		subjects: make(map[subjectKey]string),
+		keys:     make(map[string][]byte),
+	}
+}
+
+func (s *MemoryKeyStore) SubjectKey(ctx context.Context, subject string) (string, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sk := subjectKey{tenant: evol.TenantID(ctx), subject: subject}
+	if id, ok := s.subjects[sk]; ok {
+		return id, s.keys[id], nil
+	}
+
+	id, key, err := NewKey()
+	if err != nil {
+		return "", nil, err
+	}
+	s.subjects[sk] = id
+	s.keys[id] = key
+	return id, key, nil
+}
+
+func (s *MemoryKeyStore) Key(ctx context.Context, id string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return key, nil
+}
+
+func (s *MemoryKeyStore) Forget(ctx context.Context, subject string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sk := subjectKey{tenant: evol.TenantID(ctx), subject: subject}
+	if id, ok := s.subjects[sk]; ok {
+		delete(s.keys, id)
+		delete(s.subjects, sk)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+// Package pii encrypts the personal data of events, so it can be erased from immutable event streams.
+//
+// Fields of event data holding personal data are tagged with the field identifying the person,
+// the subject, whose key encrypts them:
+//
+//	type OrderCreatedEvent struct {
+//		OrderId string
+//		BuyerId string `pii:"BuyerId"`
+//		Address string `pii:"BuyerId"`
+//	}
+//
+// EventCodec encrypts those fields with the key of the subject in a KeyStore when events are marshaled,
+// and decrypts them when events are unmarshaled. Forgetting the subject deletes its key, its personal data
+// then decodes as redacted values. Encrypted values only carry the random id of the key, never the subject.
+// Only top level fields of the event data are encrypted, the FieldsKey metadata of an encoded event lists them.
+package pii
+
+import "errors"
+
+// Redacted replaces the string values whose key was forgotten, other values become null.
+const Redacted = "[redacted]"
+
+// TagName is the struct tag naming the subject field of personal data.
+const TagName = "pii"
+
+// FieldsKey is the metadata key listing the encrypted fields of an encoded event, by JSON name separated by commas.
+// Events decoded by EventCodec no longer carry it.
+const FieldsKey = "evol-pii-fields"
+
+// ErrKeyNotFound is returned by a KeyStore for the keys of forgotten subjects.
+var ErrKeyNotFound = errors.New("[evol] pii: key not found")
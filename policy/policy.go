@@ -0,0 +1,226 @@
+// Package policy reacts to events with commands, for the reactions that need no state of their own,
+// such as sending OrderConfirmedCmd on OrderPayedEvent, where a saga would be overkill.
+//
+// The commands carry the metadata of the event, its correlation id and tenant included, and the
+// CauseKey of the event. A policy failing to send a command returns the error to the event bus,
+// which retries the event with the retry policy of the bus, or the one of the policy. A command bus
+// handling commands asynchronously, like command.LocalCommandBus, only fails to dispatch them.
+// Policies are idempotent as far as their SentStore remembers: the commands already sent for an event are
+// not sent again when it is redelivered, nor by concurrent deliveries of it. The default memory store forgets
+// them after DefaultSentTTL and on restart, a policy needs a durable SentStore to stay idempotent across restarts.
+// A command is claimed before it is sent and released when sending fails, a process stopping in between
+// does not send it again.
+package policy
+
+import (
+	"context"
+	"errors"
+	"evol"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// CauseKey is the metadata key of the commands sent by a policy, the policy name and the event
+// that caused them.
+const CauseKey = "evol-policy-cause"
+
+// Reaction returns the commands to send for an event, in order. It must return the same commands
+// on every delivery of the event, the commands already sent being skipped by their position.
+type Reaction func(ctx context.Context, e evol.Event) ([]evol.Command, error)
+
+// Send returns a Reaction sending the single command returned by f, none when it is nil.
+func Send(f func(ctx context.Context, e evol.Event) (evol.Command, error)) Reaction {
+	return func(ctx context.Context, e evol.Event) ([]evol.Command, error) {
+		cmd, err := f(ctx, e)
+		if err != nil || cmd == nil {
+			return nil, err
+		}
+		return []evol.Command{cmd}, nil
+	}
+}
+
+// Policy sends the commands of its reaction to the events of its topics, it implements evol.Policy.
+type Policy struct {
+	name   string
+	topics []evol.Topic
+	react  Reaction
+
+	sent   SentStore
+	retry  *evol.RetryPolicy
+	logger evol.Logger
+
+	// set by Bind
+	cmdBus   evol.CommandHandler
+	cmdBusMu sync.RWMutex
+}
+
+// NewPolicy creates a Policy reacting to the events of topics, name identifies it on the event bus
+// and in the commands it sends.
+func NewPolicy(name string, topics []evol.Topic, react Reaction, options ...Option) (*Policy, error) {
+	if name == "" {
+		return nil, errors.New("[evol] NewPolicy: missing policy name")
+	}
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("[evol] NewPolicy %s: missing topics", name)
+	}
+	if react == nil {
+		return nil, fmt.Errorf("[evol] NewPolicy %s: missing reaction", name)
+	}
+
+	p := &Policy{
+		name:   name,
+		topics: topics,
+		react:  react,
+		sent:   NewMemorySentStore(DefaultSentTTL),
+	}
+
+	for _, option := range options {
+		if option == nil {
+			continue
+		}
+		option(p)
+	}
+
+	return p, nil
+}
+
+// Option is an option setter used to configure a Policy.
+type Option func(*Policy)
+
+// WithSentStore sets where the policy records the commands it sent, a memory store by default,
+// which forgets them after DefaultSentTTL and when the process stops.
+func WithSentStore(s SentStore) Option {
+	return func(p *Policy) {
+		p.sent = s
+	}
+}
+
+// WithRetryPolicy sets how the event bus retries the policy when it fails to send a command.
+func WithRetryPolicy(rp evol.RetryPolicy) Option {
+	return func(p *Policy) {
+		p.retry = &rp
+	}
+}
+
+// WithLogger sets the logger of the policy, evol.GetLogger() by default.
+func WithLogger(l evol.Logger) Option {
+	return func(p *Policy) {
+		p.logger = l
+	}
+}
+
+// Name returns the name of the policy.
+func (p *Policy) Name() string {
+	return p.name
+}
+
+// Topics implements evol.Policy.
+func (p *Policy) Topics() []evol.Topic {
+	return p.topics
+}
+
+// Bind implements evol.Policy.
+func (p *Policy) Bind(cmdBus evol.CommandHandler) {
+	p.cmdBusMu.Lock()
+	defer p.cmdBusMu.Unlock()
+
+	p.cmdBus = cmdBus
+}
+
+func (p *Policy) bus() evol.CommandHandler {
+	p.cmdBusMu.RLock()
+	defer p.cmdBusMu.RUnlock()
+
+	return p.cmdBus
+}
+
+// HandleEvent sends the commands of the reaction to e, but the ones already sent for it.
+// Events without version can not be told apart, their commands are sent on every delivery.
+func (p *Policy) HandleEvent(ctx context.Context, e evol.Event) error {
+	bus := p.bus()
+	if bus == nil {
+		return fmt.Errorf("[evol] policy %s is not bound to a command bus", p.name)
+	}
+
+	// buses already do, for handlers called directly
+	ctx = evol.ContextWithMetadata(ctx, e.Metadata())
+	ctx = evol.ContextWithCorrelationID(ctx)
+
+	cmds, err := p.react(ctx, e)
+	if err != nil {
+		return err
+	}
+
+	cause := fmt.Sprintf("%s:%s:%s:%d", p.name, e.AggregateType(), e.AggregateIdentity(), e.Version())
+	ctx = evol.ContextWithMetadata(ctx, evol.Metadata{CauseKey: cause})
+
+	for i, cmd := range cmds {
+		if cmd == nil {
+			continue
+		}
+
+		key := ""
+		if e.Version() > 0 {
+			key = cause + ":" + strconv.Itoa(i)
+			claimed, err := p.sent.Claim(ctx, key)
+			if err != nil {
+				return fmt.Errorf("[evol] policy %s: %w", p.name, err)
+			}
+			if !claimed {
+				p.log().Debug("policy command already sent", p.fields(ctx, e, cmd)...)
+				continue
+			}
+		}
+
+		if err := bus.HandleCommand(ctx, cmd); err != nil {
+			if key != "" {
+				if rerr := p.sent.Release(ctx, key); rerr != nil {
+					p.log().Error("policy could not release command", append(p.fields(ctx, e, cmd), evol.LogKeyError, rerr)...)
+				}
+			}
+			return fmt.Errorf("[evol] policy %s could not send %s: %w", p.name, cmd.Name(), err)
+		}
+		p.log().Debug("policy sent command", p.fields(ctx, e, cmd)...)
+	}
+
+	return nil
+}
+
+func (p *Policy) log() evol.Logger {
+	return evol.LoggerOr(p.logger)
+}
+
+func (p *Policy) fields(ctx context.Context, e evol.Event, cmd evol.Command) []interface{} {
+	kv := []interface{}{"policy", p.name, evol.LogKeyTopic, e.Topic()}
+	return append(kv, evol.CommandFields(ctx, cmd)...)
+}
+
+// Register registers p in evol.DefaultRegistry under its name.
+func Register(p *Policy) error {
+	return RegisterIn(evol.DefaultRegistry, p)
+}
+
+// RegisterIn registers p in r under its name.
+func RegisterIn(r *evol.Registry, p *Policy) error {
+	return r.RegisterPolicy(p.name, p)
+}
+
+// Prepare binds the policies of r to cmdBus and registers them on evtBus.
+func Prepare(ctx context.Context, r *evol.Registry, evtBus evol.EventBus, cmdBus evol.CommandHandler) error {
+	for _, name := range r.PolicyNames() {
+		p := r.Policy(name)
+		p.Bind(cmdBus)
+
+		options := []evol.HandlerOption{evol.WithHandlerName(name)}
+		if pp, ok := p.(*Policy); ok && pp.retry != nil {
+			options = append(options, evol.WithRetryPolicy(*pp.retry))
+		}
+		for _, topic := range p.Topics() {
+			if err := evtBus.RegisterHandler(ctx, topic, p, options...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
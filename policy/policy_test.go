@@ -0,0 +1,184 @@
+package policy_test
+
+import (
+	"context"
+	"errors"
+	"evol"
+	"evol/aggregatestore"
+	"evol/application"
+	"evol/eventbus/local"
+	"evol/policy"
+	"evol/repo/memory"
+	"sync"
+	"testing"
+	"time"
+)
+
+type confirmCmd struct {
+	OrderId string
+	Step    int
+}
+
+func (c *confirmCmd) Name() evol.CommandName                  { return "ConfirmCmd" }
+func (c *confirmCmd) TargetAggregateType() evol.AggregateType { return "Order" }
+func (c *confirmCmd) TargetIdentity() string                  { return c.OrderId }
+
+// confirm reacts to an event of an order with two commands
+func confirm(ctx context.Context, e evol.Event) ([]evol.Command, error) {
+	return []evol.Command{
+		&confirmCmd{OrderId: e.AggregateIdentity(), Step: 1},
+		&confirmCmd{OrderId: e.AggregateIdentity(), Step: 2},
+	}, nil
+}
+
+// cmdBus records the commands it receives with their context, failing the ones fail returns true for
+type cmdBus struct {
+	mu   sync.Mutex
+	cmds []*confirmCmd
+	ctxs []context.Context
+	fail func(cmd *confirmCmd) bool
+}
+
+func (b *cmdBus) HandleCommand(ctx context.Context, cmd evol.Command) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := cmd.(*confirmCmd)
+	if b.fail != nil && b.fail(c) {
+		return errors.New("boom")
+	}
+	b.cmds = append(b.cmds, c)
+	b.ctxs = append(b.ctxs, ctx)
+	return nil
+}
+
+func (b *cmdBus) RegisterCmdHandler(name evol.CommandName, h evol.CommandHandler) error {
+	return nil
+}
+
+func (b *cmdBus) steps() []int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var steps []int
+	for _, c := range b.cmds {
+		steps = append(steps, c.Step)
+	}
+	return steps
+}
+
+func paid(id string, version int, options ...evol.EventOption) evol.Event {
+	options = append([]evol.EventOption{evol.ForAggregate("Order", id), evol.WithVersion(version)}, options...)
+	return evol.NewEvent("OrderPaid", nil, time.Now(), options...)
+}
+
+func newPolicy(t *testing.T, bus evol.CommandHandler) *policy.Policy {
+	t.Helper()
+	p, err := policy.NewPolicy("confirmation", []evol.Topic{"OrderPaid"}, confirm, policy.WithLogger(evol.NopLogger()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Bind(bus)
+	return p
+}
+
+func TestPolicySendsCommandsOnce(t *testing.T) {
+	bus := &cmdBus{}
+	p := newPolicy(t, bus)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := p.HandleEvent(ctx, paid("o1", 3)); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if steps := bus.steps(); len(steps) != 2 {
+		t.Fatalf("sent steps %v for concurrent deliveries", steps)
+	}
+
+	// events without version can not be told apart
+	for i := 0; i < 2; i++ {
+		if err := p.HandleEvent(ctx, paid("o2", 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(bus.steps()); n != 6 {
+		t.Errorf("sent %d commands, want the ones of every delivery of an event without version", n)
+	}
+}
+
+func TestPolicyResendsFailedCommand(t *testing.T) {
+	failing := true
+	bus := &cmdBus{fail: func(cmd *confirmCmd) bool { return cmd.Step == 2 && failing }}
+	p := newPolicy(t, bus)
+
+	if err := p.HandleEvent(context.Background(), paid("o1", 3)); err == nil {
+		t.Fatal("the policy did not fail")
+	}
+	failing = false
+	if err := p.HandleEvent(context.Background(), paid("o1", 3)); err != nil {
+		t.Fatal(err)
+	}
+	if steps := bus.steps(); len(steps) != 2 || steps[0] != 1 || steps[1] != 2 {
+		t.Errorf("sent steps %v, want 1 then 2 on the redelivery", steps)
+	}
+}
+
+func TestPolicyCommandMetadata(t *testing.T) {
+	bus := &cmdBus{}
+	p := newPolicy(t, bus)
+
+	e := paid("o1", 3, evol.WithMetadata(evol.Metadata{evol.TenantIDKey: "acme", evol.CorrelationIDKey: "c1"}))
+	if err := p.HandleEvent(context.Background(), e); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.HandleEvent(context.Background(), paid("o2", 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := bus.ctxs[0]
+	if evol.TenantID(ctx) != "acme" || evol.CorrelationID(ctx) != "c1" {
+		t.Errorf("command metadata %v", evol.MetadataFromContext(ctx))
+	}
+	if cause := evol.MetadataFromContext(ctx)[policy.CauseKey]; cause != "confirmation:Order:o1:3" {
+		t.Errorf("cause %q", cause)
+	}
+	if evol.CorrelationID(bus.ctxs[2]) == "" || evol.CorrelationID(bus.ctxs[2]) != evol.CorrelationID(bus.ctxs[3]) {
+		t.Error("the commands of an event without correlation id do not share a new one")
+	}
+}
+
+func TestPolicyWiredByApp(t *testing.T) {
+	r := evol.NewRegistry()
+	p, err := policy.NewPolicy("confirmation", []evol.Topic{"OrderPaid"}, confirm, policy.WithLogger(evol.NopLogger()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := policy.RegisterIn(r, p); err != nil {
+		t.Fatal(err)
+	}
+
+	bus := &cmdBus{}
+	eventBus := local.NewEventBus(local.WithLogger(evol.NopLogger()))
+	store := aggregatestore.NewAggregateEventStore(memory.NewAggregateEventRepo(), aggregatestore.WithRegistry(r))
+	app := application.NewApp(r)
+	if err := app.Start(context.Background(), bus, eventBus, store, nil, application.WithLogger(evol.NopLogger())); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := eventBus.HandleEvent(context.Background(), paid("o1", 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := app.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if steps := bus.steps(); len(steps) != 2 {
+		t.Errorf("sent steps %v through the App", steps)
+	}
+}
@@ -0,0 +1,93 @@
+package policy
+
+import (
+	"context"
+	"evol"
+	"sync"
+	"time"
+)
+
+// SentStore records the commands policies sent, by a key of the policy, event and command position.
+// A delivery claims a command before sending it, so concurrent deliveries of an event do not both send it.
+// The keys of each tenant are kept apart, by the tenant of ctx.
+type SentStore interface {
+	// Claim records the command of key as sent, it reports false when it was claimed already.
+	// Checking and recording the key must be atomic.
+	Claim(ctx context.Context, key string) (bool, error)
+	// Release forgets the claim of a command that could not be sent, a later delivery sends it
+	Release(ctx context.Context, key string) error
+}
+
+// DefaultSentTTL is how long the memory SentStore of a policy remembers a command, longer than
+// the redeliveries of an event usually take.
+const DefaultSentTTL = 24 * time.Hour
+
+// memorySentStore keeps the keys of each tenant apart, until they expire
+type memorySentStore struct {
+	ttl time.Duration
+	now func() time.Time
+
+	keys map[sentKey]time.Time
+	// expiries lists the keys in the order they were claimed, thus of their expiry
+	expiries []sentExpiry
+	keysMu   sync.Mutex
+}
+
+type sentKey struct {
+	tenant string
+	key    string
+}
+
+type sentExpiry struct {
+	key sentKey
+	at  time.Time
+}
+
+// NewMemorySentStore creates a SentStore in memory, it forgets the keys ttl after they were claimed,
+// DefaultSentTTL when ttl is not positive, and all of them when the process stops.
+func NewMemorySentStore(ttl time.Duration) SentStore {
+	if ttl <= 0 {
+		ttl = DefaultSentTTL
+	}
+	return &memorySentStore{ttl: ttl, now: time.Now, keys: make(map[sentKey]time.Time)}
+}
+
+func (s *memorySentStore) Claim(ctx context.Context, key string) (bool, error) {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+
+	now := s.now()
+	s.prune(now)
+
+	k := sentKey{tenant: evol.TenantID(ctx), key: key}
+	if _, ok := s.keys[k]; ok {
+		return false, nil
+	}
+	at := now.Add(s.ttl)
+	s.keys[k] = at
+	s.expiries = append(s.expiries, sentExpiry{key: k, at: at})
+	return true, nil
+}
+
+func (s *memorySentStore) Release(ctx context.Context, key string) error {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+
+	// its expiry entry is pruned in time, it no longer matches the key
+	delete(s.keys, sentKey{tenant: evol.TenantID(ctx), key: key})
+	return nil
+}
+
+// prune drops the keys expired at now, the oldest first
+func (s *memorySentStore) prune(now time.Time) {
+	n := 0
+	for ; n < len(s.expiries) && !now.Before(s.expiries[n].at); n++ {
+		e := s.expiries[n]
+		// a key released and claimed again expires later, with its last entry
+		if s.keys[e.key].Equal(e.at) {
+			delete(s.keys, e.key)
+		}
+	}
+	// append drops the pruned entries when it grows the slice
+	s.expiries = s.expiries[n:]
+}
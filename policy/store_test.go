@@ -0,0 +1,61 @@
+package policy
+
+import (
+	"context"
+	"evol"
+	"testing"
+	"time"
+)
+
+func TestMemorySentStoreExpires(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewMemorySentStore(time.Hour).(*memorySentStore)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+	acme := evol.ContextWithTenant(ctx, "acme")
+
+	claim := func(ctx context.Context, key string) bool {
+		t.Helper()
+		ok, err := s.Claim(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+	release := func(ctx context.Context, key string) {
+		t.Helper()
+		if err := s.Release(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !claim(ctx, "k1") || claim(ctx, "k1") {
+		t.Fatal("k1 claimed twice")
+	}
+	if !claim(acme, "k1") {
+		t.Fatal("keys not kept apart by tenant")
+	}
+
+	now = now.Add(30 * time.Minute)
+	if !claim(ctx, "k2") {
+		t.Fatal("k2 not claimed")
+	}
+
+	now = now.Add(30 * time.Minute)
+	if !claim(ctx, "k1") || claim(ctx, "k2") {
+		t.Fatal("k1 of the default tenant did not expire alone")
+	}
+
+	// claimed again after its release, k2 is kept another ttl
+	release(ctx, "k2")
+	if !claim(ctx, "k2") {
+		t.Fatal("released k2 not claimed")
+	}
+	now = now.Add(45 * time.Minute)
+	if claim(ctx, "k2") || !claim(acme, "k1") {
+		t.Fatal("k2 expired with its first claim")
+	}
+	if len(s.keys) != 3 || len(s.expiries) != 3 {
+		t.Errorf("kept %d keys, %d expiries, want 3", len(s.keys), len(s.expiries))
+	}
+}
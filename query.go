@@ -1,4 +1,25 @@
 package evol
 
+import (
+	"context"
+	"errors"
+)
+
 type Query interface {
 }
+
+// QueryHandler answers queries, with a result whose type depends on the query.
+type QueryHandler interface {
+	HandleQuery(context.Context, Query) (interface{}, error)
+}
+
+// QueryHandlerFunc is a function that can be used as a query handler.
+type QueryHandlerFunc func(context.Context, Query) (interface{}, error)
+
+// HandleQuery implements the HandleQuery method of the QueryHandler.
+func (h QueryHandlerFunc) HandleQuery(ctx context.Context, q Query) (interface{}, error) {
+	return h(ctx, q)
+}
+
+// ErrUnhandledQuery is returned by a query bus for a query no handler is registered for.
+var ErrUnhandledQuery = errors.New("[evol] unhandled query")
@@ -0,0 +1,385 @@
+package evol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// Saga is a saga manager registered in a Registry, bound to a command bus and a saga repo when the application runs.
+type Saga interface {
+	EventHandler
+
+	// Topics returns the topics of the events the saga handles
+	Topics() []Topic
+
+	// Bind sets the command bus and the repo of the saga, its background work runs until ctx is done
+	Bind(ctx context.Context, cmdBus CommandHandler, repo SagaRepo)
+
+	// Wait returns once the background work started by Bind is done
+	Wait()
+}
+
+// Policy reacts to events by sending commands, without state of its own. It is registered in a Registry
+// and bound to the command bus when the application runs.
+type Policy interface {
+	EventHandler
+
+	// Topics returns the topics of the events the policy reacts to
+	Topics() []Topic
+
+	// Bind sets the command bus the policy sends its commands to
+	Bind(cmdBus CommandHandler)
+}
+
+// Registry owns the aggregates, commands, event handlers, sagas and policies of a bounded context, and its command bus.
+// The package level functions use DefaultRegistry, filled by the init functions of domain packages,
+// a Registry of its own keeps a second bounded context or a test apart from it.
+type Registry struct {
+	aggFactories   map[AggregateType]func(string) Aggregate
+	aggFactoriesMu *sync.RWMutex
+
+	cmds   map[CommandName]Command
+	cmdsMu *sync.RWMutex
+
+	handlers map[Topic][]EventHandler
+	// names holds the names given to the handlers, by their index in handlers
+	names      map[Topic][]string
+	handlersMu *sync.RWMutex
+
+	sagas   map[string]Saga
+	sagasMu *sync.RWMutex
+
+	policies   map[string]Policy
+	policiesMu *sync.RWMutex
+
+	cmdBus *CommandBus
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		aggFactories:   make(map[AggregateType]func(string) Aggregate),
+		aggFactoriesMu: &sync.RWMutex{},
+		cmds:           make(map[CommandName]Command),
+		cmdsMu:         &sync.RWMutex{},
+		handlers:       make(map[Topic][]EventHandler),
+		names:          make(map[Topic][]string),
+		handlersMu:     &sync.RWMutex{},
+		sagas:          make(map[string]Saga),
+		sagasMu:        &sync.RWMutex{},
+		policies:       make(map[string]Policy),
+		policiesMu:     &sync.RWMutex{},
+		cmdBus:         new(CommandBus),
+	}
+}
+
+// DefaultRegistry is the Registry of the package level functions, it shares their
+// maps with EventHandlers and CmdBus.
+var DefaultRegistry = &Registry{
+	aggFactories:   make(map[AggregateType]func(string) Aggregate),
+	aggFactoriesMu: &sync.RWMutex{},
+	cmds:           make(map[CommandName]Command),
+	cmdsMu:         &sync.RWMutex{},
+	handlers:       EventHandlers,
+	names:          make(map[Topic][]string),
+	handlersMu:     &EventHandlersMu,
+	sagas:          make(map[string]Saga),
+	sagasMu:        &sync.RWMutex{},
+	policies:       make(map[string]Policy),
+	policiesMu:     &sync.RWMutex{},
+	cmdBus:         &CmdBus,
+}
+
+// RegisterAggregate registers the factory of an aggregate type, it panics on an invalid or duplicated registration.
+// The factory is not called before the first CreateAggregate.
+func (r *Registry) RegisterAggregate(aggregateType AggregateType, factory func(string) Aggregate) {
+	ftype := reflect.TypeOf(factory)
+	if ftype.Kind() != reflect.Func {
+		panic("[evol] RegisterAggregate parameter not a func")
+	}
+	if ftype.NumIn() != 1 {
+		panic("[evol] RegisterAggregate factory func parameter not match")
+	}
+
+	if err := r.registerAggregate(aggregateType, factory); err != nil {
+		panic(err.Error())
+	}
+}
+
+func (r *Registry) registerAggregate(aggregateType AggregateType, factory func(string) Aggregate) error {
+	r.aggFactoriesMu.Lock()
+	defer r.aggFactoriesMu.Unlock()
+
+	if _, ok := r.aggFactories[aggregateType]; ok {
+		return fmt.Errorf("[evol] RegisterAggregate register duplicated aggregate: %s", aggregateType)
+	}
+
+	r.aggFactories[aggregateType] = factory
+	return nil
+}
+
+// CreateAggregate creates an aggregate with the registered factory of its type.
+// A panicking factory fails with the panic as error.
+func (r *Registry) CreateAggregate(aggType AggregateType, identity string) (a Aggregate, err error) {
+	r.aggFactoriesMu.RLock()
+	factory, ok := r.aggFactories[aggType]
+	r.aggFactoriesMu.RUnlock()
+
+	if !ok {
+		return nil, errors.New("[evol] CreateAggregate aggregate not registered")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			a, err = nil, fmt.Errorf("[evol] CreateAggregate %s %s: %v", aggType, identity, p)
+		}
+	}()
+	return factory(identity), nil
+}
+
+// RegisterCommand registers a command by its name.
+func (r *Registry) RegisterCommand(cmd Command) error {
+	r.cmdsMu.Lock()
+	defer r.cmdsMu.Unlock()
+
+	if _, ok := r.cmds[cmd.Name()]; ok {
+		return errors.New("command already registered")
+	}
+
+	r.cmds[cmd.Name()] = cmd
+	return nil
+}
+
+// NewCommand returns a new zero command of the type registered under name, nil when not registered.
+func (r *Registry) NewCommand(name CommandName) Command {
+	r.cmdsMu.RLock()
+	defer r.cmdsMu.RUnlock()
+
+	cmd, ok := r.cmds[name]
+	if !ok {
+		return nil
+	}
+
+	// commands are decoded into the result, never hand out the registered one
+	t := reflect.TypeOf(cmd)
+	if t.Kind() != reflect.Ptr {
+		return cmd
+	}
+	if c, ok := reflect.New(t.Elem()).Interface().(Command); ok {
+		return c
+	}
+	return cmd
+}
+
+// Commands returns the registered commands by name.
+func (r *Registry) Commands() map[CommandName]Command {
+	r.cmdsMu.RLock()
+	defer r.cmdsMu.RUnlock()
+
+	mapCopy := make(map[CommandName]Command, len(r.cmds))
+	for name, cmd := range r.cmds {
+		mapCopy[name] = cmd
+	}
+	return mapCopy
+}
+
+// RegisterEventHandlers registers h for the events of topics, named by DefaultHandlerName.
+func (r *Registry) RegisterEventHandlers(h EventHandler, topics ...Topic) {
+	r.handlersMu.Lock()
+	defer r.handlersMu.Unlock()
+
+	for _, topic := range topics {
+		r.addHandler(topic, "", h)
+	}
+}
+
+// RegisterNamedEventHandler registers h for the events of topics under name, unique per topic.
+// Buses with durable subscriptions, like NATS, name them after it.
+func (r *Registry) RegisterNamedEventHandler(name string, h EventHandler, topics ...Topic) error {
+	if name == "" || h == nil {
+		return errors.New("[evol] RegisterNamedEventHandler: missing name or handler")
+	}
+
+	r.handlersMu.Lock()
+	defer r.handlersMu.Unlock()
+
+	for _, topic := range topics {
+		for i, h := range r.handlers[topic] {
+			if r.handlerName(topic, i, h) == name {
+				return fmt.Errorf("[evol] RegisterNamedEventHandler: %s already registered on %s", name, topic)
+			}
+		}
+	}
+	for _, topic := range topics {
+		r.addHandler(topic, name, h)
+	}
+	return nil
+}
+
+// addHandler appends h and its name, r.handlersMu must be held
+func (r *Registry) addHandler(topic Topic, name string, h EventHandler) {
+	names := r.names[topic]
+	// handlers appended to the EventHandlers map directly have no name
+	for len(names) < len(r.handlers[topic]) {
+		names = append(names, "")
+	}
+	r.handlers[topic] = append(r.handlers[topic], h)
+	r.names[topic] = append(names, name)
+}
+
+// handlerName returns the name of the handler at index i of topic, r.handlersMu must be held
+func (r *Registry) handlerName(topic Topic, i int, h EventHandler) string {
+	if names := r.names[topic]; i < len(names) && names[i] != "" {
+		return names[i]
+	}
+	return DefaultHandlerName(h)
+}
+
+// NamedEventHandler is an event handler with its name in a Registry.
+type NamedEventHandler struct {
+	Name    string
+	Handler EventHandler
+}
+
+// NamedEventHandlers returns the registered event handlers by topic, with their names.
+func (r *Registry) NamedEventHandlers() map[Topic][]NamedEventHandler {
+	r.handlersMu.RLock()
+	defer r.handlersMu.RUnlock()
+
+	res := make(map[Topic][]NamedEventHandler, len(r.handlers))
+	for topic, handlers := range r.handlers {
+		for i, h := range handlers {
+			res[topic] = append(res[topic], NamedEventHandler{Name: r.handlerName(topic, i, h), Handler: h})
+		}
+	}
+	return res
+}
+
+// DefaultHandlerName names a handler registered without name: the name of its function for a function,
+// such as domain.ProjectOrderCreated, its type otherwise.
+func DefaultHandlerName(h EventHandler) string {
+	if v := reflect.ValueOf(h); v.Kind() == reflect.Func && !v.IsNil() {
+		if f := runtime.FuncForPC(v.Pointer()); f != nil {
+			return f.Name()
+		}
+	}
+	return fmt.Sprintf("%T", h)
+}
+
+// EventHandlers returns the registered event handlers by topic.
+func (r *Registry) EventHandlers() map[Topic][]EventHandler {
+	r.handlersMu.RLock()
+	defer r.handlersMu.RUnlock()
+
+	mapCopy := make(map[Topic][]EventHandler, len(r.handlers))
+	for topic, handlers := range r.handlers {
+		mapCopy[topic] = append([]EventHandler(nil), handlers...)
+	}
+	return mapCopy
+}
+
+// RegisterSaga registers a saga under a unique name, usually its saga type.
+func (r *Registry) RegisterSaga(name string, s Saga) error {
+	if name == "" {
+		return errors.New("[evol] RegisterSaga: missing saga name")
+	}
+
+	r.sagasMu.Lock()
+	defer r.sagasMu.Unlock()
+
+	if _, ok := r.sagas[name]; ok {
+		return fmt.Errorf("saga %s already register", name)
+	}
+	r.sagas[name] = s
+	return nil
+}
+
+// Saga returns the saga registered under name, nil if there is none.
+func (r *Registry) Saga(name string) Saga {
+	r.sagasMu.RLock()
+	defer r.sagasMu.RUnlock()
+
+	return r.sagas[name]
+}
+
+// SagaNames returns the names of the registered sagas, sorted.
+func (r *Registry) SagaNames() []string {
+	r.sagasMu.RLock()
+	defer r.sagasMu.RUnlock()
+
+	names := make([]string, 0, len(r.sagas))
+	for name := range r.sagas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RegisterPolicy registers a policy under a unique name.
+func (r *Registry) RegisterPolicy(name string, p Policy) error {
+	if name == "" {
+		return errors.New("[evol] RegisterPolicy: missing policy name")
+	}
+
+	r.policiesMu.Lock()
+	defer r.policiesMu.Unlock()
+
+	if _, ok := r.policies[name]; ok {
+		return fmt.Errorf("[evol] policy %s already registered", name)
+	}
+	r.policies[name] = p
+	return nil
+}
+
+// Policy returns the policy registered under name, nil if there is none.
+func (r *Registry) Policy(name string) Policy {
+	r.policiesMu.RLock()
+	defer r.policiesMu.RUnlock()
+
+	return r.policies[name]
+}
+
+// PolicyNames returns the names of the registered policies, sorted.
+func (r *Registry) PolicyNames() []string {
+	r.policiesMu.RLock()
+	defer r.policiesMu.RUnlock()
+
+	names := make([]string, 0, len(r.policies))
+	for name := range r.policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetCommandBus sets the bus SendCommand dispatches to.
+func (r *Registry) SetCommandBus(bus CommandBus) {
+	r.cmdsMu.Lock()
+	defer r.cmdsMu.Unlock()
+
+	*r.cmdBus = bus
+}
+
+// CommandBus returns the bus set with SetCommandBus.
+func (r *Registry) CommandBus() CommandBus {
+	r.cmdsMu.RLock()
+	defer r.cmdsMu.RUnlock()
+
+	return *r.cmdBus
+}
+
+// SendCommand dispatches cmd to the command bus, with a new correlation id unless ctx already has one.
+func (r *Registry) SendCommand(ctx context.Context, cmd Command) error {
+	bus := r.CommandBus()
+	if bus == nil {
+		return errors.New("[evol] SendCommand: no command bus, the application is not running")
+	}
+
+	ctx = ContextWithCorrelationID(ctx)
+	return bus.HandleCommand(ctx, cmd)
+}
@@ -0,0 +1,114 @@
+package evol
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+type PingCmd struct {
+	Id string
+}
+
+func (c *PingCmd) Name() CommandName                  { return "PingCmd" }
+func (c *PingCmd) TargetAggregateType() AggregateType { return "Ping" }
+func (c *PingCmd) TargetIdentity() string             { return c.Id }
+
+// badRoutes has a Handle method with an invalid signature
+type badRoutes struct {
+	*BaseAggregate
+	Router
+}
+
+func (b *badRoutes) HandlePingCmd(cmd *PingCmd) error { return nil }
+
+func TestRegistryCreatesAggregatesLazily(t *testing.T) {
+	r := NewRegistry()
+
+	created := 0
+	r.RegisterAggregate("Ping", func(id string) Aggregate {
+		created++
+		if id == "" {
+			panic("missing id")
+		}
+		return &pinger{BaseAggregate: NewBaseAggregate("Ping", id)}
+	})
+	err := RegisterRoutedAggregate(r, "Bad", func(id string) *badRoutes {
+		created++
+		return &badRoutes{BaseAggregate: NewBaseAggregate("Bad", id)}
+	})
+	if err == nil || !strings.Contains(err.Error(), "HandlePingCmd") {
+		t.Errorf("registered invalid routes: %v", err)
+	}
+	if created != 0 {
+		t.Fatal("RegisterAggregate called the factory")
+	}
+
+	a, err := r.CreateAggregate("Ping", "p1")
+	if err != nil || a.EntityIdentity() != "p1" {
+		t.Fatalf("CreateAggregate: %v %v", a, err)
+	}
+	if _, err := r.CreateAggregate("Ping", ""); err == nil || !strings.Contains(err.Error(), "missing id") {
+		t.Errorf("CreateAggregate of a panicking factory: %v", err)
+	}
+	if _, err := r.CreateAggregate("Bad", "b1"); err == nil {
+		t.Error("created an aggregate of invalid routes")
+	}
+	if _, err := r.CreateAggregate("Other", "o1"); err == nil {
+		t.Error("created an aggregate not registered")
+	}
+}
+
+func TestRegistryNewCommand(t *testing.T) {
+	r := NewRegistry()
+	registered := &PingCmd{Id: "registered"}
+	if err := r.RegisterCommand(registered); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RegisterCommand(&PingCmd{}); err == nil {
+		t.Error("registered a command twice")
+	}
+
+	cmd := r.NewCommand("PingCmd")
+	if cmd == Command(registered) || cmd.(*PingCmd).Id != "" {
+		t.Errorf("NewCommand returned %#v, want a new zero command", cmd)
+	}
+	if r.NewCommand("PongCmd") != nil {
+		t.Error("NewCommand of a command not registered")
+	}
+	if err := r.SendCommand(context.Background(), cmd); err == nil {
+		t.Error("sent a command without command bus")
+	}
+}
+
+func projectPing(ctx context.Context, e Event) error { return nil }
+
+type pingProjector struct{}
+
+func (pingProjector) HandleEvent(ctx context.Context, e Event) error { return nil }
+
+func TestRegistryNamesEventHandlers(t *testing.T) {
+	r := NewRegistry()
+	r.RegisterEventHandlers(EventHandlerFunc(projectPing), "Pinged")
+	r.RegisterEventHandlers(pingProjector{}, "Pinged")
+	if err := r.RegisterNamedEventHandler("audit", pingProjector{}, "Pinged", "Ponged"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.RegisterNamedEventHandler("audit", pingProjector{}, "Ponged"); err == nil {
+		t.Error("registered two handlers named audit on Ponged")
+	}
+	if err := r.RegisterNamedEventHandler("evol.pingProjector", pingProjector{}, "Pinged"); err == nil {
+		t.Error("registered a name taken by a handler registered without name")
+	}
+
+	var names []string
+	for _, h := range r.NamedEventHandlers()["Pinged"] {
+		names = append(names, h.Name)
+	}
+	if want := "evol.projectPing evol.pingProjector audit"; strings.Join(names, " ") != want {
+		t.Errorf("names %v, want %s", names, want)
+	}
+	if n := len(r.EventHandlers()["Ponged"]); n != 1 {
+		t.Errorf("%d handlers on Ponged", n)
+	}
+}
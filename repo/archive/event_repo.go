@@ -0,0 +1,217 @@
+// Package archive moves cold aggregate streams out of the event repo of an application.
+package archive
+
+import (
+	"context"
+	"errors"
+	"evol"
+	"fmt"
+	"time"
+)
+
+// ErrArchived is returned when saving events to an archived stream, archived streams are read only.
+var ErrArchived = errors.New("[evol] aggregate stream archived")
+
+// EventRepo is an evol.EventRepo saving to a hot repo, loading the streams it no longer has from a cold repo.
+// Archive moves a stream from the hot repo to the cold one, archive streams that will not change,
+// such as deleted or idle ones, events are not saved to archived streams.
+// The outbox of the repo is the one of the hot repo, archived events are not published again.
+type EventRepo struct {
+	hot     evol.EventRepo
+	deleter evol.StreamDeleter
+	cold    evol.EventRepo
+	logger  evol.Logger
+}
+
+// Option is an option setter used to configure an EventRepo.
+type Option func(*EventRepo)
+
+// WithLogger sets the logger of the repo, evol.GetLogger() by default.
+func WithLogger(l evol.Logger) Option {
+	return func(r *EventRepo) {
+		r.logger = l
+	}
+}
+
+// NewEventRepo creates an EventRepo over hot, which must implement evol.StreamDeleter, and cold.
+func NewEventRepo(hot, cold evol.EventRepo, opts ...Option) (*EventRepo, error) {
+	if hot == nil || cold == nil {
+		return nil, errors.New("[evol] archive NewEventRepo: missing repo")
+	}
+	deleter, ok := evol.As[evol.StreamDeleter](hot)
+	if !ok {
+		return nil, fmt.Errorf("[evol] archive NewEventRepo: hot repo %T can not delete streams", hot)
+	}
+
+	r := &EventRepo{hot: hot, deleter: deleter, cold: cold}
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		opt(r)
+	}
+	return r, nil
+}
+
+func (r *EventRepo) Save(ctx context.Context, events []evol.Event) error {
+	if len(events) == 0 {
+		return errors.New("save events are empty")
+	}
+	id := events[0].AggregateIdentity()
+
+	// a new stream would hide an archived one, look for it in the cold repo
+	if v := events[0].Version(); v <= 1 {
+		if archived, err := r.archived(ctx, id); err != nil {
+			return err
+		} else if archived {
+			return fmt.Errorf("[evol] %s %s: %w", events[0].AggregateType(), id, ErrArchived)
+		}
+	}
+
+	err := r.hot.Save(ctx, events)
+	if errors.Is(err, evol.ErrVersionConflict) {
+		// the versions of an archived stream follow the events of the cold repo
+		if archived, aerr := r.archived(ctx, id); aerr != nil {
+			return aerr
+		} else if archived {
+			return fmt.Errorf("[evol] %s %s: %w", events[0].AggregateType(), id, ErrArchived)
+		}
+	}
+	return err
+}
+
+func (r *EventRepo) Load(ctx context.Context, id string) ([]evol.Event, error) {
+	events, err := r.hot.Load(ctx, id)
+	if errors.Is(err, evol.ErrAggregateNotFound) {
+		return r.cold.Load(ctx, id)
+	}
+	return events, err
+}
+
+// Archive moves the stream of the aggregate id of the tenant in ctx to the cold repo.
+// Archiving a stream the hot repo does not have is not an error.
+func (r *EventRepo) Archive(ctx context.Context, id string) error {
+	events, err := r.hot.Load(ctx, id)
+	if errors.Is(err, evol.ErrAggregateNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if err := r.cold.Save(ctx, events); err != nil {
+		// an interrupted archive already saved the stream
+		if !errors.Is(err, evol.ErrVersionConflict) {
+			return fmt.Errorf("could not archive stream %s: %w", id, err)
+		}
+		archived, lerr := r.cold.Load(ctx, id)
+		if lerr != nil || len(archived) != len(events) {
+			return fmt.Errorf("could not archive stream %s: %w", id, err)
+		}
+	}
+
+	if err := r.deleter.DeleteStream(ctx, id); err != nil {
+		return fmt.Errorf("could not delete archived stream %s: %w", id, err)
+	}
+	evol.LoggerOr(r.logger).Info("archived stream", evol.LogKeyTenant, evol.TenantID(ctx), evol.LogKeyAggregateType, events[0].AggregateType(), evol.LogKeyAggregateID, id, "events", len(events))
+	return nil
+}
+
+// ArchiveBefore archives the streams of all tenants whose last event is older than t,
+// and returns how many it archived. The hot repo must implement evol.StreamLister.
+func (r *EventRepo) ArchiveBefore(ctx context.Context, t time.Time) (int, error) {
+	return r.archiveStreams(ctx, func(ctx context.Context, s evol.StreamInfo) (bool, error) {
+		return s.Updated.Before(t), nil
+	})
+}
+
+// ArchiveDeleted archives the streams of all tenants ending with a tombstone,
+// and returns how many it archived. The hot repo must implement evol.StreamLister.
+func (r *EventRepo) ArchiveDeleted(ctx context.Context) (int, error) {
+	return r.archiveStreams(ctx, func(ctx context.Context, s evol.StreamInfo) (bool, error) {
+		events, err := r.hot.Load(ctx, s.AggregateIdentity)
+		if errors.Is(err, evol.ErrAggregateNotFound) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		return evol.DeletedError(events) != nil, nil
+	})
+}
+
+// archiveStreams archives the streams of the hot repo selected by cold
+func (r *EventRepo) archiveStreams(ctx context.Context, cold func(context.Context, evol.StreamInfo) (bool, error)) (int, error) {
+	lister, ok := evol.As[evol.StreamLister](r.hot)
+	if !ok {
+		return 0, fmt.Errorf("[evol] archive: hot repo %T can not list streams", r.hot)
+	}
+	streams, err := lister.Streams(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, s := range streams {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+
+		tenantCtx := evol.ContextWithTenant(ctx, s.Tenant)
+		if ok, err := cold(tenantCtx, s); err != nil {
+			return n, err
+		} else if !ok {
+			continue
+		}
+
+		if err := r.Archive(tenantCtx, s.AggregateIdentity); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// DeleteStream implements evol.StreamDeleter, erasing the stream from both repos.
+func (r *EventRepo) DeleteStream(ctx context.Context, id string) error {
+	if err := r.deleter.DeleteStream(ctx, id); err != nil {
+		return err
+	}
+	if deleter, ok := evol.As[evol.StreamDeleter](r.cold); ok {
+		return deleter.DeleteStream(ctx, id)
+	}
+	return nil
+}
+
+// Fetch implements evol.Outbox with the outbox of the hot repo.
+func (r *EventRepo) Fetch(ctx context.Context, after uint64, limit int) ([]evol.OutboxRecord, error) {
+	outbox, ok := evol.As[evol.Outbox](r.hot)
+	if !ok {
+		return nil, fmt.Errorf("[evol] archive Fetch: hot repo %T is not an outbox", r.hot)
+	}
+	return outbox.Fetch(ctx, after, limit)
+}
+
+// Streams implements evol.StreamLister with the streams of both repos, those that can list them.
+func (r *EventRepo) Streams(ctx context.Context) ([]evol.StreamInfo, error) {
+	var res []evol.StreamInfo
+	for _, repo := range []evol.EventRepo{r.hot, r.cold} {
+		lister, ok := evol.As[evol.StreamLister](repo)
+		if !ok {
+			continue
+		}
+		streams, err := lister.Streams(ctx)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, streams...)
+	}
+	return res, nil
+}
+
+// archived reports whether the cold repo has the stream of the aggregate id
+func (r *EventRepo) archived(ctx context.Context, id string) (bool, error) {
+	_, err := r.cold.Load(ctx, id)
+	if errors.Is(err, evol.ErrAggregateNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,277 @@
+// Package file stores events in a file, for applications and tools that need events to outlive
+// the process without running a database.
+package file
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"evol"
+	"evol/codec"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// EventRepo is an evol.EventRepo appending the encoded events, one per line, to a file in save order.
+// The events are indexed in memory when the repo is opened, every call first reads the lines other
+// processes appended since. Saves lock the file where the system can, so concurrent writers to the
+// same aggregate fail with evol.ErrVersionConflict instead of interleaving events.
+type EventRepo struct {
+	mu sync.Mutex
+	f  *os.File
+	// offset is the size of the file read so far
+	offset int64
+
+	// all events in save order, read by outbox relays
+	log     []record
+	streams map[key][]int
+
+	codec evol.EventCodec
+}
+
+// record is a stored event, its line and what indexes it
+type record struct {
+	tenant    string
+	aType     evol.AggregateType
+	id        string
+	timestamp time.Time
+	data      []byte
+}
+
+// key identifies a stream, identities are unique within a tenant
+type key struct {
+	tenant string
+	id     string
+}
+
+// Option is an option setter used to configure an EventRepo.
+type Option func(*EventRepo)
+
+// WithCodec uses the specified codec for encoding events, codec.JsonEventCodec by default.
+// The codec must not write new lines.
+func WithCodec(c evol.EventCodec) Option {
+	return func(r *EventRepo) {
+		r.codec = c
+	}
+}
+
+// NewEventRepo opens the EventRepo of the file at path, created when missing, with optional settings.
+func NewEventRepo(path string, options ...Option) (*EventRepo, error) {
+	r := &EventRepo{
+		streams: make(map[key][]int),
+		codec:   &codec.JsonEventCodec{},
+	}
+
+	for _, option := range options {
+		if option == nil {
+			continue
+		}
+		option(r)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	r.f = f
+
+	if err := r.read(context.Background()); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// read indexes the lines appended since the last read, a line still being written is left for later
+func (r *EventRepo) read(ctx context.Context) error {
+	info, err := r.f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() <= r.offset {
+		return nil
+	}
+
+	data, err := io.ReadAll(io.NewSectionReader(r.f, r.offset, info.Size()-r.offset))
+	if err != nil {
+		return err
+	}
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			return nil
+		}
+		line := data[:i]
+		data = data[i+1:]
+		r.offset += int64(i + 1)
+		if len(line) == 0 {
+			continue
+		}
+
+		e, err := r.codec.UnmarshalEvent(ctx, line)
+		if err != nil {
+			return fmt.Errorf("could not unmarshal event %d of %s: %w", len(r.log)+1, r.f.Name(), err)
+		}
+		rec := record{
+			tenant:    evol.EventTenantID(e),
+			aType:     e.AggregateType(),
+			id:        e.AggregateIdentity(),
+			timestamp: e.Timestamp(),
+			data:      line,
+		}
+		k := key{tenant: rec.tenant, id: rec.id}
+		r.streams[k] = append(r.streams[k], len(r.log))
+		r.log = append(r.log, rec)
+	}
+}
+
+func (r *EventRepo) Save(ctx context.Context, events []evol.Event) error {
+	if len(events) == 0 {
+		return errors.New("save events are empty")
+	}
+
+	// the tenant of a stream is read back from the metadata of its events
+	tenant := evol.StoreTenantID(ctx, events)
+	if tenant != "" {
+		for _, e := range events {
+			if evol.EventTenantID(e) == "" {
+				evol.WithMetadata(evol.Metadata{evol.TenantIDKey: tenant})(e)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, e := range events {
+		data, err := r.codec.MarshalEvent(ctx, e)
+		if err != nil {
+			return fmt.Errorf("could not marshal event: %w", err)
+		}
+		if bytes.IndexByte(data, '\n') >= 0 {
+			return fmt.Errorf("[evol] file EventRepo: encoded %s event spans lines", e.Topic())
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := lockFile(r.f); err != nil {
+		return err
+	}
+	defer unlockFile(r.f)
+
+	if err := r.read(ctx); err != nil {
+		return err
+	}
+	k := key{tenant: tenant, id: events[0].AggregateIdentity()}
+	if v := events[0].Version(); v > 0 && v != len(r.streams[k])+1 {
+		return evol.ErrVersionConflict
+	}
+
+	if _, err := r.f.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if err := r.f.Sync(); err != nil {
+		return err
+	}
+	return r.read(ctx)
+}
+
+func (r *EventRepo) Load(ctx context.Context, id string) ([]evol.Event, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.read(ctx); err != nil {
+		return nil, err
+	}
+	positions, ok := r.streams[key{tenant: evol.TenantID(ctx), id: id}]
+	if !ok {
+		return nil, evol.ErrAggregateNotFound
+	}
+
+	events := make([]evol.Event, len(positions))
+	for i, p := range positions {
+		var err error
+		if events[i], err = r.decode(ctx, p); err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
+
+// decode returns the event at index i of the log
+func (r *EventRepo) decode(ctx context.Context, i int) (evol.Event, error) {
+	e, err := r.codec.UnmarshalEvent(ctx, r.log[i].data)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal event %d of %s: %w", i+1, r.f.Name(), err)
+	}
+	return e, nil
+}
+
+// Fetch implements evol.Outbox, the position of an event is its line in the file starting at 1.
+func (r *EventRepo) Fetch(ctx context.Context, after uint64, limit int) ([]evol.OutboxRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.read(ctx); err != nil {
+		return nil, err
+	}
+
+	var res []evol.OutboxRecord
+	for i := after; i < uint64(len(r.log)); i++ {
+		if limit > 0 && len(res) == limit {
+			break
+		}
+		e, err := r.decode(ctx, int(i))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, evol.OutboxRecord{Position: i + 1, Event: e})
+	}
+	return res, nil
+}
+
+// Streams implements evol.StreamLister.
+func (r *EventRepo) Streams(ctx context.Context) ([]evol.StreamInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.read(ctx); err != nil {
+		return nil, err
+	}
+
+	res := make([]evol.StreamInfo, 0, len(r.streams))
+	for k, positions := range r.streams {
+		last := r.log[positions[len(positions)-1]]
+		res = append(res, evol.StreamInfo{
+			Tenant:            k.tenant,
+			AggregateType:     last.aType,
+			AggregateIdentity: k.id,
+			Version:           len(positions),
+			Updated:           last.timestamp,
+		})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Tenant != res[j].Tenant {
+			return res[i].Tenant < res[j].Tenant
+		}
+		if res[i].AggregateType != res[j].AggregateType {
+			return res[i].AggregateType < res[j].AggregateType
+		}
+		return res[i].AggregateIdentity < res[j].AggregateIdentity
+	})
+	return res, nil
+}
+
+// Close closes the file of the repo.
+func (r *EventRepo) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.f.Close()
+}
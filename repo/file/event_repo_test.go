@@ -0,0 +1,74 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"evol"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func tested(id string, v int) evol.Event {
+	return evol.NewEvent("Tested", map[string]interface{}{"id": id}, time.Now(), evol.ForAggregate("Test", id), evol.WithVersion(v))
+}
+
+func TestEventRepo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+	ctx := context.Background()
+	acme := evol.ContextWithTenant(ctx, "acme")
+
+	r, err := NewEventRepo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err := r.Save(ctx, []evol.Event{tested("a", 1), tested("a", 2)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Save(acme, []evol.Event{tested("a", 1)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Save(ctx, []evol.Event{tested("a", 2)}); !errors.Is(err, evol.ErrVersionConflict) {
+		t.Errorf("saved a stale version: %v", err)
+	}
+
+	// another process appending to the file
+	other, err := NewEventRepo(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if err := other.Save(ctx, []evol.Event{tested("b", 1)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Save(ctx, []evol.Event{tested("b", 1)}); !errors.Is(err, evol.ErrVersionConflict) {
+		t.Errorf("saved over the events of another process: %v", err)
+	}
+
+	if events, err := r.Load(ctx, "a"); err != nil || len(events) != 2 || events[1].Version() != 2 {
+		t.Errorf("loaded %v: %v", events, err)
+	}
+	if events, err := r.Load(acme, "a"); err != nil || len(events) != 1 {
+		t.Errorf("loaded %v for acme: %v", events, err)
+	}
+	if _, err := r.Load(acme, "b"); !errors.Is(err, evol.ErrAggregateNotFound) {
+		t.Errorf("loaded the stream of another tenant: %v", err)
+	}
+
+	records, err := r.Fetch(ctx, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Position != 2 || evol.EventTenantID(records[1].Event) != "acme" {
+		t.Errorf("fetched %v", records)
+	}
+
+	streams, err := r.Streams(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streams) != 3 || streams[0].AggregateIdentity != "a" || streams[0].Version != 2 || streams[2].Tenant != "acme" {
+		t.Errorf("streams %+v", streams)
+	}
+}
@@ -0,0 +1,495 @@
+package jetstream
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"evol"
+	"evol/codec"
+	"fmt"
+	"github.com/nats-io/nats.go"
+	"strconv"
+	"time"
+)
+
+const (
+	// versionHeader holds the aggregate version of a stored event
+	versionHeader = "Evol-Version"
+	// batchHeader holds the version of the first event saved with the event, batchSizeHeader their number
+	batchHeader     = "Evol-Batch"
+	batchSizeHeader = "Evol-Batch-Size"
+)
+
+// purgeAPI is the JetStream API subject purging a stream, followed by its name
+const purgeAPI = "$JS.API.STREAM.PURGE."
+
+// errCodeWrongLastSequence is the JetStream API error code of a failed expected last subject sequence
+const errCodeWrongLastSequence = 10071
+
+// EventRepo is an evol.EventRepo storing the events of each aggregate on its own subject of a JetStream stream,
+// the subjects of a tenant being prefixed with it.
+// Saves use the expected last subject sequence, so a concurrent write to the same aggregate fails with
+// evol.ErrVersionConflict instead of interleaving events.
+//
+// JetStream stores the events of a Save one message at a time, so a failing Save may leave part of its events.
+// Load skips such an incomplete batch and the next Save stores the same versions after it, the stream stays
+// consistent for the aggregate. Fetch and Streams read the stored messages: an outbox relay may publish part
+// of a failed Save.
+type EventRepo struct {
+	streamName string
+	conn       *nats.Conn
+	js         nats.JetStreamContext
+	msgs       lastMsgGetter
+	connOpts   []nats.Option
+	codec      evol.EventCodec
+	timeout    time.Duration
+}
+
+// NewEventRepo creates an EventRepo and its stream named after appID, with optional settings.
+func NewEventRepo(url, appID string, options ...Option) (*EventRepo, error) {
+	r := &EventRepo{
+		streamName: appID + "_store",
+		codec:      &codec.JsonEventCodec{},
+		timeout:    5 * time.Second,
+	}
+
+	// Apply configuration options.
+	for _, option := range options {
+		if option == nil {
+			continue
+		}
+
+		if err := option(r); err != nil {
+			return nil, fmt.Errorf("error while applying option: %w", err)
+		}
+	}
+
+	// Create the NATS connection.
+	var err error
+	if r.conn, err = nats.Connect(url, r.connOpts...); err != nil {
+		return nil, fmt.Errorf("could not create NATS connection: %w", err)
+	}
+
+	// Create Jetstream context.
+	if r.js, err = r.conn.JetStream(); err != nil {
+		return nil, fmt.Errorf("could not create Jetstream context: %w", err)
+	}
+
+	var ok bool
+	if r.msgs, ok = r.js.(lastMsgGetter); !ok {
+		return nil, errors.New("Jetstream context can not get the last message of a subject")
+	}
+
+	if _, err = r.js.StreamInfo(r.streamName); err == nil {
+		return r, nil
+	}
+
+	// Create the stream, every aggregate stream is a subject of it.
+	cfg := &nats.StreamConfig{
+		Name:     r.streamName,
+		Subjects: []string{r.streamName + ".>"},
+		Storage:  nats.FileStorage,
+	}
+
+	if _, err = r.js.AddStream(cfg); err != nil {
+		return nil, fmt.Errorf("could not create NATS stream: %w", err)
+	}
+
+	return r, nil
+}
+
+// lastMsgGetter is implemented by the JetStream context, but not part of its interface yet
+type lastMsgGetter interface {
+	GetLastMsg(name, subject string, opts ...nats.JSOpt) (*nats.RawStreamMsg, error)
+}
+
+// Option is an option setter used to configure creation.
+type Option func(*EventRepo) error
+
+// WithCodec uses the specified codec for encoding events.
+func WithCodec(codec evol.EventCodec) Option {
+	return func(r *EventRepo) error {
+		r.codec = codec
+
+		return nil
+	}
+}
+
+// WithNATSOptions adds the NATS options to the underlying client.
+func WithNATSOptions(opts ...nats.Option) Option {
+	return func(r *EventRepo) error {
+		r.connOpts = opts
+
+		return nil
+	}
+}
+
+// WithLoadTimeout limits how long Load waits for the events of an aggregate, 5s by default.
+func WithLoadTimeout(d time.Duration) Option {
+	return func(r *EventRepo) error {
+		r.timeout = d
+
+		return nil
+	}
+}
+
+func (r *EventRepo) Save(ctx context.Context, events []evol.Event) error {
+	if len(events) == 0 {
+		return errors.New("save events are empty")
+	}
+
+	id := events[0].AggregateIdentity()
+	if id == "" {
+		return errors.New("missing aggregate identity")
+	}
+	subject := r.subject(evol.StoreTenantID(ctx, events), id)
+
+	lastSeq, lastVersion, err := r.last(subject)
+	if err != nil {
+		return err
+	}
+
+	if v := events[0].Version(); v > 0 && v != lastVersion+1 {
+		return evol.ErrVersionConflict
+	}
+
+	for _, e := range events {
+		if e.AggregateIdentity() != id {
+			return fmt.Errorf("[evol] save events of different aggregates: %s and %s", id, e.AggregateIdentity())
+		}
+	}
+
+	for i, e := range events {
+		data, err := r.codec.MarshalEvent(ctx, e)
+		if err == nil {
+			msg := nats.NewMsg(subject)
+			msg.Data = data
+			// set directly, the publish option skips an expected sequence of 0 meaning an empty subject
+			msg.Header.Set(nats.ExpectedLastSubjSeqHdr, strconv.FormatUint(lastSeq, 10))
+			msg.Header.Set(versionHeader, strconv.Itoa(lastVersion+i+1))
+			msg.Header.Set(batchHeader, strconv.Itoa(lastVersion+1))
+			msg.Header.Set(batchSizeHeader, strconv.Itoa(len(events)))
+			lastSeq, err = r.publish(ctx, msg)
+		} else {
+			err = fmt.Errorf("could not marshal event: %w", err)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// publish stores msg, a wrong expected last subject sequence fails with evol.ErrVersionConflict
+func (r *EventRepo) publish(ctx context.Context, msg *nats.Msg) (uint64, error) {
+	// the client only reports the description of API errors, not their code
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	resp, err := r.conn.RequestMsgWithContext(ctx, msg)
+	if err != nil {
+		return 0, fmt.Errorf("could not store event: %w", err)
+	}
+
+	var ack struct {
+		Sequence uint64    `json:"seq"`
+		Error    *apiError `json:"error"`
+	}
+	if err := json.Unmarshal(resp.Data, &ack); err != nil {
+		return 0, fmt.Errorf("could not store event: %w", err)
+	}
+	if ack.Error != nil {
+		if ack.Error.ErrorCode == errCodeWrongLastSequence {
+			return 0, evol.ErrVersionConflict
+		}
+		return 0, fmt.Errorf("could not store event: %w", ack.Error)
+	}
+	return ack.Sequence, nil
+}
+
+// apiError is the error of a JetStream API response
+type apiError struct {
+	Code        int    `json:"code"`
+	ErrorCode   int    `json:"err_code"`
+	Description string `json:"description"`
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Description, e.ErrorCode)
+}
+
+func (r *EventRepo) Load(ctx context.Context, id string) ([]evol.Event, error) {
+	subject := r.subject(evol.TenantID(ctx), id)
+
+	lastSeq, _, err := r.last(subject)
+	if err != nil {
+		return nil, err
+	}
+	if lastSeq == 0 {
+		return nil, evol.ErrAggregateNotFound
+	}
+
+	sub, err := r.js.SubscribeSync(subject, nats.OrderedConsumer(), nats.DeliverAll())
+	if err != nil {
+		return nil, fmt.Errorf("could not subscribe to aggregate stream: %w", err)
+	}
+	defer sub.Unsubscribe()
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var events []evol.Event
+	var batch batch
+	for {
+		msg, err := sub.NextMsgWithContext(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("could not read aggregate stream: %w", err)
+		}
+
+		meta, err := msg.Metadata()
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := r.codec.UnmarshalEvent(ctx, msg.Data)
+		if err != nil {
+			return nil, fmt.Errorf("could not unmarshal event: %w", err)
+		}
+		if err := batch.add(msg.Header, e); err != nil {
+			return nil, fmt.Errorf("stored event %d: %w", meta.Sequence.Stream, err)
+		}
+		if batch.complete() {
+			events = append(events, batch.events...)
+			batch.events = nil
+		}
+
+		// events stored after the lookup belong to the next load, an incomplete last batch is skipped
+		if meta.Sequence.Stream >= lastSeq {
+			if len(events) == 0 {
+				return nil, evol.ErrAggregateNotFound
+			}
+			return events, nil
+		}
+	}
+}
+
+// batch gathers the events of a Save while loading them
+type batch struct {
+	events []evol.Event
+	first  int
+	size   int
+	// last is the version of the last complete batch
+	last int
+}
+
+// add adds the next stored event, the ones stored without batch headers being a batch of their own.
+// A batch starting again at the first version of an incomplete one replaces it.
+func (b *batch) add(h nats.Header, e evol.Event) error {
+	version, err := strconv.Atoi(h.Get(versionHeader))
+	if err != nil {
+		return fmt.Errorf("[evol] invalid version: %w", err)
+	}
+
+	first, size, ok := batchOf(h)
+	if !ok {
+		first, size = version, 1
+	}
+
+	switch {
+	case version == first && first == b.last+1:
+		b.events, b.first, b.size = []evol.Event{e}, first, size
+	case len(b.events) > 0 && first == b.first && version == first+len(b.events):
+		b.events = append(b.events, e)
+	default:
+		return fmt.Errorf("[evol] version %d of batch %d does not follow version %d", version, first, b.last)
+	}
+
+	if b.complete() {
+		b.last = version
+	}
+	return nil
+}
+
+func (b *batch) complete() bool {
+	return len(b.events) > 0 && len(b.events) == b.size
+}
+
+// batchOf returns the first version and the size of the batch of a stored event
+func batchOf(h nats.Header) (int, int, bool) {
+	first, err := strconv.Atoi(h.Get(batchHeader))
+	if err != nil {
+		return 0, 0, false
+	}
+	size, err := strconv.Atoi(h.Get(batchSizeHeader))
+	if err != nil || size < 1 {
+		return 0, 0, false
+	}
+	return first, size, true
+}
+
+// DeleteStream implements evol.StreamDeleter by purging the subject of the aggregate.
+func (r *EventRepo) DeleteStream(ctx context.Context, id string) error {
+	// the client has no subject filter for purges yet, use the API directly
+	req, err := json.Marshal(struct {
+		Filter string `json:"filter"`
+	}{r.subject(evol.TenantID(ctx), id)})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	msg, err := r.conn.RequestWithContext(ctx, purgeAPI+r.streamName, req)
+	if err != nil {
+		return fmt.Errorf("could not purge aggregate stream: %w", err)
+	}
+
+	var resp struct {
+		Error *apiError `json:"error"`
+	}
+	if err := json.Unmarshal(msg.Data, &resp); err != nil {
+		return fmt.Errorf("could not purge aggregate stream: %w", err)
+	}
+	if resp.Error != nil {
+		return fmt.Errorf("could not purge aggregate stream: %w", resp.Error)
+	}
+	return nil
+}
+
+func (r *EventRepo) Close() error {
+	r.conn.Close()
+
+	return nil
+}
+
+// last returns the stream sequence of the last event on the subject and the aggregate version of the last complete
+// batch, zeros when empty.
+func (r *EventRepo) last(subject string) (uint64, int, error) {
+	msg, err := r.msgs.GetLastMsg(r.streamName, subject)
+	if errors.Is(err, nats.ErrMsgNotFound) {
+		return 0, 0, nil
+	} else if err != nil {
+		return 0, 0, fmt.Errorf("could not read last event: %w", err)
+	}
+
+	version, err := strconv.Atoi(msg.Header.Get(versionHeader))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid version of stored event %d: %w", msg.Sequence, err)
+	}
+	// the next save replaces an incomplete batch
+	if first, size, ok := batchOf(msg.Header); ok && version != first+size-1 {
+		version = first - 1
+	}
+
+	return msg.Sequence, version, nil
+}
+
+// subject encodes the tenant and the aggregate identity, any character is allowed in them but not in a subject token.
+// The default tenant has no token, so the streams stored before tenants keep their subject.
+func (r *EventRepo) subject(tenant, id string) string {
+	subject := r.streamName + "."
+	if tenant != "" {
+		subject += base64.RawURLEncoding.EncodeToString([]byte(tenant)) + "."
+	}
+	return subject + base64.RawURLEncoding.EncodeToString([]byte(id))
+}
+
+// Fetch implements evol.Outbox over the whole stream, the position of an event is its stream sequence.
+func (r *EventRepo) Fetch(ctx context.Context, after uint64, limit int) ([]evol.OutboxRecord, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	var records []evol.OutboxRecord
+	err := r.scan(ctx, after, func(seq uint64, e evol.Event) bool {
+		records = append(records, evol.OutboxRecord{Position: seq, Event: e})
+		return len(records) < limit
+	})
+	return records, err
+}
+
+// scan reads the events stored after the stream sequence after with an ordered consumer,
+// until fn returns false or the last event stored when scan started
+func (r *EventRepo) scan(ctx context.Context, after uint64, fn func(seq uint64, e evol.Event) bool) error {
+	info, err := r.js.StreamInfo(r.streamName)
+	if err != nil {
+		return fmt.Errorf("could not read stream info: %w", err)
+	}
+	lastSeq := info.State.LastSeq
+	if lastSeq <= after || info.State.Msgs == 0 {
+		return nil
+	}
+
+	sub, err := r.js.SubscribeSync(r.streamName+".>", nats.OrderedConsumer(), nats.StartSequence(after+1))
+	if err != nil {
+		return fmt.Errorf("could not subscribe to stream: %w", err)
+	}
+	defer sub.Unsubscribe()
+
+	// the events after may all have been deleted, the consumer has nothing to deliver then
+	ci, err := sub.ConsumerInfo()
+	if err != nil {
+		return fmt.Errorf("could not read consumer info: %w", err)
+	}
+	if ci.NumPending == 0 && ci.Delivered.Consumer == 0 {
+		return nil
+	}
+
+	for {
+		msgCtx, cancel := context.WithTimeout(ctx, r.timeout)
+		msg, err := sub.NextMsgWithContext(msgCtx)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("could not read stream: %w", err)
+		}
+
+		meta, err := msg.Metadata()
+		if err != nil {
+			return err
+		}
+		seq := meta.Sequence.Stream
+
+		e, err := r.codec.UnmarshalEvent(ctx, msg.Data)
+		if err != nil {
+			return fmt.Errorf("could not unmarshal event %d: %w", seq, err)
+		}
+
+		// events stored after the lookup belong to the next scan
+		if !fn(seq, e) || seq >= lastSeq || meta.NumPending == 0 {
+			return nil
+		}
+	}
+}
+
+// Streams implements evol.StreamLister by reading the whole stream, the streams come in the order of their first event.
+func (r *EventRepo) Streams(ctx context.Context) ([]evol.StreamInfo, error) {
+	type key struct{ tenant, id string }
+	streams := map[key]*evol.StreamInfo{}
+	var order []key
+
+	err := r.scan(ctx, 0, func(_ uint64, e evol.Event) bool {
+		k := key{evol.EventTenantID(e), e.AggregateIdentity()}
+		info, ok := streams[k]
+		if !ok {
+			info = &evol.StreamInfo{Tenant: k.tenant, AggregateType: e.AggregateType(), AggregateIdentity: k.id}
+			streams[k] = info
+			order = append(order, k)
+		}
+		info.Version++
+		if t := e.Timestamp(); t.After(info.Updated) {
+			info.Updated = t
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]evol.StreamInfo, len(order))
+	for i, k := range order {
+		res[i] = *streams[k]
+	}
+	return res, nil
+}
@@ -0,0 +1,341 @@
+package jetstream
+
+import (
+	"context"
+	"errors"
+	"evol"
+	"evol/codec"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+const testAggregate evol.AggregateType = "Test"
+
+// startServer starts an embedded JetStream server and returns its URL
+func startServer(t *testing.T) string {
+	t.Helper()
+
+	ns, err := server.NewServer(&server.Options{Port: -1, JetStream: true, StoreDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ns.Start()
+	t.Cleanup(ns.Shutdown)
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+	return ns.ClientURL()
+}
+
+// newTestRepo starts an embedded JetStream server and returns a repo connected to it
+func newTestRepo(t *testing.T, options ...Option) *EventRepo {
+	t.Helper()
+
+	r, err := NewEventRepo(startServer(t), "test", append([]Option{WithLoadTimeout(2 * time.Second)}, options...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func testEvents(id string, from, n int, options ...evol.EventOption) []evol.Event {
+	var events []evol.Event
+	for v := from; v < from+n; v++ {
+		opts := append([]evol.EventOption{evol.ForAggregate(testAggregate, id), evol.WithVersion(v)}, options...)
+		events = append(events, evol.NewEvent("Tested", map[string]interface{}{"n": v}, time.Now(), opts...))
+	}
+	return events
+}
+
+func versions(events []evol.Event) []int {
+	var vs []int
+	for _, e := range events {
+		vs = append(vs, e.Version())
+	}
+	return vs
+}
+
+func assertVersions(t *testing.T, events []evol.Event, want ...int) {
+	t.Helper()
+	got := versions(events)
+	if len(got) != len(want) {
+		t.Fatalf("got versions %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("got versions %v, want %v", got, want)
+		}
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	r := newTestRepo(t)
+	ctx := context.Background()
+
+	if _, err := r.Load(ctx, "a"); !errors.Is(err, evol.ErrAggregateNotFound) {
+		t.Fatalf("load of a missing stream: %v", err)
+	}
+
+	if err := r.Save(ctx, testEvents("a", 1, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Save(ctx, testEvents("b", 1, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Save(ctx, testEvents("a", 3, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := r.Load(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertVersions(t, events, 1, 2, 3)
+	if events[0].AggregateIdentity() != "a" || events[0].Topic() != "Tested" {
+		t.Fatalf("unexpected event %s %s", events[0].AggregateIdentity(), events[0].Topic())
+	}
+
+	if err := r.Save(ctx, append(testEvents("a", 4, 1), testEvents("b", 2, 1)...)); err == nil {
+		t.Fatal("saved events of different aggregates")
+	}
+}
+
+func TestSaveConflict(t *testing.T) {
+	r := newTestRepo(t)
+	ctx := context.Background()
+
+	if err := r.Save(ctx, testEvents("a", 1, 2)); err != nil {
+		t.Fatal(err)
+	}
+
+	// a version already stored
+	if err := r.Save(ctx, testEvents("a", 2, 1)); !errors.Is(err, evol.ErrVersionConflict) {
+		t.Fatalf("save of a stored version: %v", err)
+	}
+
+	// a concurrent save between the lookup of the last event and the publish, caught by the server
+	msg := nats.NewMsg(r.subject("", "a"))
+	msg.Data = []byte("{}")
+	msg.Header.Set(nats.ExpectedLastSubjSeqHdr, "1")
+	msg.Header.Set(versionHeader, "3")
+	if _, err := r.publish(ctx, msg); !errors.Is(err, evol.ErrVersionConflict) {
+		t.Fatalf("publish with a wrong last sequence: %v", err)
+	}
+
+	events, err := r.Load(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertVersions(t, events, 1, 2)
+}
+
+func TestTenants(t *testing.T) {
+	r := newTestRepo(t)
+	ctx := context.Background()
+	acme := evol.ContextWithTenant(ctx, "acme")
+
+	if err := r.Save(ctx, testEvents("a", 1, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Save(acme, testEvents("a", 1, 2)); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := r.Load(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertVersions(t, events, 1)
+
+	events, err = r.Load(acme, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertVersions(t, events, 1, 2)
+
+	// the tenant of the events wins over the one of the context
+	if err := r.Save(ctx, testEvents("a", 3, 1, evol.WithMetadata(evol.Metadata{evol.TenantIDKey: "acme"}))); err != nil {
+		t.Fatal(err)
+	}
+	if events, err = r.Load(acme, "a"); err != nil {
+		t.Fatal(err)
+	}
+	assertVersions(t, events, 1, 2, 3)
+
+	if _, err := r.Load(evol.ContextWithTenant(ctx, "other"), "a"); !errors.Is(err, evol.ErrAggregateNotFound) {
+		t.Fatalf("load of another tenant: %v", err)
+	}
+}
+
+func TestDeleteStream(t *testing.T) {
+	r := newTestRepo(t)
+	ctx := context.Background()
+	acme := evol.ContextWithTenant(ctx, "acme")
+
+	if err := r.Save(ctx, testEvents("a", 1, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Save(acme, testEvents("a", 1, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.DeleteStream(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Load(ctx, "a"); !errors.Is(err, evol.ErrAggregateNotFound) {
+		t.Fatalf("load of a deleted stream: %v", err)
+	}
+	if _, err := r.Load(acme, "a"); err != nil {
+		t.Fatalf("load of the stream of another tenant: %v", err)
+	}
+
+	// the stream starts over
+	if err := r.Save(ctx, testEvents("a", 1, 1)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	r := newTestRepo(t)
+	ctx := context.Background()
+
+	if records, err := r.Fetch(ctx, 0, 10); err != nil || len(records) != 0 {
+		t.Fatalf("fetch of an empty store: %v %v", records, err)
+	}
+
+	if err := r.Save(ctx, testEvents("a", 1, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Save(ctx, testEvents("b", 1, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Save(ctx, testEvents("c", 1, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := r.Fetch(ctx, 0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[0].Position != 1 || records[2].Position != 3 {
+		t.Fatalf("unexpected records %v", records)
+	}
+
+	records, err = r.Fetch(ctx, 3, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Position != 4 || records[1].Event.AggregateIdentity() != "c" {
+		t.Fatalf("unexpected records %v", records)
+	}
+
+	if records, err = r.Fetch(ctx, 5, 10); err != nil || len(records) != 0 {
+		t.Fatalf("fetch after the last event: %v %v", records, err)
+	}
+
+	// purged events are skipped
+	if err := r.DeleteStream(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if records, err = r.Fetch(ctx, 2, 10); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Position != 5 {
+		t.Fatalf("unexpected records %v", records)
+	}
+	if err := r.DeleteStream(ctx, "c"); err != nil {
+		t.Fatal(err)
+	}
+	if records, err = r.Fetch(ctx, 2, 10); err != nil || len(records) != 0 {
+		t.Fatalf("fetch of purged events: %v %v", records, err)
+	}
+
+	streams, err := r.Streams(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streams) != 1 || streams[0].AggregateIdentity != "a" || streams[0].Version != 2 {
+		t.Fatalf("unexpected streams %v", streams)
+	}
+}
+
+// failingCodec fails to marshal the event of version fail
+type failingCodec struct {
+	codec.JsonEventCodec
+	fail int
+}
+
+func (c *failingCodec) MarshalEvent(ctx context.Context, e evol.Event) ([]byte, error) {
+	if e.Version() == c.fail {
+		return nil, errors.New("marshal failed")
+	}
+	return c.JsonEventCodec.MarshalEvent(ctx, e)
+}
+
+func TestIncompleteBatch(t *testing.T) {
+	c := &failingCodec{fail: 4}
+	r := newTestRepo(t, WithCodec(c))
+	ctx := context.Background()
+
+	// a batch failing on its first event stores nothing
+	if err := r.Save(ctx, testEvents("a", 4, 1)); err == nil {
+		t.Fatal("saved an event failing to marshal")
+	}
+	if _, err := r.Load(ctx, "a"); !errors.Is(err, evol.ErrAggregateNotFound) {
+		t.Fatalf("load of a stream without events: %v", err)
+	}
+
+	if err := r.Save(ctx, testEvents("a", 1, 2)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the event 3 is stored, the event 4 is not
+	if err := r.Save(ctx, testEvents("a", 3, 3)); err == nil {
+		t.Fatal("saved an event failing to marshal")
+	}
+	events, err := r.Load(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertVersions(t, events, 1, 2)
+
+	// the next save replaces the incomplete batch
+	c.fail = 0
+	if err := r.Save(ctx, testEvents("a", 3, 2)); err != nil {
+		t.Fatal(err)
+	}
+	if events, err = r.Load(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	assertVersions(t, events, 1, 2, 3, 4)
+	if err := r.Save(ctx, testEvents("a", 4, 1)); !errors.Is(err, evol.ErrVersionConflict) {
+		t.Fatalf("save of a stored version: %v", err)
+	}
+
+	// the outbox reads every stored event
+	records, err := r.Fetch(ctx, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 5 {
+		t.Fatalf("got %d records, want 5", len(records))
+	}
+
+	// an event not following the stored ones
+	msg := nats.NewMsg(r.subject("", "a"))
+	msg.Data, _ = c.MarshalEvent(ctx, testEvents("a", 7, 1)[0])
+	msg.Header.Set(versionHeader, "7")
+	msg.Header.Set(batchHeader, "7")
+	msg.Header.Set(batchSizeHeader, strconv.Itoa(1))
+	if _, err := r.publish(ctx, msg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Load(ctx, "a"); err == nil {
+		t.Fatal("loaded a stream with a missing version")
+	}
+}
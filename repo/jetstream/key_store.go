@@ -0,0 +1,115 @@
+package jetstream
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"evol"
+	"evol/pii"
+	"fmt"
+	"github.com/nats-io/nats.go"
+)
+
+// KeyStore is a pii.KeyStore in a JetStream key value bucket named after appID.
+// Forgetting a subject purges its key, with no history left in the bucket.
+// The subjects of the default tenant keep the bucket keys they had before tenants.
+type KeyStore struct {
+	conn *nats.Conn
+	kv   nats.KeyValue
+}
+
+// NewKeyStore creates a KeyStore and its bucket.
+func NewKeyStore(url, appID string, opts ...nats.Option) (*KeyStore, error) {
+	conn, err := nats.Connect(url, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("could not create NATS connection: %w", err)
+	}
+
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("could not create Jetstream context: %w", err)
+	}
+
+	bucket := appID + "_pii_keys"
+	kv, err := js.KeyValue(bucket)
+	if errors.Is(err, nats.ErrBucketNotFound) {
+		kv, err = js.CreateKeyValue(&nats.KeyValueConfig{Bucket: bucket, Storage: nats.FileStorage})
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("could not open key bucket: %w", err)
+	}
+
+	return &KeyStore{conn: conn, kv: kv}, nil
+}
+
+func (s *KeyStore) SubjectKey(ctx context.Context, subject string) (string, []byte, error) {
+	entry, err := s.kv.Get(subjectKey(ctx, subject))
+	if err == nil {
+		id := string(entry.Value())
+		key, err := s.Key(ctx, id)
+		return id, key, err
+	} else if !errors.Is(err, nats.ErrKeyNotFound) {
+		return "", nil, err
+	}
+
+	id, key, err := pii.NewKey()
+	if err != nil {
+		return "", nil, err
+	}
+	if _, err := s.kv.Put("key."+id, key); err != nil {
+		return "", nil, fmt.Errorf("could not store key: %w", err)
+	}
+	if _, err := s.kv.Create(subjectKey(ctx, subject), []byte(id)); err != nil {
+		// created concurrently, use the other key
+		_ = s.kv.Purge("key." + id)
+		entry, getErr := s.kv.Get(subjectKey(ctx, subject))
+		if getErr != nil {
+			return "", nil, fmt.Errorf("could not store subject key: %w", err)
+		}
+		id = string(entry.Value())
+		key, err := s.Key(ctx, id)
+		return id, key, err
+	}
+	return id, key, nil
+}
+
+func (s *KeyStore) Key(ctx context.Context, id string) ([]byte, error) {
+	entry, err := s.kv.Get("key." + id)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return nil, pii.ErrKeyNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return entry.Value(), nil
+}
+
+func (s *KeyStore) Forget(ctx context.Context, subject string) error {
+	entry, err := s.kv.Get(subjectKey(ctx, subject))
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if err := s.kv.Purge("key." + string(entry.Value())); err != nil {
+		return fmt.Errorf("could not purge key: %w", err)
+	}
+	return s.kv.Purge(subjectKey(ctx, subject))
+}
+
+func (s *KeyStore) Close() error {
+	s.conn.Close()
+
+	return nil
+}
+
+// subjectKey encodes the subject of the tenant in ctx, any character is allowed in them but not in a bucket key
+func subjectKey(ctx context.Context, subject string) string {
+	enc := base64.RawURLEncoding.EncodeToString
+	if tenant := evol.TenantID(ctx); tenant != "" {
+		return "subject." + enc([]byte(tenant)) + "." + enc([]byte(subject))
+	}
+	return "subject." + enc([]byte(subject))
+}
@@ -0,0 +1,44 @@
+package jetstream
+
+import (
+	"context"
+	"errors"
+	"evol"
+	"evol/pii"
+	"testing"
+)
+
+func TestKeyStoreSubjectsOfEachTenant(t *testing.T) {
+	s, err := NewKeyStore(startServer(t), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	ctx := context.Background()
+	acme := evol.ContextWithTenant(ctx, "acme")
+
+	id, _, err := s.SubjectKey(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acmeId, _, err := s.SubjectKey(acme, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _, err := s.SubjectKey(acme, "u1"); err != nil || again != acmeId {
+		t.Fatalf("second key of acme u1 %s %v", again, err)
+	}
+	if acmeId == id {
+		t.Fatal("tenants share the key of u1")
+	}
+
+	if err := s.Forget(acme, "u1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Key(ctx, acmeId); !errors.Is(err, pii.ErrKeyNotFound) {
+		t.Errorf("key of forgotten acme u1: %v", err)
+	}
+	if _, err := s.Key(ctx, id); err != nil {
+		t.Errorf("key of u1 forgotten with acme u1: %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package memory
+
+import (
+	"context"
+	"evol"
+	"sync"
+)
+
+// CheckpointStore keeps consumer positions in memory.
+type CheckpointStore struct {
+	positions   map[string]uint64
+	positionsMu sync.RWMutex
+}
+
+func NewCheckpointStore() *CheckpointStore {
+	return &CheckpointStore{
+		positions: make(map[string]uint64),
+	}
+}
+
+func (s *CheckpointStore) LoadCheckpoint(ctx context.Context, name string) (uint64, error) {
+	s.positionsMu.RLock()
+	defer s.positionsMu.RUnlock()
+
+	return s.positions[name], nil
+}
+
+func (s *CheckpointStore) SaveCheckpoint(ctx context.Context, name string, position uint64) error {
+	s.positionsMu.Lock()
+	defer s.positionsMu.Unlock()
+
+	s.positions[name] = position
+	return nil
+}
+
+// fetch pages through an append only log, positions start at 1.
+// The events of deleted streams are nil, their positions are skipped.
+func fetch(log []evol.Event, after uint64, limit int) []evol.OutboxRecord {
+	var res []evol.OutboxRecord
+	for i := after; i < uint64(len(log)); i++ {
+		if limit > 0 && len(res) == limit {
+			break
+		}
+		if log[i] == nil {
+			continue
+		}
+		res = append(res, evol.OutboxRecord{Position: i + 1, Event: log[i]})
+	}
+	return res
+}
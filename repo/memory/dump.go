@@ -0,0 +1,106 @@
+package memory
+
+import (
+	"bufio"
+	"context"
+	"evol"
+	"evol/codec"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Streams implements evol.StreamLister.
+func (r *AggregateEventRepo) Streams(ctx context.Context) ([]evol.StreamInfo, error) {
+	r.dbMu.RLock()
+	defer r.dbMu.RUnlock()
+
+	res := make([]evol.StreamInfo, 0, len(r.db))
+	for _, ar := range r.db {
+		res = append(res, evol.StreamInfo{
+			Tenant:            ar.tenant,
+			AggregateType:     ar.aType,
+			AggregateIdentity: ar.identity,
+			Version:           len(ar.events),
+			Updated:           ar.events[len(ar.events)-1].Timestamp(),
+		})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Tenant != res[j].Tenant {
+			return res[i].Tenant < res[j].Tenant
+		}
+		if res[i].AggregateType != res[j].AggregateType {
+			return res[i].AggregateType < res[j].AggregateType
+		}
+		return res[i].AggregateIdentity < res[j].AggregateIdentity
+	})
+	return res, nil
+}
+
+// Dump writes all events in save order, one encoded event per line.
+// A nil codec encodes events with the codec of the repo, or codec.JsonEventCodec without.
+func (r *AggregateEventRepo) Dump(ctx context.Context, w io.Writer, c evol.EventCodec) error {
+	// events stored encoded are written as they are, unless another codec is given
+	reencode := c != nil
+	if c == nil {
+		c = &codec.JsonEventCodec{}
+	}
+
+	r.dbMu.RLock()
+	defer r.dbMu.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	for _, e := range r.log {
+		if e == nil {
+			// deleted stream
+			continue
+		}
+		if ee, ok := e.(*encodedEvent); ok && !reencode {
+			if _, err := bw.Write(append(ee.data, '\n')); err != nil {
+				return err
+			}
+			continue
+		}
+		e, err := r.decode(ctx, e)
+		if err != nil {
+			return err
+		}
+		data, err := c.MarshalEvent(ctx, e)
+		if err != nil {
+			return fmt.Errorf("could not marshal event: %w", err)
+		}
+		if _, err := bw.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// RestoreAggregateEventRepo creates an AggregateEventRepo with the events of a Dump, configured with options.
+// A nil codec decodes events with codec.JsonEventCodec.
+func RestoreAggregateEventRepo(ctx context.Context, rd io.Reader, c evol.EventCodec, options ...Option) (*AggregateEventRepo, error) {
+	if c == nil {
+		c = &codec.JsonEventCodec{}
+	}
+
+	r := NewAggregateEventRepo(options...)
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		e, err := c.UnmarshalEvent(ctx, scanner.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("could not unmarshal event on line %d: %w", line, err)
+		}
+		if err := r.Save(ctx, []evol.Event{e}); err != nil {
+			return nil, fmt.Errorf("could not restore event on line %d: %w", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
@@ -4,24 +4,101 @@ import (
 	"context"
 	"errors"
 	"evol"
+	"fmt"
 	"sync"
 )
 
+// AggregateEventRepo keeps the streams of each tenant apart
 type AggregateEventRepo struct {
-	db   map[string]AggregateRecord
+	db   map[key]AggregateRecord
 	dbMu sync.RWMutex
+
+	// all events in save order, read by outbox relays
+	log []evol.Event
+
+	// codec stores the events encoded when set
+	codec evol.EventCodec
+}
+
+func NewAggregateEventRepo(options ...Option) *AggregateEventRepo {
+	r := &AggregateEventRepo{
+		db: make(map[key]AggregateRecord),
+	}
+
+	for _, option := range options {
+		if option == nil {
+			continue
+		}
+		option(r)
+	}
+
+	return r
 }
 
-func NewAggregateEventRepo() *AggregateEventRepo {
-	return &AggregateEventRepo{
-		db: make(map[string]AggregateRecord),
+// Option is an option setter used to configure an AggregateEventRepo.
+type Option func(*AggregateEventRepo)
+
+// WithCodec stores the events encoded with c and decodes them when they are read, so a codec like
+// pii.EventCodec keeps personal data encrypted in memory. Events are kept as they are saved by default.
+func WithCodec(c evol.EventCodec) Option {
+	return func(r *AggregateEventRepo) {
+		r.codec = c
+	}
+}
+
+// encodedEvent is an event stored encoded, its envelope without data and its encoding
+type encodedEvent struct {
+	evol.Event
+	data []byte
+}
+
+// encode returns the events to store
+func (r *AggregateEventRepo) encode(ctx context.Context, events []evol.Event) ([]evol.Event, error) {
+	if r.codec == nil {
+		return events, nil
+	}
+
+	res := make([]evol.Event, len(events))
+	for i, e := range events {
+		data, err := r.codec.MarshalEvent(ctx, e)
+		if err != nil {
+			return nil, fmt.Errorf("could not marshal event: %w", err)
+		}
+		envelope := evol.NewEvent(e.Topic(), nil, e.Timestamp(),
+			evol.ForAggregate(e.AggregateType(), e.AggregateIdentity()),
+			evol.WithVersion(e.Version()),
+		)
+		res[i] = &encodedEvent{Event: envelope, data: data}
+	}
+	return res, nil
+}
+
+// decode returns a stored event as it was saved
+func (r *AggregateEventRepo) decode(ctx context.Context, e evol.Event) (evol.Event, error) {
+	ee, ok := e.(*encodedEvent)
+	if !ok {
+		return e, nil
+	}
+	decoded, err := r.codec.UnmarshalEvent(ctx, ee.data)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal %s %s v%d: %w", ee.AggregateType(), ee.AggregateIdentity(), ee.Version(), err)
 	}
+	return decoded, nil
+}
+
+// key identifies a stream or an entity, identities are unique within a tenant
+type key struct {
+	tenant string
+	id     string
 }
 
 type AggregateRecord struct {
+	tenant   string
 	identity string
 	aType    evol.AggregateType
 	events   []evol.Event
+	// indexes of the events in the log
+	positions []int
 }
 
 func (r *AggregateEventRepo) Save(ctx context.Context, events []evol.Event) error {
@@ -34,33 +111,84 @@ func (r *AggregateEventRepo) Save(ctx context.Context, events []evol.Event) erro
 
 	id := events[0].AggregateIdentity()
 	at := events[0].AggregateType()
+	k := key{tenant: evol.StoreTenantID(ctx, events), id: id}
 
-	ar, ok := r.db[id]
+	ar, ok := r.db[k]
+	if v := events[0].Version(); v > 0 && v != len(ar.events)+1 {
+		return evol.ErrVersionConflict
+	}
+	events, err := r.encode(ctx, events)
+	if err != nil {
+		return err
+	}
 	if !ok {
 		ar = AggregateRecord{
+			tenant:   k.tenant,
 			identity: id,
 			aType:    at,
-			events:   events,
 		}
-		r.db[id] = ar
-	} else {
-		ar.events = append(ar.events, events...)
-		r.db[id] = ar
 	}
+	for _, e := range events {
+		ar.events = append(ar.events, e)
+		ar.positions = append(ar.positions, len(r.log))
+		r.log = append(r.log, e)
+	}
+	r.db[k] = ar
 
 	return nil
 }
 
+// Fetch implements evol.Outbox, the position of an event is its index in save order starting at 1.
+func (r *AggregateEventRepo) Fetch(ctx context.Context, after uint64, limit int) ([]evol.OutboxRecord, error) {
+	r.dbMu.RLock()
+	defer r.dbMu.RUnlock()
+
+	records := fetch(r.log, after, limit)
+	for i := range records {
+		e, err := r.decode(ctx, records[i].Event)
+		if err != nil {
+			return nil, err
+		}
+		records[i].Event = e
+	}
+	return records, nil
+}
+
 func (r *AggregateEventRepo) Load(ctx context.Context, id string) ([]evol.Event, error) {
-	ar, ok := r.db[id]
+	r.dbMu.RLock()
+	defer r.dbMu.RUnlock()
+
+	ar, ok := r.db[key{tenant: evol.TenantID(ctx), id: id}]
 	if !ok {
 		return nil, evol.ErrAggregateNotFound
 	}
 
 	events := make([]evol.Event, len(ar.events))
 	for i, e := range ar.events {
-		events[i] = e
+		var err error
+		if events[i], err = r.decode(ctx, e); err != nil {
+			return nil, err
+		}
 	}
 
 	return events, nil
 }
+
+// DeleteStream implements evol.StreamDeleter, the events of the stream are also erased from the outbox log.
+func (r *AggregateEventRepo) DeleteStream(ctx context.Context, id string) error {
+	r.dbMu.Lock()
+	defer r.dbMu.Unlock()
+
+	k := key{tenant: evol.TenantID(ctx), id: id}
+	ar, ok := r.db[k]
+	if !ok {
+		return nil
+	}
+	delete(r.db, k)
+
+	// keep the positions of the other events
+	for _, p := range ar.positions {
+		r.log[p] = nil
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package memory
+
+import (
+	"bytes"
+	"context"
+	"evol"
+	"evol/pii"
+	"strings"
+	"testing"
+	"time"
+)
+
+type signedUp struct {
+	UserId string
+	Email  string `pii:"UserId"`
+}
+
+func TestEventRepoWithCodec(t *testing.T) {
+	keys := pii.NewMemoryKeyStore()
+	c := pii.NewEventCodec(nil, keys)
+	r := NewAggregateEventRepo(WithCodec(c))
+	ctx := context.Background()
+
+	e := evol.NewEvent("SignedUp", &signedUp{UserId: "u1", Email: "u1@example.com"}, time.Now(), evol.ForAggregate("User", "u1"), evol.WithVersion(1))
+	if err := r.Save(ctx, []evol.Event{e}); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := r.Load(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email := events[0].Data().(map[string]interface{})["Email"]; email != "u1@example.com" {
+		t.Fatalf("loaded email %v", email)
+	}
+
+	// the dump keeps the events as stored, encrypted
+	var dump bytes.Buffer
+	if err := r.Dump(ctx, &dump, nil); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(dump.String(), "u1@example.com") {
+		t.Fatalf("dump in plaintext: %s", dump.String())
+	}
+
+	if err := keys.Forget(ctx, "u1"); err != nil {
+		t.Fatal(err)
+	}
+	records, err := r.Fetch(ctx, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email := records[0].Event.Data().(map[string]interface{})["Email"]; email != pii.Redacted {
+		t.Fatalf("email of a forgotten user %v", email)
+	}
+}
+
+// taggedEvent is an event implementation that can not be a map key
+type taggedEvent struct {
+	evol.Event
+	tags []string
+}
+
+func TestDeleteStream(t *testing.T) {
+	r := NewAggregateEventRepo()
+	ctx := context.Background()
+
+	save := func(id string, v int) {
+		t.Helper()
+		e := evol.NewEvent("Tested", nil, time.Now(), evol.ForAggregate("Test", id), evol.WithVersion(v))
+		if err := r.Save(ctx, []evol.Event{taggedEvent{Event: e, tags: []string{id}}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	save("a", 1)
+	save("b", 1)
+	save("a", 2)
+
+	if err := r.DeleteStream(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	records, err := r.Fetch(ctx, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Position != 2 || records[0].Event.AggregateIdentity() != "b" {
+		t.Fatalf("unexpected records %v", records)
+	}
+
+	// the stream starts over, after the other events
+	save("a", 1)
+	if records, err = r.Fetch(ctx, 2, 10); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Position != 4 {
+		t.Fatalf("unexpected records %v", records)
+	}
+}
@@ -7,16 +7,26 @@ import (
 	"sync"
 )
 
+// ModelRepo keeps the entities of each tenant apart
 type ModelRepo struct {
-	db   map[string]evol.Entity
+	db   map[key]evol.Entity
 	dbMu sync.RWMutex
+
+	// events saved with entities in save order, read by outbox relays
+	log []evol.Event
+}
+
+func NewModelRepo() *ModelRepo {
+	return &ModelRepo{
+		db: make(map[key]evol.Entity),
+	}
 }
 
 func (m *ModelRepo) Find(ctx context.Context, id string) (evol.Entity, error) {
 	m.dbMu.RLock()
 	defer m.dbMu.RUnlock()
 
-	e, ok := m.db[id]
+	e, ok := m.db[key{tenant: evol.TenantID(ctx), id: id}]
 	if !ok {
 		return nil, evol.ErrAggregateNotFound
 	}
@@ -27,9 +37,12 @@ func (m *ModelRepo) FindAll(ctx context.Context) ([]evol.Entity, error) {
 	m.dbMu.RLock()
 	defer m.dbMu.RUnlock()
 
+	tenant := evol.TenantID(ctx)
 	res := make([]evol.Entity, 0)
-	for _, entity := range m.db {
-		res = append(res, entity)
+	for k, entity := range m.db {
+		if k.tenant == tenant {
+			res = append(res, entity)
+		}
 	}
 	return res, nil
 
@@ -39,23 +52,52 @@ func (m *ModelRepo) Save(ctx context.Context, entity evol.Entity) error {
 	m.dbMu.Lock()
 	defer m.dbMu.Unlock()
 
+	return m.save(ctx, entity)
+}
+
+// SaveWithEvents implements evol.OutboxRepository, the entity and its events are stored under one lock.
+func (m *ModelRepo) SaveWithEvents(ctx context.Context, entity evol.Entity, events []evol.Event) error {
+	m.dbMu.Lock()
+	defer m.dbMu.Unlock()
+
+	if err := m.save(ctx, entity); err != nil {
+		return err
+	}
+	m.log = append(m.log, events...)
+
+	return nil
+}
+
+// Fetch implements evol.Outbox, the position of an event is its index in save order starting at 1.
+func (m *ModelRepo) Fetch(ctx context.Context, after uint64, limit int) ([]evol.OutboxRecord, error) {
+	m.dbMu.RLock()
+	defer m.dbMu.RUnlock()
+
+	return fetch(m.log, after, limit), nil
+}
+
+func (m *ModelRepo) save(ctx context.Context, entity evol.Entity) error {
 	id := entity.EntityIdentity()
 	if id == "" {
 		return errors.New("missing entity identity")
 	}
-	m.db[id] = entity
+	if m.db == nil {
+		m.db = make(map[key]evol.Entity)
+	}
+	m.db[key{tenant: evol.TenantID(ctx), id: id}] = entity
 
 	return nil
-
 }
 
 func (m *ModelRepo) Remove(ctx context.Context, id string) error {
 	m.dbMu.Lock()
 	defer m.dbMu.Unlock()
 
-	if _, ok := m.db[id]; ok {
-		delete(m.db, id)
+	k := key{tenant: evol.TenantID(ctx), id: id}
+	if _, ok := m.db[k]; !ok {
+		return errors.New("no such entity")
 	}
+	delete(m.db, k)
 
-	return errors.New("no such entity")
+	return nil
 }
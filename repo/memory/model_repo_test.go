@@ -0,0 +1,34 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"evol"
+	"testing"
+)
+
+func TestModelRepoRemove(t *testing.T) {
+	m := NewModelRepo()
+	ctx := context.Background()
+	acme := evol.ContextWithTenant(ctx, "acme")
+
+	for _, c := range []context.Context{ctx, acme} {
+		if err := m.Save(c, evol.NewBaseAggregate("Test", "a")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := m.Remove(ctx, "a"); err != nil {
+		t.Fatalf("remove of a stored entity: %v", err)
+	}
+	if _, err := m.Find(ctx, "a"); !errors.Is(err, evol.ErrAggregateNotFound) {
+		t.Fatalf("find of a removed entity: %v", err)
+	}
+	if err := m.Remove(ctx, "a"); err == nil {
+		t.Fatal("removed a missing entity")
+	}
+
+	if _, err := m.Find(acme, "a"); err != nil {
+		t.Fatalf("find of the entity of another tenant: %v", err)
+	}
+}
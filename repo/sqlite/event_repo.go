@@ -0,0 +1,212 @@
+// Package sqlite stores events in a SQLite database, opened by the application with the driver of its choice.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"evol"
+	"evol/codec"
+	"fmt"
+	"time"
+)
+
+// schema creates the events table, position being the order events were saved in
+// and seq the position of an event in the stream of its aggregate
+const schema = `CREATE TABLE IF NOT EXISTS evol_events (
+	position       INTEGER PRIMARY KEY AUTOINCREMENT,
+	tenant         TEXT    NOT NULL,
+	aggregate_type TEXT    NOT NULL,
+	aggregate_id   TEXT    NOT NULL,
+	seq            INTEGER NOT NULL,
+	timestamp      INTEGER NOT NULL,
+	data           BLOB    NOT NULL,
+	UNIQUE (tenant, aggregate_id, seq)
+)`
+
+// EventRepo is an evol.EventRepo storing each event in a row of the evol_events table, created when missing.
+// The events of a Save are inserted in one transaction, the unique stream sequence makes a concurrent write
+// to the same aggregate fail with evol.ErrVersionConflict.
+type EventRepo struct {
+	db    *sql.DB
+	codec evol.EventCodec
+}
+
+// Option is an option setter used to configure an EventRepo.
+type Option func(*EventRepo)
+
+// WithCodec uses the specified codec for encoding events, codec.JsonEventCodec by default.
+func WithCodec(c evol.EventCodec) Option {
+	return func(r *EventRepo) {
+		r.codec = c
+	}
+}
+
+// NewEventRepo creates an EventRepo over db and its table, with optional settings.
+// Open db with immediate transactions, such as _txlock=immediate with github.com/mattn/go-sqlite3,
+// so concurrent Saves wait for each other instead of failing with a busy database.
+// Closing db is left to the caller.
+func NewEventRepo(ctx context.Context, db *sql.DB, options ...Option) (*EventRepo, error) {
+	if db == nil {
+		return nil, errors.New("[evol] sqlite NewEventRepo: db nil")
+	}
+
+	r := &EventRepo{
+		db:    db,
+		codec: &codec.JsonEventCodec{},
+	}
+
+	for _, option := range options {
+		if option == nil {
+			continue
+		}
+		option(r)
+	}
+
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return nil, fmt.Errorf("could not create the events table: %w", err)
+	}
+	return r, nil
+}
+
+func (r *EventRepo) Save(ctx context.Context, events []evol.Event) (err error) {
+	if len(events) == 0 {
+		return errors.New("save events are empty")
+	}
+
+	id := events[0].AggregateIdentity()
+	tenant := evol.StoreTenantID(ctx, events)
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var last int
+	row := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(seq), 0) FROM evol_events WHERE tenant = ? AND aggregate_id = ?`, tenant, id)
+	if err := row.Scan(&last); err != nil {
+		return err
+	}
+	if v := events[0].Version(); v > 0 && v != last+1 {
+		return evol.ErrVersionConflict
+	}
+
+	for i, e := range events {
+		data, err := r.codec.MarshalEvent(ctx, e)
+		if err != nil {
+			return fmt.Errorf("could not marshal event: %w", err)
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO evol_events (tenant, aggregate_type, aggregate_id, seq, timestamp, data) VALUES (?, ?, ?, ?, ?, ?)`,
+			tenant, string(e.AggregateType()), id, last+i+1, e.Timestamp().UnixNano(), data,
+		)
+		if err != nil {
+			// the stream was written since its version was read
+			if r.conflict(ctx, tenant, id, last) {
+				return evol.ErrVersionConflict
+			}
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// conflict tells whether the stream has more than last events, outside of the failed transaction
+func (r *EventRepo) conflict(ctx context.Context, tenant, id string, last int) bool {
+	var n int
+	row := r.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(seq), 0) FROM evol_events WHERE tenant = ? AND aggregate_id = ?`, tenant, id)
+	return row.Scan(&n) == nil && n > last
+}
+
+func (r *EventRepo) Load(ctx context.Context, id string) ([]evol.Event, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT position, data FROM evol_events WHERE tenant = ? AND aggregate_id = ? ORDER BY seq`,
+		evol.TenantID(ctx), id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	records, err := r.scan(ctx, rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, evol.ErrAggregateNotFound
+	}
+
+	events := make([]evol.Event, len(records))
+	for i, rec := range records {
+		events[i] = rec.Event
+	}
+	return events, nil
+}
+
+// Fetch implements evol.Outbox, the position of an event is the position of its row.
+func (r *EventRepo) Fetch(ctx context.Context, after uint64, limit int) ([]evol.OutboxRecord, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT position, data FROM evol_events WHERE position > ? ORDER BY position LIMIT ?`,
+		int64(after), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return r.scan(ctx, rows)
+}
+
+// scan decodes the position and data rows, then closes them
+func (r *EventRepo) scan(ctx context.Context, rows *sql.Rows) ([]evol.OutboxRecord, error) {
+	defer rows.Close()
+
+	var res []evol.OutboxRecord
+	for rows.Next() {
+		var position int64
+		var data []byte
+		if err := rows.Scan(&position, &data); err != nil {
+			return nil, err
+		}
+		e, err := r.codec.UnmarshalEvent(ctx, data)
+		if err != nil {
+			return nil, fmt.Errorf("could not unmarshal event %d: %w", position, err)
+		}
+		res = append(res, evol.OutboxRecord{Position: uint64(position), Event: e})
+	}
+	return res, rows.Err()
+}
+
+// DeleteStream implements evol.StreamDeleter.
+func (r *EventRepo) DeleteStream(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM evol_events WHERE tenant = ? AND aggregate_id = ?`, evol.TenantID(ctx), id)
+	return err
+}
+
+// Streams implements evol.StreamLister.
+func (r *EventRepo) Streams(ctx context.Context) ([]evol.StreamInfo, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT tenant, aggregate_type, aggregate_id, COUNT(*), MAX(timestamp)
+		FROM evol_events GROUP BY tenant, aggregate_id ORDER BY tenant, aggregate_type, aggregate_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []evol.StreamInfo
+	for rows.Next() {
+		var info evol.StreamInfo
+		var aType string
+		var updated int64
+		if err := rows.Scan(&info.Tenant, &aType, &info.AggregateIdentity, &info.Version, &updated); err != nil {
+			return nil, err
+		}
+		info.AggregateType = evol.AggregateType(aType)
+		info.Updated = time.Unix(0, updated)
+		res = append(res, info)
+	}
+	return res, rows.Err()
+}
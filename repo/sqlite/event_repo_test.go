@@ -0,0 +1,115 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"evol"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func tested(id string, v int) evol.Event {
+	return evol.NewEvent("Tested", map[string]interface{}{"id": id}, time.Now(), evol.ForAggregate("Test", id), evol.WithVersion(v))
+}
+
+func newRepo(t *testing.T) *EventRepo {
+	t.Helper()
+	db, err := sql.Open("sqlite3", "file:"+filepath.Join(t.TempDir(), "events.db")+"?_txlock=immediate&_busy_timeout=5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	r, err := NewEventRepo(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestEventRepo(t *testing.T) {
+	r := newRepo(t)
+	ctx := context.Background()
+	acme := evol.ContextWithTenant(ctx, "acme")
+
+	if err := r.Save(ctx, []evol.Event{tested("a", 1), tested("a", 2)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Save(acme, []evol.Event{tested("a", 1)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Save(ctx, []evol.Event{tested("b", 1)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Save(ctx, []evol.Event{tested("a", 2)}); !errors.Is(err, evol.ErrVersionConflict) {
+		t.Errorf("saved a stale version: %v", err)
+	}
+
+	if events, err := r.Load(ctx, "a"); err != nil || len(events) != 2 || events[1].Version() != 2 {
+		t.Errorf("loaded %v: %v", events, err)
+	}
+	if events, err := r.Load(acme, "a"); err != nil || len(events) != 1 {
+		t.Errorf("loaded %v for acme: %v", events, err)
+	}
+	if _, err := r.Load(acme, "b"); !errors.Is(err, evol.ErrAggregateNotFound) {
+		t.Errorf("loaded the stream of another tenant: %v", err)
+	}
+
+	records, err := r.Fetch(ctx, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Position != 2 || records[1].Event.AggregateIdentity() != "a" {
+		t.Errorf("fetched %v", records)
+	}
+
+	streams, err := r.Streams(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streams) != 3 || streams[0].AggregateIdentity != "a" || streams[0].Version != 2 || streams[2].Tenant != "acme" {
+		t.Errorf("streams %+v", streams)
+	}
+
+	if err := r.DeleteStream(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Load(ctx, "a"); !errors.Is(err, evol.ErrAggregateNotFound) {
+		t.Errorf("loaded a deleted stream: %v", err)
+	}
+}
+
+func TestConcurrentSaves(t *testing.T) {
+	r := newRepo(t)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- r.Save(ctx, []evol.Event{tested("a", 1)})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	saved := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			saved++
+		case !errors.Is(err, evol.ErrVersionConflict):
+			t.Error(err)
+		}
+	}
+	if saved != 1 {
+		t.Errorf("saved version 1 %d times", saved)
+	}
+}
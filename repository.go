@@ -3,10 +3,14 @@ package evol
 import (
 	"context"
 	"errors"
+	"time"
 )
 
 var ErrAggregateNotFound = errors.New("[evol] could not find entity form repository")
 
+// ErrVersionConflict is returned by EventRepo.Save when the stream was written since the aggregate was loaded
+var ErrVersionConflict = errors.New("[evol] aggregate stream version conflict")
+
 //ReadRepository is a read entity repository for CQRS query
 type ReadRepository interface {
 	// Find returns an entity for an Identity
@@ -25,16 +29,36 @@ type WriteRepository interface {
 	Remove(context.Context, string) error
 }
 
+// RWRepository stores entities, the entities of each tenant apart, see TenantID.
 type RWRepository interface {
 	ReadRepository
 	WriteRepository
 }
 
 //EventRepo is an aggregate codec repository for Event Sourcing
+//The streams of each tenant are kept apart, see StoreTenantID.
 type EventRepo interface {
-	// Save appends all events in the codec stream to the store
+	// Save appends all events in the codec stream to the store,
+	// versioned events must follow the last stored version or ErrVersionConflict is returned
 	Save(ctx context.Context, events []Event) error
 
-	// Load loads all events for the aggregate id from the store
+	// Load loads all events for the aggregate id of the tenant in ctx from the store
 	Load(context.Context, string) ([]Event, error)
 }
+
+// StreamInfo describes the event stream of an aggregate.
+type StreamInfo struct {
+	// Tenant the stream belongs to, empty for the default tenant
+	Tenant            string
+	AggregateType     AggregateType
+	AggregateIdentity string
+	// Version is the number of events in the stream
+	Version int
+	// Updated is the time of the last event
+	Updated time.Time
+}
+
+// StreamLister is an EventRepo able to list the streams it stores, of all tenants, used by tooling.
+type StreamLister interface {
+	Streams(ctx context.Context) ([]StreamInfo, error)
+}
@@ -0,0 +1,95 @@
+package evol
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy decides how often and after which delay an event handler gets the event again after failing.
+type RetryPolicy struct {
+	// MaxAttempts is the number of deliveries including the first one, values below 1 mean a single attempt.
+	MaxAttempts int
+	// InitialBackoff is the delay before the second attempt.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay, zero means no cap.
+	MaxBackoff time.Duration
+	// Multiplier grows the delay after every attempt, values below 1 keep it constant.
+	Multiplier float64
+	// Jitter randomizes each delay by up to this fraction of it, in [0, 1].
+	Jitter float64
+	// Retryable classifies errors, nil retries every error that is not Permanent.
+	Retryable func(error) bool
+}
+
+// ExponentialBackoff retries up to maxAttempts times, doubling the delay from initial up to max with 20% jitter.
+func ExponentialBackoff(maxAttempts int, initial, max time.Duration) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    maxAttempts,
+		InitialBackoff: initial,
+		MaxBackoff:     max,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// Attempts returns the number of deliveries allowed by the policy.
+func (p RetryPolicy) Attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// ShouldRetry reports whether the handler gets another attempt after attempt failed with err.
+func (p RetryPolicy) ShouldRetry(attempt int, err error) bool {
+	if attempt >= p.Attempts() || IsPermanent(err) {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return true
+}
+
+// Backoff returns the delay between the failed attempt and the next one.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff)
+	if p.Multiplier > 1 && attempt > 1 {
+		d *= math.Pow(p.Multiplier, float64(attempt-1))
+	}
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks err as not retryable, the event goes to the dead letters right away.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent.
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
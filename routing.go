@@ -0,0 +1,259 @@
+package evol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mitchellh/mapstructure"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ErrUnhandledCommand is returned by a routed aggregate for a command it has no Handle method for.
+var ErrUnhandledCommand = errors.New("[evol] unhandled command")
+
+// routes of a routed aggregate type, discovered once by reflection at registration
+type routes struct {
+	commands map[reflect.Type]commandRoute
+	events   map[Topic]eventRoute
+}
+
+// commandRoute calls Handle<Cmd>(ctx context.Context, cmd *Cmd) error
+type commandRoute struct {
+	method reflect.Value
+}
+
+// eventRoute calls Apply<Event>([ctx context.Context,] data *Event) [error]
+type eventRoute struct {
+	method  reflect.Value
+	data    reflect.Type
+	withCtx bool
+	withErr bool
+}
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	commandType = reflect.TypeOf((*Command)(nil)).Elem()
+	topicType   = reflect.TypeOf((*interface{ Topic() Topic })(nil)).Elem()
+)
+
+// routesOf returns the routes of the methods of t named in methods,
+// or of all its Handle and Apply methods when there are none
+func routesOf(t reflect.Type, methods []string) (*routes, error) {
+	r := &routes{commands: map[reflect.Type]commandRoute{}, events: map[Topic]eventRoute{}}
+	if len(methods) == 0 {
+		for i := 0; i < t.NumMethod(); i++ {
+			m := t.Method(i)
+			if _, err := r.add(m); err != nil {
+				return nil, fmt.Errorf("[evol] %s.%s: %w", t, m.Name, err)
+			}
+		}
+		if len(r.commands) == 0 && len(r.events) == 0 {
+			return nil, fmt.Errorf("[evol] %s has no Handle or Apply method to route to", t)
+		}
+		return r, nil
+	}
+
+	for _, name := range methods {
+		m, ok := t.MethodByName(name)
+		if !ok {
+			return nil, fmt.Errorf("[evol] %s has no method %s", t, name)
+		}
+		if ok, err := r.add(m); err != nil {
+			return nil, fmt.Errorf("[evol] %s.%s: %w", t, m.Name, err)
+		} else if !ok {
+			return nil, fmt.Errorf("[evol] %s.%s is neither a Handle<Cmd> nor an Apply<Event> method", t, m.Name)
+		}
+	}
+	return r, nil
+}
+
+// add routes to m when it is a Handle or Apply method, it reports whether it is one
+func (r *routes) add(m reflect.Method) (bool, error) {
+	switch {
+	case strings.HasPrefix(m.Name, "Handle"):
+		return r.addCommand(m)
+	case strings.HasPrefix(m.Name, "Apply"):
+		return r.addEvent(m)
+	}
+	return false, nil
+}
+
+// addCommand routes the commands of m, methods named Handle<Cmd> taking a *Cmd
+func (r *routes) addCommand(m reflect.Method) (bool, error) {
+	// the receiver is the first input, the command the last one
+	ft := m.Type
+	if ft.NumIn() < 2 {
+		return false, nil
+	}
+	cmd := ft.In(ft.NumIn() - 1)
+	if cmd.Kind() != reflect.Ptr || !cmd.Implements(commandType) || m.Name != "Handle"+cmd.Elem().Name() {
+		return false, nil
+	}
+	if ft.NumIn() != 3 || ft.In(1) != contextType || ft.NumOut() != 1 || ft.Out(0) != errorType {
+		return true, fmt.Errorf("must be func(context.Context, %s) error", cmd)
+	}
+
+	r.commands[cmd] = commandRoute{method: m.Func}
+	return true, nil
+}
+
+// addEvent routes the events of m, methods named Apply<Event> taking a *Event,
+// the topic being the one of the Topic method of Event or its type name
+func (r *routes) addEvent(m reflect.Method) (bool, error) {
+	ft := m.Type
+	if ft.NumIn() < 2 {
+		return false, nil
+	}
+	data := ft.In(ft.NumIn() - 1)
+	if data.Kind() != reflect.Ptr || m.Name != "Apply"+data.Elem().Name() {
+		return false, nil
+	}
+
+	route := eventRoute{method: m.Func, data: data, withCtx: ft.NumIn() == 3}
+	if ft.NumIn() > 3 || route.withCtx && ft.In(1) != contextType {
+		return true, fmt.Errorf("must be func([context.Context, ]%s) [error]", data)
+	}
+	switch {
+	case ft.NumOut() == 1 && ft.Out(0) == errorType:
+		route.withErr = true
+	case ft.NumOut() != 0:
+		return true, fmt.Errorf("must return nothing or an error")
+	}
+
+	topic := Topic(data.Elem().Name())
+	if data.Implements(topicType) {
+		topic = reflect.New(data.Elem()).Interface().(interface{ Topic() Topic }).Topic()
+	}
+	if _, ok := r.events[topic]; ok {
+		return true, fmt.Errorf("topic %s already applied by another method", topic)
+	}
+
+	r.events[topic] = route
+	return true, nil
+}
+
+// Router implements HandleCommand and HandleSourcingEvent of an aggregate with its methods, by their names:
+//
+//	func (o *OrderAggregate) HandleCreateOrderCmd(ctx context.Context, cmd *CreateOrderCmd) error
+//	func (o *OrderAggregate) ApplyOrderCreatedEvent(e *OrderCreatedEvent)
+//
+// Apply methods may also take a context first and return an error. They receive the event data decoded
+// into their type with mapstructure, as hand written HandleSourcingEvent methods do, so mapstructure tags
+// apply and time fields are also parsed from RFC 3339 strings. The topic of an Apply method is the one
+// of the Topic method of its data type, or its type name. Commands without a Handle method
+// fail with ErrUnhandledCommand, events without an Apply method are ignored.
+//
+// Aggregates opt in by embedding a Router next to their BaseAggregate, and registering their factory
+// with RegisterRoutedAggregate.
+type Router struct {
+	aType  AggregateType
+	self   reflect.Value
+	routes *routes
+}
+
+func (r *Router) router() *Router {
+	return r
+}
+
+// RoutedAggregate is an aggregate embedding a Router.
+type RoutedAggregate interface {
+	Aggregate
+	router() *Router
+}
+
+// RegisterRoutedAggregate registers in reg the factory of an aggregate type routed by its Router, to the
+// methods named, or else to all its Handle and Apply methods. The methods are discovered once, registering
+// fails on invalid signatures, a method named that is not a route, or an aggregate without routes.
+func RegisterRoutedAggregate[A RoutedAggregate](reg *Registry, aggregateType AggregateType, factory func(string) A, methods ...string) error {
+	routes, err := routesOf(reflect.TypeOf((*A)(nil)).Elem(), methods)
+	if err != nil {
+		return err
+	}
+
+	return reg.registerAggregate(aggregateType, func(id string) Aggregate {
+		a := factory(id)
+		*a.router() = Router{aType: aggregateType, self: reflect.ValueOf(a), routes: routes}
+		return a
+	})
+}
+
+// HandleCommand calls the Handle method of cmd.
+func (r *Router) HandleCommand(ctx context.Context, cmd Command) error {
+	if r.routes == nil {
+		return errors.New("[evol] aggregate not routed, it must be created by a factory registered with RegisterRoutedAggregate")
+	}
+
+	route, ok := r.routes.commands[reflect.TypeOf(cmd)]
+	if !ok {
+		return fmt.Errorf("[evol] %s %s: %w", r.aType, cmd.Name(), ErrUnhandledCommand)
+	}
+
+	out := route.method.Call([]reflect.Value{r.self, reflect.ValueOf(ctx), reflect.ValueOf(cmd)})
+	if err, _ := out[0].Interface().(error); err != nil {
+		return err
+	}
+	return nil
+}
+
+// HandleSourcingEvent calls the Apply method of the topic of e.
+func (r *Router) HandleSourcingEvent(ctx context.Context, e Event) error {
+	if r.routes == nil {
+		return errors.New("[evol] aggregate not routed, it must be created by a factory registered with RegisterRoutedAggregate")
+	}
+
+	route, ok := r.routes.events[e.Topic()]
+	if !ok {
+		return nil
+	}
+
+	data, err := decodeData(e.Data(), route.data)
+	if err != nil {
+		return fmt.Errorf("[evol] %s could not decode %s: %w", r.aType, e.Topic(), err)
+	}
+
+	in := []reflect.Value{r.self, data}
+	if route.withCtx {
+		in = []reflect.Value{r.self, reflect.ValueOf(ctx), data}
+	}
+	out := route.method.Call(in)
+	if route.withErr {
+		if err, _ := out[0].Interface().(error); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeData returns the event data as a value of the pointer type t, decoding it with mapstructure
+// when it is not of that type, such as the map[string]interface{} of unmarshaled events
+func decodeData(data interface{}, t reflect.Type) (reflect.Value, error) {
+	if data == nil {
+		return reflect.New(t.Elem()), nil
+	}
+
+	v := reflect.ValueOf(data)
+	switch v.Type() {
+	case t:
+		return v, nil
+	case t.Elem():
+		p := reflect.New(t.Elem())
+		p.Elem().Set(v)
+		return p, nil
+	}
+
+	p := reflect.New(t.Elem())
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.StringToTimeHookFunc(time.RFC3339Nano),
+		Result:     p.Interface(),
+	})
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	if err := dec.Decode(data); err != nil {
+		return reflect.Value{}, err
+	}
+	return p, nil
+}
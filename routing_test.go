@@ -0,0 +1,124 @@
+package evol
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+type PingedEvent struct {
+	By string    `mapstructure:"pinged_by"`
+	At time.Time `mapstructure:"at"`
+}
+
+type PingSentEvent struct{}
+
+// pinger applies the pings it receives, and handles PingCmd
+type pinger struct {
+	*BaseAggregate
+	Router
+	last *PingedEvent
+	sent int
+}
+
+func (p *pinger) ApplyPingedEvent(e *PingedEvent) {
+	p.last = e
+}
+
+func (p *pinger) HandlePingCmd(ctx context.Context, cmd *PingCmd) error {
+	p.PublishEvent("PingSentEvent", &PingSentEvent{}, time.Now(), p)
+	return nil
+}
+
+// ApplyPingSentEvent is not a route when the routes are listed without it
+func (p *pinger) ApplyPingSentEvent(e *PingSentEvent) {
+	p.sent++
+}
+
+func newPinger(t *testing.T, methods ...string) *pinger {
+	t.Helper()
+	r := NewRegistry()
+	err := RegisterRoutedAggregate(r, "Pinger", func(id string) *pinger {
+		return &pinger{BaseAggregate: NewBaseAggregate("Pinger", id)}
+	}, methods...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := r.CreateAggregate("Pinger", "p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.(*pinger)
+}
+
+func TestRoutes(t *testing.T) {
+	ctx := context.Background()
+	p := newPinger(t)
+	if err := p.HandleCommand(ctx, &PingCmd{Id: "p1"}); err != nil {
+		t.Fatal(err)
+	}
+	if p.sent != 1 || len(p.DomainEvents()) != 1 {
+		t.Errorf("handled PingCmd into %d events, applied %d", len(p.DomainEvents()), p.sent)
+	}
+	if err := p.HandleCommand(ctx, &otherCmd{}); !errors.Is(err, ErrUnhandledCommand) {
+		t.Errorf("handled a command without Handle method: %v", err)
+	}
+
+	listed := newPinger(t, "HandlePingCmd", "ApplyPingedEvent")
+	if err := listed.HandleCommand(ctx, &PingCmd{Id: "p1"}); err != nil {
+		t.Fatal(err)
+	}
+	if listed.sent != 0 {
+		t.Error("routed an event to a method not listed")
+	}
+
+	for _, methods := range [][]string{{"HandlePongCmd"}, {"EntityIdentity"}} {
+		err := RegisterRoutedAggregate(NewRegistry(), "Pinger", func(id string) *pinger { return nil }, methods...)
+		if err == nil {
+			t.Errorf("registered routes to %v", methods)
+		}
+	}
+
+	// an aggregate not created by its registered factory is not routed
+	if err := (&pinger{}).HandleCommand(ctx, &PingCmd{}); err == nil {
+		t.Error("handled a command without routes")
+	}
+}
+
+type otherCmd struct{}
+
+func (c *otherCmd) Name() CommandName                  { return "OtherCmd" }
+func (c *otherCmd) TargetAggregateType() AggregateType { return "Pinger" }
+func (c *otherCmd) TargetIdentity() string             { return "p1" }
+
+func TestRoutedEventDataDecodedWithMapstructure(t *testing.T) {
+	at := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	p := newPinger(t)
+
+	// data unmarshaled from JSON, the keys named by the mapstructure tags as hand written handlers decode them
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(`{"pinged_by": "bob", "at": "2020-01-02T03:04:05.000000006Z"}`), &data); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.HandleSourcingEvent(context.Background(), NewEvent("PingedEvent", data, at)); err != nil {
+		t.Fatal(err)
+	}
+	if p.last == nil || p.last.By != "bob" || !p.last.At.Equal(at) {
+		t.Errorf("applied %+v", p.last)
+	}
+
+	// data of the type of the Apply method is passed as is
+	e := &PingedEvent{By: "alice"}
+	if err := p.HandleSourcingEvent(context.Background(), NewEvent("PingedEvent", e, at)); err != nil {
+		t.Fatal(err)
+	}
+	if p.last != e {
+		t.Errorf("applied %+v, want %+v", p.last, e)
+	}
+
+	if err := p.HandleSourcingEvent(context.Background(), NewEvent("PingedEvent", map[string]interface{}{"at": "yesterday"}, at)); err == nil {
+		t.Error("applied an invalid time")
+	}
+}
@@ -16,8 +16,29 @@ type SagaHandler interface {
 	IsAlive() bool
 }
 
+// SagaRepo stores live sagas, the sagas of each tenant and saga type apart, see TenantID.
+// Load and Delete find the saga type in ctx, set by the saga manager with ContextWithSagaType,
+// so sagas of two types resolving the same identity do not share their state.
 type SagaRepo interface {
-	Load(identity string) SagaHandler
-	Save(handler SagaHandler) error
-	Delete(identity string) error
+	Load(ctx context.Context, identity string) SagaHandler
+	Save(ctx context.Context, handler SagaHandler) error
+	Delete(ctx context.Context, identity string) error
+}
+
+type sagaTypeKey struct{}
+
+// ContextWithSagaType returns a context for the sagas of sagaType.
+func ContextWithSagaType(ctx context.Context, sagaType string) context.Context {
+	return context.WithValue(ctx, sagaTypeKey{}, sagaType)
+}
+
+// SagaTypeFromContext returns the saga type of ctx, empty if none.
+func SagaTypeFromContext(ctx context.Context) string {
+	t, _ := ctx.Value(sagaTypeKey{}).(string)
+	return t
+}
+
+// SagaLister is a SagaRepo able to list the live sagas of the tenant in ctx, used by tooling.
+type SagaLister interface {
+	ListSagas(ctx context.Context) ([]SagaHandler, error)
 }
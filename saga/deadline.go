@@ -0,0 +1,313 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"evol"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the time to the deadlines of a SagaManager, tests replace it with a fake one.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// SystemClock is the Clock of the time package.
+var SystemClock Clock = systemClock{}
+
+// DeadlineHandler is a saga handling the deadlines it scheduled with ScheduleDeadline.
+// The saga ends when it calls EndSaga from HandleDeadline.
+type DeadlineHandler interface {
+	HandleDeadline(ctx context.Context, name string, bus evol.CommandHandler) error
+}
+
+// ErrNoDeadlines is returned by ScheduleDeadline when the context does not come from a SagaManager.
+var ErrNoDeadlines = errors.New("[evol] saga: no deadline scheduler in context")
+
+type deadlinesKey struct{}
+
+// ScheduleDeadline asks the SagaManager handling the current event to call HandleDeadline
+// of the saga with name after d, replacing the deadline of the same name.
+// Sagas embedding BaseSaga keep their deadlines in their state, stored with them by the SagaRepo,
+// the deadlines of other sagas are only kept in memory by the manager. Deadlines are dropped when the saga ends.
+func ScheduleDeadline(ctx context.Context, name string, d time.Duration) error {
+	s, ok := ctx.Value(deadlinesKey{}).(*scheduler)
+	if !ok {
+		return ErrNoDeadlines
+	}
+	at := s.now.Add(d)
+	if k, ok := s.saga.(deadlineKeeper); ok {
+		k.keepDeadline(name, at)
+	}
+	s.changes = append(s.changes, func() { s.deadlines.schedule(s.key, name, at) })
+	return nil
+}
+
+// CancelDeadline cancels a deadline scheduled by the saga handling the current event.
+func CancelDeadline(ctx context.Context, name string) error {
+	s, ok := ctx.Value(deadlinesKey{}).(*scheduler)
+	if !ok {
+		return ErrNoDeadlines
+	}
+	if k, ok := s.saga.(deadlineKeeper); ok {
+		k.dropDeadline(name)
+	}
+	s.changes = append(s.changes, func() { s.deadlines.cancel(s.key, name) })
+	return nil
+}
+
+// scheduler is what ScheduleDeadline finds in the context of a saga
+type scheduler struct {
+	deadlines *deadlines
+	saga      evol.SagaHandler
+	key       sagaKey
+	now       time.Time
+	// changes to the deadlines, made once the saga handled the event without error
+	changes []func()
+}
+
+func (s *scheduler) commit() {
+	for _, change := range s.changes {
+		change()
+	}
+}
+
+// deadlineKeeper is a saga keeping its deadlines in its state, as the sagas embedding BaseSaga do
+type deadlineKeeper interface {
+	pendingDeadlines() map[string]time.Time
+	keepDeadline(name string, at time.Time)
+	dropDeadline(name string)
+}
+
+// AllSagasLister is a SagaRepo listing the live sagas of every tenant, by tenant.
+// SagaManager.Bind restores the deadlines stored with the sagas it lists.
+type AllSagasLister interface {
+	ListAllSagas(ctx context.Context) (map[string][]evol.SagaHandler, error)
+}
+
+// sagaKey identifies a saga, saga identities are unique within a tenant and saga type
+type sagaKey struct {
+	tenant   string
+	sagaType string
+	sagaId   string
+}
+
+// keyOf returns the key of a saga of the tenant and saga type of ctx
+func keyOf(ctx context.Context, sagaId string) sagaKey {
+	return sagaKey{tenant: evol.TenantID(ctx), sagaType: evol.SagaTypeFromContext(ctx), sagaId: sagaId}
+}
+
+type deadline struct {
+	sagaKey
+	name string
+	at   time.Time
+}
+
+// deadlines of the sagas of a manager, by saga then by name
+type deadlines struct {
+	mu sync.Mutex
+	m  map[sagaKey]map[string]time.Time
+}
+
+func (d *deadlines) schedule(key sagaKey, name string, at time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.m == nil {
+		d.m = map[sagaKey]map[string]time.Time{}
+	}
+	if d.m[key] == nil {
+		d.m[key] = map[string]time.Time{}
+	}
+	d.m[key][name] = at
+}
+
+func (d *deadlines) cancel(key sagaKey, name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.m[key], name)
+	if len(d.m[key]) == 0 {
+		delete(d.m, key)
+	}
+}
+
+func (d *deadlines) cancelAll(key sagaKey) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.m, key)
+}
+
+// due removes and returns the deadlines at or before now, earliest first
+func (d *deadlines) due(now time.Time) []deadline {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var res []deadline
+	for key, names := range d.m {
+		for name, at := range names {
+			if at.After(now) {
+				continue
+			}
+			res = append(res, deadline{sagaKey: key, name: name, at: at})
+			delete(names, name)
+		}
+		if len(names) == 0 {
+			delete(d.m, key)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].at.Equal(res[j].at) {
+			return res[i].at.Before(res[j].at)
+		}
+		if res[i].tenant != res[j].tenant {
+			return res[i].tenant < res[j].tenant
+		}
+		if res[i].sagaId != res[j].sagaId {
+			return res[i].sagaId < res[j].sagaId
+		}
+		return res[i].name < res[j].name
+	})
+	return res
+}
+
+// Deadlines returns the pending deadlines of a saga of the tenant in ctx by name.
+func (m *SagaManager) Deadlines(ctx context.Context, sagaId string) map[string]time.Time {
+	m.deadlines.mu.Lock()
+	defer m.deadlines.mu.Unlock()
+
+	key := keyOf(evol.ContextWithSagaType(ctx, m.SagaType), sagaId)
+	res := make(map[string]time.Time, len(m.deadlines.m[key]))
+	for name, at := range m.deadlines.m[key] {
+		res[name] = at
+	}
+	return res
+}
+
+// FireDeadlines hands the deadlines due by the clock to their sagas and returns how many were handled.
+// The first error is returned after all due deadlines were handled.
+func (m *SagaManager) FireDeadlines(ctx context.Context) (int, error) {
+	var firstErr error
+	fired := 0
+	for _, d := range m.deadlines.due(m.clock().Now()) {
+		ctx := evol.ContextWithSagaType(evol.ContextWithTenant(ctx, d.tenant), m.SagaType)
+		ok, err := m.fireDeadline(ctx, d)
+		if ok {
+			fired++
+		}
+		if err != nil {
+			m.log().Error("saga could not handle deadline", "saga_type", m.SagaType, "saga_id", d.sagaId, evol.LogKeyTenant, d.tenant, "deadline", d.name, evol.LogKeyError, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return fired, firstErr
+}
+
+// fireDeadline hands d to its saga, it reports whether the saga handles deadlines
+func (m *SagaManager) fireDeadline(ctx context.Context, d deadline) (bool, error) {
+	unlock := m.locks.lock(d.sagaKey)
+	defer unlock()
+
+	saga := m.SagaRepo.Load(ctx, d.sagaId)
+	if saga == nil || !saga.IsAlive() {
+		return false, nil
+	}
+	handler, ok := saga.(DeadlineHandler)
+	if !ok {
+		return false, nil
+	}
+
+	// the stored saga knows its deadlines best, one cancelled or moved since is not due
+	if k, ok := saga.(deadlineKeeper); ok {
+		at, ok := k.pendingDeadlines()[d.name]
+		if !ok {
+			return false, nil
+		}
+		if at.After(d.at) {
+			m.deadlines.schedule(d.sagaKey, d.name, at)
+			return false, nil
+		}
+		k.dropDeadline(d.name)
+	}
+
+	sctx, s := m.sagaContext(ctx, saga)
+	if err := handler.HandleDeadline(sctx, d.name, m.CmdBus); err != nil {
+		return true, err
+	}
+	s.commit()
+	return true, m.saveOrEnd(ctx, saga)
+}
+
+// RestoreDeadlines schedules the deadlines stored with the sagas of the manager, when its SagaRepo
+// implements AllSagasLister. Bind restores them, a manager bound to a repo filled later restores them again.
+func (m *SagaManager) RestoreDeadlines(ctx context.Context) error {
+	lister, ok := m.SagaRepo.(AllSagasLister)
+	if !ok {
+		return nil
+	}
+	sagas, err := lister.ListAllSagas(ctx)
+	if err != nil {
+		return err
+	}
+
+	for tenant, handlers := range sagas {
+		for _, s := range handlers {
+			if s.SagaType() != m.SagaType {
+				continue
+			}
+			if k, ok := s.(deadlineKeeper); ok {
+				key := sagaKey{tenant: tenant, sagaType: m.SagaType, sagaId: s.SagaIdentity()}
+				for name, at := range k.pendingDeadlines() {
+					m.deadlines.schedule(key, name, at)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// RunDeadlines fires due deadlines every interval until ctx is done.
+func (m *SagaManager) RunDeadlines(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, _ = m.FireDeadlines(ctx)
+		}
+	}
+}
+
+func (m *SagaManager) clock() Clock {
+	if m.Clock != nil {
+		return m.Clock
+	}
+	return SystemClock
+}
+
+// sagaContext lets the saga schedule deadlines while it handles an event or a deadline,
+// they are scheduled when the returned scheduler commits
+func (m *SagaManager) sagaContext(ctx context.Context, saga evol.SagaHandler) (context.Context, *scheduler) {
+	s := &scheduler{
+		deadlines: &m.deadlines,
+		saga:      saga,
+		key:       keyOf(ctx, saga.SagaIdentity()),
+		now:       m.clock().Now(),
+	}
+	return context.WithValue(ctx, deadlinesKey{}, s), s
+}
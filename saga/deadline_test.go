@@ -0,0 +1,239 @@
+package saga_test
+
+import (
+	"context"
+	"evol"
+	"evol/evoltest"
+	"evol/saga"
+	"testing"
+	"time"
+)
+
+type reminderEvent struct {
+	Id string
+}
+
+// reminderSaga sends a reminder an hour after it started, unless it was cancelled
+type reminderSaga struct {
+	*saga.BaseSaga
+}
+
+func (s *reminderSaga) HandleSagaEvent(ctx context.Context, e evol.Event, bus evol.CommandHandler) error {
+	if e.Topic() == "Cancelled" {
+		return saga.CancelDeadline(ctx, "remind")
+	}
+	return saga.ScheduleDeadline(ctx, "remind", time.Hour)
+}
+
+func (s *reminderSaga) HandleDeadline(ctx context.Context, name string, bus evol.CommandHandler) error {
+	s.EndSaga()
+	return bus.HandleCommand(ctx, &remindCmd{Id: s.SagaIdentity()})
+}
+
+type remindCmd struct {
+	Id string
+}
+
+func (c *remindCmd) Name() evol.CommandName                  { return "RemindCmd" }
+func (c *remindCmd) TargetAggregateType() evol.AggregateType { return "Reminder" }
+func (c *remindCmd) TargetIdentity() string                  { return c.Id }
+
+func newReminderManager(clock saga.Clock) *saga.SagaManager {
+	m := saga.NewSagaManager(&saga.SagaManagerOpt{
+		SagaType:    "ReminderSaga",
+		StartEvents: []evol.Topic{"Started"},
+		OnEvents:    []evol.Topic{"Cancelled"},
+		EndEvents:   []evol.Topic{"Done"},
+		Resolver: func(e evol.Event) string {
+			return e.Data().(*reminderEvent).Id
+		},
+		SagaFactory: func(sagaType string, sagaIdentity string) evol.SagaHandler {
+			return &reminderSaga{BaseSaga: saga.NewBaseSaga(sagaIdentity, sagaType)}
+		},
+	})
+	m.Clock = clock
+	m.Logger = evol.NopLogger()
+	return m
+}
+
+func TestDeadlinesStoredWithSaga(t *testing.T) {
+	clock := evoltest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	repo := saga.NewMemorySagaRepo()
+	acme := evol.ContextWithTenant(context.Background(), "acme")
+	// the repo finds the saga type in ctx
+	reminders := evol.ContextWithSagaType(context.Background(), "ReminderSaga")
+	acmeReminders := evol.ContextWithSagaType(acme, "ReminderSaga")
+
+	before := newReminderManager(clock)
+	before.SagaRepo = repo
+	for _, ctx := range []context.Context{context.Background(), acme} {
+		for _, id := range []string{"r1", "r2"} {
+			if err := before.HandleEvent(ctx, evol.NewEvent("Started", &reminderEvent{Id: id}, clock.Now())); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := before.HandleEvent(acme, evol.NewEvent("Cancelled", &reminderEvent{Id: "r2"}, clock.Now())); err != nil {
+		t.Fatal(err)
+	}
+
+	s := repo.Load(acmeReminders, "r1").(*reminderSaga)
+	if at, ok := s.Deadlines["remind"]; !ok || !at.Equal(clock.Now().Add(time.Hour)) {
+		t.Fatalf("stored deadlines %v", s.Deadlines)
+	}
+
+	// a new manager, as after a restart, restores the deadlines of the repo
+	bus := evoltest.NewCommandRecorder()
+	ctx, cancel := context.WithCancel(context.Background())
+	after := newReminderManager(clock)
+	after.Bind(ctx, bus, repo)
+	defer after.Wait()
+	defer cancel()
+
+	clock.Advance(time.Hour)
+	fired, err := after.FireDeadlines(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fired != 3 || len(bus.Commands()) != 3 {
+		t.Fatalf("fired %d deadlines, sent %d commands, want 3", fired, len(bus.Commands()))
+	}
+
+	if repo.Load(acmeReminders, "r1") != nil || repo.Load(reminders, "r2") != nil {
+		t.Error("reminded sagas did not end")
+	}
+	if s := repo.Load(acmeReminders, "r2"); s == nil || len(s.(*reminderSaga).Deadlines) != 0 {
+		t.Errorf("cancelled saga %v", s)
+	}
+}
+
+func TestSagaTypesShareIdentities(t *testing.T) {
+	clock := evoltest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	repo := saga.NewMemorySagaRepo()
+	reminders, followUps := newReminderManager(clock), newReminderManager(clock)
+	followUps.SagaType = "FollowUpSaga"
+	for _, m := range []*saga.SagaManager{reminders, followUps} {
+		m.SagaRepo = repo
+		if err := m.HandleEvent(context.Background(), evol.NewEvent("Started", &reminderEvent{Id: "o1"}, clock.Now())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := followUps.HandleEvent(context.Background(), evol.NewEvent("Cancelled", &reminderEvent{Id: "o1"}, clock.Now())); err != nil {
+		t.Fatal(err)
+	}
+
+	for sagaType, n := range map[string]int{"ReminderSaga": 1, "FollowUpSaga": 0} {
+		s := repo.Load(evol.ContextWithSagaType(context.Background(), sagaType), "o1")
+		if s == nil || s.SagaType() != sagaType || len(s.(*reminderSaga).Deadlines) != n {
+			t.Errorf("%s saga %v", sagaType, s)
+		}
+	}
+	if n := len(reminders.Deadlines(context.Background(), "o1")); n != 1 {
+		t.Errorf("%d reminder deadlines after the follow up was cancelled", n)
+	}
+}
+
+func TestDeadlinesNeedManager(t *testing.T) {
+	if err := saga.ScheduleDeadline(context.Background(), "remind", time.Hour); err != saga.ErrNoDeadlines {
+		t.Errorf("scheduled a deadline without manager: %v", err)
+	}
+	if err := saga.CancelDeadline(context.Background(), "remind"); err != saga.ErrNoDeadlines {
+		t.Errorf("cancelled a deadline without manager: %v", err)
+	}
+}
+
+func TestFireDeadlines(t *testing.T) {
+	clock := evoltest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	bus := evoltest.NewCommandRecorder()
+	m := newReminderManager(clock)
+	m.SagaRepo = saga.NewMemorySagaRepo()
+	m.CmdBus = bus
+	ctx := context.Background()
+	handle := func(topic evol.Topic, id string) {
+		t.Helper()
+		if err := m.HandleEvent(ctx, evol.NewEvent(topic, &reminderEvent{Id: id}, clock.Now())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fire := func(want ...string) {
+		t.Helper()
+		bus.Reset()
+		fired, err := m.FireDeadlines(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, cmd := range bus.Commands() {
+			got = append(got, cmd.TargetIdentity())
+		}
+		if fired != len(want) || !equal(got, want) {
+			t.Errorf("fired %d deadlines reminding %v, want %v", fired, got, want)
+		}
+	}
+
+	handle("Started", "r1")
+	handle("Started", "r2")
+	handle("Started", "r3")
+	clock.Advance(30 * time.Minute)
+	fire()
+
+	// cancelled, and moved by scheduling the same name again
+	handle("Cancelled", "r2")
+	handle("Started", "r3")
+	if at := m.Deadlines(ctx, "r3")["remind"]; !at.Equal(clock.Now().Add(time.Hour)) {
+		t.Errorf("moved deadline at %v", at)
+	}
+
+	clock.Advance(30 * time.Minute)
+	fire("r1")
+	fire()
+	clock.Advance(30 * time.Minute)
+	fire("r3")
+	if len(m.Deadlines(ctx, "r2")) != 0 {
+		t.Error("cancelled deadline still scheduled")
+	}
+}
+
+func TestRunDeadlines(t *testing.T) {
+	clock := evoltest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	bus := evoltest.NewCommandRecorder()
+	m := newReminderManager(clock)
+	m.SagaRepo = saga.NewMemorySagaRepo()
+	m.CmdBus = bus
+	if err := m.HandleEvent(context.Background(), evol.NewEvent("Started", &reminderEvent{Id: "r1"}, clock.Now())); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.RunDeadlines(ctx, time.Millisecond)
+	}()
+	clock.Advance(time.Hour)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(bus.Commands()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("deadline not fired by RunDeadlines")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+	if n := len(bus.Commands()); n != 1 {
+		t.Errorf("%d reminders sent", n)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -1,39 +1,147 @@
 package saga
 
 import (
+	"context"
+	"encoding/json"
 	"evol"
+	"fmt"
+	"io"
+	"sort"
 	"sync"
 )
 
+// memorySagaRepo keeps the sagas of each tenant and saga type apart
 type memorySagaRepo struct {
-	sagas   map[string]evol.SagaHandler
+	sagas   map[sagaKey]evol.SagaHandler
 	sagasMu sync.RWMutex
 }
 
 func NewMemorySagaRepo() *memorySagaRepo {
 	return &memorySagaRepo{
-		sagas: make(map[string]evol.SagaHandler),
+		sagas: make(map[sagaKey]evol.SagaHandler),
 	}
 }
 
-func (r *memorySagaRepo) Load(identity string) evol.SagaHandler {
+func (r *memorySagaRepo) Load(ctx context.Context, identity string) evol.SagaHandler {
 	r.sagasMu.RLock()
 	defer r.sagasMu.RUnlock()
 
-	return r.sagas[identity]
+	return r.sagas[keyOf(ctx, identity)]
 }
 
-func (r *memorySagaRepo) Save(handler evol.SagaHandler) error {
+func (r *memorySagaRepo) Save(ctx context.Context, handler evol.SagaHandler) error {
 	r.sagasMu.Lock()
 	defer r.sagasMu.Unlock()
 
-	r.sagas[handler.SagaIdentity()] = handler
+	key := keyOf(ctx, handler.SagaIdentity())
+	key.sagaType = handler.SagaType()
+	r.sagas[key] = handler
 	return nil
 }
 
-func (r *memorySagaRepo) Delete(identity string) error {
+func (r *memorySagaRepo) Delete(ctx context.Context, identity string) error {
 	r.sagasMu.Lock()
 	defer r.sagasMu.Unlock()
-	delete(r.sagas, identity)
+	delete(r.sagas, keyOf(ctx, identity))
 	return nil
 }
+
+// ListSagas implements evol.SagaLister.
+func (r *memorySagaRepo) ListSagas(ctx context.Context) ([]evol.SagaHandler, error) {
+	tenant := evol.TenantID(ctx)
+
+	var res []evol.SagaHandler
+	for _, s := range r.list() {
+		if s.tenant == tenant {
+			res = append(res, s.SagaHandler)
+		}
+	}
+	return res, nil
+}
+
+// ListAllSagas implements AllSagasLister.
+func (r *memorySagaRepo) ListAllSagas(ctx context.Context) (map[string][]evol.SagaHandler, error) {
+	res := make(map[string][]evol.SagaHandler)
+	for _, s := range r.list() {
+		res[s.tenant] = append(res[s.tenant], s.SagaHandler)
+	}
+	return res, nil
+}
+
+type tenantSaga struct {
+	tenant string
+	evol.SagaHandler
+}
+
+// list returns the sagas of all tenants, sorted
+func (r *memorySagaRepo) list() []tenantSaga {
+	r.sagasMu.RLock()
+	defer r.sagasMu.RUnlock()
+
+	res := make([]tenantSaga, 0, len(r.sagas))
+	for key, s := range r.sagas {
+		res = append(res, tenantSaga{tenant: key.tenant, SagaHandler: s})
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].tenant != res[j].tenant {
+			return res[i].tenant < res[j].tenant
+		}
+		if res[i].SagaType() != res[j].SagaType() {
+			return res[i].SagaType() < res[j].SagaType()
+		}
+		return res[i].SagaIdentity() < res[j].SagaIdentity()
+	})
+	return res
+}
+
+type dumpedSaga struct {
+	Tenant       string          `json:"tenant,omitempty"`
+	SagaType     string          `json:"saga_type"`
+	SagaIdentity string          `json:"saga_id"`
+	State        json.RawMessage `json:"state"`
+}
+
+// Dump writes the sagas of all tenants one per line, with their exported fields as JSON state.
+func (r *memorySagaRepo) Dump(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for _, s := range r.list() {
+		state, err := json.Marshal(s.SagaHandler)
+		if err != nil {
+			return fmt.Errorf("could not marshal saga %s %s: %w", s.SagaType(), s.SagaIdentity(), err)
+		}
+		if err := enc.Encode(dumpedSaga{Tenant: s.tenant, SagaType: s.SagaType(), SagaIdentity: s.SagaIdentity(), State: state}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestoreMemorySagaRepo creates a memory SagaRepo with the sagas of a Dump,
+// made by the SagaFactory of their registered SagaManager.
+func RestoreMemorySagaRepo(rd io.Reader) (*memorySagaRepo, error) {
+	r := NewMemorySagaRepo()
+
+	dec := json.NewDecoder(rd)
+	for {
+		var d dumpedSaga
+		if err := dec.Decode(&d); err == io.EOF {
+			return r, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("could not read saga dump: %w", err)
+		}
+
+		m := Manager(d.SagaType)
+		if m == nil {
+			return nil, fmt.Errorf("saga %s not registered", d.SagaType)
+		}
+		s := m.SagaFactory(d.SagaType, d.SagaIdentity)
+		if err := json.Unmarshal(d.State, s); err != nil {
+			return nil, fmt.Errorf("could not unmarshal saga %s %s: %w", d.SagaType, d.SagaIdentity, err)
+		}
+		// only live sagas are stored
+		s.StartSaga()
+		if err := r.Save(evol.ContextWithTenant(context.Background(), d.Tenant), s); err != nil {
+			return nil, err
+		}
+	}
+}
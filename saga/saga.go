@@ -7,12 +7,16 @@ import (
 	"fmt"
 	"github.com/thoas/go-funk"
 	"sync"
+	"time"
 )
 
 type BaseSaga struct {
 	sagaId   string
 	isAlive  bool
 	sagaType string
+
+	// Deadlines scheduled by the saga by name, stored with it
+	Deadlines map[string]time.Time `json:"deadlines,omitempty"`
 }
 
 func (s *BaseSaga) SagaType() string {
@@ -35,6 +39,24 @@ func (s *BaseSaga) IsAlive() bool {
 	return s.isAlive
 }
 
+func (s *BaseSaga) pendingDeadlines() map[string]time.Time {
+	return s.Deadlines
+}
+
+func (s *BaseSaga) keepDeadline(name string, at time.Time) {
+	if s.Deadlines == nil {
+		s.Deadlines = map[string]time.Time{}
+	}
+	s.Deadlines[name] = at
+}
+
+func (s *BaseSaga) dropDeadline(name string) {
+	delete(s.Deadlines, name)
+	if len(s.Deadlines) == 0 {
+		s.Deadlines = nil
+	}
+}
+
 func NewBaseSaga(id string, sagaType string) *BaseSaga {
 	return &BaseSaga{
 		sagaId:   id,
@@ -44,11 +66,6 @@ func NewBaseSaga(id string, sagaType string) *BaseSaga {
 
 }
 
-// Sagas stores all saga manager, prepare for dependency injection when startup
-// dependency: saga aggregatestore, command CmdBus, codec handler register on codec CmdBus
-var sagaManagers = make(map[string]*SagaManager)
-var sagaMsmu sync.RWMutex
-
 //SagaManager manage a type of saga, means that a single SagaManager can only manage a single SagaType, implement EventHandler
 type SagaManager struct {
 	SagaType    string
@@ -63,6 +80,28 @@ type SagaManager struct {
 	OnEvents    []evol.Topic
 	EndEvents   []evol.Topic
 	CmdBus      evol.CommandHandler
+
+	// Observer is notified when sagas start and end, optional
+	Observer SagaObserver
+
+	// Logger defaults to evol.GetLogger()
+	Logger evol.Logger
+
+	// Clock of the deadlines, defaults to SystemClock
+	Clock Clock
+
+	// each saga handles its events and deadlines one at a time
+	locks     locks
+	deadlines deadlines
+
+	// deadline runners started by Bind
+	wg sync.WaitGroup
+}
+
+// SagaObserver is notified of the lifecycle of the sagas of a SagaManager, ctx carries the tenant of the saga
+type SagaObserver interface {
+	SagaStarted(ctx context.Context, sagaType string, sagaIdentity string)
+	SagaEnded(ctx context.Context, sagaType string, sagaIdentity string)
 }
 
 type SagaManagerOpt struct {
@@ -88,13 +127,22 @@ func NewSagaManager(option *SagaManagerOpt) *SagaManager {
 	return m
 }
 
-// HandleEvent handle saga codec
+// HandleEvent handle saga codec, the saga is saved after each event and deleted when it ends.
+// A saga failing to handle an event is neither saved nor ended, nor are its deadlines scheduled,
+// so a retry of the event starts over from the stored saga. Sagas belong to the tenant of their events.
 func (m *SagaManager) HandleEvent(ctx context.Context, e evol.Event) error {
+	// buses already do, for handlers called directly
+	ctx = evol.ContextWithMetadata(ctx, e.Metadata())
+	ctx = evol.ContextWithSagaType(ctx, m.SagaType)
 	sagaId := m.Resolver(e)
 
-	saga := m.SagaRepo.Load(sagaId)
+	unlock := m.locks.lock(keyOf(ctx, sagaId))
+	defer unlock()
+
+	saga := m.SagaRepo.Load(ctx, sagaId)
 	//creat if not exist, start saga
-	if saga == nil {
+	started := saga == nil
+	if started {
 		saga = m.SagaFactory(m.SagaType, sagaId)
 		saga.StartSaga()
 	}
@@ -102,21 +150,91 @@ func (m *SagaManager) HandleEvent(ctx context.Context, e evol.Event) error {
 	if !saga.IsAlive() {
 		return fmt.Errorf("saga: %v not alive", saga)
 	}
-	err := saga.HandleSagaEvent(ctx, e, m.CmdBus)
+	sctx, s := m.sagaContext(ctx, saga)
+	if err := saga.HandleSagaEvent(sctx, e, m.CmdBus); err != nil {
+		return err
+	}
+	s.commit()
+	if started {
+		m.log().Debug("saga started", m.fields(ctx, sagaId, e)...)
+		if m.Observer != nil {
+			m.Observer.SagaStarted(ctx, m.SagaType, sagaId)
+		}
+	}
 
-	//end saga for some specific events
+	//end saga for some specific events, or when the saga ended itself
 	if funk.Contains(m.EndEvents, e.Topic()) {
-		m.endSaga(saga)
+		saga.EndSaga()
 	}
+	if !saga.IsAlive() {
+		m.log().Debug("saga ended", m.fields(ctx, sagaId, e)...)
+	}
+	return m.saveOrEnd(ctx, saga)
+}
 
-	if err != nil {
-		return err
+func (m *SagaManager) log() evol.Logger {
+	return evol.LoggerOr(m.Logger)
+}
+
+func (m *SagaManager) fields(ctx context.Context, sagaId string, e evol.Event) []interface{} {
+	kv := []interface{}{"saga_type", m.SagaType, "saga_id", sagaId, evol.LogKeyTopic, e.Topic()}
+	if id := evol.CorrelationID(ctx); id != "" {
+		kv = append(kv, evol.LogKeyCorrelationID, id)
 	}
-	return nil
+	if tenant := evol.TenantID(ctx); tenant != "" {
+		kv = append(kv, evol.LogKeyTenant, tenant)
+	}
+	return kv
 }
 
-func (m *SagaManager) endSaga(saga evol.SagaHandler) {
-	saga.EndSaga()
+// saveOrEnd saves a live saga, an ended saga is deleted with its deadlines
+func (m *SagaManager) saveOrEnd(ctx context.Context, saga evol.SagaHandler) error {
+	if saga.IsAlive() {
+		return m.SagaRepo.Save(ctx, saga)
+	}
+
+	m.deadlines.cancelAll(keyOf(ctx, saga.SagaIdentity()))
+	if m.Observer != nil {
+		m.Observer.SagaEnded(ctx, m.SagaType, saga.SagaIdentity())
+	}
+	return m.SagaRepo.Delete(ctx, saga.SagaIdentity())
+}
+
+// locks of the sagas handling an event or a deadline, so a saga is loaded and saved by one of them at a time
+type locks struct {
+	mu sync.Mutex
+	m  map[sagaKey]*sagaLock
+}
+
+type sagaLock struct {
+	sync.Mutex
+	waiters int
+}
+
+// lock locks the saga of key and returns its unlock
+func (l *locks) lock(key sagaKey) func() {
+	l.mu.Lock()
+	if l.m == nil {
+		l.m = map[sagaKey]*sagaLock{}
+	}
+	sl, ok := l.m[key]
+	if !ok {
+		sl = &sagaLock{}
+		l.m[key] = sl
+	}
+	sl.waiters++
+	l.mu.Unlock()
+
+	sl.Lock()
+	return func() {
+		sl.Unlock()
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if sl.waiters--; sl.waiters == 0 {
+			delete(l.m, key)
+		}
+	}
 }
 
 func checkParam(m *SagaManager) error {
@@ -143,33 +261,72 @@ func checkParam(m *SagaManager) error {
 	return nil
 }
 
+// RegisterSaga registers m in evol.DefaultRegistry under its SagaType.
 func RegisterSaga(m *SagaManager) error {
+	return RegisterSagaIn(evol.DefaultRegistry, m)
+}
+
+// RegisterSagaIn registers m in r under its SagaType.
+func RegisterSagaIn(r *evol.Registry, m *SagaManager) error {
 	if err := checkParam(m); err != nil {
 		return err
 	}
 
-	sagaMsmu.Lock()
-	defer sagaMsmu.Unlock()
-	sagaType := m.SagaType
-	if _, ok := sagaManagers[sagaType]; ok {
-		return fmt.Errorf("saga %s already register", sagaType)
+	return r.RegisterSaga(m.SagaType, m)
+}
+
+// Manager returns the SagaManager registered for sagaType in evol.DefaultRegistry, nil if there is none.
+func Manager(sagaType string) *SagaManager {
+	m, _ := evol.DefaultRegistry.Saga(sagaType).(*SagaManager)
+	return m
+}
+
+// Topics implements evol.Saga, the start, on and end events.
+func (m *SagaManager) Topics() []evol.Topic {
+	topics := make([]evol.Topic, 0, len(m.StartEvents)+len(m.OnEvents)+len(m.EndEvents))
+	topics = append(topics, m.StartEvents...)
+	topics = append(topics, m.OnEvents...)
+	return append(topics, m.EndEvents...)
+}
+
+// Bind implements evol.Saga, deadlines are checked every DeadlineInterval until ctx is done.
+// The deadlines stored with the sagas of repo are restored when it implements AllSagasLister.
+func (m *SagaManager) Bind(ctx context.Context, cmdBus evol.CommandHandler, repo evol.SagaRepo) {
+	m.CmdBus = cmdBus
+	m.SagaRepo = repo
+	if err := m.RestoreDeadlines(ctx); err != nil {
+		m.log().Error("saga deadlines could not be restored", "saga_type", m.SagaType, evol.LogKeyError, err)
 	}
-	sagaManagers[sagaType] = m
-	return nil
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		m.RunDeadlines(ctx, DeadlineInterval)
+	}()
+}
+
+// Wait implements evol.Saga, it returns once the deadline runners started by Bind are stopped.
+func (m *SagaManager) Wait() {
+	m.wg.Wait()
 }
 
+// DeadlineInterval is how often bound sagas check their deadlines.
+var DeadlineInterval = time.Second
+
+// PrepareSagas binds the sagas of evol.DefaultRegistry and registers them on evtBus.
 func PrepareSagas(ctx context.Context, evtBus evol.EventBus, cmdBus evol.CommandHandler, repo evol.SagaRepo) error {
+	return Prepare(ctx, evol.DefaultRegistry, evtBus, cmdBus, repo)
+}
+
+// Prepare binds the sagas of r and registers them on evtBus.
+func Prepare(ctx context.Context, r *evol.Registry, evtBus evol.EventBus, cmdBus evol.CommandHandler, repo evol.SagaRepo) error {
 	if repo == nil {
 		return errors.New("missing saga aggregatestore")
 	}
-	sagaMsmu.RLock()
-	defer sagaMsmu.RUnlock()
-	for _, saga := range sagaManagers {
-		saga.CmdBus = cmdBus
-		saga.SagaRepo = repo
-		events := append(append(saga.StartEvents, saga.OnEvents...), saga.EndEvents...)
-		for _, topic := range events {
-			err := evtBus.RegisterHandler(ctx, topic, saga)
+	for _, name := range r.SagaNames() {
+		saga := r.Saga(name)
+		saga.Bind(ctx, cmdBus, repo)
+		for _, topic := range saga.Topics() {
+			err := evtBus.RegisterHandler(ctx, topic, saga, evol.WithHandlerName(name))
 			if err != nil {
 				return err
 			}
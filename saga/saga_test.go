@@ -0,0 +1,72 @@
+package saga_test
+
+import (
+	"context"
+	"errors"
+	"evol"
+	"evol/evoltest"
+	"evol/saga"
+	"testing"
+	"time"
+)
+
+// flakySaga schedules a reminder, then fails to handle the events of fail
+type flakySaga struct {
+	*saga.BaseSaga
+	Handled int
+	fail    *bool
+}
+
+func (s *flakySaga) HandleSagaEvent(ctx context.Context, e evol.Event, bus evol.CommandHandler) error {
+	s.Handled++
+	if err := saga.ScheduleDeadline(ctx, "remind", time.Hour); err != nil {
+		return err
+	}
+	if *s.fail {
+		return errors.New("boom")
+	}
+	return nil
+}
+
+func TestFailedSagaNotSaved(t *testing.T) {
+	clock := evoltest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	repo := saga.NewMemorySagaRepo()
+	fail := true
+	m := saga.NewSagaManager(&saga.SagaManagerOpt{
+		SagaType:    "FlakySaga",
+		StartEvents: []evol.Topic{"Started"},
+		Resolver: func(e evol.Event) string {
+			return e.Data().(*reminderEvent).Id
+		},
+		SagaFactory: func(sagaType string, sagaIdentity string) evol.SagaHandler {
+			return &flakySaga{BaseSaga: saga.NewBaseSaga(sagaIdentity, sagaType), fail: &fail}
+		},
+	})
+	m.Clock = clock
+	m.Logger = evol.NopLogger()
+	m.SagaRepo = repo
+
+	ctx := evol.ContextWithSagaType(context.Background(), "FlakySaga")
+	started := evol.NewEvent("Started", &reminderEvent{Id: "f1"}, clock.Now())
+	if err := m.HandleEvent(context.Background(), started); err == nil {
+		t.Fatal("the saga did not fail")
+	}
+	if s := repo.Load(ctx, "f1"); s != nil {
+		t.Errorf("saved the failed saga %v", s)
+	}
+	if d := m.Deadlines(ctx, "f1"); len(d) != 0 {
+		t.Errorf("scheduled the deadlines of the failed saga %v", d)
+	}
+
+	// the retry starts over
+	fail = false
+	if err := m.HandleEvent(context.Background(), started); err != nil {
+		t.Fatal(err)
+	}
+	if s := repo.Load(ctx, "f1"); s == nil || s.(*flakySaga).Handled != 1 {
+		t.Errorf("saga after the retry %v", s)
+	}
+	if d := m.Deadlines(ctx, "f1"); len(d) != 1 {
+		t.Errorf("deadlines after the retry %v", d)
+	}
+}
@@ -0,0 +1,48 @@
+package evol
+
+import (
+	"context"
+	"errors"
+)
+
+// TenantIDKey is the metadata key of the tenant a command, an event or a saga belongs to.
+// Command handlers copy it into the events, buses into the context of handlers,
+// so everything caused by a command stays with its tenant.
+const TenantIDKey = "evol-tenant-id"
+
+// ErrTenantMismatch is returned when a store is asked for data of another tenant than the one in context.
+var ErrTenantMismatch = errors.New("[evol] tenant mismatch")
+
+// ContextWithTenant returns a context for the tenant, the empty tenant being the default one
+// of applications without tenants.
+func ContextWithTenant(ctx context.Context, tenant string) context.Context {
+	return ContextWithMetadata(ctx, Metadata{TenantIDKey: tenant})
+}
+
+// TenantID returns the tenant carried by the metadata of ctx, empty for the default tenant.
+func TenantID(ctx context.Context) string {
+	return MetadataFromContext(ctx)[TenantIDKey]
+}
+
+// TenantEntity is an entity knowing the tenant it belongs to, BaseAggregate implements it.
+// AggregateModelStore sets it on the models it saves and checks it on the models it loads.
+type TenantEntity interface {
+	EntityTenantID() string
+	SetEntityTenantID(tenant string)
+}
+
+// EventTenantID returns the tenant of an event, empty for the default tenant.
+func EventTenantID(e Event) string {
+	return e.Metadata()[TenantIDKey]
+}
+
+// StoreTenantID returns the tenant events are stored for, the tenant of the first event,
+// or the tenant of ctx for events without one. Repositories partition streams with it.
+func StoreTenantID(ctx context.Context, events []Event) string {
+	if len(events) > 0 {
+		if tenant := EventTenantID(events[0]); tenant != "" {
+			return tenant
+		}
+	}
+	return TenantID(ctx)
+}
@@ -0,0 +1,69 @@
+package evol
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TombstoneTopic is the topic of the event ending the stream of a deleted aggregate.
+// It is published like any other event, so projections and sagas can forget the aggregate.
+const TombstoneTopic Topic = "evol.tombstone"
+
+// ErrAggregateDeleted is matched by the AggregateDeletedError of an aggregate whose stream ends with a tombstone.
+var ErrAggregateDeleted = errors.New("[evol] aggregate deleted")
+
+// AggregateDeletedError is returned when loading a deleted aggregate, errors.Is matches it with ErrAggregateDeleted.
+type AggregateDeletedError struct {
+	AggregateType     AggregateType
+	AggregateIdentity string
+	// Version of the tombstone
+	Version   int
+	DeletedAt time.Time
+}
+
+func (e *AggregateDeletedError) Error() string {
+	return fmt.Sprintf("[evol] aggregate %s %s deleted at version %d", e.AggregateType, e.AggregateIdentity, e.Version)
+}
+
+func (e *AggregateDeletedError) Is(target error) bool {
+	return target == ErrAggregateDeleted
+}
+
+// NewTombstone creates the tombstone of an aggregate stream, version being the position it is appended at.
+func NewTombstone(aggregateType AggregateType, identity string, version int, timestamp time.Time, options ...EventOption) Event {
+	options = append(options, ForAggregate(aggregateType, identity), WithVersion(version))
+	return NewEvent(TombstoneTopic, nil, timestamp, options...)
+}
+
+// IsTombstone reports whether e is the tombstone of a deleted aggregate.
+func IsTombstone(e Event) bool {
+	return e != nil && e.Topic() == TombstoneTopic
+}
+
+// DeletedError returns the AggregateDeletedError of a stream ending with a tombstone, nil otherwise.
+func DeletedError(events []Event) error {
+	if len(events) == 0 || !IsTombstone(events[len(events)-1]) {
+		return nil
+	}
+
+	e := events[len(events)-1]
+	version := e.Version()
+	if version == 0 {
+		version = len(events)
+	}
+	return &AggregateDeletedError{
+		AggregateType:     e.AggregateType(),
+		AggregateIdentity: e.AggregateIdentity(),
+		Version:           version,
+		DeletedAt:         e.Timestamp(),
+	}
+}
+
+// StreamDeleter is an EventRepo able to erase streams, the hard delete of an aggregate.
+type StreamDeleter interface {
+	// DeleteStream erases all events of the aggregate id of the tenant in ctx,
+	// deleting an unknown stream is not an error
+	DeleteStream(ctx context.Context, id string) error
+}
@@ -0,0 +1,71 @@
+package tracing
+
+import (
+	"context"
+	"evol"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AggregateStore is an evol.AggregateStore tracing loads and saves.
+type AggregateStore struct {
+	store evol.AggregateStore
+}
+
+func NewAggregateStore(store evol.AggregateStore) *AggregateStore {
+	return &AggregateStore{store: store}
+}
+
+// Unwrap implements evol.Wrapper.
+func (s *AggregateStore) Unwrap() interface{} {
+	return s.store
+}
+
+func (s *AggregateStore) Load(ctx context.Context, aggregateType evol.AggregateType, aggregateIdentity string) (evol.Aggregate, error) {
+	ctx, span := tracer().Start(ctx, "load "+aggregateType.String(),
+		trace.WithAttributes(
+			aggregateTypeKey.String(aggregateType.String()),
+			aggregateIdKey.String(aggregateIdentity),
+		),
+	)
+
+	agg, err := s.store.Load(ctx, aggregateType, aggregateIdentity)
+	if v, ok := agg.(evol.VersionedAggregate); ok && err == nil {
+		span.SetAttributes(versionKey.Int(v.AggregateVersion()))
+	}
+	end(span, err)
+
+	return agg, err
+}
+
+// LoadOrCreate implements evol.CreatingAggregateStore, traced like Load.
+func (s *AggregateStore) LoadOrCreate(ctx context.Context, aggregateType evol.AggregateType, aggregateIdentity string) (evol.Aggregate, bool, error) {
+	ctx, span := tracer().Start(ctx, "load "+aggregateType.String(),
+		trace.WithAttributes(
+			aggregateTypeKey.String(aggregateType.String()),
+			aggregateIdKey.String(aggregateIdentity),
+		),
+	)
+
+	agg, created, err := evol.LoadOrCreate(ctx, s.store, aggregateType, aggregateIdentity)
+	if v, ok := agg.(evol.VersionedAggregate); ok && err == nil {
+		span.SetAttributes(versionKey.Int(v.AggregateVersion()))
+	}
+	end(span, err)
+
+	return agg, created, err
+}
+
+func (s *AggregateStore) Save(ctx context.Context, aggregate evol.Aggregate) error {
+	ctx, span := tracer().Start(ctx, "save "+aggregate.AggregateType().String(),
+		trace.WithAttributes(
+			aggregateTypeKey.String(aggregate.AggregateType().String()),
+			aggregateIdKey.String(aggregate.EntityIdentity()),
+			eventsKey.Int(len(aggregate.DomainEvents())),
+		),
+	)
+
+	err := s.store.Save(ctx, aggregate)
+	end(span, err)
+
+	return err
+}
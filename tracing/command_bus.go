@@ -0,0 +1,62 @@
+package tracing
+
+import (
+	"context"
+	"evol"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CommandBus is an evol.CommandBus tracing the dispatch and the handling of commands.
+type CommandBus struct {
+	bus evol.CommandBus
+}
+
+func NewCommandBus(bus evol.CommandBus) *CommandBus {
+	return &CommandBus{bus: bus}
+}
+
+// Unwrap implements evol.Wrapper.
+func (b *CommandBus) Unwrap() interface{} {
+	return b.bus
+}
+
+func (b *CommandBus) HandleCommand(ctx context.Context, cmd evol.Command) error {
+	ctx, span := tracer().Start(ctx, "dispatch "+string(cmd.Name()),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			commandKey.String(string(cmd.Name())),
+			aggregateTypeKey.String(cmd.TargetAggregateType().String()),
+			aggregateIdKey.String(cmd.TargetIdentity()),
+		),
+	)
+
+	err := b.bus.HandleCommand(Inject(ctx), cmd)
+	end(span, err)
+
+	return err
+}
+
+func (b *CommandBus) RegisterCmdHandler(name evol.CommandName, handler evol.CommandHandler) error {
+	return b.bus.RegisterCmdHandler(name, &commandHandler{handler: handler})
+}
+
+// commandHandler traces the handling of a command, events created by it carry the span context.
+type commandHandler struct {
+	handler evol.CommandHandler
+}
+
+func (h *commandHandler) HandleCommand(ctx context.Context, cmd evol.Command) error {
+	ctx, span := tracer().Start(ctx, "handle "+string(cmd.Name()),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			commandKey.String(string(cmd.Name())),
+			aggregateTypeKey.String(cmd.TargetAggregateType().String()),
+			aggregateIdKey.String(cmd.TargetIdentity()),
+		),
+	)
+
+	err := h.handler.HandleCommand(Inject(ctx), cmd)
+	end(span, err)
+
+	return err
+}
@@ -0,0 +1,67 @@
+package tracing
+
+import (
+	"context"
+	"evol"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// EventBus is an evol.EventBus tracing the publishing of events and each handler invocation.
+type EventBus struct {
+	bus evol.EventBus
+}
+
+func NewEventBus(bus evol.EventBus) *EventBus {
+	return &EventBus{bus: bus}
+}
+
+// Unwrap implements evol.Wrapper.
+func (b *EventBus) Unwrap() interface{} {
+	return b.bus
+}
+
+// HandleEvent publishes the event with the publish span context set in its metadata.
+// Without a span in ctx, as in an outbox relay, the span continues the trace stored in the event.
+func (b *EventBus) HandleEvent(ctx context.Context, e evol.Event) error {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		ctx = Extract(ctx, e.Metadata())
+	}
+
+	ctx, span := tracer().Start(ctx, "publish "+string(e.Topic()),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(eventAttributes(e)...),
+	)
+
+	ctx = Inject(ctx)
+	evol.WithMetadata(evol.MetadataFromContext(ctx))(e)
+	err := b.bus.HandleEvent(ctx, e)
+	end(span, err)
+
+	return err
+}
+
+func (b *EventBus) RegisterHandler(ctx context.Context, topic evol.Topic, h evol.EventHandler, options ...evol.HandlerOption) error {
+	// keep the name of the wrapped handler for dead letters
+	name := evol.NewHandlerConfig(options...).HandlerName(h)
+	options = append(options, evol.WithHandlerName(name))
+
+	return b.bus.RegisterHandler(ctx, topic, &eventHandler{name: name, handler: h}, options...)
+}
+
+// eventHandler traces a handler invocation as a child of the publish span.
+type eventHandler struct {
+	name    string
+	handler evol.EventHandler
+}
+
+func (h *eventHandler) HandleEvent(ctx context.Context, e evol.Event) error {
+	ctx, span := tracer().Start(Extract(ctx, e.Metadata()), "handle "+string(e.Topic()),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(append(eventAttributes(e), handlerKey.String(h.name))...),
+	)
+
+	err := h.handler.HandleEvent(Inject(ctx), e)
+	end(span, err)
+
+	return err
+}
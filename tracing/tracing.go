@@ -0,0 +1,61 @@
+// Package tracing creates OpenTelemetry spans around command dispatch, aggregate
+// load and save, event publishing and event handling. Trace context travels in
+// evol.Metadata, so it crosses buses, codecs and services with the events and commands.
+package tracing
+
+import (
+	"context"
+	"evol"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "evol"
+
+var (
+	commandKey       = attribute.Key("evol.command")
+	aggregateTypeKey = attribute.Key("evol.aggregate_type")
+	aggregateIdKey   = attribute.Key("evol.aggregate_id")
+	topicKey         = attribute.Key("evol.topic")
+	handlerKey       = attribute.Key("evol.handler")
+	versionKey       = attribute.Key("evol.version")
+	eventsKey        = attribute.Key("evol.events")
+)
+
+func tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Inject adds the trace context of ctx to its evol.Metadata, using the global propagator.
+func Inject(ctx context.Context) context.Context {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	return evol.ContextWithMetadata(ctx, evol.Metadata(carrier))
+}
+
+// Extract returns ctx with the remote trace context found in md, using the global propagator.
+func Extract(ctx context.Context, md evol.Metadata) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(md))
+}
+
+// end records err on the span and ends it.
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func eventAttributes(e evol.Event) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		topicKey.String(string(e.Topic())),
+		aggregateTypeKey.String(e.AggregateType().String()),
+		aggregateIdKey.String(e.AggregateIdentity()),
+		versionKey.Int(e.Version()),
+	}
+}
@@ -0,0 +1,78 @@
+package typed
+
+import (
+	"context"
+	"evol"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Aggregate is an evol.BaseAggregate dispatching commands and events to typed handlers, registered by
+// the factory of the aggregate embedding it:
+//
+//	evol.RegisterAggregate(OrderAggregateType, func(id string) evol.Aggregate {
+//		o := &OrderAggregate{Aggregate: typed.NewAggregate(OrderAggregateType, id)}
+//		typed.Handle(o.Aggregate, o.create)
+//		typed.Apply(o.Aggregate, o.created)
+//		return o
+//	})
+//
+// Commands without a handler fail with evol.ErrUnhandledCommand, events without one are ignored.
+type Aggregate struct {
+	*evol.BaseAggregate
+
+	commands map[reflect.Type]evol.CommandHandler
+	events   map[evol.Topic]evol.EventHandler
+}
+
+// NewAggregate creates an Aggregate without handlers.
+func NewAggregate(aggregateType evol.AggregateType, identity string) *Aggregate {
+	return &Aggregate{
+		BaseAggregate: evol.NewBaseAggregate(aggregateType, identity),
+		commands:      make(map[reflect.Type]evol.CommandHandler),
+		events:        make(map[evol.Topic]evol.EventHandler),
+	}
+}
+
+// Handle handles the commands of type C sent to a with h, it panics when C already has a handler.
+func Handle[C evol.Command](a *Aggregate, h func(context.Context, C) error) {
+	t := reflect.TypeOf((*C)(nil)).Elem()
+	if _, ok := a.commands[t]; ok {
+		panic(fmt.Sprintf("[evol] %s already handles %s", a.AggregateType(), t))
+	}
+	a.commands[t] = CommandHandler[C](h)
+}
+
+// Apply applies the events of data T to a with h, it panics when their topic already has a handler.
+func Apply[T any](a *Aggregate, h func(context.Context, Event[T]) error) {
+	topic := TopicOf[T]()
+	if _, ok := a.events[topic]; ok {
+		panic(fmt.Sprintf("[evol] %s already applies %s", a.AggregateType(), topic))
+	}
+	a.events[topic] = EventHandler[T](h)
+}
+
+// Publish publishes a domain event of the topic of T, applied to a immediately like evol.BaseAggregate.PublishEvent.
+func Publish[T any](a *Aggregate, data T, timestamp time.Time, options ...evol.EventOption) Event[T] {
+	e := a.PublishEvent(TopicOf[T](), data, timestamp, a, options...)
+	return Event[T]{Event: e, payload: data}
+}
+
+// HandleCommand calls the handler of the type of cmd.
+func (a *Aggregate) HandleCommand(ctx context.Context, cmd evol.Command) error {
+	h, ok := a.commands[reflect.TypeOf(cmd)]
+	if !ok {
+		return fmt.Errorf("[evol] %s %s: %w", a.AggregateType(), cmd.Name(), evol.ErrUnhandledCommand)
+	}
+	return h.HandleCommand(ctx, cmd)
+}
+
+// HandleSourcingEvent calls the handler of the topic of e.
+func (a *Aggregate) HandleSourcingEvent(ctx context.Context, e evol.Event) error {
+	h, ok := a.events[e.Topic()]
+	if !ok {
+		return nil
+	}
+	return h.HandleEvent(ctx, e)
+}
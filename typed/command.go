@@ -0,0 +1,39 @@
+package typed
+
+import (
+	"context"
+	"evol"
+	"fmt"
+	"reflect"
+)
+
+// CommandHandler handles the commands of type C, it is an evol.CommandHandler asserting their type.
+type CommandHandler[C evol.Command] func(context.Context, C) error
+
+// HandleCommand implements evol.CommandHandler.
+func (h CommandHandler[C]) HandleCommand(ctx context.Context, cmd evol.Command) error {
+	c, ok := cmd.(C)
+	if !ok {
+		return fmt.Errorf("[evol] handler of %T got a %T command", c, cmd)
+	}
+	return h(ctx, c)
+}
+
+// RegisterCommand registers the command type C in r.
+func RegisterCommand[C evol.Command](r *evol.Registry) error {
+	return r.RegisterCommand(newCommand[C]())
+}
+
+// RegisterCommandHandler registers h on bus for the name of the commands of type C.
+func RegisterCommandHandler[C evol.Command](bus evol.CommandBus, h func(context.Context, C) error) error {
+	return bus.RegisterCmdHandler(newCommand[C]().Name(), CommandHandler[C](h))
+}
+
+// newCommand returns a zero C, pointing to a new value when C is a pointer type
+func newCommand[C evol.Command]() C {
+	var c C
+	if t := reflect.TypeOf(&c).Elem(); t.Kind() == reflect.Ptr {
+		c = reflect.New(t.Elem()).Interface().(C)
+	}
+	return c
+}
@@ -0,0 +1,96 @@
+// Package typed is a generic API over the evol interfaces, with event data, commands and query results
+// of static types instead of interface{} and type assertions:
+//
+//	typed.RegisterEventHandler(evol.DefaultRegistry, func(ctx context.Context, e typed.Event[OrderCreatedEvent]) error {
+//		return project(e.Payload())
+//	})
+//
+// Typed events, handlers and aggregates implement evol.Event, evol.EventHandler, evol.CommandHandler
+// and evol.Aggregate, they mix with untyped ones on the same buses and stores.
+// The topic of the events of data T is the one of the Topic method of T, or the type name of T.
+package typed
+
+import (
+	"context"
+	"evol"
+	"evol/codec"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Event is an evol.Event with its data decoded into a T.
+type Event[T any] struct {
+	evol.Event
+	payload T
+}
+
+// Payload returns the data of the event.
+func (e Event[T]) Payload() T {
+	return e.payload
+}
+
+// CopyEvent implements evol.EventCopier, the copy is an Event[T] too.
+func (e Event[T]) CopyEvent(options ...evol.EventOption) evol.Event {
+	return Event[T]{Event: evol.CopyEvent(e.Event, options...), payload: e.payload}
+}
+
+// NewEvent creates an event of the topic of T.
+func NewEvent[T any](data T, timestamp time.Time, options ...evol.EventOption) Event[T] {
+	return Event[T]{Event: evol.NewEvent(TopicOf[T](), data, timestamp, options...), payload: data}
+}
+
+// EventFrom decodes the data of e into a T, e being of any topic.
+func EventFrom[T any](e evol.Event) (Event[T], error) {
+	if te, ok := e.(Event[T]); ok {
+		return te, nil
+	}
+	if data, ok := e.Data().(T); ok {
+		return Event[T]{Event: e, payload: data}, nil
+	}
+
+	var data T
+	if err := codec.DecodeData(e, &data); err != nil {
+		return Event[T]{}, err
+	}
+	return Event[T]{Event: e, payload: data}, nil
+}
+
+// TopicOf returns the topic of the events of data T, the one of its Topic method, or its type name.
+func TopicOf[T any]() evol.Topic {
+	var data T
+	if t, ok := interface{}(&data).(interface{ Topic() evol.Topic }); ok {
+		return t.Topic()
+	}
+	if t, ok := interface{}(data).(interface{ Topic() evol.Topic }); ok {
+		return t.Topic()
+	}
+
+	t := reflect.TypeOf(&data).Elem()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return evol.Topic(t.Name())
+}
+
+// EventHandler handles the events of data T, it is an evol.EventHandler decoding their data.
+type EventHandler[T any] func(context.Context, Event[T]) error
+
+// HandleEvent implements evol.EventHandler.
+func (h EventHandler[T]) HandleEvent(ctx context.Context, e evol.Event) error {
+	te, err := EventFrom[T](e)
+	if err != nil {
+		return fmt.Errorf("[evol] could not decode %s: %w", e.Topic(), err)
+	}
+	return h(ctx, te)
+}
+
+// RegisterEventHandler registers h in r for the topic of T, the application subscribes it when it runs.
+func RegisterEventHandler[T any](r *evol.Registry, h func(context.Context, Event[T]) error) {
+	r.RegisterEventHandlers(EventHandler[T](h), TopicOf[T]())
+}
+
+// Subscribe registers h on bus for the topic of T.
+func Subscribe[T any](ctx context.Context, bus evol.EventBus, h func(context.Context, Event[T]) error, options ...evol.HandlerOption) error {
+	return bus.RegisterHandler(ctx, TopicOf[T](), EventHandler[T](h), options...)
+}
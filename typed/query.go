@@ -0,0 +1,80 @@
+package typed
+
+import (
+	"context"
+	"evol"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// QueryHandler answers the queries of type Q with an R, it is an evol.QueryHandler asserting their type.
+type QueryHandler[Q evol.Query, R any] func(context.Context, Q) (R, error)
+
+// HandleQuery implements evol.QueryHandler.
+func (h QueryHandler[Q, R]) HandleQuery(ctx context.Context, q evol.Query) (interface{}, error) {
+	tq, ok := q.(Q)
+	if !ok {
+		return nil, fmt.Errorf("[evol] handler of %T got a %T query", tq, q)
+	}
+	return h(ctx, tq)
+}
+
+// QueryBus is an evol.QueryHandler dispatching queries to the handler of their type.
+type QueryBus struct {
+	handlers map[reflect.Type]evol.QueryHandler
+	mu       sync.RWMutex
+}
+
+// NewQueryBus creates a QueryBus without handlers.
+func NewQueryBus() *QueryBus {
+	return &QueryBus{handlers: make(map[reflect.Type]evol.QueryHandler)}
+}
+
+// RegisterQueryHandler registers h for the queries of the type of q.
+func (b *QueryBus) RegisterQueryHandler(q evol.Query, h evol.QueryHandler) error {
+	return b.register(reflect.TypeOf(q), h)
+}
+
+func (b *QueryBus) register(t reflect.Type, h evol.QueryHandler) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.handlers[t]; ok {
+		return fmt.Errorf("[evol] query %s already has a handler", t)
+	}
+	b.handlers[t] = h
+	return nil
+}
+
+// HandleQuery answers q with the handler of its type, or fails with evol.ErrUnhandledQuery.
+func (b *QueryBus) HandleQuery(ctx context.Context, q evol.Query) (interface{}, error) {
+	b.mu.RLock()
+	h, ok := b.handlers[reflect.TypeOf(q)]
+	b.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("[evol] %T: %w", q, evol.ErrUnhandledQuery)
+	}
+	return h.HandleQuery(ctx, q)
+}
+
+// RegisterQueryHandler registers h on bus for the queries of type Q.
+func RegisterQueryHandler[Q evol.Query, R any](bus *QueryBus, h func(context.Context, Q) (R, error)) error {
+	return bus.register(reflect.TypeOf((*Q)(nil)).Elem(), QueryHandler[Q, R](h))
+}
+
+// Ask answers q with h, its result asserted to an R.
+func Ask[R any](ctx context.Context, h evol.QueryHandler, q evol.Query) (R, error) {
+	var r R
+	res, err := h.HandleQuery(ctx, q)
+	if err != nil || res == nil {
+		return r, err
+	}
+
+	r, ok := res.(R)
+	if !ok {
+		return r, fmt.Errorf("[evol] %T answered a %T, not a %T", q, res, r)
+	}
+	return r, nil
+}
@@ -0,0 +1,183 @@
+package typed
+
+import (
+	"context"
+	"errors"
+	"evol"
+	"strings"
+	"testing"
+	"time"
+)
+
+type OpenAccountCmd struct {
+	Id string
+}
+
+func (c *OpenAccountCmd) Name() evol.CommandName                  { return "OpenAccountCmd" }
+func (c *OpenAccountCmd) TargetAggregateType() evol.AggregateType { return "Account" }
+func (c *OpenAccountCmd) TargetIdentity() string                  { return c.Id }
+
+type CloseAccountCmd struct {
+	Id string
+}
+
+func (c *CloseAccountCmd) Name() evol.CommandName                  { return "CloseAccountCmd" }
+func (c *CloseAccountCmd) TargetAggregateType() evol.AggregateType { return "Account" }
+func (c *CloseAccountCmd) TargetIdentity() string                  { return c.Id }
+
+type AccountOpened struct {
+	Owner   string
+	Balance float64
+}
+
+type accountClosed struct{}
+
+func (accountClosed) Topic() evol.Topic { return "AccountClosed" }
+
+// account is opened by OpenAccountCmd, it does not handle CloseAccountCmd
+type account struct {
+	*Aggregate
+	owner   string
+	balance float64
+}
+
+func newAccount(id string) *account {
+	a := &account{Aggregate: NewAggregate("Account", id)}
+	Handle(a.Aggregate, a.open)
+	Apply(a.Aggregate, a.opened)
+	return a
+}
+
+func (a *account) open(ctx context.Context, cmd *OpenAccountCmd) error {
+	Publish(a.Aggregate, AccountOpened{Owner: "bob", Balance: 10}, time.Now())
+	return nil
+}
+
+func (a *account) opened(ctx context.Context, e Event[AccountOpened]) error {
+	a.owner, a.balance = e.Payload().Owner, e.Payload().Balance
+	return nil
+}
+
+func TestAggregateDispatchesByType(t *testing.T) {
+	ctx := context.Background()
+	a := newAccount("a1")
+
+	if err := a.HandleCommand(ctx, &OpenAccountCmd{Id: "a1"}); err != nil {
+		t.Fatal(err)
+	}
+	if a.owner != "bob" || len(a.DomainEvents()) != 1 || a.DomainEvents()[0].Topic() != "AccountOpened" {
+		t.Errorf("opened account %+v with events %v", a, a.DomainEvents())
+	}
+	if err := a.HandleCommand(ctx, &CloseAccountCmd{Id: "a1"}); !errors.Is(err, evol.ErrUnhandledCommand) {
+		t.Errorf("handled a command without handler: %v", err)
+	}
+
+	// events unmarshaled from a store carry their data as a map
+	b := newAccount("a1")
+	data := map[string]interface{}{"Owner": "alice", "Balance": 5.5}
+	if err := b.HandleSourcingEvent(ctx, evol.NewEvent("AccountOpened", data, time.Now())); err != nil {
+		t.Fatal(err)
+	}
+	if b.owner != "alice" || b.balance != 5.5 {
+		t.Errorf("applied %+v", b)
+	}
+	if err := b.HandleSourcingEvent(ctx, evol.NewEvent("AccountOpened", map[string]interface{}{"Balance": "ten"}, time.Now())); err == nil {
+		t.Error("applied data of another type")
+	}
+	if err := b.HandleSourcingEvent(ctx, evol.NewEvent("AccountClosed", nil, time.Now())); err != nil {
+		t.Errorf("event without handler: %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registered two handlers of OpenAccountCmd")
+		}
+	}()
+	Handle(a.Aggregate, a.open)
+}
+
+func TestCommandHandlerTypeMismatch(t *testing.T) {
+	var got *OpenAccountCmd
+	h := CommandHandler[*OpenAccountCmd](func(ctx context.Context, cmd *OpenAccountCmd) error {
+		got = cmd
+		return nil
+	})
+	if err := h.HandleCommand(context.Background(), &OpenAccountCmd{Id: "a1"}); err != nil || got.Id != "a1" {
+		t.Fatalf("handled %v: %v", got, err)
+	}
+	if err := h.HandleCommand(context.Background(), &CloseAccountCmd{Id: "a1"}); err == nil || !strings.Contains(err.Error(), "CloseAccountCmd") {
+		t.Errorf("handled a command of another type: %v", err)
+	}
+
+	r := evol.NewRegistry()
+	if err := RegisterCommand[*OpenAccountCmd](r); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.NewCommand("OpenAccountCmd").(*OpenAccountCmd); !ok {
+		t.Error("registered command of another type")
+	}
+}
+
+func TestEventHandler(t *testing.T) {
+	if topic := TopicOf[AccountOpened](); topic != "AccountOpened" {
+		t.Errorf("topic %s", topic)
+	}
+	if topic := TopicOf[accountClosed](); topic != "AccountClosed" {
+		t.Errorf("topic of a Topic method %s", topic)
+	}
+
+	var got AccountOpened
+	h := EventHandler[AccountOpened](func(ctx context.Context, e Event[AccountOpened]) error {
+		got = e.Payload()
+		return nil
+	})
+	for _, data := range []interface{}{AccountOpened{Owner: "bob"}, &AccountOpened{Owner: "bob"}, map[string]interface{}{"Owner": "bob"}} {
+		got = AccountOpened{}
+		if err := h.HandleEvent(context.Background(), evol.NewEvent("AccountOpened", data, time.Now())); err != nil || got.Owner != "bob" {
+			t.Errorf("handled %T into %+v: %v", data, got, err)
+		}
+	}
+	if err := h.HandleEvent(context.Background(), evol.NewEvent("AccountOpened", "bob", time.Now())); err == nil {
+		t.Error("handled data of another type")
+	}
+
+	e := NewEvent(AccountOpened{Owner: "bob"}, time.Now())
+	if copied, ok := e.CopyEvent().(Event[AccountOpened]); !ok || copied.Payload().Owner != "bob" {
+		t.Errorf("copy %#v", e.CopyEvent())
+	}
+}
+
+type balanceQuery struct {
+	Id string
+}
+
+type ownerQuery struct{}
+
+func TestQueryBus(t *testing.T) {
+	ctx := context.Background()
+	bus := NewQueryBus()
+	err := RegisterQueryHandler(bus, func(ctx context.Context, q balanceQuery) (float64, error) {
+		return 10, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.RegisterQueryHandler(balanceQuery{}, evol.QueryHandlerFunc(nil)); err == nil {
+		t.Error("registered two handlers of balanceQuery")
+	}
+
+	if balance, err := Ask[float64](ctx, bus, balanceQuery{Id: "a1"}); err != nil || balance != 10 {
+		t.Errorf("balance %v: %v", balance, err)
+	}
+	if _, err := Ask[string](ctx, bus, balanceQuery{Id: "a1"}); err == nil {
+		t.Error("asked for a result of another type")
+	}
+	if _, err := Ask[string](ctx, bus, ownerQuery{}); !errors.Is(err, evol.ErrUnhandledQuery) {
+		t.Errorf("asked a query without handler: %v", err)
+	}
+
+	h := QueryHandler[balanceQuery, float64](func(ctx context.Context, q balanceQuery) (float64, error) { return 0, nil })
+	if _, err := h.HandleQuery(ctx, ownerQuery{}); err == nil {
+		t.Error("handled a query of another type")
+	}
+}
@@ -0,0 +1,28 @@
+package evol
+
+// Wrapper is implemented by the decorators of buses, repos and stores, such as the ones of the metrics and
+// tracing packages, to reach the optional interfaces of what they decorate with As.
+type Wrapper interface {
+	// Unwrap returns the decorated bus, repo or store
+	Unwrap() interface{}
+}
+
+// As returns v as a T, or else the first value v decorates that is a T, following Unwrap.
+// Buses, repos and stores are checked for optional interfaces, like StreamDeleter or Pending, with it:
+//
+//	deleter, ok := evol.As[evol.StreamDeleter](repo)
+func As[T any](v interface{}) (T, bool) {
+	for v != nil {
+		if t, ok := v.(T); ok {
+			return t, true
+		}
+		w, ok := v.(Wrapper)
+		if !ok {
+			break
+		}
+		v = w.Unwrap()
+	}
+
+	var zero T
+	return zero, false
+}